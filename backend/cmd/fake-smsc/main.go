@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mpolobe/africa-railways/backend/sms"
+)
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func list(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func main() {
+	delay, err := strconv.Atoi(getenv("FAKE_SMSC_REPORT_DELAY_MS", "2000"))
+	if err != nil {
+		log.Fatalf("❌ FAKE_SMSC_REPORT_DELAY_MS: %v", err)
+	}
+	smsc := sms.NewFakeSMSC(sms.FakeSMSCConfig{
+		Reject:        list("FAKE_SMSC_REJECT"),
+		Undeliverable: list("FAKE_SMSC_UNDELIVERABLE"),
+		ReportDelayMS: delay,
+		ATCallbackURL: os.Getenv("FAKE_SMSC_AT_CALLBACK_URL"),
+	})
+
+	addr := ":" + getenv("FAKE_SMSC_PORT", "8089")
+	log.Printf("📨 Fake SMSC listening on %s, inbox at http://localhost%s/inbox", addr, addr)
+	log.Printf("   Point providers at it with AT_BASE_URL=http://localhost%s and TWILIO_BASE_URL=http://localhost%s", addr, addr)
+	log.Fatal(http.ListenAndServe(addr, smsc))
+}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"time"
+
+	ticketmeta "github.com/mpolobe/africa-railways/backend/pkg/metadata"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
 )
 
 // Config represents the application configuration
@@ -33,22 +39,6 @@ type Config struct {
 	} `json:"api"`
 }
 
-// TicketMetadata represents the NFT metadata
-type TicketMetadata struct {
-	Name        string                   `json:"name"`
-	Description string                   `json:"description"`
-	Image       string                   `json:"image"`
-	ExternalURL string                   `json:"external_url"`
-	Attributes  []map[string]interface{} `json:"attributes"`
-}
-
-// PinataResponse from IPFS upload
-type PinataResponse struct {
-	IpfsHash  string    `json:"IpfsHash"`
-	PinSize   int       `json:"PinSize"`
-	Timestamp time.Time `json:"Timestamp"`
-}
-
 // UserOperation for gasless minting
 type UserOperation struct {
 	Sender               string `json:"sender"`
@@ -105,15 +95,15 @@ func main() {
 	fmt.Println("----------------------------------")
 
 	ticketID := fmt.Sprintf("TKT%d", time.Now().Unix())
-	metadata := generateTicketJSON(ticketID, config.API.BaseURL)
+	ticket := generateTicket(ticketID)
 
-	_, _ = json.MarshalIndent(metadata, "", "  ")
 	fmt.Printf("✅ Created Ticket #%s with attributes:\n", ticketID)
 	fmt.Println("   • Route: JHB-CPT")
 	fmt.Println("   • Class: Standard")
 	fmt.Println("   • Seat: 14A")
 	fmt.Println("   • Departure: Tomorrow 10:00 AM")
 	fmt.Println("   • Price: R450.00 ZAR")
+	fmt.Println("   • Passenger: sealed off-chain, only a commitment is published")
 
 	// STEP 2: Upload to IPFS
 	fmt.Println("\n" + string(make([]byte, 70)))
@@ -121,22 +111,57 @@ func main() {
 	fmt.Println("-------------------------")
 	fmt.Printf("Using API Key: %s...\n", config.Storage.IPFSAPIKey[:10])
 
-	cid, pinSize, err := uploadToIPFS(config.Storage.IPFSAPIKey, metadata)
+	pinner, err := storage.NewPinner(config.Storage.Provider, config.Storage.IPFSAPIKey)
 	if err != nil {
-		log.Printf("⚠️  IPFS upload simulation: %v", err)
-		// Use mock CID for demonstration
-		cid = fmt.Sprintf("QmXyZ%d", time.Now().Unix())
-		pinSize = 1024
-		fmt.Printf("✅ Mock CID generated: %s\n", cid)
-	} else {
-		fmt.Printf("✅ Uploaded to IPFS successfully!\n")
-		fmt.Printf("   CID: %s\n", cid)
-		fmt.Printf("   Size: %d bytes\n", pinSize)
+		log.Fatalf("❌ %v", err)
+	}
+	key, vault, err := demoKeys()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	// The upload is queued durably and retried until the artwork and then
+	// the metadata are pinned at their expected CIDs; the ticket is minted
+	// only once they are
+	queue := storage.NewUploadQueue(getenv("UPLOAD_QUEUE_PATH", "ipfs-uploads.json"), pinner)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	prepared, job, err := ticketmeta.QueueTicket(queue, vault, ticket, key)
+	if err != nil {
+		log.Fatalf("❌ Failed to queue ticket upload: %v", err)
+	}
+	fmt.Printf("📥 Upload %s queued: image %s, metadata %s\n", job.ID, prepared.Image.CID, prepared.MetadataFile.CID)
+
+	timeout, err := time.ParseDuration(getenv("UPLOAD_WAIT", "2m"))
+	if err != nil {
+		log.Fatalf("❌ Invalid UPLOAD_WAIT %q", os.Getenv("UPLOAD_WAIT"))
 	}
+	waitCtx, cancelWait := context.WithTimeout(ctx, timeout)
+	job, err = queue.Wait(waitCtx, job.ID)
+	cancelWait()
+	ipfsURI, uriErr := prepared.TokenURI(job)
+	if err != nil || uriErr != nil {
+		if errors.Is(err, storage.ErrUploadDead) {
+			fmt.Printf("❌ Upload %s is in the dead-letter queue: %s\n", job.ID, job.LastError)
+			fmt.Println("   Replay it from the pin manager's /uploads/replay once IPFS is reachable")
+		} else {
+			fmt.Printf("⏳ Upload %s is still queued after %s (attempt %d): %s\n", job.ID, timeout, job.Attempts, job.LastError)
+		}
+		fmt.Println("   Not minting: the ticket would point at content that is not on IPFS")
+		return
+	}
+
+	pin := prepared.MetadataFile
+	fmt.Printf("✅ Ticket image pinned: %s\n", prepared.Metadata.Image)
+	fmt.Printf("✅ Uploaded to %s successfully!\n", pinner.Name())
+	fmt.Printf("   CID: %s\n", pin.CID)
+	fmt.Printf("   Size: %d bytes\n", len(pin.Data))
+	cid, pinSize := pin.CID.String(), len(pin.Data)
 
-	ipfsURI := fmt.Sprintf("ipfs://%s", cid)
 	fmt.Printf("   IPFS URI: %s\n", ipfsURI)
-	fmt.Printf("   Gateway: %s%s\n", config.Storage.IPFSGateway, cid)
+	fmt.Printf("   Gateway: %s\n", pin.CID.URL(config.Storage.IPFSGateway))
 
 	// STEP 3: Mint on Polygon (Gasless)
 	fmt.Println("\n" + string(make([]byte, 70)))
@@ -193,6 +218,13 @@ func main() {
 	fmt.Println("🚀 This is the INVISIBLE ticketing experience!")
 }
 
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 // loadConfig loads configuration from config.json
 func loadConfig() (*Config, error) {
 	configPaths := []string{
@@ -223,62 +255,48 @@ func loadConfig() (*Config, error) {
 	return &config, nil
 }
 
-// generateTicketJSON creates ticket metadata
-func generateTicketJSON(ticketID, baseURL string) TicketMetadata {
-	departureTime := time.Now().Add(24 * time.Hour)
-
-	return TicketMetadata{
-		Name:        fmt.Sprintf("Africa Railways: Ticket #%s", ticketID),
-		Description: "Standard Class Ticket - Johannesburg to Cape Town",
-		Image:       "ipfs://QmYourTicketDesignCID",
-		ExternalURL: fmt.Sprintf("%s/verify/%s", baseURL, ticketID),
-		Attributes: []map[string]interface{}{
-			{"trait_type": "Route", "value": "JHB-CPT"},
-			{"trait_type": "Class", "value": "Standard"},
-			{"trait_type": "Seat", "value": "14A"},
-			{"trait_type": "Departure", "value": departureTime.Unix(), "display_type": "date"},
-			{"trait_type": "Passenger", "value": "John Doe"},
-			{"trait_type": "Phone", "value": "+27123456789"},
-			{"trait_type": "Price", "value": 450.00, "display_type": "number"},
-			{"trait_type": "Currency", "value": "ZAR"},
-		},
-	}
-}
-
-// uploadToIPFS uploads metadata to IPFS
-func uploadToIPFS(apiKey string, metadata TicketMetadata) (string, int, error) {
-	url := "https://api.pinata.cloud/pinning/pinJSONToIPFS"
-
-	requestBody := map[string]interface{}{
-		"pinataContent": metadata,
-		"pinataMetadata": map[string]string{
-			"name": metadata.Name,
-		},
+// demoKeys loads TICKET_SIGNING_KEY and the TICKET_PII_KEY vault, or uses
+// throwaway ones for the demonstration
+func demoKeys() (ed25519.PrivateKey, ticketmeta.PIIVault, error) {
+	key, err := ticketmeta.LoadSigningKey()
+	if err != nil {
+		log.Printf("⚠️  %v; signing with a temporary key", err)
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			return nil, nil, err
+		}
 	}
-
-	jsonData, _ := json.Marshal(requestBody)
-
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	vault, err := ticketmeta.NewFileVaultFromEnv()
 	if err != nil {
-		return "", 0, err
+		log.Printf("⚠️  %v; keeping passenger data in memory", err)
+		vaultKey := make([]byte, 32)
+		if _, err := rand.Read(vaultKey); err != nil {
+			return nil, nil, err
+		}
+		vault, err = ticketmeta.NewFileVault("", vaultKey)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
+	return key, vault, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", 0, fmt.Errorf("API error: %s", string(body))
+// generateTicket creates the ticket a USSD purchase would
+func generateTicket(ticketID string) ticketmeta.TicketDetails {
+	departureTime := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+
+	return ticketmeta.TicketDetails{
+		TicketID:       ticketID,
+		PassengerName:  "John Doe",
+		PassengerPhone: "+27123456789",
+		RouteFrom:      "Johannesburg",
+		RouteTo:        "Cape Town",
+		DepartureTime:  departureTime,
+		ArrivalTime:    departureTime.Add(26 * time.Hour),
+		SeatNumber:     "14A",
+		Class:          "Standard",
+		Price:          450.00,
+		Currency:       "ZAR",
 	}
-
-	var result PinataResponse
-	json.Unmarshal(body, &result)
-
-	return result.IpfsHash, result.PinSize, nil
 }
 
 // mintGaslessTicket mints NFT with gas sponsorship
@@ -14,6 +14,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
 )
 
 // Simplified metadata and IPFS structures for this example
@@ -52,7 +53,7 @@ func main() {
 	fmt.Println("\n📋 Step 1: Creating Ticket Metadata...")
 	
 	ticketID := fmt.Sprintf("TKT%d", time.Now().Unix())
-	_ = TicketMetadata{
+	metadata := TicketMetadata{
 		Name:        fmt.Sprintf("Africa Railways: Ticket #%s", ticketID),
 		Description: "Standard Class Ticket - Johannesburg to Cape Town",
 		Image:       "ipfs://QmYourTicketDesignCID", // Replace with actual QR code image
@@ -81,15 +82,16 @@ func main() {
 	fmt.Printf("   ✅ Route: JHB → CPT\n")
 	fmt.Printf("   ✅ Passenger: John Doe\n")
 
-	// Step 2: Upload metadata to IPFS (mocked for now)
+	// Step 2: Upload metadata to IPFS (in memory for now)
 	fmt.Println("\n📤 Step 2: Uploading Metadata to IPFS...")
 	
-	// In production, use actual IPFS upload:
-	// uploader := ipfs.NewUploader("pinata")
-	// metadataURI, err := uploader.UploadJSON(metadata)
-	
-	// For now, use mock URI
-	metadataURI := fmt.Sprintf("ipfs://QmMockMetadata%d", time.Now().Unix())
+	// In production, pin with storage.NewPinnerFromEnv(). The memory pinner
+	// gives the same real CID the metadata will have once pinned.
+	pin, err := storage.NewMemoryPinner().PinJSON(context.Background(), "ticket-"+ticketID, metadata)
+	if err != nil {
+		log.Fatalf("Failed to pin metadata: %v", err)
+	}
+	metadataURI := pin.CID.URI()
 	fmt.Printf("   ✅ Metadata URI: %s\n", metadataURI)
 
 	// Step 3: Connect to Polygon
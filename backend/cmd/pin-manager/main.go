@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
+)
+
+const defaultSweepInterval = time.Hour
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found, using system environment variables")
+	}
+
+	manager, err := storage.NewPinManagerFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	interval, err := time.ParseDuration(getenv("PIN_SWEEP_INTERVAL", defaultSweepInterval.String()))
+	if err != nil || interval <= 0 {
+		log.Fatalf("❌ Invalid PIN_SWEEP_INTERVAL %q", os.Getenv("PIN_SWEEP_INTERVAL"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Pins made before the registry existed are adopted, so they show in
+	// the accounting; they expire only once a journey is tracked for them
+	if _, ok := manager.Pinner.(storage.PinLister); ok {
+		if added, err := manager.Reconcile(ctx); err != nil {
+			log.Printf("⚠️  Failed to reconcile pins with %s: %v", manager.Name(), err)
+		} else if added > 0 {
+			log.Printf("📋 Recorded %d pins found at %s", added, manager.Name())
+		}
+	}
+
+	// Uploads queued by ticket sales are retried here, through the manager
+	// so they are recorded and expire with their journeys
+	var queue *storage.UploadQueue
+	if path := os.Getenv("UPLOAD_QUEUE_PATH"); path != "" {
+		queue = storage.NewUploadQueue(path, manager)
+		go queue.Run(ctx)
+		log.Printf("📥 Retrying queued uploads from %s", path)
+	}
+
+	go func() {
+		addr := ":" + getenv("PIN_MANAGER_PORT", "8095")
+		log.Printf("📡 Pin manager listening on %s", addr)
+		log.Fatal(http.ListenAndServe(addr, handler(manager, queue, os.Getenv("PIN_MANAGER_TOKEN"))))
+	}()
+
+	log.Printf("📌 Pin manager running: %s, retention %s, sweeping every %s",
+		manager.Name(), manager.Retention, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sweep(ctx, manager)
+		select {
+		case <-ctx.Done():
+			log.Println("👋 Pin manager stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sweep(ctx context.Context, manager *storage.PinManager) storage.SweepResult {
+	result, err := manager.Sweep(ctx)
+	if err != nil {
+		log.Printf("❌ Pin sweep failed: %v", err)
+		return result
+	}
+	for _, err := range result.Errors {
+		log.Printf("⚠️  %v", err)
+	}
+	if result.Unpinned > 0 {
+		log.Printf("🧹 Released %d expired pins (%d archived to cold storage)", result.Unpinned, result.Archived)
+	}
+	return result
+}
+
+// handler serves GET /stats for the dashboard and POST /sweep to release
+// expired pins now. With a token set both need it as a Bearer token;
+// without one /stats is open and /sweep is disabled. With a queue it also
+// serves GET /uploads?status=dead to list the dead-letter queue and POST
+// /uploads/replay {"id": ...} to retry a job from it, both of which always
+// need the token.
+func handler(manager *storage.PinManager, queue *storage.UploadQueue, token string) http.Handler {
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	admin := func(w http.ResponseWriter, r *http.Request, method string) bool {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return false
+		}
+		if token == "" {
+			http.Error(w, "set PIN_MANAGER_TOKEN to use "+r.URL.Path, http.StatusForbidden)
+			return false
+		}
+		return authorized(w, r)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		stats, err := manager.Stats(r.Context())
+		if err != nil {
+			log.Printf("❌ Failed to read pin registry: %v", err)
+			http.Error(w, "failed to read pin registry", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, stats)
+	})
+	mux.HandleFunc("/sweep", func(w http.ResponseWriter, r *http.Request) {
+		if !admin(w, r, http.MethodPost) {
+			return
+		}
+		writeJSON(w, sweep(r.Context(), manager))
+	})
+	if queue != nil {
+		mux.HandleFunc("/uploads", func(w http.ResponseWriter, r *http.Request) {
+			if !admin(w, r, http.MethodGet) {
+				return
+			}
+			jobs, err := queue.Jobs(storage.UploadStatus(r.URL.Query().Get("status")))
+			if err != nil {
+				log.Printf("❌ Failed to read upload queue: %v", err)
+				http.Error(w, "failed to read upload queue", http.StatusInternalServerError)
+				return
+			}
+			// The files can be large and may hold passenger details
+			for i := range jobs {
+				files := make([]storage.UploadFile, len(jobs[i].Files))
+				for j, f := range jobs[i].Files {
+					f.Data = nil
+					files[j] = f
+				}
+				jobs[i].Files = files
+			}
+			writeJSON(w, jobs)
+		})
+		mux.HandleFunc("/uploads/replay", func(w http.ResponseWriter, r *http.Request) {
+			if !admin(w, r, http.MethodPost) {
+				return
+			}
+			var req struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+				http.Error(w, `expected {"id": "<upload id>"}`, http.StatusBadRequest)
+				return
+			}
+			job, err := queue.Replay(req.ID)
+			if errors.Is(err, storage.ErrUnknownUpload) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			job.Files = nil
+			writeJSON(w, job)
+		})
+	}
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/mpolobe/africa-railways/backend/pkg/gas"
+	"github.com/mpolobe/africa-railways/pkg/price"
 )
 
 var (
@@ -20,6 +27,9 @@ var (
 	relayerAddress common.Address
 	rpcURL         string
 	usingValidator bool
+	polPrice       price.Oracle
+	policy         *gas.PolicyManager
+	apiToken       string // RELAYER_API_TOKEN, needed for /sponsor and /policy
 )
 
 func main() {
@@ -96,6 +106,27 @@ func initialize() error {
 	relayerAddress = common.HexToAddress(addressStr)
 	log.Printf("📍 Relayer Address: %s", relayerAddress.Hex())
 
+	// POL/USD price for balance reports
+	polPrice, err = price.NewOracleFromEnv(rpcURL)
+	if errors.Is(err, price.ErrNotConfigured) {
+		log.Printf("⚠️  %v, USD values are unavailable", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to configure POL price: %w", err)
+	}
+
+	// Local sponsorship rules, checked before Alchemy's gas policy
+	policy = gas.NewPolicyManager(client)
+	if policy.Rules, err = gas.NewRuleEngineFromEnv(polPrice); err != nil {
+		return fmt.Errorf("failed to load gas rules: %w", err)
+	}
+	if policy.Rules != nil {
+		usage := policy.Rules.Usage()
+		log.Printf("🛡️  Gas rules loaded from %s: $%.2f of $%.2f spent today",
+			os.Getenv("GAS_RULES_PATH"), usage.SpentUSD, usage.DailyBudgetUSD)
+	} else {
+		log.Println("⚠️  GAS_RULES_PATH not set; sponsorship is left to Alchemy's policy alone")
+	}
+
 	// Check balance
 	balance, err := client.BalanceAt(context.Background(), relayerAddress, nil)
 	if err != nil {
@@ -138,6 +169,14 @@ func startHTTPServer() {
 	http.HandleFunc("/mint", handleMint)
 	http.HandleFunc("/balance", handleBalance)
 	http.HandleFunc("/status", handleStatus)
+	http.HandleFunc("/sponsor", handleSponsor)
+	http.HandleFunc("/sponsor/commit", handleCommit)
+	http.HandleFunc("/sponsor/release", handleRelease)
+	http.HandleFunc("/policy", handlePolicy)
+	apiToken = os.Getenv("RELAYER_API_TOKEN")
+	if apiToken == "" {
+		log.Println("⚠️  RELAYER_API_TOKEN not set; /sponsor and /policy are disabled")
+	}
 
 	port := os.Getenv("RELAYER_PORT")
 	if port == "" {
@@ -148,6 +187,7 @@ func startHTTPServer() {
 	log.Printf("   Health: http://localhost:%s/health", port)
 	log.Printf("   Balance: http://localhost:%s/balance", port)
 	log.Printf("   Status: http://localhost:%s/status", port)
+	log.Printf("   Policy: http://localhost:%s/policy", port)
 	
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatalf("❌ HTTP server failed: %v", err)
@@ -209,6 +249,154 @@ func handleMint(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, `{"status":"success","message":"Minting endpoint ready (implementation pending)"}`)
 }
 
+// authorized checks the request's Bearer token against RELAYER_API_TOKEN;
+// without one the endpoint is disabled
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if apiToken == "" {
+		http.Error(w, "set RELAYER_API_TOKEN to use "+r.URL.Path, http.StatusForbidden)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(apiToken)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleSponsor decides whether to sponsor a transaction, by the local gas
+// rules and then Alchemy's policy. A sponsored decision carries a
+// reservation held against today's caps: once the transaction is mined,
+// POST it to /sponsor/commit, or to /sponsor/release if it is not sent.
+func handleSponsor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	var body struct {
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Data      string `json:"data"`
+		Passenger string `json:"passenger,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !common.IsHexAddress(body.To) {
+		http.Error(w, "expected JSON with from, to and data", http.StatusBadRequest)
+		return
+	}
+	req := gas.SponsorshipRequest{
+		From: common.HexToAddress(body.From),
+		To:   common.HexToAddress(body.To),
+		Data: common.FromHex(body.Data),
+	}
+	if req.From == (common.Address{}) {
+		req.From = relayerAddress
+	}
+	if common.IsHexAddress(body.Passenger) {
+		req.Passenger = common.HexToAddress(body.Passenger)
+	}
+
+	var err error
+	if req.Gas, err = client.EstimateGas(r.Context(), ethereum.CallMsg{From: req.From, To: &req.To, Data: req.Data}); err != nil {
+		http.Error(w, "failed to estimate gas: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if req.GasPrice, err = client.SuggestGasPrice(r.Context()); err != nil {
+		http.Error(w, "failed to get gas price: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	decision, err := policy.Check(r.Context(), req)
+	if err != nil && !errors.Is(err, gas.ErrPolicyNotConfigured) {
+		http.Error(w, "sponsorship check failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// handleCommit charges a mined, sponsored transaction to today's caps and
+// budget at the gas it used: {"tx_hash": "0x...", "reservation": "...",
+// "passenger": "0x..."}, where reservation is from /sponsor and passenger
+// is optional as for /sponsor
+func handleCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	var body struct {
+		TxHash      string `json:"tx_hash"`
+		Reservation string `json:"reservation,omitempty"`
+		Passenger   string `json:"passenger,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(common.FromHex(body.TxHash)) != common.HashLength {
+		http.Error(w, "expected JSON with tx_hash", http.StatusBadRequest)
+		return
+	}
+	var passenger common.Address
+	if common.IsHexAddress(body.Passenger) {
+		passenger = common.HexToAddress(body.Passenger)
+	}
+
+	decision, err := policy.Commit(r.Context(), common.HexToHash(body.TxHash), body.Reservation, passenger)
+	switch {
+	case errors.Is(err, gas.ErrNotMined), errors.Is(err, gas.ErrCommitted):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil && decision.TxHash == "":
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	case err != nil && !decision.Sponsored:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		// Counted, but the gas could not be valued for the budget; the rule
+		// engine has logged it
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// handleRelease frees the reservation /sponsor made for a transaction that
+// will not be sent: {"reservation": "..."}
+func handleRelease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	var body struct {
+		Reservation string `json:"reservation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Reservation == "" {
+		http.Error(w, "expected JSON with reservation", http.StatusBadRequest)
+		return
+	}
+	policy.Release(gas.Decision{Reservation: body.Reservation})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePolicy reports today's sponsorship against the local gas rules
+func handlePolicy(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if policy.Rules == nil {
+		fmt.Fprint(w, `{"rules":false}`)
+		return
+	}
+	json.NewEncoder(w).Encode(policy.Rules.Usage())
+}
+
 func handleBalance(w http.ResponseWriter, r *http.Request) {
 	balance, err := client.BalanceAt(context.Background(), relayerAddress, nil)
 	if err != nil {
@@ -234,9 +422,21 @@ func handleBalance(w http.ResponseWriter, r *http.Request) {
 		estimatedTx = int(balancePOL / 0.0002)
 	}
 
+	// Value the balance at the oracle price; without one the USD figure is null
+	balanceUSD, polUSD, priceSource := "null", "null", `""`
+	if polPrice != nil {
+		if quote, err := polPrice.Price(r.Context()); err == nil {
+			balanceUSD = fmt.Sprintf("%.2f", quote.Value(balancePOL))
+			polUSD = fmt.Sprintf("%.4f", quote.USD)
+			priceSource = fmt.Sprintf("%q", quote.Source)
+		} else {
+			log.Printf("⚠️  No POL price: %v", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"balance_pol":%.4f,"balance_usd":%.2f,"address":"%s","gas_price_gwei":%.2f,"estimated_tx":%d}`, 
-		balancePOL, balancePOL*0.50, relayerAddress.Hex(), gasPriceVal, estimatedTx)
+	fmt.Fprintf(w, `{"balance_pol":%.4f,"balance_usd":%s,"pol_usd":%s,"price_source":%s,"address":"%s","gas_price_gwei":%.2f,"estimated_tx":%d}`, 
+		balancePOL, balanceUSD, polUSD, priceSource, relayerAddress.Hex(), gasPriceVal, estimatedTx)
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/backend/sms"
+	"github.com/redis/go-redis/v9"
+)
+
+// Default schedules, overridable with SMS_*_SCHEDULE
+const (
+	defaultReminderSchedule   = "*/5 * * * *"
+	defaultDigestSchedule     = "0 19 * * *"
+	defaultLowBalanceSchedule = "0 9,15 * * *"
+	defaultLowBalance         = 100
+)
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found, using system environment variables")
+	}
+
+	loc, err := time.LoadLocation(getenv("SMS_TIMEZONE", "Africa/Johannesburg"))
+	if err != nil {
+		log.Fatalf("❌ SMS_TIMEZONE: %v", err)
+	}
+	lowBalance, err := strconv.Atoi(getenv("SMS_LOW_BALANCE_AFRC", strconv.Itoa(defaultLowBalance)))
+	if err != nil {
+		log.Fatalf("❌ SMS_LOW_BALANCE_AFRC: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	notifier := sms.NewNotificationService(getenv("SMS_PROVIDER", sms.ProviderFailover))
+	// Passengers pick their language over USSD; the gateway keeps it in Redis
+	if redisURL := os.Getenv("USSD_REDIS_URL"); redisURL != "" {
+		opts, err := redis.ParseURL(redisURL)
+		if err != nil {
+			log.Fatalf("❌ USSD_REDIS_URL: %v", err)
+		}
+		notifier.SetLocaleResolver(sms.NewRedisLocales(redis.NewClient(opts)))
+	} else {
+		log.Println("⚠️  USSD_REDIS_URL not set, SMS use each country's default language")
+	}
+	outbox, err := sms.NewOutbox(os.Getenv("SMS_OUTBOX_PATH"), notifier.Provider())
+	if err != nil {
+		log.Fatalf("❌ SMS outbox: %v", err)
+	}
+	defer outbox.Close()
+	notifier.SetOutbox(outbox)
+	go outbox.Run(ctx)
+
+	sent, err := sms.NewFileSentLog(getenv("SMS_SENT_LOG", "sms-sent.jsonl"))
+	if err != nil {
+		log.Fatalf("❌ SMS sent log: %v", err)
+	}
+	defer sent.Close()
+	optOuts, err := sms.NewFileOptOuts(getenv("SMS_OPT_OUT_PATH", "sms-opt-outs.jsonl"))
+	if err != nil {
+		log.Fatalf("❌ SMS opt-out list: %v", err)
+	}
+	defer optOuts.Close()
+	notifier.SetOptOuts(optOuts)
+	jobs := &sms.NotificationJobs{Notifier: notifier, Sent: sent, LowBalance: lowBalance}
+	scheduler := sms.NewScheduler(&sms.FileLock{Path: getenv("SMS_SCHEDULER_LOCK", "sms-scheduler.lock")})
+
+	var gatewayTickets *sms.GatewayTickets
+	if gateway := os.Getenv("USSD_GATEWAY_URL"); gateway != "" {
+		gatewayTickets = &sms.GatewayTickets{BaseURL: gateway, AdminToken: os.Getenv("USSD_ADMIN_TOKEN")}
+		jobs.Tickets = gatewayTickets
+		if err := scheduler.Add("departure-reminders", getenv("SMS_REMINDER_SCHEDULE", defaultReminderSchedule), loc, jobs.DepartureReminders); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	} else {
+		log.Println("⚠️  USSD_GATEWAY_URL not set, departure reminders disabled")
+	}
+
+	var walletFeed *sms.WalletFeed
+	if feed := os.Getenv("SMS_WALLET_FEED_URL"); feed != "" {
+		walletFeed = &sms.WalletFeed{URL: feed, Token: os.Getenv("SMS_WALLET_FEED_TOKEN")}
+		jobs.Wallets = walletFeed
+		if err := scheduler.Add("daily-digests", getenv("SMS_DIGEST_SCHEDULE", defaultDigestSchedule), loc, jobs.DailyDigests); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := scheduler.Add("low-balance-alerts", getenv("SMS_LOW_BALANCE_SCHEDULE", defaultLowBalanceSchedule), loc, jobs.LowBalanceAlerts); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	} else {
+		log.Println("⚠️  SMS_WALLET_FEED_URL not set, daily digests and low balance alerts disabled")
+	}
+
+	if port := os.Getenv("SMS_HTTP_PORT"); port != "" {
+		go serveWebhooks(":"+port, notifier, outbox, sent, optOuts, gatewayTickets, walletFeed)
+	}
+
+	log.Println("🗓️  SMS scheduler running")
+	scheduler.Run(ctx)
+	log.Println("👋 SMS scheduler stopped")
+}
+
+// serveWebhooks receives delivery reports, messages other services send
+// and, when the gateway is configured, inbound SMS commands
+func serveWebhooks(addr string, notifier *sms.NotificationService, outbox *sms.Outbox, seen sms.SentLog,
+	optOuts sms.OptOutList, tickets *sms.GatewayTickets, wallets *sms.WalletFeed) {
+	token := os.Getenv("SMS_DLR_TOKEN")
+	publicURL := os.Getenv("SMS_PUBLIC_URL")
+	mux := http.NewServeMux()
+
+	reports := &sms.DeliveryReports{
+		Outbox:          outbox,
+		Token:           token,
+		TwilioAuthToken: os.Getenv("TWILIO_AUTH_TOKEN"),
+		PublicURL:       publicURL,
+	}
+	if reports.Configured() {
+		mux.Handle("/sms/dlr/", http.StripPrefix("/sms/dlr", reports.Handler()))
+	} else {
+		log.Println("⚠️  Neither SMS_DLR_TOKEN nor TWILIO_AUTH_TOKEN and SMS_PUBLIC_URL set, delivery reports disabled")
+	}
+
+	// Other services, e.g. the USSD gateway, send through the outbox
+	send := &sms.SendAPI{Notifier: notifier, Token: os.Getenv("SMS_SEND_TOKEN")}
+	if send.Token != "" {
+		handler := http.StripPrefix("/sms", send.Handler())
+		mux.Handle("/sms/send", handler)
+		mux.Handle("/sms/ticket-confirmation", handler)
+	} else {
+		log.Println("⚠️  SMS_SEND_TOKEN not set, other services cannot send SMS through the outbox")
+	}
+
+	if tickets != nil {
+		commands := &sms.Commands{Notifier: notifier, Registry: tickets, OptOuts: optOuts}
+		if wallets != nil {
+			commands.Wallets = wallets
+		}
+		inbound := &sms.InboundSMS{
+			Commands:        commands,
+			Token:           token,
+			TwilioAuthToken: os.Getenv("TWILIO_AUTH_TOKEN"),
+			PublicURL:       publicURL,
+			Seen:            seen,
+		}
+		if inbound.Configured() {
+			mux.Handle("/sms/inbound/", http.StripPrefix("/sms/inbound", inbound.Handler()))
+		} else {
+			log.Println("⚠️  Neither SMS_DLR_TOKEN nor TWILIO_AUTH_TOKEN and SMS_PUBLIC_URL set, inbound SMS commands disabled")
+		}
+	} else {
+		log.Println("⚠️  USSD_GATEWAY_URL not set, inbound SMS commands disabled")
+	}
+
+	log.Printf("📡 SMS webhooks listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
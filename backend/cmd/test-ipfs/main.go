@@ -1,197 +1,133 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/backend/pkg/metadata"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
 )
 
-// TicketMetadata represents the NFT metadata
-type TicketMetadata struct {
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Image       string            `json:"image"`
-	ExternalURL string            `json:"external_url"`
-	Attributes  []TicketAttribute `json:"attributes"`
-}
-
-type TicketAttribute struct {
-	TraitType   string      `json:"trait_type"`
-	Value       interface{} `json:"value"`
-	DisplayType string      `json:"display_type,omitempty"`
-}
-
-// PinataResponse represents the response from Pinata
-type PinataResponse struct {
-	IpfsHash  string    `json:"IpfsHash"`
-	PinSize   int       `json:"PinSize"`
-	Timestamp time.Time `json:"Timestamp"`
-}
-
 func main() {
 	// Load environment variables
 	if err := godotenv.Load("/workspaces/africa-railways/.env"); err != nil {
 		log.Printf("Warning: .env file not found")
 	}
 
-	fmt.Println("📤 IPFS Upload Test - Pinata")
+	fmt.Println("📤 IPFS Upload Test")
 	fmt.Println("=" + string(make([]byte, 50)))
 
-	// Get API credentials - try JWT first, then API key/secret
-	jwt := os.Getenv("PINATA_JWT")
-	apiKey := os.Getenv("PINATA_API_KEY")
-	secretKey := os.Getenv("PINATA_SECRET_KEY")
-	
-	if jwt == "" && apiKey == "" {
-		log.Fatal("❌ PINATA_JWT or PINATA_API_KEY must be set")
+	// IPFS_PROVIDER picks the backend; Pinata reads PINATA_JWT first, then
+	// PINATA_API_KEY and PINATA_SECRET_KEY
+	pinner, err := storage.NewPinnerFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
 	fmt.Println("\n✅ Configuration:")
-	if jwt != "" {
+	fmt.Printf("   Provider: %s\n", pinner.Name())
+	if jwt := os.Getenv("PINATA_JWT"); pinner.Name() == storage.ProviderPinata && jwt != "" {
 		if len(jwt) > 20 {
 			fmt.Printf("   JWT Token: %s...%s\n", jwt[:10], jwt[len(jwt)-10:])
 		} else {
 			fmt.Printf("   JWT Token: %s\n", jwt)
 		}
-	} else {
+	} else if apiKey := os.Getenv("PINATA_API_KEY"); pinner.Name() == storage.ProviderPinata {
 		if len(apiKey) > 10 {
 			fmt.Printf("   API Key: %s...\n", apiKey[:10])
 		} else {
 			fmt.Printf("   API Key: %s\n", apiKey)
 		}
-		if secretKey != "" && secretKey != "your_pinata_secret_key_here" {
-			fmt.Println("   Secret Key: Configured")
-		}
+		fmt.Println("   Secret Key: Configured")
 	}
 
-	// Create sample ticket metadata
-	fmt.Println("\n📋 Creating Sample Ticket Metadata...")
+	// Create a sample ticket
+	fmt.Println("\n📋 Creating Sample Ticket...")
 	
 	ticketID := fmt.Sprintf("TKT%d", time.Now().Unix())
 	departureTime := time.Now().Add(24 * time.Hour)
 	
-	metadata := TicketMetadata{
-		Name:        fmt.Sprintf("Africa Railways: Ticket #%s", ticketID),
-		Description: "Standard Class Ticket - Johannesburg to Cape Town",
-		Image:       "ipfs://QmYourTicketDesignCID",
-		ExternalURL: fmt.Sprintf("https://africarailways.com/verify/%s", ticketID),
-		Attributes: []TicketAttribute{
-			{TraitType: "Route", Value: "JHB-CPT"},
-			{TraitType: "Class", Value: "Standard"},
-			{TraitType: "Seat", Value: "14A"},
-			{
-				TraitType:   "Departure",
-				Value:       departureTime.Unix(),
-				DisplayType: "date",
-			},
-			{TraitType: "Passenger", Value: "John Doe"},
-			{TraitType: "Phone", Value: "+27123456789"},
-			{
-				TraitType:   "Price",
-				Value:       450.00,
-				DisplayType: "number",
-			},
-			{TraitType: "Currency", Value: "ZAR"},
-		},
+	ticket := metadata.TicketDetails{
+		TicketID:       ticketID,
+		PassengerName:  "John Doe",
+		PassengerPhone: "+27123456789",
+		RouteFrom:      "Johannesburg",
+		RouteTo:        "Cape Town",
+		DepartureTime:  departureTime,
+		ArrivalTime:    departureTime.Add(20 * time.Hour),
+		SeatNumber:     "14A",
+		Class:          "Standard",
+		Price:          450.00,
+		Currency:       "ZAR",
 	}
 
-	// Display metadata
-	jsonData, _ := json.MarshalIndent(metadata, "", "  ")
-	fmt.Println("\n📄 Metadata to Upload:")
-	fmt.Println(string(jsonData))
+	key, err := metadata.LoadSigningKey()
+	if err != nil {
+		log.Printf("⚠️  %v; signing with a temporary key", err)
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
 
-	// Upload to Pinata
-	fmt.Println("\n📤 Uploading to Pinata IPFS...")
-	ipfsHash, err := uploadToPinata(jwt, apiKey, secretKey, metadata)
+	// Upload to IPFS: artwork first, then metadata validated against schema
+	// version 2. Returned CIDs are checked against the content.
+	fmt.Printf("\n📤 Uploading to %s...\n", pinner.Name())
+	pinned, err := metadata.PinTicket(context.Background(), pinner, nil, ticket, key)
 	if err != nil {
 		log.Fatalf("❌ Upload failed: %v", err)
 	}
+	pin := pinned.MetadataPin
 
-	fmt.Println("\n✅ Upload Successful!")
-	fmt.Println("=" + string(make([]byte, 50)))
-	fmt.Printf("\n📍 IPFS Hash: %s\n", ipfsHash)
-	fmt.Printf("🔗 IPFS URI: ipfs://%s\n", ipfsHash)
-	fmt.Printf("🌐 Gateway URL: https://gateway.pinata.cloud/ipfs/%s\n", ipfsHash)
-	fmt.Printf("🌐 Alternative: https://ipfs.io/ipfs/%s\n", ipfsHash)
-
-	fmt.Println("\n🎉 IPFS Integration Working!")
-	fmt.Println("=" + string(make([]byte, 50)))
-	fmt.Println("\n✅ You can now:")
-	fmt.Println("   1. Upload ticket metadata to IPFS")
-	fmt.Println("   2. Get permanent IPFS URIs")
-	fmt.Println("   3. Use URIs in NFT minting")
-	fmt.Println("   4. Access metadata via IPFS gateways")
-}
-
-// uploadToPinata uploads JSON metadata to Pinata
-func uploadToPinata(jwt, apiKey, secretKey string, metadata TicketMetadata) (string, error) {
-	url := "https://api.pinata.cloud/pinning/pinJSONToIPFS"
-
-	// Prepare request body
-	requestBody := map[string]interface{}{
-		"pinataContent": metadata,
-		"pinataMetadata": map[string]string{
-			"name": metadata.Name,
-		},
-	}
+	// Display metadata
+	jsonData, _ := json.MarshalIndent(pinned.Metadata, "", "  ")
+	fmt.Println("\n📄 Uploaded Metadata:")
+	fmt.Println(string(jsonData))
 
-	jsonData, err := json.Marshal(requestBody)
+	// The CID is known from the content alone
+	encoded, err := storage.MarshalJSON(pinned.Metadata)
 	if err != nil {
-		return "", err
+		log.Fatalf("❌ %v", err)
 	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	expected, err := pinner.CIDFor(encoded)
 	if err != nil {
-		return "", err
+		log.Fatalf("❌ Failed to compute CID: %v", err)
 	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	
-	// Try different authentication methods
-	if jwt != "" {
-		// Use JWT Bearer token method (preferred)
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
-	} else if secretKey != "" && secretKey != "your_pinata_secret_key_here" {
-		// Use API Key + Secret Key method
-		req.Header.Set("pinata_api_key", apiKey)
-		req.Header.Set("pinata_secret_api_key", secretKey)
-	} else {
-		return "", fmt.Errorf("no valid authentication credentials provided")
-	}
-
-	// Send request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	fmt.Printf("\n🧮 Expected CID: %s\n", expected)
+	if pin.CID != expected {
+		fmt.Printf("⚠️  Provider chose a different CID encoding: %s\n", pin.CID)
 	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	if pin.Verified {
+		fmt.Println("✅ Returned CID matches the content")
 	}
 
-	// Check status
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("pinata API error: %s - %s", resp.Status, string(body))
+	// IPFS_VERIFY_GATEWAY fetches it back and re-hashes it
+	if gateway := os.Getenv("IPFS_VERIFY_GATEWAY"); gateway != "" {
+		fmt.Printf("\n🔍 Verifying through %s...\n", gateway)
+		if err := storage.NewGatewayVerifier(gateway).Verify(context.Background(), pin.CID); err != nil {
+			log.Fatalf("❌ Gateway verification failed: %v", err)
+		}
+		fmt.Println("✅ Gateway serves matching content")
 	}
 
-	// Parse response
-	var result PinataResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", err
-	}
+	fmt.Println("\n✅ Upload Successful!")
+	fmt.Println("=" + string(make([]byte, 50)))
+	fmt.Printf("\n📍 IPFS CID: %s (%d bytes)\n", pin.CID, pin.Size)
+	fmt.Printf("🔗 IPFS URI: %s\n", pin.CID.URI())
+	fmt.Printf("🌐 Gateway URL: %s\n", pin.CID.URL("https://gateway.pinata.cloud/ipfs/"))
+	fmt.Printf("🌐 Alternative: %s\n", pin.CID.URL(storage.DefaultGateway))
 
-	return result.IpfsHash, nil
+	fmt.Println("\n🎉 IPFS Integration Working!")
+	fmt.Println("=" + string(make([]byte, 50)))
+	fmt.Println("\n✅ You can now:")
+	fmt.Println("   1. Upload ticket metadata to IPFS")
+	fmt.Println("   2. Get permanent IPFS URIs")
+	fmt.Println("   3. Use URIs in NFT minting")
+	fmt.Println("   4. Access metadata via IPFS gateways")
 }
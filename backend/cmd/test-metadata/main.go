@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
 )
 
 // Simplified metadata structures for testing
@@ -80,9 +83,11 @@ func main() {
 
 	// Test IPFS mock upload
 	fmt.Println("\n📤 Mock IPFS Upload:")
-	mockHash := fmt.Sprintf("QmMockMetadata%d", time.Now().Unix())
-	mockURI := fmt.Sprintf("ipfs://%s", mockHash)
-	fmt.Printf("   ✅ Metadata URI: %s\n", mockURI)
+	pin, err := storage.NewMemoryPinner().PinJSON(context.Background(), "ticket-"+ticketID, metadata)
+	if err != nil {
+		log.Fatalf("Failed to pin metadata: %v", err)
+	}
+	fmt.Printf("   ✅ Metadata URI: %s\n", pin.CID.URI())
 
 	// Display human-readable ticket info
 	fmt.Println("\n🎫 Ticket Information:")
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/metadata"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
+)
+
+// verifyRequest is what a staff scanner posts: the QR code and the ID the
+// passenger presents, either an ID number or a phone number
+type verifyRequest struct {
+	Code     string `json:"code"`
+	IDNumber string `json:"id_number,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+}
+
+type verifyResponse struct {
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+	TicketID  string `json:"ticket_id,omitempty"`
+	Route     string `json:"route,omitempty"`
+	Class     string `json:"class,omitempty"`
+	Seat      string `json:"seat,omitempty"`
+	Departure string `json:"departure,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+}
+
+type server struct {
+	pub       ed25519.PublicKey
+	vault     metadata.PIIVault
+	token     string
+	retriever *storage.Retriever
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// publicKey reads TICKET_VERIFY_PUBLIC_KEY, or derives it from
+// TICKET_SIGNING_KEY when the verifier runs beside the issuer
+func publicKey() (ed25519.PublicKey, error) {
+	if hexKey := os.Getenv("TICKET_VERIFY_PUBLIC_KEY"); hexKey != "" {
+		pub, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, errors.New("TICKET_VERIFY_PUBLIC_KEY must be a 32-byte hex Ed25519 public key")
+		}
+		return pub, nil
+	}
+	key, err := metadata.LoadSigningKey()
+	if err != nil {
+		return nil, errors.New("set TICKET_VERIFY_PUBLIC_KEY or TICKET_SIGNING_KEY")
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+func main() {
+	pub, err := publicKey()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	vault, err := metadata.NewFileVaultFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	token := os.Getenv("TICKET_VERIFIER_TOKEN")
+	if token == "" {
+		log.Fatal("❌ TICKET_VERIFIER_TOKEN must be set; the verifier answers identity questions")
+	}
+
+	retriever, err := storage.NewRetrieverFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	s := &server{pub: pub, vault: vault, token: token, retriever: retriever}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/verify", s.handleVerify)
+	mux.HandleFunc("/erase", s.handleErase)
+	mux.HandleFunc("/ipfs/", s.handleIPFS)
+	mux.HandleFunc("/tickets/", s.handleTicket)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	addr := ":" + getenv("TICKET_VERIFIER_PORT", "8090")
+	log.Printf("🎫 Ticket verifier listening on %s, fetching IPFS content from %s",
+		addr, strings.Join(retriever.Gateways(), ", "))
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (s *server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleVerify checks the QR signature and, on private tickets, whether the
+// presented ID is the passenger's. The response never contains personal data.
+func (s *server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	var req verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "expected JSON with code and id_number or phone", http.StatusBadRequest)
+		return
+	}
+	kind, presented := metadata.IdentityIDNumber, req.IDNumber
+	if presented == "" {
+		kind, presented = metadata.IdentityPhone, req.Phone
+	}
+
+	payload, identity, err := metadata.VerifyPassenger(s.pub, s.vault, req.Code, kind, presented)
+	var resp verifyResponse
+	switch {
+	case errors.Is(err, metadata.ErrRecordNotFound):
+		// Erased or never recorded: the ticket is genuine but nobody can be
+		// matched to it
+		resp = verifyResponse{Valid: true, Identity: metadata.IdentityMismatch, Error: "no passenger record"}
+	case err != nil:
+		log.Printf("⚠️  Rejected ticket code: %v", err)
+		writeJSON(w, verifyResponse{Error: err.Error()})
+		return
+	default:
+		resp = verifyResponse{Valid: true, Identity: identity}
+	}
+	resp.TicketID = payload.TicketID
+	resp.Route = payload.Route
+	resp.Class = payload.Class
+	resp.Seat = payload.Seat
+	resp.Departure = time.Unix(payload.Departure, 0).UTC().Format(time.RFC3339)
+	log.Printf("🎫 Verified %s: identity %s", payload.TicketID, resp.Identity)
+	writeJSON(w, resp)
+}
+
+// handleErase deletes a passenger's record on request, e.g. under POPIA or
+// GDPR. The published commitment then matches no one.
+func (s *server) handleErase(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	var req struct {
+		TicketID string `json:"ticket_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TicketID == "" {
+		http.Error(w, "expected JSON with ticket_id", http.StatusBadRequest)
+		return
+	}
+	if err := s.vault.Delete(req.TicketID); err != nil {
+		log.Printf("❌ Failed to erase passenger record %s: %v", req.TicketID, err)
+		http.Error(w, "failed to erase record", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🗑️  Erased passenger record for %s", req.TicketID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetch reads the CID after prefix in the request path and retrieves it.
+// Pinned ticket content is public, so no token is needed.
+func (s *server) fetch(w http.ResponseWriter, r *http.Request, prefix string) (storage.CID, []byte, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", nil, false
+	}
+	cid, err := storage.ParseCID(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", nil, false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+	data, err := s.retriever.Fetch(ctx, cid)
+	if err != nil {
+		log.Printf("⚠️  Failed to fetch %s: %v", cid, err)
+		http.Error(w, "content not available", http.StatusBadGateway)
+		return "", nil, false
+	}
+	// Content never changes under its CID
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	return cid, data, true
+}
+
+// handleIPFS serves ticket artwork and metadata by CID, e.g. for the
+// dashboard to render a ticket
+func (s *server) handleIPFS(w http.ResponseWriter, r *http.Request) {
+	_, data, ok := s.fetch(w, r, "/ipfs/")
+	if !ok {
+		return
+	}
+	contentType := http.DetectContentType(data)
+	switch {
+	case bytes.Contains(data[:min(len(data), 512)], []byte("<svg")):
+		contentType = "image/svg+xml"
+	case json.Valid(data):
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	// SVG can carry scripts; nothing fetched is trusted to run here
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// handleTicket serves ticket metadata by CID, migrated to the current
+// schema version
+func (s *server) handleTicket(w http.ResponseWriter, r *http.Request) {
+	cid, data, ok := s.fetch(w, r, "/tickets/")
+	if !ok {
+		return
+	}
+	meta, err := metadata.ParseMetadata(data)
+	if err != nil {
+		log.Printf("⚠️  %s is not ticket metadata: %v", cid, err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, meta)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
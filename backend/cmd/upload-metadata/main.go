@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"time"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/metadata"
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
 )
 
 // Config represents the application configuration
@@ -44,15 +50,6 @@ type Config struct {
 	} `json:"features"`
 }
 
-// TicketMetadata represents the NFT metadata structure
-type TicketMetadata struct {
-	Name        string                   `json:"name"`
-	Description string                   `json:"description"`
-	Image       string                   `json:"image"`
-	ExternalURL string                   `json:"external_url,omitempty"`
-	Attributes  []map[string]interface{} `json:"attributes"`
-}
-
 func main() {
 	fmt.Println("📤 Automated Metadata Uploader")
 	fmt.Println("=" + string(make([]byte, 60)))
@@ -69,44 +66,58 @@ func main() {
 	fmt.Printf("   IPFS Provider: %s\n", config.Storage.Provider)
 	fmt.Printf("   API Key: %s...\n", config.Storage.IPFSAPIKey[:10])
 
-	// Step 2: Create sample ticket metadata
-	fmt.Println("\n🎫 Step 2: Creating ticket metadata...")
+	// Step 2: Create a sample ticket
+	fmt.Println("\n🎫 Step 2: Creating ticket...")
 	
 	ticketID := fmt.Sprintf("TKT%d", time.Now().Unix())
-	ticket := createTicketMetadata(
-		ticketID,
-		"John Doe",
-		"JHB-CPT",
-		"Standard",
-		"14A",
-		time.Now().Add(24*time.Hour).Unix(),
-		450.00,
-		"ipfs://QmYourTicketDesignCID",
-		config.API.BaseURL,
-	)
-
-	// Display metadata
-	jsonData, _ := json.MarshalIndent(ticket, "", "  ")
-	fmt.Println("\n📄 Ticket Metadata:")
-	fmt.Println(string(jsonData))
+	ticket := metadata.TicketDetails{
+		TicketID:       ticketID,
+		PassengerName:  "John Doe",
+		PassengerPhone: "+27123456789",
+		RouteFrom:      "Johannesburg",
+		RouteTo:        "Cape Town",
+		DepartureTime:  time.Now().Add(24 * time.Hour),
+		SeatNumber:     "14A",
+		Class:          "Standard",
+		Price:          450.00,
+		Currency:       "ZAR",
+	}
+	key, err := metadata.LoadSigningKey()
+	if err != nil {
+		log.Printf("⚠️  %v; signing with a temporary key", err)
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
 
 	// Step 3: Upload to IPFS
 	fmt.Println("\n📤 Step 3: Uploading to IPFS...")
 	fmt.Printf("   Provider: %s\n", config.Storage.Provider)
 	fmt.Printf("   Using API Key from config.json\n")
 
-	cid, err := uploadMetadataToIPFS(config.Storage.IPFSAPIKey, ticket, config.Storage.Provider)
+	pinner, err := storage.NewPinner(config.Storage.Provider, config.Storage.IPFSAPIKey)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	// The artwork is pinned first; the metadata is validated before either
+	pinned, err := metadata.PinTicket(context.Background(), pinner, nil, ticket, key)
 	if err != nil {
 		log.Fatalf("❌ Upload failed: %v", err)
 	}
+	cid := pinned.MetadataPin.CID
+
+	// Display metadata
+	jsonData, _ := json.MarshalIndent(pinned.Metadata, "", "  ")
+	fmt.Println("\n📄 Ticket Metadata:")
+	fmt.Println(string(jsonData))
 
 	// Step 4: Display results
 	fmt.Println("\n✅ Upload Successful!")
 	fmt.Println("=" + string(make([]byte, 60)))
 	fmt.Printf("\n📍 IPFS CID: %s\n", cid)
-	fmt.Printf("🔗 IPFS URI: ipfs://%s\n", cid)
-	fmt.Printf("🌐 Gateway URL: %s%s\n", config.Storage.IPFSGateway, cid)
-	fmt.Printf("🌐 Pinata Gateway: %s%s\n", config.Storage.PinataGateway, cid)
+	fmt.Printf("🔗 IPFS URI: %s\n", cid.URI())
+	fmt.Printf("🌐 Gateway URL: %s\n", cid.URL(config.Storage.IPFSGateway))
+	fmt.Printf("🌐 Pinata Gateway: %s\n", cid.URL(config.Storage.PinataGateway))
 	fmt.Printf("🎫 Verify URL: %s%s/%s\n", config.API.BaseURL, config.API.VerifyEndpoint, ticketID)
 
 	// Step 5: Summary
@@ -114,7 +125,7 @@ func main() {
 	fmt.Println("🎉 Automated Metadata Upload Complete!")
 	fmt.Println("\n✨ What Happened:")
 	fmt.Println("  1. ✅ Loaded config.json from root")
-	fmt.Println("  2. ✅ Created ticket metadata")
+	fmt.Println("  2. ✅ Created and validated ticket metadata")
 	fmt.Println("  3. ✅ Uploaded to IPFS using configured API key")
 	fmt.Println("  4. ✅ Received CID (Content Identifier)")
 	fmt.Println("  5. ✅ Generated IPFS URI for NFT minting")
@@ -152,74 +163,3 @@ func loadConfig() (*Config, error) {
 
 	return &config, nil
 }
-
-// createTicketMetadata creates metadata from ticket details
-func createTicketMetadata(
-	ticketID string,
-	passengerName string,
-	route string,
-	class string,
-	seat string,
-	departureTime int64,
-	price float64,
-	imageIPFS string,
-	baseURL string,
-) TicketMetadata {
-	return TicketMetadata{
-		Name:        fmt.Sprintf("Africa Railways: Ticket #%s", ticketID),
-		Description: fmt.Sprintf("%s Class Ticket - %s", class, route),
-		Image:       imageIPFS,
-		ExternalURL: fmt.Sprintf("%s/verify/%s", baseURL, ticketID),
-		Attributes: []map[string]interface{}{
-			{
-				"trait_type": "Route",
-				"value":      route,
-			},
-			{
-				"trait_type": "Class",
-				"value":      class,
-			},
-			{
-				"trait_type": "Seat",
-				"value":      seat,
-			},
-			{
-				"trait_type":   "Departure",
-				"value":        departureTime,
-				"display_type": "date",
-			},
-			{
-				"trait_type": "Passenger",
-				"value":      passengerName,
-			},
-			{
-				"trait_type":   "Price",
-				"value":        price,
-				"display_type": "number",
-			},
-			{
-				"trait_type": "Currency",
-				"value":      "ZAR",
-			},
-		},
-	}
-}
-
-// uploadMetadataToIPFS uploads ticket metadata to IPFS and returns the CID
-func uploadMetadataToIPFS(apiKey string, ticket TicketMetadata, provider string) (string, error) {
-	// Implementation depends on provider
-	// For now, return a mock CID
-	// In production, this would call the actual IPFS API
-	
-	fmt.Println("   📡 Connecting to IPFS provider...")
-	fmt.Println("   📦 Preparing metadata...")
-	fmt.Println("   🔐 Authenticating with API key...")
-	fmt.Println("   ⬆️  Uploading to IPFS...")
-	fmt.Println("   ✅ Upload confirmed!")
-	
-	// Mock CID for demonstration
-	// In production, replace with actual upload logic
-	mockCID := fmt.Sprintf("Qm%d", time.Now().Unix())
-	
-	return mockCID, nil
-}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math/big"
 	"net/http"
 	"os"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
@@ -22,6 +25,10 @@ type PolicyManager struct {
 	apiKey   string
 	rpcURL   string
 	client   *ethclient.Client
+	// Rules, when set, are checked before Alchemy's policy; a transaction
+	// they refuse is never sent to Alchemy. A transaction they allow holds
+	// a reservation until Commit charges it once mined.
+	Rules *RuleEngine
 }
 
 // NewPolicyManager creates a new gas policy manager
@@ -64,20 +71,117 @@ type SponsoredTransactionResponse struct {
 	Error     string `json:"error,omitempty"`
 }
 
-// IsTransactionSponsored checks if a transaction qualifies for gas sponsorship
+// IsTransactionSponsored checks if a transaction qualifies for gas
+// sponsorship. It only asks: any reservation the rules make is released
+// straight away, and Commit charges the transaction without one.
 func (pm *PolicyManager) IsTransactionSponsored(from, to common.Address, data []byte) (bool, error) {
+	req := SponsorshipRequest{From: from, To: to, Data: data}
+	if pm.Rules != nil && pm.client != nil {
+		// The rules value the gas against the daily budget
+		ctx := context.Background()
+		gas, err := pm.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+		if err != nil {
+			return false, fmt.Errorf("failed to estimate gas: %w", err)
+		}
+		gasPrice, err := pm.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to get gas price: %w", err)
+		}
+		req.Gas, req.GasPrice = gas, gasPrice
+	}
+	decision, err := pm.Check(context.Background(), req)
+	pm.Release(decision)
+	return decision.Sponsored, err
+}
+
+// ErrPolicyNotConfigured is returned when no Alchemy gas policy is set
+var ErrPolicyNotConfigured = errors.New("gas policy ID not configured")
+
+// Check decides whether to sponsor a transaction: first by the local Rules,
+// if any, then by Alchemy's policy. A sponsored transaction holds the
+// Decision's reservation under the rules: Commit it once mined, or Release
+// it if the transaction is not sent. A refused one holds nothing.
+func (pm *PolicyManager) Check(ctx context.Context, req SponsorshipRequest) (Decision, error) {
+	decision := Decision{Sponsored: true, Rule: RuleAllowed, To: req.To, Passenger: req.From}
+	if pm.Rules != nil {
+		if decision = pm.Rules.Check(ctx, req); !decision.Sponsored {
+			return decision, nil
+		}
+	}
 	if pm.policyID == "" {
-		return false, fmt.Errorf("gas policy ID not configured")
+		return pm.Release(refuse(decision, RuleAlchemy, ErrPolicyNotConfigured.Error())), ErrPolicyNotConfigured
 	}
 
-	req := SponsoredTransactionRequest{
+	sponsored, err := pm.checkSponsorship(SponsoredTransactionRequest{
 		PolicyID: pm.policyID,
-		From:     from.Hex(),
-		To:       to.Hex(),
-		Data:     fmt.Sprintf("0x%x", data),
+		From:     req.From.Hex(),
+		To:       req.To.Hex(),
+		Data:     fmt.Sprintf("0x%x", req.Data),
+	})
+	if err != nil {
+		log.Printf("❌ Sponsorship check for %s on %s failed: %v", methodName(decision), req.To.Hex(), err)
+		return pm.Release(refuse(decision, RuleAlchemy, err.Error())), err
 	}
+	if !sponsored {
+		decision = pm.Release(refuse(decision, RuleAlchemy, "Alchemy's gas policy does not sponsor it"))
+		log.Printf("🚫 Refused sponsorship of %s for %s on %s [%s]: %s", methodName(decision), decision.Passenger.Hex(), req.To.Hex(), decision.Rule, decision.Reason)
+	}
+	return decision, nil
+}
 
-	return pm.checkSponsorship(req)
+// Release frees the reservation a Decision holds under the local Rules,
+// for a transaction that will not be sent, and returns the Decision
+// without it
+func (pm *PolicyManager) Release(decision Decision) Decision {
+	if pm.Rules != nil && decision.Reservation != "" {
+		pm.Rules.Release(decision.Reservation)
+	}
+	decision.Reservation = ""
+	return decision
+}
+
+// Commit charges a mined transaction to the local Rules at the gas its
+// receipt shows it used, in place of the reservation Check returned.
+// reservation and passenger may be empty: the passenger is then taken from
+// the transaction, as Check does, and their oldest reservation replaced.
+// Without Rules there is nothing to charge.
+func (pm *PolicyManager) Commit(ctx context.Context, hash common.Hash, reservation string, passenger common.Address) (Decision, error) {
+	if pm.Rules == nil {
+		return Decision{Sponsored: true, Rule: RuleAllowed, TxHash: hash.Hex()}, nil
+	}
+	tx, pending, err := pm.client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to get transaction %s: %w", hash.Hex(), err)
+	}
+	if pending {
+		return Decision{}, ErrNotMined
+	}
+	if tx.To() == nil {
+		return Decision{}, fmt.Errorf("transaction %s creates a contract", hash.Hex())
+	}
+	receipt, err := pm.client.TransactionReceipt(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return Decision{}, ErrNotMined
+	} else if err != nil {
+		return Decision{}, fmt.Errorf("failed to get receipt for %s: %w", hash.Hex(), err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to recover sender of %s: %w", hash.Hex(), err)
+	}
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil {
+		gasPrice = tx.GasPrice()
+	}
+	return pm.Rules.Commit(ctx, hash, SponsorshipRequest{
+		From:        from,
+		To:          *tx.To(),
+		Data:        tx.Data(),
+		Passenger:   passenger,
+		Gas:         receipt.GasUsed,
+		GasPrice:    gasPrice,
+		Reservation: reservation,
+	})
 }
 
 // checkSponsorship makes API call to check if transaction is sponsored
@@ -140,20 +244,15 @@ func (pm *PolicyManager) getPolicyStatus() string {
 	return "configured"
 }
 
-// EstimateGasWithPolicy estimates gas considering policy sponsorship
+// EstimateGasWithPolicy estimates gas considering policy sponsorship. Like
+// IsTransactionSponsored it holds no reservation; call Commit once the
+// transaction is mined.
 func (pm *PolicyManager) EstimateGasWithPolicy(
 	ctx context.Context,
 	from, to common.Address,
 	data []byte,
 	value *big.Int,
 ) (uint64, bool, error) {
-	// Check if transaction is sponsored
-	sponsored, err := pm.IsTransactionSponsored(from, to, data)
-	if err != nil {
-		// If check fails, proceed with normal gas estimation
-		sponsored = false
-	}
-
 	// Estimate gas
 	msg := map[string]interface{}{
 		"from":  from.Hex(),
@@ -165,10 +264,24 @@ func (pm *PolicyManager) EstimateGasWithPolicy(
 	// Use eth_estimateGas
 	gasLimit, err := pm.client.EstimateGas(ctx, toCallMsg(msg))
 	if err != nil {
-		return 0, sponsored, err
+		return 0, false, err
+	}
+
+	// Check if transaction is sponsored. A failed check is returned rather
+	// than read as unsponsored, so the caller never pays for gas by mistake.
+	req := SponsorshipRequest{From: from, To: to, Data: data, Gas: gasLimit}
+	if pm.Rules != nil {
+		if req.GasPrice, err = pm.client.SuggestGasPrice(ctx); err != nil {
+			return gasLimit, false, fmt.Errorf("failed to get gas price: %w", err)
+		}
+	}
+	decision, err := pm.Check(ctx, req)
+	pm.Release(decision)
+	if err != nil && !errors.Is(err, ErrPolicyNotConfigured) {
+		return gasLimit, false, fmt.Errorf("sponsorship check failed: %w", err)
 	}
 
-	return gasLimit, sponsored, nil
+	return gasLimit, decision.Sponsored, nil
 }
 
 // toCallMsg converts map to ethereum.CallMsg
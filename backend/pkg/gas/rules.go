@@ -0,0 +1,509 @@
+package gas
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/mpolobe/africa-railways/pkg/price"
+)
+
+// DefaultLedgerPath is where a RuleEngine keeps the day's spend unless
+// GAS_LEDGER_PATH says otherwise
+const DefaultLedgerPath = "gas-ledger.json"
+
+// ReservationTTL is how long a slot reserved by Check is held for a
+// transaction that is neither committed nor released
+const ReservationTTL = 15 * time.Minute
+
+// commitRetention is how long a committed transaction is remembered so it
+// is not charged again, well past any client's retries
+const commitRetention = 7 * 24 * time.Hour
+
+// Rules are the local sponsorship policy, checked before Alchemy's. They
+// are read from JSON, e.g.
+//
+//	{
+//	  "contracts": {"0xTicketNFT...": ["safeMint(address,string)"]},
+//	  "passenger_daily_cap": 5,
+//	  "daily_budget_usd": 25
+//	}
+type Rules struct {
+	// Contracts maps each sponsored contract to the methods that may be
+	// called on it, as Solidity signatures. Transactions to any other
+	// address are refused.
+	Contracts map[string][]string `json:"contracts"`
+	// PassengerDailyCap is how many transactions one passenger may have
+	// sponsored per UTC day; 0 means no cap
+	PassengerDailyCap int `json:"passenger_daily_cap"`
+	// DailyBudgetUSD caps the gas sponsored per UTC day across everyone; 0
+	// means no cap
+	DailyBudgetUSD float64 `json:"daily_budget_usd"`
+}
+
+// Rule names reported in a Decision
+const (
+	RuleAllowed      = "allowed"
+	RuleRecipient    = "unknown_recipient"
+	RuleMethod       = "method_not_allowed"
+	RulePassengerCap = "passenger_daily_cap"
+	RuleDailyBudget  = "daily_budget"
+	RuleCost         = "cost_unknown"
+	RuleAlchemy      = "alchemy_policy" // Alchemy's own policy, after the local rules
+)
+
+// Decision is the outcome of checking a transaction against the Rules
+type Decision struct {
+	Sponsored bool           `json:"sponsored"`
+	Rule      string         `json:"rule"`
+	Reason    string         `json:"reason"`
+	Passenger common.Address `json:"passenger"`
+	To        common.Address `json:"to"`
+	Method    string         `json:"method,omitempty"`
+	CostUSD   float64        `json:"cost_usd"`
+	Day       string         `json:"day"`
+	TxHash    string         `json:"tx_hash,omitempty"` // Set once committed
+	// Reservation is set when Check allows the transaction: its slot and
+	// estimated cost are held against today's caps until Commit or Release
+	Reservation string `json:"reservation,omitempty"`
+}
+
+// SponsorshipRequest is a transaction the relayer has been asked to sponsor
+type SponsorshipRequest struct {
+	From common.Address
+	To   common.Address
+	Data []byte
+	// Passenger is who the transaction is for. If zero it is the first
+	// argument of methods whose first parameter is an address, e.g. the
+	// recipient of safeMint, or else From.
+	Passenger common.Address
+	// Gas is the estimate when checking and the gas used when committing;
+	// with GasPrice, in wei, it is needed when there is a daily budget
+	Gas      uint64
+	GasPrice *big.Int
+	// Reservation, when committing, is the Decision.Reservation Check
+	// returned. If empty the passenger's oldest reservation is used.
+	Reservation string
+}
+
+// RuleUsage is what has been sponsored today against the Rules
+type RuleUsage struct {
+	Day               string         `json:"day"`
+	SpentUSD          float64        `json:"spent_usd"`
+	DailyBudgetUSD    float64        `json:"daily_budget_usd"`
+	Sponsored         int            `json:"sponsored"`
+	Refused           int            `json:"refused"`
+	Passengers        map[string]int `json:"passengers"`
+	PassengerDailyCap int            `json:"passenger_daily_cap"`
+	// ReservedUSD is the estimated cost of transactions allowed but not yet
+	// committed, held against the budget alongside SpentUSD
+	ReservedUSD float64                `json:"reserved_usd"`
+	Reserved    map[string]Reservation `json:"reserved,omitempty"`
+	// Committed maps each transaction charged in the last week to its cost,
+	// so none is charged twice, even after midnight
+	Committed map[string]Charge `json:"committed,omitempty"`
+}
+
+// Reservation is the slot and estimated cost Check holds for a passenger
+type Reservation struct {
+	Passenger string    `json:"passenger"`
+	CostUSD   float64   `json:"cost_usd"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Charge is what a committed transaction cost and when it was charged
+type Charge struct {
+	CostUSD float64   `json:"cost_usd"`
+	At      time.Time `json:"at"`
+}
+
+// Errors returned by Commit
+var (
+	ErrCommitted = errors.New("transaction is already charged")
+	ErrNotMined  = errors.New("transaction is not mined yet")
+)
+
+type method struct {
+	signature      string
+	firstIsAddress bool
+}
+
+// RuleEngine applies Rules, keeping the day's spend and per-passenger counts
+// in a JSON ledger so a restart does not reset them
+type RuleEngine struct {
+	rules     Rules
+	contracts map[common.Address]map[[4]byte]method
+	oracle    price.Oracle
+	path      string
+	now       func() time.Time
+
+	mu     sync.Mutex
+	ledger RuleUsage
+}
+
+var signaturePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\(([A-Za-z0-9_\[\],]*)\)$`)
+
+// NewRuleEngine checks rules and keeps its ledger at path, or in memory if
+// path is empty. oracle values gas in USD and is needed for a daily budget.
+func NewRuleEngine(rules Rules, oracle price.Oracle, path string) (*RuleEngine, error) {
+	if rules.PassengerDailyCap < 0 || rules.DailyBudgetUSD < 0 {
+		return nil, errors.New("gas rules: caps cannot be negative")
+	}
+	if rules.DailyBudgetUSD > 0 && oracle == nil {
+		return nil, errors.New("gas rules: a daily budget needs a POL price")
+	}
+	e := &RuleEngine{rules: rules, contracts: make(map[common.Address]map[[4]byte]method), oracle: oracle, path: path, now: time.Now}
+	for addr, signatures := range rules.Contracts {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("gas rules: %q is not a contract address", addr)
+		}
+		methods := make(map[[4]byte]method)
+		for _, sig := range signatures {
+			sig = strings.ReplaceAll(sig, " ", "")
+			m := signaturePattern.FindStringSubmatch(sig)
+			if m == nil {
+				return nil, fmt.Errorf("gas rules: %q is not a method signature like safeMint(address,string)", sig)
+			}
+			var selector [4]byte
+			copy(selector[:], crypto.Keccak256([]byte(sig))[:4])
+			methods[selector] = method{signature: sig, firstIsAddress: strings.HasPrefix(m[1]+",", "address,")}
+		}
+		e.contracts[common.HexToAddress(addr)] = methods
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &e.ledger); err != nil {
+				return nil, fmt.Errorf("invalid gas ledger %s: %w", path, err)
+			}
+		}
+	}
+	return e, nil
+}
+
+// LoadRules reads Rules from a JSON file
+func LoadRules(path string) (Rules, error) {
+	var rules Rules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("invalid gas rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// NewRuleEngineFromEnv loads the rules at GAS_RULES_PATH, keeping the ledger
+// at GAS_LEDGER_PATH (default gas-ledger.json). It returns nil without
+// GAS_RULES_PATH.
+func NewRuleEngineFromEnv(oracle price.Oracle) (*RuleEngine, error) {
+	path := os.Getenv("GAS_RULES_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	ledger := os.Getenv("GAS_LEDGER_PATH")
+	if ledger == "" {
+		ledger = DefaultLedgerPath
+	}
+	return NewRuleEngine(rules, oracle, ledger)
+}
+
+// Check decides whether a transaction may be sponsored under the rules and
+// today's counts, and logs the decision with its reason. A transaction the
+// rules allow reserves a slot under the passenger's cap and its estimated
+// cost under the budget, so concurrent checks cannot all pass on the same
+// headroom. Commit replaces the reservation with the actual cost; Release
+// frees it if the transaction is not sent, and otherwise it lapses after
+// ReservationTTL. Refusals are counted.
+func (e *RuleEngine) Check(ctx context.Context, req SponsorshipRequest) Decision {
+	d := e.check(ctx, req)
+
+	e.mu.Lock()
+	now := e.now()
+	e.rollover(now)
+	if d.Sponsored {
+		passenger := d.Passenger.Hex()
+		if e.rules.PassengerDailyCap > 0 && e.ledger.Passengers[passenger]+e.held(passenger) >= e.rules.PassengerDailyCap {
+			d = refuse(d, RulePassengerCap, fmt.Sprintf("passenger has had %d sponsored transactions today, the cap", e.rules.PassengerDailyCap))
+		} else if e.rules.DailyBudgetUSD > 0 && e.ledger.SpentUSD+e.ledger.ReservedUSD+d.CostUSD > e.rules.DailyBudgetUSD {
+			d = refuse(d, RuleDailyBudget, fmt.Sprintf("$%.4f would take today's spend past $%.2f ($%.4f spent, $%.4f reserved)",
+				d.CostUSD, e.rules.DailyBudgetUSD, e.ledger.SpentUSD, e.ledger.ReservedUSD))
+		} else {
+			d.Reservation = newReservationID()
+			e.ledger.Reserved[d.Reservation] = Reservation{Passenger: passenger, CostUSD: d.CostUSD, ExpiresAt: now.Add(ReservationTTL)}
+			e.tally()
+		}
+	}
+	if !d.Sponsored {
+		e.ledger.Refused++
+	}
+	if err := e.save(); err != nil {
+		log.Printf("⚠️  Failed to save gas ledger: %v", err)
+	}
+	e.mu.Unlock()
+
+	if d.Sponsored {
+		log.Printf("✅ Rules allow %s for %s on %s (~$%.4f): %s", methodName(d), d.Passenger.Hex(), d.To.Hex(), d.CostUSD, d.Reason)
+	} else {
+		log.Printf("🚫 Refused sponsorship of %s for %s on %s [%s]: %s", methodName(d), d.Passenger.Hex(), d.To.Hex(), d.Rule, d.Reason)
+	}
+	return d
+}
+
+// Release frees the slot and cost Check reserved for a transaction that
+// will not be sent, e.g. because Alchemy refused it. A reservation already
+// committed, released or lapsed is ignored.
+func (e *RuleEngine) Release(reservation string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rollover(e.now())
+	if _, ok := e.ledger.Reserved[reservation]; !ok {
+		return
+	}
+	delete(e.ledger.Reserved, reservation)
+	e.tally()
+	if err := e.save(); err != nil {
+		log.Printf("⚠️  Failed to save gas ledger: %v", err)
+	}
+}
+
+// Commit charges a mined transaction to its passenger's cap and the daily
+// budget in place of the reservation Check made. req describes the
+// transaction as sent, with the gas it used and the price paid, so the
+// budget sees the actual cost. The caps are not checked again: the gas is
+// already spent. A transaction the rules would never sponsor is not
+// charged, and one already charged returns ErrCommitted.
+func (e *RuleEngine) Commit(ctx context.Context, tx common.Hash, req SponsorshipRequest) (Decision, error) {
+	d := e.check(ctx, req)
+	d.TxHash = tx.Hex()
+	if !d.Sponsored && d.Rule != RuleCost {
+		return d, fmt.Errorf("not a sponsored transaction [%s]: %s", d.Rule, d.Reason)
+	}
+	// Without a price the passenger is still counted, but the budget cannot
+	// be charged
+	var valueErr error
+	if !d.Sponsored {
+		valueErr = fmt.Errorf("gas of %s is not charged to the budget: %s", d.TxHash, d.Reason)
+		d.Sponsored, d.Rule = true, RuleAllowed
+	}
+
+	e.mu.Lock()
+	now := e.now()
+	e.rollover(now)
+	if _, ok := e.ledger.Committed[d.TxHash]; ok {
+		e.mu.Unlock()
+		return d, ErrCommitted
+	}
+	if id := e.reservationFor(req.Reservation, d.Passenger.Hex()); id != "" {
+		delete(e.ledger.Reserved, id)
+		e.tally()
+	}
+	e.ledger.Committed[d.TxHash] = Charge{CostUSD: d.CostUSD, At: now}
+	e.ledger.Sponsored++
+	e.ledger.SpentUSD += d.CostUSD
+	e.ledger.Passengers[d.Passenger.Hex()]++
+	spent := e.ledger.SpentUSD
+	if err := e.save(); err != nil {
+		log.Printf("⚠️  Failed to save gas ledger: %v", err)
+	}
+	e.mu.Unlock()
+
+	log.Printf("⛽ Sponsored %s for %s on %s in %s ($%.4f, $%.4f today)", methodName(d), d.Passenger.Hex(), d.To.Hex(), d.TxHash, d.CostUSD, spent)
+	if valueErr != nil {
+		log.Printf("⚠️  %v", valueErr)
+	}
+	return d, valueErr
+}
+
+// Usage reports today's sponsorship against the rules
+func (e *RuleEngine) Usage() RuleUsage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rollover(e.now())
+	usage := e.ledger
+	usage.Passengers = make(map[string]int, len(e.ledger.Passengers))
+	for passenger, n := range e.ledger.Passengers {
+		usage.Passengers[passenger] = n
+	}
+	usage.Reserved = make(map[string]Reservation, len(e.ledger.Reserved))
+	for id, r := range e.ledger.Reserved {
+		usage.Reserved[id] = r
+	}
+	usage.Committed = make(map[string]Charge, len(e.ledger.Committed))
+	for tx, charge := range e.ledger.Committed {
+		usage.Committed[tx] = charge
+	}
+	return usage
+}
+
+// check applies the rules that do not depend on today's counts
+func (e *RuleEngine) check(ctx context.Context, req SponsorshipRequest) Decision {
+	d := Decision{To: req.To, Passenger: req.Passenger, Day: day(e.now())}
+	if d.Passenger == (common.Address{}) {
+		d.Passenger = req.From
+	}
+
+	methods, ok := e.contracts[req.To]
+	if !ok {
+		return refuse(d, RuleRecipient, "recipient is not a sponsored contract")
+	}
+	if len(req.Data) < 4 {
+		return refuse(d, RuleMethod, "transaction calls no method")
+	}
+	var selector [4]byte
+	copy(selector[:], req.Data[:4])
+	m, ok := methods[selector]
+	if !ok {
+		return refuse(d, RuleMethod, fmt.Sprintf("method 0x%x is not allowlisted for this contract", selector))
+	}
+	d.Method = m.signature
+	if req.Passenger == (common.Address{}) && m.firstIsAddress && len(req.Data) >= 36 {
+		d.Passenger = common.BytesToAddress(req.Data[16:36])
+	}
+
+	if req.Gas > 0 && req.GasPrice != nil && e.oracle != nil {
+		quote, err := e.oracle.Price(ctx)
+		if err != nil && e.rules.DailyBudgetUSD > 0 {
+			return refuse(d, RuleCost, fmt.Sprintf("no POL price to value the gas: %v", err))
+		}
+		if err == nil {
+			wei := new(big.Int).Mul(new(big.Int).SetUint64(req.Gas), req.GasPrice)
+			pol, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+			d.CostUSD = quote.Value(pol)
+		}
+	} else if e.rules.DailyBudgetUSD > 0 {
+		return refuse(d, RuleCost, "gas and gas price are needed to check the daily budget")
+	}
+
+	d.Sponsored, d.Rule, d.Reason = true, RuleAllowed, "allowlisted method within today's caps"
+	return d
+}
+
+func refuse(d Decision, rule, reason string) Decision {
+	d.Sponsored, d.Rule, d.Reason = false, rule, reason
+	return d
+}
+
+// rollover starts a new day's counts on a new day and drops lapsed
+// reservations; callers hold e.mu. Reservations count against the day they
+// were made, so they do not carry over, but committed transactions do
+// until they are older than commitRetention.
+func (e *RuleEngine) rollover(now time.Time) {
+	if today := day(now); e.ledger.Day != today {
+		e.ledger = RuleUsage{Day: today, Committed: e.ledger.Committed}
+		for tx, charge := range e.ledger.Committed {
+			if now.Sub(charge.At) > commitRetention {
+				delete(e.ledger.Committed, tx)
+			}
+		}
+	}
+	if e.ledger.Passengers == nil {
+		e.ledger.Passengers = make(map[string]int)
+	}
+	if e.ledger.Reserved == nil {
+		e.ledger.Reserved = make(map[string]Reservation)
+	}
+	if e.ledger.Committed == nil {
+		e.ledger.Committed = make(map[string]Charge)
+	}
+	for id, r := range e.ledger.Reserved {
+		if now.After(r.ExpiresAt) {
+			log.Printf("⌛ Reservation %s for %s lapsed uncommitted", id, r.Passenger)
+			delete(e.ledger.Reserved, id)
+		}
+	}
+	e.tally()
+	e.ledger.DailyBudgetUSD, e.ledger.PassengerDailyCap = e.rules.DailyBudgetUSD, e.rules.PassengerDailyCap
+}
+
+// tally totals the open reservations; callers hold e.mu
+func (e *RuleEngine) tally() {
+	e.ledger.ReservedUSD = 0
+	for _, r := range e.ledger.Reserved {
+		e.ledger.ReservedUSD += r.CostUSD
+	}
+}
+
+// held counts a passenger's open reservations; callers hold e.mu
+func (e *RuleEngine) held(passenger string) int {
+	n := 0
+	for _, r := range e.ledger.Reserved {
+		if r.Passenger == passenger {
+			n++
+		}
+	}
+	return n
+}
+
+// reservationFor finds the reservation a commit replaces: the one named,
+// or else the passenger's oldest. Callers hold e.mu.
+func (e *RuleEngine) reservationFor(id, passenger string) string {
+	if id != "" {
+		if _, ok := e.ledger.Reserved[id]; ok {
+			return id
+		}
+		return ""
+	}
+	var oldest string
+	for id, r := range e.ledger.Reserved {
+		if r.Passenger == passenger && (oldest == "" || r.ExpiresAt.Before(e.ledger.Reserved[oldest].ExpiresAt)) {
+			oldest = id
+		}
+	}
+	return oldest
+}
+
+func newReservationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// save writes the ledger atomically; callers hold e.mu
+func (e *RuleEngine) save() error {
+	if e.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(e.path), "."+filepath.Base(e.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+func methodName(d Decision) string {
+	if d.Method == "" {
+		return "transaction"
+	}
+	return d.Method
+}
@@ -0,0 +1,140 @@
+package gas
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/mpolobe/africa-railways/pkg/price"
+)
+
+var (
+	ticketNFT = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	passenger = common.HexToAddress("0xAbC0000000000000000000000000000000000001")
+)
+
+// mint is a safeMint(address,string) call for to, at polCost POL of gas
+func mint(to common.Address, polCost float64) SponsorshipRequest {
+	data := append(crypto.Keccak256([]byte("safeMint(address,string)"))[:4], common.LeftPadBytes(to.Bytes(), 32)...)
+	gasPrice, _ := new(big.Float).Mul(big.NewFloat(polCost), big.NewFloat(1e13)).Int(nil)
+	return SponsorshipRequest{To: ticketNFT, Data: data, Gas: 100_000, GasPrice: gasPrice}
+}
+
+func newTestEngine(t *testing.T, rules Rules, path string) (*RuleEngine, *time.Time) {
+	t.Helper()
+	rules.Contracts = map[string][]string{ticketNFT.Hex(): {"safeMint(address,string)"}}
+	e, err := NewRuleEngine(rules, price.Static{USD: 0.5}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 23, 50, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	return e, &now
+}
+
+func TestRuleEngineReservesOnCheck(t *testing.T) {
+	ctx := context.Background()
+	e, now := newTestEngine(t, Rules{PassengerDailyCap: 1}, "")
+
+	first := e.Check(ctx, mint(passenger, 1))
+	if !first.Sponsored || first.Reservation == "" {
+		t.Fatalf("first check = %+v, want sponsored with a reservation", first)
+	}
+	// The slot is held before the first transaction is mined
+	if d := e.Check(ctx, mint(passenger, 1)); d.Sponsored || d.Rule != RulePassengerCap {
+		t.Errorf("second check = %s, want refused by the passenger cap", d.Rule)
+	}
+
+	e.Release(first.Reservation)
+	second := e.Check(ctx, mint(passenger, 1))
+	if !second.Sponsored {
+		t.Fatalf("check after release refused: %s", second.Reason)
+	}
+	// An unsent transaction gives its slot back once the reservation lapses
+	*now = now.Add(ReservationTTL + time.Second)
+	if usage := e.Usage(); len(usage.Reserved) != 0 {
+		t.Errorf("%d reservations after the TTL, want none", len(usage.Reserved))
+	}
+	third := e.Check(ctx, mint(passenger, 1))
+	if !third.Sponsored {
+		t.Fatalf("check after the lapse refused: %s", third.Reason)
+	}
+
+	req := mint(passenger, 1)
+	req.Reservation = third.Reservation
+	if _, err := e.Commit(ctx, common.HexToHash("0x01"), req); err != nil {
+		t.Fatal(err)
+	}
+	usage := e.Usage()
+	if len(usage.Reserved) != 0 || usage.Passengers[passenger.Hex()] != 1 || usage.Sponsored != 1 {
+		t.Errorf("after commit: %d reserved, %d for the passenger, %d sponsored, want 0, 1, 1",
+			len(usage.Reserved), usage.Passengers[passenger.Hex()], usage.Sponsored)
+	}
+}
+
+func TestRuleEngineReservesBudget(t *testing.T) {
+	ctx := context.Background()
+	e, _ := newTestEngine(t, Rules{DailyBudgetUSD: 0.8}, "")
+
+	// Each check is estimated at 1 POL, $0.50
+	first := e.Check(ctx, mint(passenger, 1))
+	if !first.Sponsored {
+		t.Fatalf("first check refused: %s", first.Reason)
+	}
+	other := common.HexToAddress("0xAbC0000000000000000000000000000000000002")
+	if d := e.Check(ctx, mint(other, 1)); d.Rule != RuleDailyBudget {
+		t.Errorf("second check = %s, want refused by the reserved budget", d.Rule)
+	}
+
+	// Commit charges the gas used rather than the estimate, here $0.10,
+	// without naming the reservation
+	if _, err := e.Commit(ctx, common.HexToHash("0x01"), mint(passenger, 0.2)); err != nil {
+		t.Fatal(err)
+	}
+	usage := e.Usage()
+	if usage.ReservedUSD != 0 || usage.SpentUSD < 0.0999 || usage.SpentUSD > 0.1001 {
+		t.Errorf("after commit: $%.4f reserved, $%.4f spent, want $0 and $0.10", usage.ReservedUSD, usage.SpentUSD)
+	}
+	if d := e.Check(ctx, mint(other, 1)); !d.Sponsored {
+		t.Errorf("check with the headroom back refused: %s", d.Reason)
+	}
+}
+
+func TestRuleEngineCommittedAcrossDays(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gas-ledger.json")
+	e, now := newTestEngine(t, Rules{PassengerDailyCap: 5}, path)
+
+	d := e.Check(ctx, mint(passenger, 1))
+	req := mint(passenger, 1)
+	req.Reservation = d.Reservation
+	tx := common.HexToHash("0x01")
+	if _, err := e.Commit(ctx, tx, req); err != nil {
+		t.Fatal(err)
+	}
+	// An open reservation belongs to the day it was made
+	e.Check(ctx, mint(passenger, 1))
+
+	// A retry after midnight, and after a restart, is not charged to the new day
+	*now = now.Add(20 * time.Minute)
+	restarted, _ := newTestEngine(t, Rules{PassengerDailyCap: 5}, path)
+	restarted.now = e.now
+	if _, err := restarted.Commit(ctx, tx, req); !errors.Is(err, ErrCommitted) {
+		t.Errorf("commit after midnight = %v, want ErrCommitted", err)
+	}
+	usage := restarted.Usage()
+	if usage.Day != "2026-03-02" || usage.Sponsored != 0 || len(usage.Reserved) != 0 {
+		t.Errorf("new day = %s with %d sponsored and %d reserved, want 2026-03-02 with none",
+			usage.Day, usage.Sponsored, len(usage.Reserved))
+	}
+
+	*now = now.Add(commitRetention + 24*time.Hour)
+	if usage := restarted.Usage(); len(usage.Committed) != 0 {
+		t.Errorf("%d committed transactions kept past the retention, want none", len(usage.Committed))
+	}
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/qr"
+)
+
+// Ticket artwork dimensions in SVG user units
+const (
+	imageWidth  = 800
+	imageHeight = 400
+	qrSide      = 300
+)
+
+// RenderSVG draws the ticket NFT's image: route, class, seat and departure
+// beside a QR code of the signed verification payload. The output depends
+// only on its inputs, so the same ticket always pins to the same CID.
+func RenderSVG(ticket TicketDetails, signedPayload string) ([]byte, error) {
+	code, err := qr.Encode([]byte(signedPayload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif">`,
+		imageWidth, imageHeight, imageWidth, imageHeight)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" rx="24" fill="#FFFFFF" stroke="#0B3D2E" stroke-width="4"/>`, imageWidth, imageHeight)
+	b.WriteString(`<path d="M0 24a24 24 0 0 1 24-24h752a24 24 0 0 1 24 24v40h-800z" fill="#0B3D2E"/>`)
+	b.WriteString(`<text x="32" y="44" font-size="24" font-weight="bold" fill="#F2C230">AFRICA RAILWAYS</text>`)
+	text(&b, 768, 44, 18, "#FFFFFF", "end", "Ticket #"+ticket.TicketID)
+
+	text(&b, 32, 120, 30, "#0B3D2E", "", ticket.RouteFrom)
+	text(&b, 32, 160, 30, "#0B3D2E", "", "→ "+ticket.RouteTo)
+
+	rows := []struct{ label, value string }{
+		{"CLASS", ticket.Class},
+		{"SEAT", ticket.SeatNumber},
+		{"DEPARTS", ticket.DepartureTime.Format("Mon 02 Jan 2006 15:04 MST")},
+	}
+	for i, row := range rows {
+		y := 215 + i*55
+		text(&b, 32, y, 14, "#6B7A73", "", row.label)
+		text(&b, 32, y+24, 22, "#1A1A1A", "", row.value)
+	}
+
+	// The QR code keeps its quiet zone inside a nested viewBox, one unit per
+	// module, so it scales without rounding
+	side := code.Size + 2*qr.QuietZone
+	fmt.Fprintf(&b, `<svg x="%d" y="%d" width="%d" height="%d" viewBox="-%d -%d %d %d" shape-rendering="crispEdges">`,
+		imageWidth-qrSide-32, 80, qrSide, qrSide, qr.QuietZone, qr.QuietZone, side, side)
+	fmt.Fprintf(&b, `<rect x="-%d" y="-%d" width="%d" height="%d" fill="#FFFFFF"/><path fill="#000000" d="`, qr.QuietZone, qr.QuietZone, side, side)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	text(&b, imageWidth-qrSide/2-32, 380+4, 12, "#6B7A73", "middle", "Scan to verify")
+	b.WriteString(`</svg>`)
+	return b.Bytes(), nil
+}
+
+// text writes an escaped <text> element; anchor may be empty
+func text(b *bytes.Buffer, x, y, size int, fill, anchor, content string) {
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="%d" fill="%s"`, x, y, size, fill)
+	if anchor != "" {
+		fmt.Fprintf(b, ` text-anchor="%s"`, anchor)
+	}
+	b.WriteString(">")
+	xml.EscapeText(b, []byte(content))
+	b.WriteString("</text>")
+}
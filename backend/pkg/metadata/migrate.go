@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// migrations upgrade metadata from the version they are keyed by to the
+// next one
+var migrations = map[int]func(*TicketMetadata) error{
+	1: migrateV1,
+}
+
+// Migrate upgrades metadata in place to SchemaVersion and validates it
+func Migrate(m *TicketMetadata) error {
+	for v := m.Version(); v != SchemaVersion; v = m.Version() {
+		migrate, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("%w: no migration from schema version %d to %d", ErrInvalidMetadata, v, SchemaVersion)
+		}
+		if err := migrate(m); err != nil {
+			return fmt.Errorf("%w: migrating from schema version %d: %v", ErrInvalidMetadata, v, err)
+		}
+	}
+	return m.Validate()
+}
+
+// ParseMetadata decodes pinned metadata of any schema version and returns
+// it migrated to the current one
+func ParseMetadata(data []byte) (*TicketMetadata, error) {
+	var m TicketMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	if err := Migrate(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// legacyCurrency is what version 1 metadata without a currency was priced
+// in; every ticket sold before currencies were recorded was in rand
+const legacyCurrency = "ZAR"
+
+// migrateV1 upgrades what GenerateMetadata and uploader.CreateTicketMetadata
+// wrote before schema versions: it drops the year-1 Arrival written for
+// tickets without one, fills in a missing Currency and fixes value types
+// and display types.
+func migrateV1(m *TicketMetadata) error {
+	attrs := make([]TicketAttribute, 0, len(m.Attributes)+1)
+	hasCurrency := false
+	for _, attr := range m.Attributes {
+		switch attr.TraitType {
+		case "Departure", "Arrival":
+			n, ok := integer(attr.Value)
+			if !ok {
+				return fmt.Errorf("%s is not a Unix timestamp", attr.TraitType)
+			}
+			if n <= 0 && attr.TraitType == "Arrival" {
+				continue
+			}
+			attr.Value, attr.DisplayType = n, "date"
+		case "Price":
+			if s, ok := attr.Value.(string); ok {
+				f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					return fmt.Errorf("Price %q is not a number", s)
+				}
+				attr.Value = f
+			}
+			attr.DisplayType = "number"
+		case "Currency":
+			code := strings.ToUpper(strings.TrimSpace(str(attr.Value)))
+			if code == "" {
+				code = legacyCurrency
+			}
+			attr.Value = code
+			hasCurrency = true
+		}
+		attrs = append(attrs, attr)
+	}
+	if !hasCurrency {
+		attrs = append(attrs, TicketAttribute{TraitType: "Currency", Value: legacyCurrency})
+	}
+	m.Attributes = append(attrs, TicketAttribute{TraitType: SchemaVersionTrait, Value: 2})
+	return nil
+}
@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// v1Metadata is what uploader.CreateTicketMetadata pinned before schema
+// versions: a string price, no currency and a year-1 arrival
+const v1Metadata = `{
+  "name": "Africa Railways: Ticket #1024",
+  "description": "Standard Class Ticket - Johannesburg to Cape Town",
+  "image": "ipfs://bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e",
+  "attributes": [
+    {"trait_type": "Route", "value": "JHB-CPT"},
+    {"trait_type": "Class", "value": "Standard"},
+    {"trait_type": "Seat", "value": "14A"},
+    {"trait_type": "Departure", "value": 1735017600},
+    {"trait_type": "Arrival", "value": -62135596800},
+    {"trait_type": "Price", "value": "450.00"}
+  ]
+}`
+
+func TestParseMetadataMigratesV1(t *testing.T) {
+	m, err := ParseMetadata([]byte(v1Metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TicketAttribute{
+		{TraitType: "Route", Value: "JHB-CPT"},
+		{TraitType: "Class", Value: "Standard"},
+		{TraitType: "Seat", Value: "14A"},
+		{TraitType: "Departure", Value: int64(1735017600), DisplayType: "date"},
+		{TraitType: "Price", Value: 450.0, DisplayType: "number"},
+		{TraitType: "Currency", Value: legacyCurrency},
+		{TraitType: SchemaVersionTrait, Value: 2},
+	}
+	if !reflect.DeepEqual(m.Attributes, want) {
+		t.Errorf("migrated attributes:\n got %#v\nwant %#v", m.Attributes, want)
+	}
+	if m.Version() != SchemaVersion {
+		t.Errorf("version = %d, want %d", m.Version(), SchemaVersion)
+	}
+
+	// Migrating again changes nothing
+	if err := Migrate(m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Attributes, want) {
+		t.Errorf("second migration changed attributes to %#v", m.Attributes)
+	}
+}
+
+func TestParseMetadataKeepsV1Currency(t *testing.T) {
+	doc := `{"name": "n", "description": "d", "image": "https://africarailways.com/t.svg", "attributes": [
+	  {"trait_type": "Route", "value": "LUN-NDL"}, {"trait_type": "Class", "value": "Economy"},
+	  {"trait_type": "Seat", "value": "3B"}, {"trait_type": "Departure", "value": 1735017600},
+	  {"trait_type": "Price", "value": 120}, {"trait_type": "Currency", "value": " zmw "}]}`
+	m, err := ParseMetadata([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range m.Attributes {
+		if attr.TraitType == "Currency" && attr.Value != "ZMW" {
+			t.Errorf("Currency = %v, want ZMW", attr.Value)
+		}
+	}
+}
+
+func TestParseMetadataRejects(t *testing.T) {
+	for name, doc := range map[string]string{
+		"not JSON":         `{"name":`,
+		"future version":   `{"attributes": [{"trait_type": "schema_version", "value": 3}]}`,
+		"bad v1 price":     `{"attributes": [{"trait_type": "Price", "value": "free"}]}`,
+		"bad v1 departure": `{"attributes": [{"trait_type": "Departure", "value": "tomorrow"}]}`,
+		"v1 missing seat": `{"name": "n", "description": "d", "image": "https://africarailways.com/t.svg", "attributes": [
+		  {"trait_type": "Route", "value": "JHB-CPT"}, {"trait_type": "Class", "value": "Economy"},
+		  {"trait_type": "Departure", "value": 1735017600}, {"trait_type": "Price", "value": 450}]}`,
+	} {
+		if _, err := ParseMetadata([]byte(doc)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: ParseMetadata = %v, want ErrInvalidMetadata", name, err)
+		}
+	}
+}
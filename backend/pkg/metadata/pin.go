@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
+)
+
+// PinnedTicket is a ticket's artwork and metadata once both are on IPFS
+type PinnedTicket struct {
+	Metadata    *TicketMetadata
+	Image       storage.Pin
+	MetadataPin storage.Pin
+	// Payload is the signed string in the QR code
+	Payload string
+}
+
+// TokenURI is the ipfs:// URI to mint the ticket NFT with
+func (p *PinnedTicket) TokenURI() string {
+	return p.MetadataPin.CID.URI()
+}
+
+// PinMetadata validates metadata and pins it. Every upload of ticket
+// metadata goes through here, so nothing malformed is pinned for good.
+func PinMetadata(ctx context.Context, pinner storage.Pinner, name string, meta *TicketMetadata) (storage.Pin, error) {
+	if err := meta.Validate(); err != nil {
+		return storage.Pin{}, err
+	}
+	return pinner.PinJSON(ctx, name, meta)
+}
+
+// PreparedTicket is a ticket's artwork and metadata, rendered, validated
+// and addressed but not yet pinned
+type PreparedTicket struct {
+	TicketID     string
+	Metadata     *TicketMetadata
+	Payload      string // The signed string in the QR code
+	Image        storage.UploadFile
+	MetadataFile storage.UploadFile
+	// JourneyEnd starts the retention window for the ticket's pins
+	JourneyEnd time.Time
+}
+
+// Job is the upload job that pins the artwork and then the metadata
+func (p *PreparedTicket) Job() storage.UploadJob {
+	return storage.UploadJob{
+		Ref:        p.TicketID,
+		Files:      []storage.UploadFile{p.Image, p.MetadataFile},
+		JourneyEnd: p.JourneyEnd,
+	}
+}
+
+// TokenURI is the ipfs:// URI to mint with, once job has pinned both files
+// at their expected CIDs. It is an error before then: a token minted
+// earlier could point at content that never reaches IPFS.
+func (p *PreparedTicket) TokenURI(job storage.UploadJob) (string, error) {
+	if !job.Verified() {
+		return "", fmt.Errorf("ticket %s is not uploaded yet (%s)", p.TicketID, job.Status)
+	}
+	for _, f := range job.Files {
+		if f.CID == p.MetadataFile.CID {
+			return f.CID.URI(), nil
+		}
+	}
+	return "", fmt.Errorf("upload %s is not ticket %s's", job.ID, p.TicketID)
+}
+
+// PrepareTicket renders the ticket image and metadata whose image is the
+// artwork's ipfs:// URI, with CIDs computed as pinner will pin them, and
+// validates the metadata. Nothing is uploaded.
+//
+// With a vault the ticket is private: the passenger's details are sealed in
+// the vault, and the metadata and QR code carry only a commitment. Without
+// one, Passenger and Phone are public attributes as GenerateMetadata writes
+// them.
+func PrepareTicket(pinner storage.Pinner, vault PIIVault, ticket TicketDetails, key ed25519.PrivateKey) (*PreparedTicket, error) {
+	verification := NewVerificationPayload(ticket)
+	var rec *PassengerRecord
+	if vault != nil {
+		var err error
+		if rec, err = NewPassengerRecord(ticket); err != nil {
+			return nil, err
+		}
+		verification.Passenger = rec.Commitment
+	}
+
+	payload, err := verification.Sign(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ticket: %w", err)
+	}
+	svg, err := RenderSVG(ticket, payload)
+	if err != nil {
+		return nil, err
+	}
+	imageCID, err := pinner.CIDFor(svg)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket.ImageURI = imageCID.URI()
+	meta := GenerateMetadata(ticket)
+	if rec != nil {
+		meta = GeneratePrivateMetadata(ticket, rec.Commitment)
+	}
+	if err := meta.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := storage.MarshalJSON(meta)
+	if err != nil {
+		return nil, err
+	}
+	metaCID, err := pinner.CIDFor(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sealed only once the ticket is known to be publishable
+	if rec != nil {
+		if err := vault.Put(rec); err != nil {
+			return nil, fmt.Errorf("failed to store passenger record: %w", err)
+		}
+	}
+	journeyEnd := ticket.ArrivalTime
+	if journeyEnd.IsZero() {
+		journeyEnd = ticket.DepartureTime
+	}
+	return &PreparedTicket{
+		TicketID:     ticket.TicketID,
+		Metadata:     meta,
+		Payload:      payload,
+		Image:        storage.UploadFile{Name: "ticket-" + ticket.TicketID + ".svg", Data: svg, CID: imageCID},
+		MetadataFile: storage.UploadFile{Name: "ticket-" + ticket.TicketID + ".json", Data: data, CID: metaCID},
+		JourneyEnd:   journeyEnd,
+	}, nil
+}
+
+// QueueTicket prepares a ticket and queues its upload. Mint with
+// PreparedTicket.TokenURI once the job is done.
+func QueueTicket(queue *storage.UploadQueue, vault PIIVault, ticket TicketDetails, key ed25519.PrivateKey) (*PreparedTicket, storage.UploadJob, error) {
+	prepared, err := PrepareTicket(queue.Pinner(), vault, ticket, key)
+	if err != nil {
+		return nil, storage.UploadJob{}, err
+	}
+	job, err := queue.Enqueue(prepared.Job())
+	if err != nil {
+		return nil, storage.UploadJob{}, err
+	}
+	return prepared, job, nil
+}
+
+// PinTicket prepares a ticket and pins it now: the image first, so the
+// metadata never points at content that failed to upload. Each pin must
+// come back at its expected CID, as the metadata already names the image's.
+// Use QueueTicket where an upload failure should be retried rather than
+// fail the sale.
+func PinTicket(ctx context.Context, pinner storage.Pinner, vault PIIVault, ticket TicketDetails, key ed25519.PrivateKey) (*PinnedTicket, error) {
+	prepared, err := PrepareTicket(pinner, vault, ticket, key)
+	if err != nil {
+		return nil, err
+	}
+	var pins [2]storage.Pin
+	for i, f := range []storage.UploadFile{prepared.Image, prepared.MetadataFile} {
+		pin, err := pinner.PinFile(ctx, f.Name, f.Data)
+		switch {
+		case err != nil:
+		case pin.CID != f.CID:
+			err = fmt.Errorf("%w: %s returned %s, expected %s", storage.ErrCIDMismatch, pinner.Name(), pin.CID, f.CID)
+		case !pin.Verified:
+			err = fmt.Errorf("%w: %s from %s", storage.ErrUnverified, pin.CID, pinner.Name())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to pin %s: %w", f.Name, err)
+		}
+		pins[i] = pin
+	}
+
+	// A managed pinner releases the ticket's pins a retention window after
+	// the journey
+	if tracker, ok := pinner.(storage.JourneyTracker); ok {
+		if err := tracker.TrackJourney(ticket.TicketID, prepared.JourneyEnd); err != nil {
+			log.Printf("⚠️  Ticket %s pins will not expire: %v", ticket.TicketID, err)
+		}
+	}
+	return &PinnedTicket{Metadata: prepared.Metadata, Image: pins[0], MetadataPin: pins[1], Payload: prepared.Payload}, nil
+}
@@ -0,0 +1,134 @@
+package metadata
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Identity kinds a passenger commitment can cover
+const (
+	IdentityIDNumber = "id" // National ID or passport number
+	IdentityPhone    = "phone"
+)
+
+// commitmentDomain separates passenger commitments from any other HMAC
+// made with the same salt
+const commitmentDomain = "africa-railways/passenger/v1|"
+
+var ErrNoIdentity = errors.New("ticket has no passenger ID number or phone to commit to")
+
+// PassengerRecord is the personal data behind a ticket. It never leaves the
+// PIIVault unencrypted; metadata and the QR code carry only Commitment.
+type PassengerRecord struct {
+	TicketID string `json:"ticket_id"`
+	Name     string `json:"name,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	IDNumber string `json:"id_number,omitempty"`
+	// Kind is the identity the commitment covers, IdentityIDNumber when the
+	// passenger gave one and IdentityPhone otherwise
+	Kind       string    `json:"kind"`
+	Salt       []byte    `json:"salt"`
+	Commitment string    `json:"commitment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewPassengerRecord draws a fresh salt and commits to the ticket's
+// passenger. The salt makes commitments unlinkable across tickets and stops
+// anyone without the vault from hashing every phone number to find a match.
+func NewPassengerRecord(ticket TicketDetails) (*PassengerRecord, error) {
+	rec := &PassengerRecord{
+		TicketID:  ticket.TicketID,
+		Name:      ticket.PassengerName,
+		Phone:     ticket.PassengerPhone,
+		IDNumber:  ticket.PassengerIDNumber,
+		Salt:      make([]byte, 32),
+		CreatedAt: time.Now().UTC(),
+	}
+	value := canonicalIDNumber(ticket.PassengerIDNumber)
+	rec.Kind = IdentityIDNumber
+	if value == "" {
+		value, rec.Kind = canonicalPhone(ticket.PassengerPhone), IdentityPhone
+	}
+	if value == "" {
+		return nil, ErrNoIdentity
+	}
+	if _, err := rand.Read(rec.Salt); err != nil {
+		return nil, err
+	}
+	rec.Commitment = commit(rec.Salt, rec.Kind, value)
+	return rec, nil
+}
+
+// Matches reports whether a presented identity is the one committed to.
+// The commitment comes from the signed QR code or the metadata, not from
+// the record, so a swapped record cannot vouch for someone else.
+func (r *PassengerRecord) Matches(commitment, kind, presented string) bool {
+	if kind != r.Kind {
+		return false
+	}
+	var value string
+	switch kind {
+	case IdentityIDNumber:
+		value = canonicalIDNumber(presented)
+	case IdentityPhone:
+		value = canonicalPhone(presented)
+	}
+	if value == "" {
+		return false
+	}
+	return hmac.Equal([]byte(commit(r.Salt, kind, value)), []byte(commitment))
+}
+
+// commit is base64url(HMAC-SHA256(salt, domain | kind:value))
+func commit(salt []byte, kind, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	fmt.Fprintf(mac, "%s%s:%s", commitmentDomain, kind, value)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalIDNumber ignores case, spaces and dashes, as ID numbers are
+// read off documents and typed by staff
+func canonicalIDNumber(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return -1
+	}, id)
+}
+
+// canonicalPhone keeps digits only, so "+27 82 000 0001" and
+// "27820000001" commit the same
+func canonicalPhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// GeneratePrivateMetadata is GenerateMetadata without the Passenger and
+// Phone attributes. The passenger appears only as a commitment, so nothing
+// personal is published to IPFS or the chain.
+func GeneratePrivateMetadata(ticket TicketDetails, commitment string) *TicketMetadata {
+	meta := GenerateMetadata(ticket)
+	attrs := meta.Attributes[:0]
+	for _, attr := range meta.Attributes {
+		if attr.TraitType == "Passenger" || attr.TraitType == "Phone" {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	meta.Attributes = append(attrs, TicketAttribute{TraitType: "Passenger Commitment", Value: commitment})
+	return meta
+}
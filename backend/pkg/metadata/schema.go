@@ -0,0 +1,242 @@
+package metadata
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mpolobe/africa-railways/backend/pkg/storage"
+)
+
+// SchemaVersion is the metadata schema GenerateMetadata writes. Metadata
+// without a schema_version attribute is version 1.
+const SchemaVersion = 2
+
+// SchemaVersionTrait is the attribute carrying the schema version
+const SchemaVersionTrait = "schema_version"
+
+// JSONSchema is the JSON Schema for SchemaVersion, for clients that validate
+// metadata themselves. Validate enforces the same rules.
+//
+//go:embed schema/ticket-metadata.v2.json
+var JSONSchema []byte
+
+var ErrInvalidMetadata = errors.New("invalid ticket metadata")
+
+// ValidationError lists everything wrong with a metadata document
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return ErrInvalidMetadata.Error() + ": " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidMetadata }
+
+// traitRule is how one known attribute is checked
+type traitRule struct {
+	required    bool
+	displayType string
+	check       func(value interface{}) string // Returns the problem, if any
+}
+
+var traitRules = map[string]traitRule{
+	SchemaVersionTrait: {required: true, check: func(v interface{}) string {
+		if n, ok := integer(v); !ok || n != SchemaVersion {
+			return fmt.Sprintf("must be %d", SchemaVersion)
+		}
+		return ""
+	}},
+	"Route": {required: true, check: func(v interface{}) string {
+		from, to, ok := strings.Cut(str(v), "-")
+		if !ok || !isCode(from) || !isCode(to) {
+			return `must be a route code like "JHB-CPT"`
+		}
+		return ""
+	}},
+	"Class":     {required: true, check: nonEmpty},
+	"Seat":      {required: true, check: nonEmpty},
+	"Departure": {required: true, displayType: "date", check: unixTime},
+	"Arrival":   {displayType: "date", check: unixTime},
+	"Price": {required: true, displayType: "number", check: func(v interface{}) string {
+		if n, ok := number(v); !ok || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return "must be a non-negative number"
+		}
+		return ""
+	}},
+	"Currency": {required: true, check: func(v interface{}) string {
+		s := str(v)
+		if len(s) < 3 || len(s) > 4 || strings.ToUpper(s) != s || !isCode(s) {
+			return `must be an upper-case currency code like "ZAR"`
+		}
+		return ""
+	}},
+	"Passenger Commitment": {check: nonEmpty},
+}
+
+// Validate checks metadata against the current schema. Run it before
+// pinning: anything that fails is unfixable once it is on IPFS.
+func (m *TicketMetadata) Validate() error {
+	var problems []string
+	if strings.TrimSpace(m.Name) == "" {
+		problems = append(problems, "name is empty")
+	}
+	if strings.TrimSpace(m.Description) == "" {
+		problems = append(problems, "description is empty")
+	}
+	if problem := checkImage(m.Image); problem != "" {
+		problems = append(problems, problem)
+	}
+	if m.ExternalURL != "" && !strings.HasPrefix(m.ExternalURL, "https://") && !strings.HasPrefix(m.ExternalURL, "http://") {
+		problems = append(problems, "external_url must be an http(s) URL")
+	}
+
+	seen := make(map[string]TicketAttribute)
+	for _, attr := range m.Attributes {
+		if attr.TraitType == "" {
+			problems = append(problems, "attribute without trait_type")
+			continue
+		}
+		if _, dup := seen[attr.TraitType]; dup {
+			problems = append(problems, fmt.Sprintf("%s appears more than once", attr.TraitType))
+			continue
+		}
+		seen[attr.TraitType] = attr
+		if _, isNumber := number(attr.Value); !isNumber {
+			if _, isString := attr.Value.(string); !isString {
+				problems = append(problems, fmt.Sprintf("%s must be a string or number", attr.TraitType))
+				continue
+			}
+		}
+		rule, known := traitRules[attr.TraitType]
+		if !known {
+			continue
+		}
+		if problem := rule.check(attr.Value); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %s", attr.TraitType, problem))
+		}
+		if rule.displayType != "" && attr.DisplayType != rule.displayType {
+			problems = append(problems, fmt.Sprintf("%s must have display_type %q", attr.TraitType, rule.displayType))
+		}
+	}
+	for trait, rule := range traitRules {
+		if _, ok := seen[trait]; rule.required && !ok {
+			problems = append(problems, fmt.Sprintf("%s is missing", trait))
+		}
+	}
+
+	if arrival, ok := seen["Arrival"]; ok {
+		a, _ := integer(arrival.Value)
+		d, _ := integer(seen["Departure"].Value)
+		if a < d {
+			problems = append(problems, "Arrival is before Departure")
+		}
+	}
+	if _, private := seen["Passenger Commitment"]; private {
+		for _, trait := range []string{"Passenger", "Phone"} {
+			if _, ok := seen[trait]; ok {
+				problems = append(problems, fmt.Sprintf("%s is published on a private ticket", trait))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	// Map iteration makes the missing-attribute order random
+	sort.Strings(problems)
+	return &ValidationError{Problems: problems}
+}
+
+// checkImage accepts the ipfs:// URI of a well-formed CID or an https URL
+func checkImage(image string) string {
+	switch {
+	case image == "":
+		return "image is empty"
+	case strings.HasPrefix(image, "ipfs://"):
+		cid, err := storage.ParseCID(image)
+		if err == nil {
+			_, _, err = cid.Decode()
+		}
+		if err != nil {
+			return fmt.Sprintf("image %q is not a valid IPFS CID", image)
+		}
+	case !strings.HasPrefix(image, "https://"):
+		return "image must be an ipfs:// URI or https URL"
+	}
+	return ""
+}
+
+// Version is the schema version the metadata declares
+func (m *TicketMetadata) Version() int {
+	for _, attr := range m.Attributes {
+		if attr.TraitType == SchemaVersionTrait {
+			if n, ok := integer(attr.Value); ok {
+				return int(n)
+			}
+			return 0
+		}
+	}
+	return 1
+}
+
+func nonEmpty(v interface{}) string {
+	if strings.TrimSpace(str(v)) == "" {
+		return "is empty"
+	}
+	return ""
+}
+
+func unixTime(v interface{}) string {
+	if n, ok := integer(v); !ok || n <= 0 {
+		return "must be a Unix timestamp"
+	}
+	return ""
+}
+
+func isCode(s string) bool {
+	if s == "" || len(s) > 4 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// number accepts the numeric types metadata values have in Go and after a
+// JSON round trip
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func integer(v interface{}) (int64, bool) {
+	f, ok := number(v)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, false
+	}
+	return int64(f), true
+}
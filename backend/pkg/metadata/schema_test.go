@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validTicket() TicketDetails {
+	return TicketDetails{
+		TicketID:       "1024",
+		PassengerName:  "John Doe",
+		PassengerPhone: "+27123456789",
+		RouteFrom:      "Johannesburg",
+		RouteTo:        "Cape Town",
+		DepartureTime:  time.Unix(1735017600, 0),
+		ArrivalTime:    time.Unix(1735088400, 0),
+		SeatNumber:     "14A",
+		Class:          "Standard",
+		Price:          450,
+		Currency:       "ZAR",
+		ImageURI:       "ipfs://bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e",
+	}
+}
+
+func TestGeneratedMetadataValidates(t *testing.T) {
+	if err := GenerateMetadata(validTicket()).Validate(); err != nil {
+		t.Errorf("with arrival: %v", err)
+	}
+	ticket := validTicket()
+	ticket.ArrivalTime = time.Time{}
+	m := GenerateMetadata(ticket)
+	if err := m.Validate(); err != nil {
+		t.Errorf("without arrival: %v", err)
+	}
+	for _, attr := range m.Attributes {
+		if attr.TraitType == "Arrival" {
+			t.Error("a zero arrival was published")
+		}
+	}
+}
+
+func TestExampleValidates(t *testing.T) {
+	data, err := os.ReadFile("examples/ticket-metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseMetadata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version() != SchemaVersion {
+		t.Errorf("example is version %d, want %d", m.Version(), SchemaVersion)
+	}
+	if !json.Valid(JSONSchema) {
+		t.Error("embedded JSON Schema is not valid JSON")
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(m *TicketMetadata)
+		want   []string
+	}{
+		{"empty name", func(m *TicketMetadata) { m.Name = " " }, []string{"name is empty"}},
+		{"bad image", func(m *TicketMetadata) { m.Image = "ipfs://not-a-cid" },
+			[]string{`image "ipfs://not-a-cid" is not a valid IPFS CID`}},
+		{"http image", func(m *TicketMetadata) { m.Image = "http://example.com/t.svg" },
+			[]string{"image must be an ipfs:// URI or https URL"}},
+		{"bad route", func(m *TicketMetadata) { set(m, "Route", "Johannesburg to Cape Town") },
+			[]string{`Route must be a route code like "JHB-CPT"`}},
+		{"negative price", func(m *TicketMetadata) { set(m, "Price", -1.0) },
+			[]string{"Price must be a non-negative number"}},
+		{"lower-case currency", func(m *TicketMetadata) { set(m, "Currency", "zar") },
+			[]string{`Currency must be an upper-case currency code like "ZAR"`}},
+		{"arrival first", func(m *TicketMetadata) { set(m, "Arrival", int64(1735000000)) },
+			[]string{"Arrival is before Departure"}},
+		{"missing seat", func(m *TicketMetadata) { remove(m, "Seat") }, []string{"Seat is missing"}},
+		{"wrong display type", func(m *TicketMetadata) { attr(m, "Departure").DisplayType = "" },
+			[]string{`Departure must have display_type "date"`}},
+		{"duplicate", func(m *TicketMetadata) {
+			m.Attributes = append(m.Attributes, TicketAttribute{TraitType: "Class", Value: "VIP"})
+		}, []string{"Class appears more than once"}},
+		{"old version", func(m *TicketMetadata) { set(m, SchemaVersionTrait, 1) },
+			[]string{"schema_version must be 2"}},
+		{"private with phone", func(m *TicketMetadata) {
+			m.Attributes = append(m.Attributes, TicketAttribute{TraitType: "Passenger Commitment", Value: "c0ffee"})
+		}, []string{"Passenger is published on a private ticket", "Phone is published on a private ticket"}},
+	}
+	for _, tc := range tests {
+		m := GenerateMetadata(validTicket())
+		tc.change(m)
+		var verr *ValidationError
+		if err := m.Validate(); !errors.As(err, &verr) || !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: Validate = %v, want a ValidationError", tc.name, err)
+		} else if !reflect.DeepEqual(verr.Problems, tc.want) {
+			t.Errorf("%s: problems = %q, want %q", tc.name, verr.Problems, tc.want)
+		}
+	}
+}
+
+func attr(m *TicketMetadata, trait string) *TicketAttribute {
+	for i := range m.Attributes {
+		if m.Attributes[i].TraitType == trait {
+			return &m.Attributes[i]
+		}
+	}
+	return nil
+}
+
+func set(m *TicketMetadata, trait string, value interface{}) {
+	attr(m, trait).Value = value
+}
+
+func remove(m *TicketMetadata, trait string) {
+	for i, a := range m.Attributes {
+		if a.TraitType == trait {
+			m.Attributes = append(m.Attributes[:i], m.Attributes[i+1:]...)
+			return
+		}
+	}
+}
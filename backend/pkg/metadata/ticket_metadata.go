@@ -28,6 +28,7 @@ type TicketDetails struct {
 	TicketID       string
 	PassengerName  string
 	PassengerPhone string
+	PassengerIDNumber string // National ID or passport, for private metadata
 	RouteFrom      string
 	RouteTo        string
 	DepartureTime  time.Time
@@ -36,17 +37,18 @@ type TicketDetails struct {
 	Class          string // "Economy", "Business", "VIP"
 	Price          float64
 	Currency       string
-	QRCode         string // Base64 encoded QR code or IPFS hash
+	ImageURI       string // ipfs:// URI of the artwork from RenderSVG
 }
 
-// GenerateMetadata creates NFT metadata from ticket details
+// GenerateMetadata creates NFT metadata from ticket details in the current
+// schema version. Call Validate before pinning it.
 func GenerateMetadata(ticket TicketDetails) *TicketMetadata {
 	// Format route code (e.g., "JHB-CPT")
 	routeCode := fmt.Sprintf("%s-%s", 
 		getRouteCode(ticket.RouteFrom), 
 		getRouteCode(ticket.RouteTo))
 
-	return &TicketMetadata{
+	meta := &TicketMetadata{
 		Name: fmt.Sprintf("Africa Railways: Ticket #%s", ticket.TicketID),
 		Description: fmt.Sprintf(
 			"%s Class Ticket - %s to %s",
@@ -54,7 +56,7 @@ func GenerateMetadata(ticket TicketDetails) *TicketMetadata {
 			ticket.RouteFrom,
 			ticket.RouteTo,
 		),
-		Image:       ticket.QRCode, // IPFS hash of ticket image/QR code
+		Image:       ticket.ImageURI, // Set by PinTicket
 		ExternalURL: fmt.Sprintf("https://africarailways.com/verify/%s", ticket.TicketID),
 		Attributes: []TicketAttribute{
 			{TraitType: "Route", Value: routeCode},
@@ -65,11 +67,6 @@ func GenerateMetadata(ticket TicketDetails) *TicketMetadata {
 				Value:       ticket.DepartureTime.Unix(),
 				DisplayType: "date",
 			},
-			{
-				TraitType:   "Arrival",
-				Value:       ticket.ArrivalTime.Unix(),
-				DisplayType: "date",
-			},
 			{TraitType: "Passenger", Value: ticket.PassengerName},
 			{TraitType: "Phone", Value: ticket.PassengerPhone},
 			{
@@ -78,8 +75,19 @@ func GenerateMetadata(ticket TicketDetails) *TicketMetadata {
 				DisplayType: "number",
 			},
 			{TraitType: "Currency", Value: ticket.Currency},
+			{TraitType: SchemaVersionTrait, Value: SchemaVersion},
 		},
 	}
+	// Arrival is optional; a zero time would otherwise publish year 1
+	if !ticket.ArrivalTime.IsZero() {
+		arrival := TicketAttribute{
+			TraitType:   "Arrival",
+			Value:       ticket.ArrivalTime.Unix(),
+			DisplayType: "date",
+		}
+		meta.Attributes = append(meta.Attributes[:4], append([]TicketAttribute{arrival}, meta.Attributes[4:]...)...)
+	}
+	return meta
 }
 
 // getRouteCode converts city names to 3-letter codes
@@ -0,0 +1,160 @@
+package metadata
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrRecordNotFound = errors.New("no passenger record for this ticket")
+
+// PIIVault keeps passenger records off-chain, keyed by ticket ID
+type PIIVault interface {
+	Put(rec *PassengerRecord) error
+	Get(ticketID string) (*PassengerRecord, error)
+	// Delete erases a passenger's data. The commitment already published
+	// can then no longer be linked to anyone.
+	Delete(ticketID string) error
+}
+
+// FileVault stores each record sealed with AES-256-GCM in a JSON file. The
+// ticket ID is authenticated with the record, so a ciphertext copied to
+// another ticket fails to open.
+type FileVault struct {
+	path    string
+	aead    cipher.AEAD
+	records map[string][]byte // Ticket ID to nonce || ciphertext
+	mu      sync.Mutex
+}
+
+// NewFileVault opens the vault at path with a 32-byte key, or keeps it in
+// memory if path is empty
+func NewFileVault(path string, key []byte) (*FileVault, error) {
+	if len(key) != 32 {
+		return nil, errors.New("vault key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	v := &FileVault{path: path, aead: aead, records: make(map[string][]byte)}
+	if path == "" {
+		return v, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &v.records); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// NewFileVaultFromEnv opens TICKET_PII_PATH (default ticket-pii.json) with
+// the hex key in TICKET_PII_KEY
+func NewFileVaultFromEnv() (*FileVault, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(os.Getenv("TICKET_PII_KEY"), "0x"))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("TICKET_PII_KEY must be a 32-byte hex key")
+	}
+	path := os.Getenv("TICKET_PII_PATH")
+	if path == "" {
+		path = "ticket-pii.json"
+	}
+	return NewFileVault(path, key)
+}
+
+func (v *FileVault) Put(rec *PassengerRecord) error {
+	plain, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := v.aead.Seal(nonce, nonce, plain, []byte(rec.TicketID))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	previous, existed := v.records[rec.TicketID]
+	v.records[rec.TicketID] = sealed
+	if err := v.save(); err != nil {
+		if existed {
+			v.records[rec.TicketID] = previous
+		} else {
+			delete(v.records, rec.TicketID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (v *FileVault) Get(ticketID string) (*PassengerRecord, error) {
+	v.mu.Lock()
+	sealed, ok := v.records[ticketID]
+	v.mu.Unlock()
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	n := v.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("corrupt passenger record")
+	}
+	plain, err := v.aead.Open(nil, sealed[:n], sealed[n:], []byte(ticketID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt passenger record: %w", err)
+	}
+	var rec PassengerRecord
+	if err := json.Unmarshal(plain, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (v *FileVault) Delete(ticketID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	sealed, ok := v.records[ticketID]
+	if !ok {
+		return nil
+	}
+	delete(v.records, ticketID)
+	if err := v.save(); err != nil {
+		v.records[ticketID] = sealed
+		return err
+	}
+	return nil
+}
+
+// save writes the vault atomically; callers hold v.mu
+func (v *FileVault) save() error {
+	if v.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(v.records)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(v.path), "."+filepath.Base(v.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.path)
+}
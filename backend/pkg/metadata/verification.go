@@ -0,0 +1,117 @@
+package metadata
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// VerificationPayload is what a ticket's QR code carries. It is signed so
+// staff scanners can check a ticket offline with only the public key.
+type VerificationPayload struct {
+	TicketID  string `json:"t"`
+	Route     string `json:"r"`
+	Class     string `json:"c"`
+	Seat      string `json:"s"`
+	Departure int64  `json:"d"` // Unix seconds
+	// Passenger is the PassengerRecord commitment on private tickets
+	Passenger string `json:"p,omitempty"`
+}
+
+// payloadPrefix versions the QR format: AR1.<payload>.<signature>, both
+// base64url without padding
+const payloadPrefix = "AR1."
+
+var ErrBadSignature = errors.New("ticket signature is invalid")
+
+// NewVerificationPayload is the payload for a ticket
+func NewVerificationPayload(ticket TicketDetails) VerificationPayload {
+	return VerificationPayload{
+		TicketID:  ticket.TicketID,
+		Route:     fmt.Sprintf("%s-%s", getRouteCode(ticket.RouteFrom), getRouteCode(ticket.RouteTo)),
+		Class:     ticket.Class,
+		Seat:      ticket.SeatNumber,
+		Departure: ticket.DepartureTime.Unix(),
+	}
+}
+
+// Sign encodes the payload and its Ed25519 signature for a QR code
+func (p VerificationPayload) Sign(key ed25519.PrivateKey) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	sig := ed25519.Sign(key, []byte(payloadPrefix+encoded))
+	return payloadPrefix + encoded + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyPayload checks a scanned QR code and returns what it vouches for
+func VerifyPayload(pub ed25519.PublicKey, scanned string) (VerificationPayload, error) {
+	var p VerificationPayload
+	rest, ok := strings.CutPrefix(scanned, payloadPrefix)
+	if !ok {
+		return p, errors.New("not an Africa Railways ticket code")
+	}
+	encoded, sigText, ok := strings.Cut(rest, ".")
+	if !ok {
+		return p, errors.New("ticket code has no signature")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigText)
+	if err != nil || !ed25519.Verify(pub, []byte(payloadPrefix+encoded), sig) {
+		return p, ErrBadSignature
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return p, fmt.Errorf("invalid ticket code: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("invalid ticket code: %w", err)
+	}
+	return p, nil
+}
+
+// Identity results from VerifyPassenger
+const (
+	IdentityMatch    = "match"
+	IdentityMismatch = "mismatch"
+	// IdentityNotCommitted is a public ticket, which has no commitment
+	IdentityNotCommitted = "not_committed"
+)
+
+// VerifyPassenger checks a scanned ticket and whether the ID the passenger
+// presents is the one the ticket was issued to. The answer is only match or
+// mismatch: nothing from the record is returned, so staff learn no more
+// than the document in front of them shows.
+func VerifyPassenger(pub ed25519.PublicKey, vault PIIVault, scanned, kind, presented string) (VerificationPayload, string, error) {
+	p, err := VerifyPayload(pub, scanned)
+	if err != nil {
+		return p, "", err
+	}
+	if p.Passenger == "" {
+		return p, IdentityNotCommitted, nil
+	}
+	rec, err := vault.Get(p.TicketID)
+	if err != nil {
+		return p, "", err
+	}
+	if rec.Matches(p.Passenger, kind, presented) {
+		return p, IdentityMatch, nil
+	}
+	return p, IdentityMismatch, nil
+}
+
+// LoadSigningKey reads the hex Ed25519 seed in TICKET_SIGNING_KEY. Scanners
+// are given the matching public key.
+func LoadSigningKey() (ed25519.PrivateKey, error) {
+	seed, err := hex.DecodeString(strings.TrimPrefix(os.Getenv("TICKET_SIGNING_KEY"), "0x"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("TICKET_SIGNING_KEY must be a 32-byte hex Ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
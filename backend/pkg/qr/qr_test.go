@@ -0,0 +1,141 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// Level M format information for masks 0-7 (ISO/IEC 18004 Annex C)
+var formatBitsM = []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+
+// Version information for versions 7-20 (ISO/IEC 18004 Annex D)
+var versionBits = map[int]int{
+	7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 11: 0x0BBF6, 12: 0x0C762, 13: 0x0D847,
+	14: 0x0E60D, 15: 0x0F928, 16: 0x10B78, 17: 0x1145D, 18: 0x12A17, 19: 0x13532, 20: 0x149A6,
+}
+
+// readFormatBits reads the copy of the format information beside the
+// top-right and bottom-left finders
+func readFormatBits(c *Code) int {
+	bits := 0
+	for i := 0; i < 8; i++ {
+		if c.Dark(c.Size-1-i, 8) {
+			bits |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if c.Dark(8, c.Size-15+i) {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+// setMask swaps a symbol's mask for another one
+func setMask(c *Code, mask int) {
+	c.applyMask((readFormatBits(c) ^ 0x5412) >> 10)
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+}
+
+// decode scans a symbol's image with an independent decoder
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+	bmp, err := gozxing.NewBinaryBitmapFromImage(c.Image(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_PURE_BARCODE: true}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		t.Fatalf("version %d: %v", c.Version, err)
+	}
+	// The raw bytes, before the decoder guesses a character set
+	segments, _ := result.GetResultMetadata()[gozxing.ResultMetadataType_BYTE_SEGMENTS].([][]byte)
+	return bytes.Join(segments, nil)
+}
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" in alphanumeric mode, version 1-M
+	data := []byte{0x20, 0x5B, 0x0B, 0x78, 0xD1, 0x72, 0xDC, 0x4D, 0x43, 0x40, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xC4, 0x23, 0x27, 0x77, 0xEB, 0xD7, 0xE7, 0xE2, 0x5D, 0x17}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("ECC = % X, want % X", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	for mask, want := range formatBitsM {
+		c := newCode(1)
+		c.drawFormatBits(mask)
+		if got := readFormatBits(c); got != want {
+			t.Errorf("mask %d format bits = %#x, want %#x", mask, got, want)
+		}
+	}
+	for version, want := range versionBits {
+		c := newCode(version)
+		c.drawVersion()
+		got := 0
+		for i := 0; i < 18; i++ {
+			if c.Dark(c.Size-11+i%3, i/3) {
+				got |= 1 << i
+			}
+		}
+		if got != want {
+			t.Errorf("version %d bits = %#x, want %#x", version, got, want)
+		}
+	}
+}
+
+func TestEncodeDecodes(t *testing.T) {
+	// The byte-mode capacity of each version at level M
+	capacities := []struct{ version, bytes int }{
+		{1, 14}, {2, 26}, {5, 84}, {7, 122}, {10, 213}, {13, 331}, {14, 362}, {20, 666},
+	}
+	text := strings.Repeat("https://africarailways.com/verify?t=TKT-0042&sig=", 14)
+	for _, tc := range capacities {
+		data := []byte(text[:tc.bytes])
+		c, err := Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != tc.version || c.Size != 4*tc.version+17 {
+			t.Errorf("%d bytes encoded as version %d (%d modules), want %d", tc.bytes, c.Version, c.Size, tc.version)
+			continue
+		}
+		if bigger, _ := Encode(append(data, '!')); bigger != nil && bigger.Version == tc.version {
+			t.Errorf("%d bytes still fit version %d", tc.bytes+1, tc.version)
+		}
+		for mask := 0; mask < 8; mask++ {
+			setMask(c, mask)
+			if got := decode(t, c); !bytes.Equal(got, data) {
+				t.Errorf("version %d mask %d decoded %q, want %q", c.Version, mask, got, data)
+			}
+		}
+	}
+}
+
+func TestEncodeBinary(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	c, err := Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decode(t, c); !bytes.Equal(got, data) {
+		t.Errorf("decoded % X, want % X", got, data)
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, 667)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("667 bytes = %v, want ErrTooLong", err)
+	}
+}
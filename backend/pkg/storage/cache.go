@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCacheBytes bounds a DiskCache when no size is configured
+const DefaultCacheBytes = 256 << 20
+
+// DiskCache keeps content by CID in a directory, evicting the least recently
+// used once it holds more than its limit. Reads touch the file's mtime, so
+// the order survives restarts. Content is checked against its CID on every
+// read; a corrupt file is dropped and reads as a miss.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List // Of *cacheEntry, most recently used first
+	entries map[CID]*list.Element
+	size    int64
+}
+
+type cacheEntry struct {
+	cid  CID
+	size int64
+}
+
+// NewDiskCache opens or creates a cache in dir holding up to maxBytes, or
+// DefaultCacheBytes if maxBytes is not positive
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{dir: dir, maxBytes: maxBytes, lru: list.New(), entries: make(map[CID]*list.Element)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type found struct {
+		entry cacheEntry
+		used  time.Time
+	}
+	var existing []found
+	for _, f := range files {
+		if f.IsDir() || f.Name()[0] == '.' {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		existing = append(existing, found{cacheEntry{CID(f.Name()), info.Size()}, info.ModTime()})
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].used.After(existing[j].used) })
+	for _, f := range existing {
+		entry := f.entry
+		c.entries[entry.cid] = c.lru.PushBack(&entry)
+		c.size += entry.size
+	}
+	c.evict()
+	return c, nil
+}
+
+// Get returns the cached content for cid, if any
+func (c *DiskCache) Get(cid CID) ([]byte, bool) {
+	if _, err := ParseCID(string(cid)); err != nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[cid]
+	if !ok {
+		return nil, false
+	}
+	path := filepath.Join(c.dir, string(cid))
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = cid.Verify(data)
+	}
+	if err != nil {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Put stores data, which must match cid
+func (c *DiskCache) Put(cid CID, data []byte) error {
+	if _, err := ParseCID(string(cid)); err != nil {
+		return err
+	}
+	if err := cid.Verify(data); err != nil {
+		return err
+	}
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[cid]; ok {
+		c.lru.MoveToFront(el)
+		return nil
+	}
+
+	path := filepath.Join(c.dir, string(cid))
+	tmp := filepath.Join(c.dir, "."+string(cid)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.entries[cid] = c.lru.PushFront(&cacheEntry{cid, int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+// Size is the number of bytes cached
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict drops the least recently used content until the cache fits; callers
+// hold c.mu
+func (c *DiskCache) evict() {
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *DiskCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.cid)
+	c.size -= entry.size
+	if err := os.Remove(filepath.Join(c.dir, string(entry.cid))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("⚠️  Failed to remove %s from the IPFS cache: %v", entry.cid, err)
+	}
+}
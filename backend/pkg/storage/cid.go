@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultGateway serves CIDs over HTTP when no gateway is configured
+const DefaultGateway = "https://ipfs.io/ipfs/"
+
+// CID is an IPFS content identifier as its string encoding, e.g.
+// "bafkrei..." (CIDv1) or "Qm..." (CIDv0)
+type CID string
+
+func (c CID) String() string {
+	return string(c)
+}
+
+// URI is the ipfs:// form used as NFT token and image URIs
+func (c CID) URI() string {
+	return "ipfs://" + string(c)
+}
+
+// URL is the CID on an HTTP gateway such as https://gateway.pinata.cloud/ipfs/
+func (c CID) URL(gateway string) string {
+	if gateway == "" {
+		gateway = DefaultGateway
+	}
+	if !strings.HasSuffix(gateway, "/") {
+		gateway += "/"
+	}
+	return gateway + string(c)
+}
+
+// ParseCID accepts a bare CID, an ipfs:// URI or a gateway URL
+func ParseCID(s string) (CID, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "ipfs://")
+	if i := strings.Index(s, "/ipfs/"); i >= 0 {
+		s = s[i+len("/ipfs/"):]
+	}
+	s = strings.TrimSuffix(s, "/")
+	if s == "" || strings.HasPrefix(s, ".") || strings.ContainsAny(s, "/?# ") {
+		return "", fmt.Errorf("invalid CID %q", s)
+	}
+	return CID(s), nil
+}
+
+// Multicodec and multihash codes used in CIDs
+const (
+	CodecRaw   = 0x55 // The content itself is the block
+	CodecDagPB = 0x70 // A UnixFS node wrapping the content
+	hashSHA256 = 0x12
+)
+
+// ChunkSize is the default IPFS chunker's block size. Content up to this
+// size is a single block, which is all ComputeCID handles.
+const ChunkSize = 256 * 1024
+
+var (
+	ErrTooLarge    = errors.New("content spans more than one IPFS chunk")
+	ErrCIDMismatch = errors.New("CID does not match content")
+)
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ComputeCID is the CIDv1 IPFS gives data added as a single chunk: with
+// CodecRaw the raw-leaves CID Kubo returns for --cid-version=1, with
+// CodecDagPB the UnixFS file node Pinata returns for cidVersion 1
+func ComputeCID(codec uint64, data []byte) (CID, error) {
+	if len(data) > ChunkSize {
+		return "", ErrTooLarge
+	}
+	var block []byte
+	switch codec {
+	case CodecRaw:
+		block = data
+	case CodecDagPB:
+		block = unixFSFile(data)
+	default:
+		return "", fmt.Errorf("unsupported codec 0x%x", codec)
+	}
+	digest := sha256.Sum256(block)
+	b := binary.AppendUvarint([]byte{0x01}, codec)
+	b = append(b, hashSHA256, sha256.Size)
+	b = append(b, digest[:]...)
+	return CID("b" + base32Lower.EncodeToString(b)), nil
+}
+
+// rawCID is ComputeCID(CodecRaw) for callers that have already checked the
+// size, or do not need a CID IPFS would agree with beyond one chunk
+func rawCID(data []byte) CID {
+	digest := sha256.Sum256(data)
+	b := append([]byte{0x01, CodecRaw, hashSHA256, sha256.Size}, digest[:]...)
+	return CID("b" + base32Lower.EncodeToString(b))
+}
+
+// unixFSFile encodes a dag-pb node with no links whose Data is a UnixFS
+// File message: Type=File, Data=content, filesize=len(content). An empty
+// file carries no Data field, as go-unixfs writes it.
+func unixFSFile(data []byte) []byte {
+	fsData := []byte{0x08, 0x02}
+	if len(data) > 0 {
+		fsData = append(fsData, 0x12)
+		fsData = binary.AppendUvarint(fsData, uint64(len(data)))
+		fsData = append(fsData, data...)
+	}
+	fsData = append(fsData, 0x18)
+	fsData = binary.AppendUvarint(fsData, uint64(len(data)))
+
+	node := []byte{0x0a}
+	node = binary.AppendUvarint(node, uint64(len(fsData)))
+	return append(node, fsData...)
+}
+
+// Decode returns the CID's codec and sha2-256 digest. CIDv0 ("Qm...") is
+// always dag-pb.
+func (c CID) Decode() (codec uint64, digest []byte, err error) {
+	s := string(c)
+	var b []byte
+	switch {
+	case len(s) == 46 && strings.HasPrefix(s, "Qm"):
+		b, err = base58Decode(s)
+		if err != nil {
+			return 0, nil, err
+		}
+		codec = CodecDagPB
+	case strings.HasPrefix(s, "b"):
+		b, err = base32Lower.DecodeString(s[1:])
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid CID %q: %w", s, err)
+		}
+		version, n := binary.Uvarint(b)
+		if n <= 0 || version != 1 {
+			return 0, nil, fmt.Errorf("invalid CID %q: unsupported version", s)
+		}
+		b = b[n:]
+		codec, n = binary.Uvarint(b)
+		if n <= 0 {
+			return 0, nil, fmt.Errorf("invalid CID %q", s)
+		}
+		b = b[n:]
+	default:
+		return 0, nil, fmt.Errorf("unsupported CID encoding %q", s)
+	}
+	if len(b) != 2+sha256.Size || b[0] != hashSHA256 || b[1] != sha256.Size {
+		return 0, nil, fmt.Errorf("CID %q is not a sha2-256 CID", s)
+	}
+	return codec, b[2:], nil
+}
+
+// Verify checks that c is the CID of data, whichever codec and version the
+// provider chose
+func (c CID) Verify(data []byte) error {
+	codec, digest, err := c.Decode()
+	if err != nil {
+		return err
+	}
+	var block []byte
+	switch codec {
+	case CodecRaw:
+		block = data
+	case CodecDagPB:
+		if len(data) > ChunkSize {
+			return ErrTooLarge
+		}
+		block = unixFSFile(data)
+	default:
+		return fmt.Errorf("unsupported codec 0x%x in %s", codec, c)
+	}
+	if sum := sha256.Sum256(block); !bytes.Equal(sum[:], digest) {
+		return fmt.Errorf("%w: %s", ErrCIDMismatch, c)
+	}
+	return nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Decode decodes base58btc, the encoding of CIDv0
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, big.NewInt(58))
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	b := n.Bytes()
+	for _, r := range s {
+		if r != '1' {
+			break
+		}
+		b = append([]byte{0}, b...)
+	}
+	return b, nil
+}
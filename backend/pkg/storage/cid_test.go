@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// CIDs from `ipfs add --only-hash`: CIDv0 is the default, CIDv1 dag-pb is
+// --cid-version=1 --raw-leaves=false and CIDv1 raw is --cid-version=1
+var cidVectors = []struct {
+	name    string
+	data    []byte
+	v0      CID
+	v1DagPB CID
+	v1Raw   CID
+}{
+	{
+		name:    "empty",
+		data:    []byte{},
+		v0:      "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH",
+		v1DagPB: "bafybeif7ztnhq65lumvvtr4ekcwd2ifwgm3awq4zfr3srh462rwyinlb4y",
+		v1Raw:   "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku",
+	},
+	{
+		name:    "hello world",
+		data:    []byte("hello world"),
+		v0:      "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD",
+		v1DagPB: "bafybeihykld7uyxzogax6vgyvag42y7464eywpf55gxi5qpoisibh3c5wa",
+		v1Raw:   "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e",
+	},
+	{
+		name:    "hello world newline",
+		data:    []byte("hello world\n"),
+		v0:      "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o",
+		v1DagPB: "bafybeicg2rebjoofv4kbyovkw7af3rpiitvnl6i7ckcywaq6xjcxnc2mby",
+		v1Raw:   "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4",
+	},
+}
+
+func TestComputeCID(t *testing.T) {
+	for _, tc := range cidVectors {
+		if got, err := ComputeCID(CodecRaw, tc.data); err != nil || got != tc.v1Raw {
+			t.Errorf("%s raw = %s, %v, want %s", tc.name, got, err, tc.v1Raw)
+		}
+		if got := rawCID(tc.data); got != tc.v1Raw {
+			t.Errorf("%s rawCID = %s, want %s", tc.name, got, tc.v1Raw)
+		}
+		if got, err := ComputeCID(CodecDagPB, tc.data); err != nil || got != tc.v1DagPB {
+			t.Errorf("%s dag-pb = %s, %v, want %s", tc.name, got, err, tc.v1DagPB)
+		}
+	}
+}
+
+func TestVerifyCID(t *testing.T) {
+	for _, tc := range cidVectors {
+		for _, cid := range []CID{tc.v0, tc.v1DagPB, tc.v1Raw} {
+			if err := cid.Verify(tc.data); err != nil {
+				t.Errorf("%s: %s.Verify = %v", tc.name, cid, err)
+			}
+			if err := cid.Verify([]byte("tampered")); !errors.Is(err, ErrCIDMismatch) {
+				t.Errorf("%s: %s.Verify(other content) = %v, want ErrCIDMismatch", tc.name, cid, err)
+			}
+		}
+	}
+
+	// CIDv0 and CIDv1 dag-pb name the same block
+	_, v0, err := cidVectors[1].v0.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v1, err := cidVectors[1].v1DagPB.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v0, v1) {
+		t.Errorf("CIDv0 digest %x, CIDv1 digest %x", v0, v1)
+	}
+}
+
+// Content over one chunk is a tree of blocks whose root ComputeCID cannot
+// derive, so it is refused rather than given a CID IPFS would not agree with
+func TestCIDMultiChunk(t *testing.T) {
+	full := bytes.Repeat([]byte{0xA5}, ChunkSize)
+	if _, err := ComputeCID(CodecDagPB, full); err != nil {
+		t.Errorf("one full chunk: %v", err)
+	}
+
+	over := append(bytes.Clone(full), 0xA5)
+	for _, codec := range []uint64{CodecRaw, CodecDagPB} {
+		if _, err := ComputeCID(codec, over); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("codec 0x%x over one chunk = %v, want ErrTooLarge", codec, err)
+		}
+	}
+	if err := cidVectors[1].v0.Verify(over); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("dag-pb Verify over one chunk = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecodeCIDRejects(t *testing.T) {
+	for _, cid := range []CID{
+		"",
+		"zdj7WWeQ43G6JJvLWQWZpyHuAMq6uYWRjkBXFad11vE2LHhQ7", // base58 CIDv1
+		"bafkrei",
+		"QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1Aw0H", // 0 is not base58
+	} {
+		if _, _, err := cid.Decode(); err == nil {
+			t.Errorf("%q decoded", cid)
+		}
+	}
+}
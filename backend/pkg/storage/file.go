@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FilePinner stores content in a local directory, one file per CID. It needs
+// no network or credentials, for tests and offline demos.
+type FilePinner struct {
+	dir string
+}
+
+// NewFilePinner stores pins under dir, creating it if needed
+func NewFilePinner(dir string) (*FilePinner, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create pin directory: %w", err)
+	}
+	return &FilePinner{dir: dir}, nil
+}
+
+func (f *FilePinner) Name() string { return ProviderFile }
+
+func (f *FilePinner) PinJSON(ctx context.Context, name string, v interface{}) (Pin, error) {
+	data, err := marshal(v)
+	if err != nil {
+		return Pin{}, err
+	}
+	return f.PinFile(ctx, name, data)
+}
+
+// PinFile names the file after the content's raw-codec CIDv1
+func (f *FilePinner) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	cid := rawCID(data)
+	path := filepath.Join(f.dir, cid.String())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o644); err != nil {
+			return Pin{}, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return Pin{}, err
+		}
+	}
+	return Pin{CID: cid, Name: name, Size: int64(len(data)), Verified: true}, nil
+}
+
+// CIDFor is the raw-codec CIDv1, as Kubo computes it for single-chunk
+// content
+func (f *FilePinner) CIDFor(data []byte) (CID, error) {
+	return rawCID(data), nil
+}
+
+// Get reads pinned content back
+func (f *FilePinner) Get(cid CID) ([]byte, error) {
+	if _, err := ParseCID(cid.String()); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(f.dir, cid.String()))
+}
+
+// Unpin deletes the content's file
+func (f *FilePinner) Unpin(ctx context.Context, cid CID) error {
+	if _, err := ParseCID(cid.String()); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(f.dir, cid.String()))
+	if os.IsNotExist(err) {
+		return ErrNotPinned
+	}
+	return err
+}
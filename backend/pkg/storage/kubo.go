@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultKuboAPI is a local Kubo (go-ipfs) node's RPC address
+const DefaultKuboAPI = "http://127.0.0.1:5001"
+
+// Kubo pins to an IPFS node through its HTTP RPC API, e.g. a node started
+// with `ipfs daemon` for local development
+type Kubo struct {
+	apiURL string
+	client *http.Client
+}
+
+// NewKubo talks to the node at apiURL, or DefaultKuboAPI if it is empty
+func NewKubo(apiURL string) *Kubo {
+	if apiURL == "" {
+		apiURL = DefaultKuboAPI
+	}
+	return &Kubo{apiURL: strings.TrimSuffix(apiURL, "/"), client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+func (k *Kubo) Name() string { return ProviderKubo }
+
+func (k *Kubo) PinJSON(ctx context.Context, name string, v interface{}) (Pin, error) {
+	data, err := marshal(v)
+	if err != nil {
+		return Pin{}, err
+	}
+	if !strings.HasSuffix(name, ".json") {
+		name += ".json"
+	}
+	return k.PinFile(ctx, name, data)
+}
+
+// kuboAddResponse is returned by /api/v0/add; Size is a decimal string
+type kuboAddResponse struct {
+	Name string `json:"Name"`
+	Hash string `json:"Hash"`
+	Size string `json:"Size"`
+}
+
+// PinFile adds data as CIDv1 (which implies raw leaves) and pins it
+func (k *Kubo) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return Pin{}, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return Pin{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return Pin{}, err
+	}
+
+	url := k.apiURL + "/api/v0/add?pin=true&cid-version=1&quieter=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return Pin{}, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return Pin{}, fmt.Errorf("kubo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Pin{}, fmt.Errorf("failed to read kubo response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Pin{}, fmt.Errorf("kubo API error: %s - %s", resp.Status, string(respBody))
+	}
+
+	var result kuboAddResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return Pin{}, fmt.Errorf("failed to parse kubo response: %w", err)
+	}
+	if result.Hash == "" {
+		return Pin{}, errors.New("kubo returned no CID")
+	}
+	size, _ := strconv.ParseInt(result.Size, 10, 64)
+	return checkPin(k.Name(), Pin{CID: CID(result.Hash), Name: name, Size: size}, data)
+}
+
+// CIDFor is the raw-leaves CIDv1 Kubo builds with cid-version=1
+func (k *Kubo) CIDFor(data []byte) (CID, error) {
+	return ComputeCID(CodecRaw, data)
+}
+
+// Unpin removes the node's recursive pin; the blocks go at the next GC
+func (k *Kubo) Unpin(ctx context.Context, cid CID) error {
+	url := k.apiURL + "/api/v0/pin/rm?arg=" + cid.String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kubo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case strings.Contains(string(body), "not pinned"):
+		return ErrNotPinned
+	}
+	return fmt.Errorf("kubo API error: %s - %s", resp.Status, string(body))
+}
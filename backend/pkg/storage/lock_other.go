@@ -0,0 +1,9 @@
+//go:build !unix
+
+package storage
+
+// lockFile is a no-op without flock; only one process may write a
+// registry file on this platform
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Unpinner releases pinned content
+type Unpinner interface {
+	Unpin(ctx context.Context, cid CID) error
+}
+
+// Usage is a provider's own account of what it stores
+type Usage struct {
+	Pins            int64 `json:"pins"`
+	Bytes           int64 `json:"bytes"`
+	ReplicatedBytes int64 `json:"replicated_bytes,omitempty"`
+}
+
+// UsageReporter is a provider that reports its storage usage
+type UsageReporter interface {
+	Usage(ctx context.Context) (Usage, error)
+}
+
+// ListedPin is a pin as a provider lists it
+type ListedPin struct {
+	CID      CID
+	Name     string
+	Size     int64
+	PinnedAt time.Time
+}
+
+// PinLister is a provider that lists its pins
+type PinLister interface {
+	ListPins(ctx context.Context) ([]ListedPin, error)
+}
+
+// JourneyTracker is told when a ticket's journey ends, which starts the
+// retention window for its pins
+type JourneyTracker interface {
+	TrackJourney(ticketID string, end time.Time) error
+}
+
+// Pin manager defaults
+const (
+	DefaultRegistryPath = "ipfs-pins.json"
+	DefaultRetention    = 30 * 24 * time.Hour
+)
+
+// PinManager is a Pinner that records every upload in a PinRegistry and
+// releases ticket assets once their journey is Retention in the past
+type PinManager struct {
+	Pinner
+	registry *PinRegistry
+
+	// Retention is how long after the journey a ticket's pins are kept
+	Retention time.Duration
+	// Cold, when set, receives a copy of content before it is unpinned
+	Cold Pinner
+	// Gateway fetches content for Cold when the provider cannot return it
+	Gateway *GatewayVerifier
+
+	now func() time.Time
+}
+
+// NewPinManager records pins made through p in registry
+func NewPinManager(p Pinner, registry *PinRegistry) *PinManager {
+	return &PinManager{
+		Pinner:    p,
+		registry:  registry,
+		Retention: DefaultRetention,
+		Gateway:   NewGatewayVerifier(DefaultGateway),
+		now:       time.Now,
+	}
+}
+
+// NewPinManagerFromEnv manages the IPFS_PROVIDER backend with the registry
+// at PIN_REGISTRY_PATH (default ipfs-pins.json). PIN_RETENTION_DAYS sets the
+// retention window (default 30), PIN_COLD_DIR archives content there before
+// unpinning, and IPFS_GATEWAY is where that content is fetched from.
+func NewPinManagerFromEnv() (*PinManager, error) {
+	p, err := providerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return managerFromEnv(p)
+}
+
+func managerFromEnv(p Pinner) (*PinManager, error) {
+	path := os.Getenv("PIN_REGISTRY_PATH")
+	if path == "" {
+		path = DefaultRegistryPath
+	}
+	m := NewPinManager(p, NewPinRegistry(path))
+	if days := os.Getenv("PIN_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PIN_RETENTION_DAYS %q", days)
+		}
+		m.Retention = time.Duration(n) * 24 * time.Hour
+	}
+	if dir := os.Getenv("PIN_COLD_DIR"); dir != "" {
+		cold, err := NewFilePinner(dir)
+		if err != nil {
+			return nil, err
+		}
+		m.Cold = cold
+	}
+	if gateway := os.Getenv("IPFS_GATEWAY"); gateway != "" {
+		m.Gateway = NewGatewayVerifier(gateway)
+	}
+	return m, nil
+}
+
+// Registry is where the manager records pins
+func (m *PinManager) Registry() *PinRegistry { return m.registry }
+
+func (m *PinManager) PinJSON(ctx context.Context, name string, v interface{}) (Pin, error) {
+	start := m.now()
+	pin, err := m.Pinner.PinJSON(ctx, name, v)
+	return pin, m.record(name, pin, start, err)
+}
+
+func (m *PinManager) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	start := m.now()
+	pin, err := m.Pinner.PinFile(ctx, name, data)
+	return pin, m.record(name, pin, start, err)
+}
+
+// record logs an upload. Failing to record a successful pin is an error:
+// a pin the registry does not know about would never be released.
+func (m *PinManager) record(name string, pin Pin, start time.Time, pinErr error) error {
+	rec := PinRecord{
+		Name:       name,
+		TicketID:   ticketIDFromName(name),
+		Provider:   m.Pinner.Name(),
+		Status:     PinStatusPinned,
+		DurationMs: m.now().Sub(start).Milliseconds(),
+		CreatedAt:  start.UTC(),
+	}
+	if pinErr != nil {
+		rec.Status, rec.Error = PinStatusFailed, pinErr.Error()
+		if err := m.registry.Add(rec); err != nil {
+			return fmt.Errorf("%w (and failed to record it: %v)", pinErr, err)
+		}
+		return pinErr
+	}
+	rec.CID, rec.Size = pin.CID, pin.Size
+	if pin.Name != "" {
+		rec.Name = pin.Name
+	}
+	if err := m.registry.Add(rec); err != nil {
+		return fmt.Errorf("pinned %s but failed to record it: %w", pin.CID, err)
+	}
+	return nil
+}
+
+// TrackJourney sets when ticketID's journey ends on all of its pins
+func (m *PinManager) TrackJourney(ticketID string, end time.Time) error {
+	return m.registry.update(func(records []PinRecord) ([]PinRecord, error) {
+		for i := range records {
+			if records[i].TicketID == ticketID {
+				records[i].JourneyEnd = end.UTC()
+			}
+		}
+		return records, nil
+	})
+}
+
+// Reconcile records pins the provider holds that the registry does not,
+// e.g. those made before the registry existed. It returns how many it added.
+func (m *PinManager) Reconcile(ctx context.Context) (int, error) {
+	lister, ok := m.Pinner.(PinLister)
+	if !ok {
+		return 0, fmt.Errorf("%s cannot list pins", m.Pinner.Name())
+	}
+	listed, err := lister.ListPins(ctx)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	err = m.registry.update(func(records []PinRecord) ([]PinRecord, error) {
+		known := make(map[CID]bool)
+		for _, rec := range records {
+			if rec.Status == PinStatusPinned {
+				known[rec.CID] = true
+			}
+		}
+		for _, pin := range listed {
+			if known[pin.CID] {
+				continue
+			}
+			known[pin.CID] = true
+			records = append(records, PinRecord{
+				CID:       pin.CID,
+				Name:      pin.Name,
+				TicketID:  ticketIDFromName(pin.Name),
+				Provider:  m.Pinner.Name(),
+				Size:      pin.Size,
+				Status:    PinStatusPinned,
+				CreatedAt: pin.PinnedAt.UTC(),
+				Imported:  true,
+			})
+			added++
+		}
+		return records, nil
+	})
+	return added, err
+}
+
+// SweepResult is what one Sweep released
+type SweepResult struct {
+	Unpinned int     `json:"unpinned"`
+	Archived int     `json:"archived"` // Of those unpinned, copied to Cold first
+	Errors   []error `json:"-"`
+}
+
+// Sweep releases every pin whose journey ended more than Retention ago,
+// archiving it to Cold first when that is set. A CID shared with a pin
+// still in its window is kept. Failures are collected and retried on the
+// next sweep.
+func (m *PinManager) Sweep(ctx context.Context) (SweepResult, error) {
+	var result SweepResult
+	unpinner, ok := m.Pinner.(Unpinner)
+	if !ok {
+		return result, fmt.Errorf("%s cannot unpin", m.Pinner.Name())
+	}
+	records, err := m.registry.Records()
+	if err != nil {
+		return result, err
+	}
+
+	now := m.now()
+	expired := make(map[CID]PinRecord)
+	keep := make(map[CID]bool)
+	for _, rec := range records {
+		if rec.Status != PinStatusPinned {
+			continue
+		}
+		if !rec.JourneyEnd.IsZero() && now.Sub(rec.JourneyEnd) > m.Retention {
+			expired[rec.CID] = rec
+		} else {
+			keep[rec.CID] = true
+		}
+	}
+	cids := make([]CID, 0, len(expired))
+	for cid := range expired {
+		if !keep[cid] {
+			cids = append(cids, cid)
+		}
+	}
+	sort.Slice(cids, func(i, j int) bool { return cids[i] < cids[j] })
+
+	for _, cid := range cids {
+		status, coldCID := PinStatusUnpinned, CID("")
+		if m.Cold != nil {
+			if coldCID, err = m.archive(ctx, cid, expired[cid].Name); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("archiving %s: %w", cid, err))
+				continue
+			}
+			status = PinStatusCold
+		}
+		if err := unpinner.Unpin(ctx, cid); err != nil && !errors.Is(err, ErrNotPinned) {
+			result.Errors = append(result.Errors, fmt.Errorf("unpinning %s: %w", cid, err))
+			continue
+		}
+		err := m.registry.update(func(records []PinRecord) ([]PinRecord, error) {
+			for i := range records {
+				if records[i].CID == cid && records[i].Status == PinStatusPinned {
+					records[i].Status, records[i].RemovedAt, records[i].ColdCID = status, now.UTC(), coldCID
+				}
+			}
+			return records, nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Unpinned++
+		if status == PinStatusCold {
+			result.Archived++
+		}
+	}
+	return result, nil
+}
+
+// archive copies content to Cold, from the provider when it can return it
+// and otherwise through the gateway, checking it against its CID either way
+func (m *PinManager) archive(ctx context.Context, cid CID, name string) (CID, error) {
+	var data []byte
+	var err error
+	if getter, ok := m.Pinner.(interface{ Get(CID) ([]byte, error) }); ok {
+		if data, err = getter.Get(cid); err == nil {
+			if err = cid.Verify(data); errors.Is(err, ErrTooLarge) {
+				err = nil
+			}
+		}
+	} else {
+		data, err = m.Gateway.Fetch(ctx, cid)
+	}
+	if err != nil {
+		return "", err
+	}
+	pin, err := m.Cold.PinFile(ctx, name, data)
+	if err != nil {
+		return "", err
+	}
+	return pin.CID, nil
+}
+
+// PinStats summarizes the registry, and the provider's own usage when it
+// reports it
+type PinStats struct {
+	Provider        string  `json:"provider"`
+	TotalUploads    int64   `json:"total_uploads"`
+	UploadsToday    int64   `json:"uploads_today"`
+	FailedUploads   int64   `json:"failed_uploads"`
+	SuccessRate     float64 `json:"success_rate"` // Percent of uploads that succeeded
+	AverageUploadMs int64   `json:"average_upload_ms"`
+	Pinned          int64   `json:"pinned"` // Distinct CIDs still pinned
+	PinnedBytes     int64   `json:"pinned_bytes"`
+	Unpinned        int64   `json:"unpinned"`
+	Archived        int64   `json:"archived"`
+	// Usage is nil when the provider does not report it
+	Usage      *Usage `json:"usage,omitempty"`
+	UsageError string `json:"usage_error,omitempty"`
+}
+
+// Stats reads the registry and asks the provider for its usage
+func (m *PinManager) Stats(ctx context.Context) (PinStats, error) {
+	records, err := m.registry.Records()
+	if err != nil {
+		return PinStats{}, err
+	}
+	stats := SummarizePins(records, m.now())
+	stats.Provider = m.Pinner.Name()
+	if reporter, ok := m.Pinner.(UsageReporter); ok {
+		if usage, err := reporter.Usage(ctx); err != nil {
+			stats.UsageError = err.Error()
+		} else {
+			stats.Usage = &usage
+		}
+	}
+	return stats, nil
+}
+
+// SummarizePins counts uploads and what is still pinned. Today is the UTC
+// day containing now.
+func SummarizePins(records []PinRecord, now time.Time) PinStats {
+	var stats PinStats
+	var totalMs int64
+	today := now.UTC().Truncate(24 * time.Hour)
+	pinned := make(map[CID]bool)
+	for _, rec := range records {
+		// Pins found by Reconcile are held but were not uploaded here
+		if !rec.Imported {
+			stats.TotalUploads++
+			totalMs += rec.DurationMs
+			if !rec.CreatedAt.Before(today) {
+				stats.UploadsToday++
+			}
+		}
+		switch rec.Status {
+		case PinStatusFailed:
+			stats.FailedUploads++
+		case PinStatusPinned:
+			if !pinned[rec.CID] {
+				pinned[rec.CID] = true
+				stats.Pinned++
+				stats.PinnedBytes += rec.Size
+			}
+		case PinStatusUnpinned:
+			stats.Unpinned++
+		case PinStatusCold:
+			stats.Unpinned++
+			stats.Archived++
+		}
+	}
+	if stats.TotalUploads > 0 {
+		stats.SuccessRate = 100 * float64(stats.TotalUploads-stats.FailedUploads) / float64(stats.TotalUploads)
+		stats.AverageUploadMs = totalMs / stats.TotalUploads
+	}
+	return stats
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingPinner refuses every upload
+type failingPinner struct{ *MemoryPinner }
+
+func (failingPinner) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	return Pin{}, errors.New("provider down")
+}
+
+func newTestManager(t *testing.T, p Pinner) (*PinManager, *time.Time) {
+	t.Helper()
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	m := NewPinManager(p, NewPinRegistry(filepath.Join(t.TempDir(), "pins.json")))
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestPinManagerSweep(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryPinner()
+	m, now := newTestManager(t, memory)
+	cold, err := NewFilePinner(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Cold = cold
+
+	expired, err := m.PinFile(ctx, "ticket-TKT1.json", []byte(`{"ticket":"TKT1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same artwork on a ticket still in its window stays pinned
+	shared, err := m.PinFile(ctx, "ticket-TKT1.svg", []byte("<svg/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.PinFile(ctx, "ticket-TKT2.svg", []byte("<svg/>")); err != nil {
+		t.Fatal(err)
+	}
+	// Pins without a journey end are kept indefinitely
+	if _, err := m.PinFile(ctx, "ticket-TKT3.json", []byte(`{"ticket":"TKT3"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.TrackJourney("TKT1", *now); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.TrackJourney("TKT2", now.Add(40*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(m.Retention - time.Hour)
+	if result, err := m.Sweep(ctx); err != nil || result.Unpinned != 0 {
+		t.Fatalf("sweep inside the window = %+v, %v, want nothing released", result, err)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	result, err := m.Sweep(ctx)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Sweep = %+v, %v", result, err)
+	}
+	if result.Unpinned != 1 || result.Archived != 1 {
+		t.Errorf("Sweep released %d (%d archived), want 1 (1)", result.Unpinned, result.Archived)
+	}
+	if _, err := memory.Get(expired.CID); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("expired metadata still pinned: %v", err)
+	}
+	if _, err := memory.Get(shared.CID); err != nil {
+		t.Errorf("shared artwork released: %v", err)
+	}
+
+	records, err := m.Registry().Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived PinRecord
+	for _, rec := range records {
+		if rec.CID == expired.CID {
+			archived = rec
+		}
+	}
+	if archived.Status != PinStatusCold || archived.RemovedAt.IsZero() {
+		t.Errorf("released record = %+v, want cold with a removal time", archived)
+	}
+	if data, err := cold.Get(archived.ColdCID); err != nil || string(data) != `{"ticket":"TKT1"}` {
+		t.Errorf("cold copy = %q, %v", data, err)
+	}
+
+	// A second sweep has nothing left to do
+	if result, err := m.Sweep(ctx); err != nil || result.Unpinned != 0 {
+		t.Errorf("second sweep = %+v, %v", result, err)
+	}
+}
+
+func TestPinManagerStats(t *testing.T) {
+	ctx := context.Background()
+	m, now := newTestManager(t, NewMemoryPinner())
+	for _, name := range []string{"ticket-TKT1.json", "ticket-TKT2.json"} {
+		if _, err := m.PinFile(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The registry is shared: failures recorded by another manager count too
+	failing := NewPinManager(failingPinner{NewMemoryPinner()}, m.Registry())
+	failing.now = m.now
+	if _, err := failing.PinFile(ctx, "ticket-TKT3.json", []byte("x")); err == nil {
+		t.Fatal("failing upload succeeded")
+	}
+	if err := m.Registry().Add(PinRecord{CID: "bafkreiimported", Size: 10, Status: PinStatusPinned,
+		CreatedAt: now.Add(-48 * time.Hour), Imported: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PinStats{
+		Provider:      ProviderMemory,
+		TotalUploads:  3,
+		UploadsToday:  3,
+		FailedUploads: 1,
+		SuccessRate:   100 * 2.0 / 3,
+		Pinned:        3,
+		PinnedBytes:   int64(len("ticket-TKT1.json")+len("ticket-TKT2.json")) + 10,
+	}
+	if stats != want {
+		t.Errorf("Stats =\n %+v\nwant\n %+v", stats, want)
+	}
+
+	records, err := m.Registry().Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := records[2]; failed.Status != PinStatusFailed || failed.CID != "" || failed.TicketID != "TKT3" {
+		t.Errorf("failed upload recorded as %+v", failed)
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const pinataAPI = "https://api.pinata.cloud"
+
+// Pinata pins through Pinata's pinning API. It authenticates with a JWT
+// when one is set, otherwise with the legacy API key and secret headers.
+type Pinata struct {
+	jwt       string
+	apiKey    string
+	secretKey string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewPinataJWT authenticates with a Pinata JWT (Authorization: Bearer)
+func NewPinataJWT(jwt string) *Pinata {
+	return &Pinata{jwt: jwt, baseURL: pinataAPI, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// NewPinataKey authenticates with pinata_api_key and pinata_secret_api_key
+func NewPinataKey(apiKey, secretKey string) *Pinata {
+	return &Pinata{apiKey: apiKey, secretKey: secretKey, baseURL: pinataAPI, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// NewPinataFromEnv prefers PINATA_JWT and falls back to PINATA_API_KEY and
+// PINATA_SECRET_KEY. PINATA_BASE_URL points it at another API host.
+func NewPinataFromEnv() (*Pinata, error) {
+	var p *Pinata
+	secret := os.Getenv("PINATA_SECRET_KEY")
+	switch {
+	case os.Getenv("PINATA_JWT") != "":
+		p = NewPinataJWT(os.Getenv("PINATA_JWT"))
+	case os.Getenv("PINATA_API_KEY") != "" && secret != "" && secret != "your_pinata_secret_key_here":
+		p = NewPinataKey(os.Getenv("PINATA_API_KEY"), secret)
+	default:
+		return nil, errors.New("PINATA_JWT, or PINATA_API_KEY and PINATA_SECRET_KEY, must be set")
+	}
+	if base := os.Getenv("PINATA_BASE_URL"); base != "" {
+		p.baseURL = strings.TrimSuffix(base, "/")
+	}
+	return p, nil
+}
+
+func (p *Pinata) Name() string { return ProviderPinata }
+
+// PinJSON uploads the encoded JSON as a file rather than through
+// pinJSONToIPFS, which re-serializes it: the CID then covers the exact
+// bytes that were encoded here.
+func (p *Pinata) PinJSON(ctx context.Context, name string, v interface{}) (Pin, error) {
+	data, err := marshal(v)
+	if err != nil {
+		return Pin{}, err
+	}
+	if !strings.HasSuffix(name, ".json") {
+		name += ".json"
+	}
+	return p.PinFile(ctx, name, data)
+}
+
+// pinataPinResponse is returned by pinFileToIPFS
+type pinataPinResponse struct {
+	IpfsHash  string    `json:"IpfsHash"`
+	PinSize   int64     `json:"PinSize"`
+	Timestamp time.Time `json:"Timestamp"`
+}
+
+func (p *Pinata) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return Pin{}, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return Pin{}, err
+	}
+	meta, _ := json.Marshal(map[string]string{"name": name})
+	writer.WriteField("pinataMetadata", string(meta))
+	writer.WriteField("pinataOptions", `{"cidVersion":1}`)
+	if err := writer.Close(); err != nil {
+		return Pin{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/pinning/pinFileToIPFS", body)
+	if err != nil {
+		return Pin{}, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	p.authorize(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Pin{}, fmt.Errorf("pinata request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Pin{}, fmt.Errorf("failed to read pinata response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Pin{}, fmt.Errorf("pinata API error: %s - %s", resp.Status, string(respBody))
+	}
+
+	var result pinataPinResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return Pin{}, fmt.Errorf("failed to parse pinata response: %w", err)
+	}
+	if result.IpfsHash == "" {
+		return Pin{}, errors.New("pinata returned no CID")
+	}
+	return checkPin(p.Name(), Pin{CID: CID(result.IpfsHash), Name: name, Size: result.PinSize}, data)
+}
+
+// CIDFor is the UnixFS CIDv1 Pinata builds for files without raw leaves
+func (p *Pinata) CIDFor(data []byte) (CID, error) {
+	return ComputeCID(CodecDagPB, data)
+}
+
+func (p *Pinata) authorize(req *http.Request) {
+	if p.jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+p.jwt)
+		return
+	}
+	req.Header.Set("pinata_api_key", p.apiKey)
+	req.Header.Set("pinata_secret_api_key", p.secretKey)
+}
+
+// Unpin removes a pin; a CID Pinata does not hold is ErrNotPinned
+func (p *Pinata) Unpin(ctx context.Context, cid CID) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, p.baseURL+"/pinning/unpin/"+cid.String(), nil)
+	if err != nil {
+		return err
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pinata request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || strings.Contains(string(body), "CURRENT_USER_HAS_NOT_PINNED_CID"):
+		return ErrNotPinned
+	}
+	return fmt.Errorf("pinata API error: %s - %s", resp.Status, string(body))
+}
+
+// pinataUsageResponse is returned by data/userPinnedDataTotal
+type pinataUsageResponse struct {
+	PinCount                     int64 `json:"pin_count"`
+	PinSizeTotal                 int64 `json:"pin_size_total"`
+	PinSizeWithReplicationsTotal int64 `json:"pin_size_with_replications_total"`
+}
+
+// Usage is what Pinata bills for: every pin on the account, not only
+// those this registry knows about
+func (p *Pinata) Usage(ctx context.Context) (Usage, error) {
+	var result pinataUsageResponse
+	if err := p.getJSON(ctx, "/data/userPinnedDataTotal", &result); err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Pins:            result.PinCount,
+		Bytes:           result.PinSizeTotal,
+		ReplicatedBytes: result.PinSizeWithReplicationsTotal,
+	}, nil
+}
+
+// pinataListResponse is a page of data/pinList
+type pinataListResponse struct {
+	Count int64 `json:"count"`
+	Rows  []struct {
+		IpfsPinHash string    `json:"ipfs_pin_hash"`
+		Size        int64     `json:"size"`
+		DatePinned  time.Time `json:"date_pinned"`
+		Metadata    struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	} `json:"rows"`
+}
+
+// pinataPageLimit is the most pinList returns per page
+const pinataPageLimit = 1000
+
+// ListPins pages through every current pin on the account
+func (p *Pinata) ListPins(ctx context.Context) ([]ListedPin, error) {
+	var pins []ListedPin
+	for offset := 0; ; offset += pinataPageLimit {
+		var page pinataListResponse
+		path := fmt.Sprintf("/data/pinList?status=pinned&pageLimit=%d&pageOffset=%d", pinataPageLimit, offset)
+		if err := p.getJSON(ctx, path, &page); err != nil {
+			return nil, err
+		}
+		for _, row := range page.Rows {
+			pins = append(pins, ListedPin{
+				CID:      CID(row.IpfsPinHash),
+				Name:     row.Metadata.Name,
+				Size:     row.Size,
+				PinnedAt: row.DatePinned,
+			})
+		}
+		if len(page.Rows) < pinataPageLimit || int64(len(pins)) >= page.Count {
+			return pins, nil
+		}
+	}
+}
+
+func (p *Pinata) getJSON(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pinata request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read pinata response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pinata API error: %s - %s", resp.Status, string(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse pinata response: %w", err)
+	}
+	return nil
+}
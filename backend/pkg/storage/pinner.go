@@ -0,0 +1,163 @@
+// Package storage pins ticket metadata and images to IPFS. Every backend
+// implements Pinner and returns a CID, so commands never deal with a
+// provider's response format or whether it hands back a hash or a URI.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Pin is content pinned by a Pinner
+type Pin struct {
+	CID  CID    `json:"cid"`
+	Name string `json:"name,omitempty"`
+	Size int64  `json:"size"` // Bytes as reported by the provider
+	// Verified is set when the CID was checked against the content locally.
+	// Content over ChunkSize cannot be, so it is pinned without an error but
+	// with Verified false; callers that hand the CID on must check it.
+	Verified bool `json:"verified"`
+}
+
+// ErrUnverified is returned by callers that need a pin's CID checked
+// against its content and got one that was not, e.g. over ChunkSize
+var ErrUnverified = errors.New("pinned CID was not checked against its content")
+
+// Pinner adds content to IPFS and keeps it pinned
+type Pinner interface {
+	// Name identifies the backend in logs, e.g. "pinata"
+	Name() string
+	// PinJSON pins v encoded as JSON, e.g. ticket metadata
+	PinJSON(ctx context.Context, name string, v interface{}) (Pin, error)
+	// PinFile pins raw bytes such as a ticket image; name is the file name
+	PinFile(ctx context.Context, name string, data []byte) (Pin, error)
+	// CIDFor is the CID PinFile will return for data, known before upload
+	CIDFor(data []byte) (CID, error)
+}
+
+// MarshalJSON encodes v exactly as PinJSON does, e.g. to compute its CID
+// with CIDFor before pinning
+func MarshalJSON(v interface{}) ([]byte, error) {
+	return marshal(v)
+}
+
+// checkPin verifies the CID provider returned against the content sent.
+// A mismatch means the provider stored something else, or the response was
+// tampered with, so the pin must not be used. Content over ChunkSize is
+// returned unverified.
+func checkPin(provider string, pin Pin, data []byte) (Pin, error) {
+	err := pin.CID.Verify(data)
+	if errors.Is(err, ErrTooLarge) {
+		return pin, nil
+	}
+	if err != nil {
+		return Pin{}, fmt.Errorf("%s returned an unverifiable CID for %s: %w", provider, pin.Name, err)
+	}
+	pin.Verified = true
+	return pin, nil
+}
+
+// Providers selectable with IPFS_PROVIDER
+const (
+	ProviderPinata = "pinata"
+	ProviderKubo   = "kubo"
+	ProviderFile   = "file"
+	ProviderMemory = "memory"
+)
+
+// NewPinnerFromEnv picks a backend from IPFS_PROVIDER, defaulting to Pinata:
+//
+//	pinata  PINATA_JWT, or PINATA_API_KEY and PINATA_SECRET_KEY
+//	kubo    IPFS_API_URL (default http://127.0.0.1:5001)
+//	file    IPFS_FILE_DIR (default ./ipfs-pins)
+//	memory  nothing; pins are lost on exit
+//
+// With PIN_REGISTRY_PATH set the backend is wrapped in a PinManager, so
+// every pin is recorded for accounting and retention.
+func NewPinnerFromEnv() (Pinner, error) {
+	p, err := providerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return managed(p)
+}
+
+func providerFromEnv() (Pinner, error) {
+	switch provider := strings.ToLower(os.Getenv("IPFS_PROVIDER")); provider {
+	case "", ProviderPinata:
+		return NewPinataFromEnv()
+	case ProviderKubo, "ipfs":
+		return NewKubo(os.Getenv("IPFS_API_URL")), nil
+	case ProviderFile:
+		dir := os.Getenv("IPFS_FILE_DIR")
+		if dir == "" {
+			dir = "ipfs-pins"
+		}
+		return NewFilePinner(dir)
+	case ProviderMemory, "mock":
+		return NewMemoryPinner(), nil
+	default:
+		return nil, fmt.Errorf("unknown IPFS_PROVIDER %q (want pinata, kubo, file or memory)", provider)
+	}
+}
+
+// NewPinner is for config files that hold a provider name and a single
+// credential, such as config.json's storage section: for Pinata it is the
+// JWT, for Kubo the API URL and for the filesystem the directory. An
+// IPFS_PROVIDER set in the environment takes precedence, and
+// PIN_REGISTRY_PATH wraps it in a PinManager as for NewPinnerFromEnv.
+func NewPinner(provider, credential string) (Pinner, error) {
+	if os.Getenv("IPFS_PROVIDER") != "" {
+		return NewPinnerFromEnv()
+	}
+	var p Pinner
+	var err error
+	switch strings.ToLower(provider) {
+	case "", ProviderPinata:
+		if credential == "" {
+			p, err = NewPinataFromEnv()
+		} else {
+			p = NewPinataJWT(credential)
+		}
+	case ProviderKubo, "ipfs":
+		p = NewKubo(credential)
+	case ProviderFile:
+		if credential == "" {
+			credential = "ipfs-pins"
+		}
+		p, err = NewFilePinner(credential)
+	case ProviderMemory, "mock":
+		p = NewMemoryPinner()
+	default:
+		return nil, fmt.Errorf("unknown IPFS provider %q (want pinata, kubo, file or memory)", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return managed(p)
+}
+
+// managed wraps p in a PinManager when PIN_REGISTRY_PATH is set
+func managed(p Pinner) (Pinner, error) {
+	if os.Getenv("PIN_REGISTRY_PATH") == "" {
+		return p, nil
+	}
+	return managerFromEnv(p)
+}
+
+// marshal encodes JSON the same way for every backend, so the same
+// metadata always pins to the same CID
+func marshal(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return data, nil
+}
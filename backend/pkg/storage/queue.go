@@ -0,0 +1,470 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UploadStatus is where an upload job is in its life
+type UploadStatus string
+
+const (
+	UploadQueued UploadStatus = "queued" // Waiting for its next attempt
+	UploadDone   UploadStatus = "done"   // Every file pinned at its expected CID
+	UploadDead   UploadStatus = "dead"   // In the dead-letter queue until replayed
+)
+
+// Upload queue defaults
+const (
+	DefaultUploadAttempts   = 6
+	DefaultUploadBackoff    = 30 * time.Second
+	DefaultUploadMaxBackoff = 30 * time.Minute
+	// DefaultUploadLease is how long a worker owns a job it is uploading;
+	// a job whose worker died is retried after it
+	DefaultUploadLease = 5 * time.Minute
+	// DefaultUploadRetention is how long a done job stays in the queue
+	DefaultUploadRetention = 7 * 24 * time.Hour
+)
+
+var (
+	ErrUploadDead    = errors.New("upload is in the dead-letter queue")
+	ErrUnknownUpload = errors.New("unknown upload job")
+)
+
+// UploadFile is one file of a job and the CID it must pin at. Data is
+// dropped once the job is done.
+type UploadFile struct {
+	Name   string `json:"name"`
+	Data   []byte `json:"data"`
+	CID    CID    `json:"cid"`
+	Pinned bool   `json:"pinned"`
+}
+
+// UploadJob pins a set of files in order, e.g. a ticket's artwork and then
+// its metadata
+type UploadJob struct {
+	ID    string       `json:"id"`
+	Ref   string       `json:"ref,omitempty"` // What the files belong to, e.g. a ticket ID
+	Files []UploadFile `json:"files"`
+	// JourneyEnd is passed to a JourneyTracker pinner with Ref once the
+	// files are pinned
+	JourneyEnd  time.Time    `json:"journey_end,omitempty"`
+	Status      UploadStatus `json:"status"`
+	Attempts    int          `json:"attempts"`
+	NextAttempt time.Time    `json:"next_attempt,omitempty"`
+	LeaseUntil  time.Time    `json:"lease_until,omitempty"`
+	LastError   string       `json:"last_error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// Verified reports whether every file is pinned at the CID computed for it
+// locally. Nothing may point at a job's CIDs until it is.
+func (j UploadJob) Verified() bool {
+	if j.Status != UploadDone {
+		return false
+	}
+	for _, f := range j.Files {
+		if !f.Pinned {
+			return false
+		}
+	}
+	return true
+}
+
+// UploadQueue persists upload jobs to a JSON file and pins them in the
+// background, retrying with exponential backoff. A job that runs out of
+// attempts, or whose provider returns a different CID, moves to the
+// dead-letter queue until Replay. Workers lease jobs under a file lock, so
+// several processes can share a queue on a volume. Done jobs keep their CIDs
+// but not their content, and are removed after Retention.
+type UploadQueue struct {
+	pinner Pinner
+	path   string
+
+	MaxAttempts  int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+	Retention    time.Duration
+	PollInterval time.Duration // How often Wait and Run look for new work
+
+	jobs []UploadJob // Used only when path is empty
+	wake chan struct{}
+	mu   sync.Mutex
+}
+
+// NewUploadQueue keeps jobs at path, or in memory if path is empty, and
+// pins them with pinner
+func NewUploadQueue(path string, pinner Pinner) *UploadQueue {
+	return &UploadQueue{
+		pinner:       pinner,
+		path:         path,
+		MaxAttempts:  DefaultUploadAttempts,
+		Backoff:      DefaultUploadBackoff,
+		MaxBackoff:   DefaultUploadMaxBackoff,
+		Lease:        DefaultUploadLease,
+		Retention:    DefaultUploadRetention,
+		PollInterval: 5 * time.Second,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Pinner is the backend the queue pins with, e.g. to compute CIDs for a job
+func (q *UploadQueue) Pinner() Pinner { return q.pinner }
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Enqueue saves a job with its Ref, Files and JourneyEnd set. Each file's
+// CID is checked against its content first; once Enqueue returns the job
+// will be attempted even if the process restarts.
+func (q *UploadQueue) Enqueue(job UploadJob) (UploadJob, error) {
+	if len(job.Files) == 0 {
+		return UploadJob{}, errors.New("upload job has no files")
+	}
+	for _, f := range job.Files {
+		expected, err := q.pinner.CIDFor(f.Data)
+		if err != nil {
+			return UploadJob{}, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if f.CID != expected {
+			return UploadJob{}, fmt.Errorf("%s: %w: %s pins at %s", f.Name, ErrCIDMismatch, q.pinner.Name(), expected)
+		}
+	}
+	now := time.Now().UTC()
+	job.ID, job.Status, job.Attempts = newJobID(), UploadQueued, 0
+	job.NextAttempt, job.LeaseUntil, job.LastError = now, time.Time{}, ""
+	job.CreatedAt, job.UpdatedAt = now, now
+	for i := range job.Files {
+		job.Files[i].Pinned = false
+	}
+	err := q.update(func(jobs []UploadJob) ([]UploadJob, bool, error) {
+		return append(jobs, job), true, nil
+	})
+	if err != nil {
+		return UploadJob{}, fmt.Errorf("failed to queue upload: %w", err)
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a job
+func (q *UploadQueue) Get(id string) (UploadJob, error) {
+	jobs, err := q.Jobs("")
+	if err != nil {
+		return UploadJob{}, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return UploadJob{}, ErrUnknownUpload
+}
+
+// Jobs returns the jobs with a status, or all jobs if status is empty,
+// newest first
+func (q *UploadQueue) Jobs(status UploadStatus) ([]UploadJob, error) {
+	q.mu.Lock()
+	jobs, err := q.load()
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	list := []UploadJob{}
+	for _, job := range jobs {
+		if status == "" || job.Status == status {
+			list = append(list, job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Replay moves a dead job back to the queue with a fresh set of attempts
+func (q *UploadQueue) Replay(id string) (UploadJob, error) {
+	var replayed UploadJob
+	err := q.update(func(jobs []UploadJob) ([]UploadJob, bool, error) {
+		for i := range jobs {
+			if jobs[i].ID != id {
+				continue
+			}
+			if jobs[i].Status != UploadDead {
+				return nil, false, fmt.Errorf("upload %s is %s, not dead", id, jobs[i].Status)
+			}
+			now := time.Now().UTC()
+			jobs[i].Status, jobs[i].Attempts = UploadQueued, 0
+			jobs[i].NextAttempt, jobs[i].LeaseUntil, jobs[i].UpdatedAt = now, time.Time{}, now
+			replayed = jobs[i]
+			return jobs, true, nil
+		}
+		return nil, false, ErrUnknownUpload
+	})
+	if err != nil {
+		return UploadJob{}, err
+	}
+	log.Printf("🔁 Replaying upload %s (%s)", id, replayed.Ref)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return replayed, nil
+}
+
+// Wait blocks until a job is done, returning ErrUploadDead if it fails for
+// good. A cancelled ctx leaves the job queued.
+func (q *UploadQueue) Wait(ctx context.Context, id string) (UploadJob, error) {
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := q.Get(id)
+		switch {
+		case err != nil:
+			return job, err
+		case job.Status == UploadDone:
+			return job, nil
+		case job.Status == UploadDead:
+			return job, fmt.Errorf("%w: %s", ErrUploadDead, job.LastError)
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run uploads due jobs until ctx is cancelled
+func (q *UploadQueue) Run(ctx context.Context) {
+	log.Printf("📤 Upload queue running with %s (max %d attempts)", q.pinner.Name(), q.MaxAttempts)
+	for {
+		q.Process(ctx)
+		timer := time.NewTimer(q.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Process attempts every due job once and returns how many it attempted
+func (q *UploadQueue) Process(ctx context.Context) int {
+	attempted := 0
+	for ctx.Err() == nil {
+		job, ok, err := q.claim()
+		if err != nil {
+			log.Printf("⚠️  Failed to read upload queue: %v", err)
+			break
+		}
+		if !ok {
+			break
+		}
+		attempted++
+		q.attempt(ctx, job)
+	}
+	return attempted
+}
+
+// claim leases the oldest due job to this worker, removing done jobs past
+// their retention on the way
+func (q *UploadQueue) claim() (UploadJob, bool, error) {
+	var claimed UploadJob
+	found := false
+	err := q.update(func(jobs []UploadJob) ([]UploadJob, bool, error) {
+		now := time.Now().UTC()
+		kept := jobs[:0]
+		for _, job := range jobs {
+			if job.Status != UploadDone || now.Sub(job.UpdatedAt) <= q.Retention {
+				kept = append(kept, job)
+			}
+		}
+		pruned := len(kept) < len(jobs)
+		jobs = kept
+
+		best := -1
+		for i, job := range jobs {
+			if job.Status != UploadQueued || job.NextAttempt.After(now) || job.LeaseUntil.After(now) {
+				continue
+			}
+			if best < 0 || job.CreatedAt.Before(jobs[best].CreatedAt) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return jobs, pruned, nil
+		}
+		jobs[best].LeaseUntil = now.Add(q.Lease)
+		jobs[best].Attempts++
+		claimed, found = jobs[best], true
+		return jobs, true, nil
+	})
+	return claimed, found, err
+}
+
+// attempt pins the job's remaining files in order and records the outcome
+func (q *UploadQueue) attempt(ctx context.Context, job UploadJob) {
+	var pinErr error
+	permanent := false
+	for i := range job.Files {
+		f := &job.Files[i]
+		if f.Pinned {
+			continue
+		}
+		pin, err := q.pinner.PinFile(ctx, f.Name, f.Data)
+		switch {
+		case err != nil:
+		case pin.CID != f.CID:
+			err = fmt.Errorf("%w: %s returned %s for %s, expected %s", ErrCIDMismatch, q.pinner.Name(), pin.CID, f.Name, f.CID)
+		case !pin.Verified:
+			err = fmt.Errorf("%w: %s for %s from %s", ErrUnverified, pin.CID, f.Name, q.pinner.Name())
+		}
+		if err != nil {
+			pinErr = err
+			// Retrying cannot change what the provider hashes content to
+			permanent = errors.Is(err, ErrCIDMismatch) || errors.Is(err, ErrUnverified)
+			break
+		}
+		f.Pinned = true
+	}
+
+	err := q.update(func(jobs []UploadJob) ([]UploadJob, bool, error) {
+		for i := range jobs {
+			if jobs[i].ID != job.ID {
+				continue
+			}
+			now := time.Now().UTC()
+			current := &jobs[i]
+			current.Files, current.LeaseUntil, current.UpdatedAt = job.Files, time.Time{}, now
+			switch {
+			case pinErr == nil:
+				current.Status, current.LastError = UploadDone, ""
+				// Only the CIDs are needed from here on
+				for j := range current.Files {
+					current.Files[j].Data = nil
+				}
+				log.Printf("✅ Uploaded %s (%d files, attempt %d)", describeJob(*current), len(current.Files), current.Attempts)
+			case permanent || current.Attempts >= q.MaxAttempts:
+				current.Status, current.LastError = UploadDead, pinErr.Error()
+				log.Printf("❌ Upload %s moved to the dead-letter queue after %d attempts: %v", describeJob(*current), current.Attempts, pinErr)
+			default:
+				current.LastError = pinErr.Error()
+				current.NextAttempt = now.Add(q.backoff(current.Attempts))
+				log.Printf("⏳ Upload %s failed (attempt %d/%d), retrying at %s: %v",
+					describeJob(*current), current.Attempts, q.MaxAttempts, current.NextAttempt.Format(time.TimeOnly), pinErr)
+			}
+			return jobs, true, nil
+		}
+		return jobs, false, nil
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to save upload queue: %v", err)
+		return
+	}
+
+	// Start the retention window now the pins exist to carry it
+	if tracker, ok := q.pinner.(JourneyTracker); ok && pinErr == nil && job.Ref != "" && !job.JourneyEnd.IsZero() {
+		if err := tracker.TrackJourney(job.Ref, job.JourneyEnd); err != nil {
+			log.Printf("⚠️  Upload %s pins will not expire: %v", describeJob(job), err)
+		}
+	}
+}
+
+func describeJob(job UploadJob) string {
+	if job.Ref == "" {
+		return job.ID
+	}
+	return job.ID + " (" + job.Ref + ")"
+}
+
+// backoff doubles the wait after each failed attempt, up to MaxBackoff
+func (q *UploadQueue) backoff(attempts int) time.Duration {
+	wait := q.Backoff
+	for i := 1; i < attempts && wait < q.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, q.MaxBackoff)
+}
+
+// update applies fn to the current jobs under the file lock and saves them
+// if fn reports a change
+func (q *UploadQueue) update(fn func([]UploadJob) ([]UploadJob, bool, error)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.path != "" {
+		unlock, err := lockFile(q.path + ".lock")
+		if err != nil {
+			return fmt.Errorf("failed to lock upload queue: %w", err)
+		}
+		defer unlock()
+	}
+	jobs, err := q.load()
+	if err != nil {
+		return err
+	}
+	jobs, changed, err := fn(jobs)
+	if err != nil || !changed {
+		return err
+	}
+	return q.save(jobs)
+}
+
+func (q *UploadQueue) load() ([]UploadJob, error) {
+	if q.path == "" {
+		jobs := make([]UploadJob, len(q.jobs))
+		for i, job := range q.jobs {
+			jobs[i] = job
+			jobs[i].Files = append([]UploadFile(nil), job.Files...)
+		}
+		return jobs, nil
+	}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []UploadJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("invalid upload queue %s: %w", q.path, err)
+	}
+	return jobs, nil
+}
+
+// save writes the queue atomically; callers hold q.mu
+func (q *UploadQueue) save(jobs []UploadJob) error {
+	if q.path == "" {
+		q.jobs = jobs
+		return nil
+	}
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(q.path), "."+filepath.Base(q.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
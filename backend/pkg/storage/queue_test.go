@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scriptedPinner fails, or misreports, the uploads a test asks it to
+type scriptedPinner struct {
+	*MemoryPinner
+	fail       map[string]int // Failures left per file name
+	cid        CID            // Reported instead of the real CID when set
+	unverified bool
+	pinned     []string
+}
+
+func (p *scriptedPinner) PinFile(ctx context.Context, name string, data []byte) (Pin, error) {
+	if p.fail[name] > 0 {
+		p.fail[name]--
+		return Pin{}, errors.New("gateway timeout")
+	}
+	pin, err := p.MemoryPinner.PinFile(ctx, name, data)
+	p.pinned = append(p.pinned, name)
+	if p.cid != "" {
+		pin.CID = p.cid
+	}
+	if p.unverified {
+		pin.Verified = false
+	}
+	return pin, err
+}
+
+func newTestQueue(path string, pinner Pinner) *UploadQueue {
+	q := NewUploadQueue(path, pinner)
+	q.MaxAttempts = 3
+	q.Backoff = time.Hour
+	q.MaxBackoff = 4 * time.Hour
+	return q
+}
+
+// makeDue brings every queued job's next attempt forward to now
+func makeDue(t *testing.T, q *UploadQueue) {
+	t.Helper()
+	err := q.update(func(jobs []UploadJob) ([]UploadJob, bool, error) {
+		for i := range jobs {
+			jobs[i].NextAttempt = time.Time{}
+		}
+		return jobs, true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ticketJob(t *testing.T, pinner Pinner) UploadJob {
+	t.Helper()
+	job := UploadJob{Ref: "TKT1", Files: []UploadFile{
+		{Name: "ticket-TKT1.svg", Data: []byte("<svg/>")},
+		{Name: "ticket-TKT1.json", Data: []byte(`{"image":"ipfs://..."}`)},
+	}}
+	for i := range job.Files {
+		cid, err := pinner.CIDFor(job.Files[i].Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Files[i].CID = cid
+	}
+	return job
+}
+
+func TestUploadQueueRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "uploads.json")
+	pinner := &scriptedPinner{MemoryPinner: NewMemoryPinner(), fail: map[string]int{"ticket-TKT1.json": 3}}
+	q := newTestQueue(path, pinner)
+
+	job, err := q.Enqueue(ticketJob(t, pinner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := q.Process(ctx); n != 1 {
+		t.Fatalf("first Process attempted %d jobs, want 1", n)
+	}
+	if n := q.Process(ctx); n != 0 {
+		t.Errorf("Process during backoff attempted %d jobs, want 0", n)
+	}
+
+	// A restarted worker picks up where the last one stopped
+	q = newTestQueue(path, pinner)
+	got, err := q.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != UploadQueued || got.Attempts != 1 || got.LastError == "" {
+		t.Fatalf("after one failure: %s, %d attempts, error %q", got.Status, got.Attempts, got.LastError)
+	}
+	if !got.Files[0].Pinned || got.Files[1].Pinned {
+		t.Errorf("pinned flags = %v, %v, want only the artwork pinned", got.Files[0].Pinned, got.Files[1].Pinned)
+	}
+	if wait := time.Until(got.NextAttempt); wait < 59*time.Minute || wait > time.Hour {
+		t.Errorf("next attempt in %s, want the 1h backoff", wait)
+	}
+
+	makeDue(t, q)
+	q.Process(ctx)
+	if got, _ = q.Get(job.ID); got.Attempts != 2 || time.Until(got.NextAttempt) < 119*time.Minute {
+		t.Errorf("after two failures: %d attempts, next in %s, want 2 and a doubled backoff",
+			got.Attempts, time.Until(got.NextAttempt))
+	}
+
+	makeDue(t, q)
+	q.Process(ctx)
+	if _, err := q.Wait(ctx, job.ID); !errors.Is(err, ErrUploadDead) {
+		t.Fatalf("Wait after the last attempt = %v, want ErrUploadDead", err)
+	}
+	if dead, _ := q.Jobs(UploadDead); len(dead) != 1 {
+		t.Fatalf("%d dead jobs, want 1", len(dead))
+	}
+
+	// Replayed jobs get a fresh set of attempts and only pin what is left
+	if _, err := q.Replay(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Replay(job.ID); err == nil {
+		t.Error("replayed a job that is not dead")
+	}
+	pinner.fail = nil
+	q.Process(ctx)
+
+	q = newTestQueue(path, pinner)
+	done, err := q.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done.Verified() || done.Attempts != 1 {
+		t.Errorf("done job verified=%v attempts=%d, want verified after 1 attempt", done.Verified(), done.Attempts)
+	}
+	for _, f := range done.Files {
+		if f.Data != nil {
+			t.Errorf("%s kept its content after upload", f.Name)
+		}
+	}
+	want := []string{"ticket-TKT1.svg", "ticket-TKT1.json"}
+	if !reflect.DeepEqual(pinner.pinned, want) {
+		t.Errorf("pinned %v, want each file once: %v", pinner.pinned, want)
+	}
+}
+
+func TestUploadQueuePermanentFailures(t *testing.T) {
+	ctx := context.Background()
+	for name, pinner := range map[string]*scriptedPinner{
+		"wrong CID":  {MemoryPinner: NewMemoryPinner(), cid: rawCID([]byte("other content"))},
+		"unverified": {MemoryPinner: NewMemoryPinner(), unverified: true},
+	} {
+		q := newTestQueue("", pinner)
+		job, err := q.Enqueue(ticketJob(t, pinner))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Process(ctx)
+		got, err := q.Get(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != UploadDead || got.Attempts != 1 {
+			t.Errorf("%s: %s after %d attempts, want dead after 1", name, got.Status, got.Attempts)
+		}
+		if got.Verified() {
+			t.Errorf("%s: dead job reports verified", name)
+		}
+	}
+}
+
+func TestUploadQueueEnqueueChecksCIDs(t *testing.T) {
+	pinner := &scriptedPinner{MemoryPinner: NewMemoryPinner()}
+	q := newTestQueue("", pinner)
+	job := ticketJob(t, pinner)
+	job.Files[1].CID = rawCID([]byte("something else"))
+	if _, err := q.Enqueue(job); !errors.Is(err, ErrCIDMismatch) {
+		t.Errorf("Enqueue with a wrong CID = %v, want ErrCIDMismatch", err)
+	}
+	if jobs, _ := q.Jobs(""); len(jobs) != 0 {
+		t.Errorf("%d jobs queued, want none", len(jobs))
+	}
+}
+
+func TestUploadQueueExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "uploads.json")
+	pinner := &scriptedPinner{MemoryPinner: NewMemoryPinner()}
+	q := newTestQueue(path, pinner)
+	q.Lease = 10 * time.Millisecond
+	job, err := q.Enqueue(ticketJob(t, pinner))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker that claims the job and dies holds it only until its lease ends
+	if _, ok, err := q.claim(); !ok || err != nil {
+		t.Fatalf("claim = %v, %v", ok, err)
+	}
+	other := newTestQueue(path, pinner)
+	if n := other.Process(ctx); n != 0 {
+		t.Fatalf("another worker took a leased job")
+	}
+	time.Sleep(2 * q.Lease)
+	if n := other.Process(ctx); n != 1 {
+		t.Fatalf("expired lease: attempted %d jobs, want 1", n)
+	}
+	if got, _ := other.Get(job.ID); got.Status != UploadDone || got.Attempts != 2 {
+		t.Errorf("job %s after %d attempts, want done after 2", got.Status, got.Attempts)
+	}
+}
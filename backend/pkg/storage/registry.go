@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PinStatus is where a pin is in its life
+type PinStatus string
+
+const (
+	PinStatusPinned   PinStatus = "pinned"
+	PinStatusFailed   PinStatus = "failed"   // The upload failed; there is no CID
+	PinStatusUnpinned PinStatus = "unpinned" // Released after the retention window
+	PinStatusCold     PinStatus = "cold"     // Copied to cold storage, then released
+)
+
+// PinRecord is one upload and what has happened to it since
+type PinRecord struct {
+	CID        CID       `json:"cid,omitempty"`
+	Name       string    `json:"name"`
+	TicketID   string    `json:"ticket_id,omitempty"`
+	Provider   string    `json:"provider"`
+	Size       int64     `json:"size"`
+	Status     PinStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+	// JourneyEnd is when the ticket's journey finishes; the retention
+	// window counts from here. Zero keeps the pin indefinitely.
+	JourneyEnd time.Time `json:"journey_end,omitempty"`
+	RemovedAt  time.Time `json:"removed_at,omitempty"`
+	ColdCID    CID       `json:"cold_cid,omitempty"` // The content's CID in cold storage
+	// Imported is set on pins Reconcile found at the provider
+	Imported bool `json:"imported,omitempty"`
+}
+
+// PinRegistry keeps PinRecords in a JSON file. Every update locks the file
+// and re-reads it, so uploaders, the pin manager and the dashboard can share
+// one registry on a volume.
+type PinRegistry struct {
+	path    string
+	records []PinRecord // Used only when path is empty
+	mu      sync.Mutex
+}
+
+// NewPinRegistry keeps records at path, or in memory if path is empty
+func NewPinRegistry(path string) *PinRegistry {
+	return &PinRegistry{path: path}
+}
+
+// Records returns every record, oldest first
+func (r *PinRegistry) Records() ([]PinRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// Add appends records
+func (r *PinRegistry) Add(recs ...PinRecord) error {
+	return r.update(func(records []PinRecord) ([]PinRecord, error) {
+		return append(records, recs...), nil
+	})
+}
+
+// update applies fn to the current records and saves the result
+func (r *PinRegistry) update(fn func([]PinRecord) ([]PinRecord, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path != "" {
+		unlock, err := lockFile(r.path + ".lock")
+		if err != nil {
+			return fmt.Errorf("failed to lock pin registry: %w", err)
+		}
+		defer unlock()
+	}
+	records, err := r.load()
+	if err != nil {
+		return err
+	}
+	if records, err = fn(records); err != nil {
+		return err
+	}
+	return r.save(records)
+}
+
+func (r *PinRegistry) load() ([]PinRecord, error) {
+	if r.path == "" {
+		return append([]PinRecord(nil), r.records...), nil
+	}
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []PinRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid pin registry %s: %w", r.path, err)
+	}
+	return records, nil
+}
+
+// save writes the registry atomically; callers hold r.mu
+func (r *PinRegistry) save(records []PinRecord) error {
+	if r.path == "" {
+		r.records = records
+		return nil
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(r.path), "."+filepath.Base(r.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// ticketIDFromName reads the ticket ID from pin names like "ticket-TKT1",
+// "ticket-TKT1.json" and "ticket-TKT1.svg"
+func ticketIDFromName(name string) string {
+	id, ok := strings.CutPrefix(name, "ticket-")
+	if !ok {
+		return ""
+	}
+	if dot := strings.LastIndexByte(id, '.'); dot > 0 {
+		id = id[:dot]
+	}
+	return id
+}
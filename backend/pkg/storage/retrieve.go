@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PublicGateways are raced when no gateways are configured
+var PublicGateways = []string{DefaultGateway, "https://dweb.link/ipfs/"}
+
+// Retriever fetches content by CID, racing every gateway at once and
+// returning the first response that matches the CID. Verified content is
+// kept in an optional DiskCache, and concurrent fetches of one CID share a
+// single race.
+type Retriever struct {
+	gateways []*GatewayVerifier
+	names    []string
+	Cache    *DiskCache // Nil disables caching
+
+	mu       sync.Mutex
+	inflight map[CID]*retrieval
+}
+
+type retrieval struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewRetriever races gateways, or PublicGateways if there are none
+func NewRetriever(gateways []string, cache *DiskCache) *Retriever {
+	if len(gateways) == 0 {
+		gateways = PublicGateways
+	}
+	r := &Retriever{Cache: cache, inflight: make(map[CID]*retrieval)}
+	for _, gateway := range gateways {
+		r.gateways = append(r.gateways, NewGatewayVerifier(gateway))
+		r.names = append(r.names, gateway)
+	}
+	return r
+}
+
+// NewRetrieverFromEnv races the comma-separated IPFS_GATEWAYS, e.g. a
+// Pinata dedicated gateway, a local node's gateway and public ones. Without
+// it, PINATA_GATEWAY and IPFS_GATEWAY are tried alongside PublicGateways.
+// Content is cached in IPFS_CACHE_DIR (default ./ipfs-cache), up to
+// IPFS_CACHE_MB megabytes (default 256); IPFS_CACHE_DIR=off disables it.
+func NewRetrieverFromEnv() (*Retriever, error) {
+	var gateways []string
+	if list := os.Getenv("IPFS_GATEWAYS"); list != "" {
+		for _, gateway := range strings.Split(list, ",") {
+			if gateway = strings.TrimSpace(gateway); gateway != "" {
+				gateways = append(gateways, gateway)
+			}
+		}
+	} else {
+		for _, key := range []string{"PINATA_GATEWAY", "IPFS_GATEWAY"} {
+			if gateway := os.Getenv(key); gateway != "" {
+				gateways = append(gateways, gateway)
+			}
+		}
+		gateways = append(gateways, PublicGateways...)
+	}
+
+	dir := os.Getenv("IPFS_CACHE_DIR")
+	if dir == "" {
+		dir = "ipfs-cache"
+	}
+	if dir == "off" {
+		return NewRetriever(gateways, nil), nil
+	}
+	var maxBytes int64
+	if mb := os.Getenv("IPFS_CACHE_MB"); mb != "" {
+		n, err := strconv.ParseInt(mb, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid IPFS_CACHE_MB %q", mb)
+		}
+		maxBytes = n << 20
+	}
+	cache, err := NewDiskCache(dir, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IPFS cache: %w", err)
+	}
+	return NewRetriever(gateways, cache), nil
+}
+
+// Gateways lists the gateways raced, in configured order
+func (r *Retriever) Gateways() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Fetch returns the content behind cid from the cache or the first gateway
+// to serve it intact. Only single-chunk content can be checked; larger
+// content returns ErrTooLarge.
+func (r *Retriever) Fetch(ctx context.Context, cid CID) ([]byte, error) {
+	if _, err := ParseCID(string(cid)); err != nil {
+		return nil, err
+	}
+	if r.Cache != nil {
+		if data, ok := r.Cache.Get(cid); ok {
+			return data, nil
+		}
+	}
+
+	r.mu.Lock()
+	call, ok := r.inflight[cid]
+	if !ok {
+		call = &retrieval{done: make(chan struct{})}
+		r.inflight[cid] = call
+		go func() {
+			// Detached so one caller giving up does not fail the others
+			call.data, call.err = r.race(context.WithoutCancel(ctx), cid)
+			if call.err == nil && r.Cache != nil {
+				if err := r.Cache.Put(cid, call.data); err != nil {
+					log.Printf("⚠️  Failed to cache %s: %v", cid, err)
+				}
+			}
+			r.mu.Lock()
+			delete(r.inflight, cid)
+			r.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// race asks every gateway for cid and returns the first verified response,
+// cancelling the rest
+func (r *Retriever) race(ctx context.Context, cid CID) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		gateway string
+		data    []byte
+		err     error
+	}
+	results := make(chan result, len(r.gateways))
+	for i, gateway := range r.gateways {
+		go func(name string, gateway *GatewayVerifier) {
+			data, err := gateway.Fetch(ctx, cid)
+			results <- result{name, data, err}
+		}(r.names[i], gateway)
+	}
+
+	var errs []error
+	for range r.gateways {
+		res := <-results
+		if res.err == nil {
+			return res.data, nil
+		}
+		if errors.Is(res.err, ErrTooLarge) {
+			return nil, res.err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", res.gateway, res.err))
+	}
+	return nil, fmt.Errorf("no gateway served %s intact: %w", cid, errors.Join(errs...))
+}
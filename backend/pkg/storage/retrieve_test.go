@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gateway serves body for every CID after delay and counts its requests
+type gateway struct {
+	*httptest.Server
+	hits atomic.Int32
+}
+
+func newGateway(t *testing.T, status int, body []byte, delay time.Duration) *gateway {
+	g := &gateway{}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.hits.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *gateway) ipfs() string { return g.URL + "/ipfs/" }
+
+var (
+	retrieveContent = []byte(`{"name":"Africa Railways: Ticket #1024"}`)
+	retrieveCID     = rawCID(retrieveContent)
+)
+
+func TestRetrieverRejectsTamperedContent(t *testing.T) {
+	// The fastest gateway answers with content that does not match the CID
+	tampered := newGateway(t, http.StatusOK, []byte(`{"name":"forged"}`), 0)
+	missing := newGateway(t, http.StatusNotFound, nil, 0)
+	honest := newGateway(t, http.StatusOK, retrieveContent, 50*time.Millisecond)
+
+	r := NewRetriever([]string{tampered.ipfs(), missing.ipfs(), honest.ipfs()}, nil)
+	data, err := r.Fetch(context.Background(), retrieveCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, retrieveContent) {
+		t.Errorf("Fetch = %q, want the content the CID names", data)
+	}
+}
+
+func TestRetrieverNoIntactCopy(t *testing.T) {
+	tampered := newGateway(t, http.StatusOK, []byte("forged"), 0)
+	missing := newGateway(t, http.StatusNotFound, nil, 0)
+
+	r := NewRetriever([]string{tampered.ipfs(), missing.ipfs()}, nil)
+	if _, err := r.Fetch(context.Background(), retrieveCID); !errors.Is(err, ErrCIDMismatch) {
+		t.Errorf("Fetch = %v, want ErrCIDMismatch", err)
+	}
+
+	large := newGateway(t, http.StatusOK, make([]byte, ChunkSize+1), 0)
+	r = NewRetriever([]string{large.ipfs()}, nil)
+	if _, err := r.Fetch(context.Background(), cidVectors[1].v0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Fetch of multi-chunk content = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestRetrieverCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	honest := newGateway(t, http.StatusOK, retrieveContent, 0)
+	r := NewRetriever([]string{honest.ipfs()}, cache)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if data, err := r.Fetch(ctx, retrieveCID); err != nil || !bytes.Equal(data, retrieveContent) {
+			t.Fatalf("Fetch %d = %q, %v", i, data, err)
+		}
+	}
+	if hits := honest.hits.Load(); hits != 1 {
+		t.Errorf("gateway asked %d times, want once then served from the cache", hits)
+	}
+
+	// A corrupted cache file is a miss, not a wrong answer
+	if err := os.WriteFile(filepath.Join(dir, string(retrieveCID)), []byte("bit rot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := r.Fetch(ctx, retrieveCID); err != nil || !bytes.Equal(data, retrieveContent) {
+		t.Errorf("Fetch over a corrupt cache = %q, %v", data, err)
+	}
+	if hits := honest.hits.Load(); hits != 2 {
+		t.Errorf("gateway asked %d times, want a refetch after the corrupt read", hits)
+	}
+
+	if err := cache.Put(retrieveCID, []byte("forged")); !errors.Is(err, ErrCIDMismatch) {
+		t.Errorf("caching the wrong content = %v, want ErrCIDMismatch", err)
+	}
+}
+
+func TestRetrieverSharesRaces(t *testing.T) {
+	slow := newGateway(t, http.StatusOK, retrieveContent, 100*time.Millisecond)
+	r := NewRetriever([]string{slow.ipfs()}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Fetch(context.Background(), retrieveCID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if hits := slow.hits.Load(); hits != 1 {
+		t.Errorf("gateway asked %d times for concurrent fetches, want 1", hits)
+	}
+
+	// A caller that gives up does not fail the race for the others
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Fetch(ctx, retrieveCID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch past its deadline = %v", err)
+	}
+	if _, err := r.Fetch(context.Background(), retrieveCID); err != nil {
+		t.Errorf("Fetch after another caller gave up: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// GatewayVerifier fetches pinned content back from an HTTP gateway and
+// re-hashes it, proving the gateway serves what the CID names
+type GatewayVerifier struct {
+	gateway string
+	client  *http.Client
+}
+
+// NewGatewayVerifier fetches from gateway, or DefaultGateway if it is empty
+func NewGatewayVerifier(gateway string) *GatewayVerifier {
+	return &GatewayVerifier{gateway: gateway, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Fetch returns the content behind cid once it matches. Only single-chunk
+// content can be checked; larger content returns ErrTooLarge.
+func (v *GatewayVerifier) Fetch(ctx context.Context, cid CID) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cid.URL(v.gateway), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gateway request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway returned %s for %s", resp.Status, cid)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ChunkSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from gateway: %w", cid, err)
+	}
+	if len(data) > ChunkSize {
+		return nil, ErrTooLarge
+	}
+	if err := cid.Verify(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Verify checks that the gateway serves content matching cid
+func (v *GatewayVerifier) Verify(ctx context.Context, cid CID) error {
+	_, err := v.Fetch(ctx, cid)
+	return err
+}
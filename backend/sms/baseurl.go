@@ -0,0 +1,45 @@
+package sms
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// baseURLTransport sends every request to base instead of the host it was
+// built for. Both provider SDKs hardcode their API hosts, so this is how
+// AT_BASE_URL and TWILIO_BASE_URL point them at the fake SMSC.
+type baseURLTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = t.base.Scheme
+	out.URL.Host = t.base.Host
+	out.URL.Path = strings.TrimRight(t.base.Path, "/") + req.URL.Path
+	out.URL.RawPath = ""
+	out.Host = ""
+	return t.next.RoundTrip(out)
+}
+
+// newBaseURLClient returns an HTTP client that rewrites requests to base
+func newBaseURLClient(base string) (*http.Client, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", base, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: want http(s)://host[:port]", base)
+	}
+	return &http.Client{
+		Transport: &baseURLTransport{base: u, next: http.DefaultTransport},
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
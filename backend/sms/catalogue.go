@@ -0,0 +1,117 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Supported SMS locales
+const (
+	LocaleEnglish    = "en"
+	LocaleSwahili    = "sw"
+	LocaleBemba      = "bem"
+	LocaleZulu       = "zu"
+	LocalePortuguese = "pt"
+)
+
+// PluralCategory returns the CLDR plural category for a cardinal count.
+// Portuguese treats 0 and 1 as singular; the other supported locales only
+// use the singular for exactly 1.
+func PluralCategory(locale string, n int) string {
+	switch locale {
+	case LocalePortuguese:
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// LocaleResolver decides which locale a phone number receives messages in
+type LocaleResolver interface {
+	Locale(phoneNumber string) string
+}
+
+// LocalePreferences stores languages chosen by passengers (for example over
+// USSD) and falls back to a default for the number's country code
+type LocalePreferences struct {
+	locales map[string]string
+	mu      sync.RWMutex
+}
+
+// NewLocalePreferences creates an empty preference table
+func NewLocalePreferences() *LocalePreferences {
+	return &LocalePreferences{locales: make(map[string]string)}
+}
+
+// Set records the locale a passenger picked
+func (lp *LocalePreferences) Set(phoneNumber, locale string) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.locales[phoneNumber] = locale
+}
+
+// Locale returns the stored locale or the country default
+func (lp *LocalePreferences) Locale(phoneNumber string) string {
+	lp.mu.RLock()
+	locale, ok := lp.locales[phoneNumber]
+	lp.mu.RUnlock()
+	if ok {
+		return locale
+	}
+	return DefaultLocale(phoneNumber)
+}
+
+// RedisLocales reads the languages passengers chose over USSD from the
+// gateway's Redis, where they are kept under ussd:lang:<msisdn>, and falls
+// back to the country default
+type RedisLocales struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisLocales reads preferences through client
+func NewRedisLocales(client *redis.Client) *RedisLocales {
+	return &RedisLocales{client: client, prefix: "ussd:lang:", timeout: 2 * time.Second}
+}
+
+// Locale returns the passenger's chosen locale or the country default
+func (rl *RedisLocales) Locale(phoneNumber string) string {
+	msisdn := e164(phoneNumber)
+	if msisdn == "" {
+		return DefaultLocale(phoneNumber)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+	locale, err := rl.client.Get(ctx, rl.prefix+msisdn).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️  Failed to read the language of %s: %v", msisdn, err)
+		}
+		return DefaultLocale(msisdn)
+	}
+	return locale
+}
+
+// DefaultLocale guesses a locale from the MSISDN country code
+func DefaultLocale(phoneNumber string) string {
+	digits := strings.TrimPrefix(phoneNumber, "+")
+	switch {
+	case strings.HasPrefix(digits, "254"), strings.HasPrefix(digits, "255"), strings.HasPrefix(digits, "256"):
+		return LocaleSwahili
+	case strings.HasPrefix(digits, "258"), strings.HasPrefix(digits, "244"):
+		return LocalePortuguese
+	default:
+		return LocaleEnglish
+	}
+}
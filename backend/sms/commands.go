@@ -0,0 +1,263 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Ticket errors reported by a PassengerRegistry
+var (
+	ErrTicketNotFound = errors.New("ticket not found")
+	ErrNotTicketOwner = errors.New("ticket belongs to another passenger")
+	ErrTicketClosed   = errors.New("ticket is already cancelled or exchanged")
+	ErrTooLate        = errors.New("too close to departure")
+	ErrUnknownWallet  = errors.New("no wallet for this number")
+	ErrPINRequired    = errors.New("PIN required")
+	ErrWrongPIN       = errors.New("wrong PIN")
+	ErrPINLocked      = errors.New("PIN locked after too many wrong attempts")
+)
+
+// TicketIssued is the status of a live ticket in the gateway's registry
+const TicketIssued = "issued"
+
+// RefundQuote is what cancelling a ticket refunds
+type RefundQuote struct {
+	TicketID string  `json:"ticket_id"`
+	Percent  float64 `json:"percent,omitempty"`
+	Refund   string  `json:"refund"` // Formatted, e.g. "R112.50"
+	// PINRequired is set when the passenger has a PIN, which confirms the
+	// cancellation in place of YES
+	PINRequired bool `json:"pin_required,omitempty"`
+}
+
+// PassengerRegistry is the ticket and passenger registry commands answer
+// from; GatewayTickets implements it over the USSD gateway's admin API
+type PassengerRegistry interface {
+	Registered(ctx context.Context, phone string) (bool, error)
+	Ticket(ctx context.Context, ticketID string) (*GatewayTicket, error)
+	// PassengerTickets lists a passenger's tickets, newest first
+	PassengerTickets(ctx context.Context, phone string) ([]GatewayTicket, error)
+	QuoteCancel(ctx context.Context, phone, ticketID string) (RefundQuote, error)
+	// Cancel needs the passenger's PIN if they have set one, as the USSD
+	// menu does; pin is empty for those who have not
+	Cancel(ctx context.Context, phone, ticketID, pin string) (RefundQuote, error)
+}
+
+// BalanceSource reports a passenger's AFRC balance
+type BalanceSource interface {
+	Balance(ctx context.Context, phone string) (int, error)
+}
+
+// Command keywords passengers text to the shortcode
+const (
+	CommandTicket    = "TICKET"
+	CommandMyTickets = "MYTICKETS"
+	CommandBalance   = "BAL"
+	CommandCancel    = "CANCEL"
+	CommandStop      = "STOP"
+	CommandStart     = "START"
+	CommandHelp      = "HELP"
+)
+
+// Command is a parsed inbound SMS
+type Command struct {
+	Keyword string
+	Args    []string
+}
+
+// commandAliases are other words passengers use for the same command
+var commandAliases = map[string]string{
+	"BALANCE":     CommandBalance,
+	"MY":          CommandMyTickets, // "MY TICKETS"
+	"TICKETS":     CommandMyTickets,
+	"UNSUBSCRIBE": CommandStop,
+	"STOPALL":     CommandStop,
+	"UNSTOP":      CommandStart,
+	"SUBSCRIBE":   CommandStart,
+}
+
+// ParseCommand reads the keyword and arguments from an SMS. Keywords are
+// case-insensitive and any punctuation around them is ignored.
+func ParseCommand(text string) Command {
+	fields := strings.Fields(strings.ToUpper(text))
+	if len(fields) == 0 {
+		return Command{Keyword: CommandHelp}
+	}
+	keyword := strings.Trim(fields[0], ".,!?#*")
+	if alias, ok := commandAliases[keyword]; ok {
+		keyword = alias
+		if fields[0] == "MY" && len(fields) > 1 && fields[1] == "TICKETS" {
+			fields = fields[1:]
+		}
+	}
+	return Command{Keyword: keyword, Args: fields[1:]}
+}
+
+// maxTicketsListed keeps a MYTICKETS reply within a couple of segments
+const maxTicketsListed = 3
+
+// Commands answers two-way SMS: ticket lookups, balances, cancellations and
+// marketing opt-outs. Replies go out through Notifier.
+type Commands struct {
+	Notifier *NotificationService
+	Registry PassengerRegistry
+	Wallets  BalanceSource // Optional; BAL is unavailable without it
+	OptOuts  OptOutList
+}
+
+// Handle runs the command in an inbound SMS and replies to the sender
+func (c *Commands) Handle(ctx context.Context, from, text string) error {
+	cmd := ParseCommand(text)
+	log.Printf("📩 SMS command %s from %s", cmd.Keyword, from)
+
+	switch cmd.Keyword {
+	case CommandStop:
+		if err := c.OptOuts.OptOut(from); err != nil {
+			return err
+		}
+		return c.Notifier.send(from, TemplateOptedOut, nil)
+	case CommandStart:
+		if err := c.OptOuts.OptIn(from); err != nil {
+			return err
+		}
+		return c.Notifier.send(from, TemplateOptedIn, nil)
+	case CommandTicket, CommandMyTickets, CommandBalance, CommandCancel:
+	default:
+		return c.Notifier.send(from, TemplateCommandHelp, nil)
+	}
+
+	registered, err := c.Registry.Registered(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return c.Notifier.send(from, TemplateNotRegistered, nil)
+	}
+
+	switch cmd.Keyword {
+	case CommandTicket:
+		return c.ticket(ctx, from, cmd.Args)
+	case CommandMyTickets:
+		return c.myTickets(ctx, from)
+	case CommandBalance:
+		return c.balance(ctx, from)
+	default:
+		return c.cancel(ctx, from, cmd.Args)
+	}
+}
+
+func (c *Commands) ticket(ctx context.Context, from string, args []string) error {
+	if len(args) == 0 {
+		return c.Notifier.send(from, TemplateCommandHelp, nil)
+	}
+	ticket, err := c.Registry.Ticket(ctx, args[0])
+	// Another passenger's ticket is reported as unknown, not as theirs
+	if errors.Is(err, ErrTicketNotFound) || err == nil && ticket.MSISDN != from {
+		return c.Notifier.send(from, TemplateTicketRefused, TicketRefused{TicketID: args[0], Reason: ReasonNotFound})
+	}
+	if err != nil {
+		return err
+	}
+	return c.Notifier.send(from, TemplateTicketStatus, ticketStatus(ticket))
+}
+
+func (c *Commands) myTickets(ctx context.Context, from string) error {
+	tickets, err := c.Registry.PassengerTickets(ctx, from)
+	if err != nil {
+		return err
+	}
+	var upcoming []TicketStatus
+	now := time.Now()
+	for i := len(tickets) - 1; i >= 0; i-- {
+		if tickets[i].Status == TicketIssued && tickets[i].Departure.After(now) {
+			upcoming = append(upcoming, ticketStatus(&tickets[i]))
+		}
+	}
+	list := MyTickets{Tickets: upcoming}
+	if len(upcoming) > maxTicketsListed {
+		list.Tickets, list.More = upcoming[:maxTicketsListed], len(upcoming)-maxTicketsListed
+	}
+	return c.Notifier.send(from, TemplateMyTickets, list)
+}
+
+func (c *Commands) balance(ctx context.Context, from string) error {
+	if c.Wallets == nil {
+		return c.Notifier.send(from, TemplateWalletBalance, WalletBalance{Unavailable: true})
+	}
+	balance, err := c.Wallets.Balance(ctx, from)
+	if errors.Is(err, ErrUnknownWallet) {
+		return c.Notifier.send(from, TemplateWalletBalance, WalletBalance{Unavailable: true})
+	}
+	if err != nil {
+		return err
+	}
+	return c.Notifier.send(from, TemplateWalletBalance, WalletBalance{Balance: balance})
+}
+
+// cancel quotes the refund for CANCEL <id> and only cancels once the
+// passenger confirms with CANCEL <id> YES, so a stray text cannot cost them
+// their seat
+func (c *Commands) cancel(ctx context.Context, from string, args []string) error {
+	if len(args) == 0 {
+		return c.Notifier.send(from, TemplateCommandHelp, nil)
+	}
+	// CANCEL <id> YES confirms without a PIN, CANCEL <id> <PIN> with one
+	ticketID := args[0]
+	confirmed := len(args) > 1
+	pin := ""
+	if confirmed && args[1] != "YES" {
+		pin = args[1]
+	}
+
+	var (
+		quote RefundQuote
+		err   error
+	)
+	if confirmed {
+		quote, err = c.Registry.Cancel(ctx, from, ticketID, pin)
+	} else {
+		quote, err = c.Registry.QuoteCancel(ctx, from, ticketID)
+	}
+	if reason, ok := refusalReason(err); ok {
+		return c.Notifier.send(from, TemplateTicketRefused, TicketRefused{TicketID: ticketID, Reason: reason})
+	}
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		return c.Notifier.send(from, TemplateCancelDone, quote)
+	}
+	return c.Notifier.send(from, TemplateCancelQuote, quote)
+}
+
+// refusalReason maps registry errors the passenger should be told about
+func refusalReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrTicketNotFound), errors.Is(err, ErrNotTicketOwner):
+		return ReasonNotFound, true
+	case errors.Is(err, ErrTicketClosed):
+		return ReasonClosed, true
+	case errors.Is(err, ErrTooLate):
+		return ReasonTooLate, true
+	case errors.Is(err, ErrPINRequired):
+		return ReasonPINRequired, true
+	case errors.Is(err, ErrWrongPIN):
+		return ReasonWrongPIN, true
+	case errors.Is(err, ErrPINLocked):
+		return ReasonPINLocked, true
+	}
+	return "", false
+}
+
+func ticketStatus(t *GatewayTicket) TicketStatus {
+	return TicketStatus{
+		TicketID:  t.TicketID,
+		Route:     t.RouteName(),
+		Departure: t.Departure,
+		Status:    t.Status,
+		Price:     t.Price.Display,
+	}
+}
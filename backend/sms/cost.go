@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Pricing holds what each provider charges per segment in USD, by country
+// calling code. The "*" entry prices countries that are not listed.
+type Pricing map[string]map[string]float64
+
+// DefaultPricing is taken from the providers' published rates; load the
+// current ones with LoadPricing before relying on the estimates
+var DefaultPricing = Pricing{
+	ProviderAfricasTalking: {
+		"254": 0.008, // Kenya
+		"256": 0.010, // Uganda
+		"255": 0.012, // Tanzania
+		"234": 0.015, // Nigeria
+		"*":   0.020,
+	},
+	ProviderTwilio: {
+		"1":   0.0079, // USA
+		"254": 0.0550, // Kenya
+		"*":   0.0800,
+	},
+}
+
+// CostEstimate is what sending a message is expected to cost
+type CostEstimate struct {
+	Provider   string  `json:"provider"`
+	PerSegment float64 `json:"per_segment_usd"`
+	Segments   int     `json:"segments"`
+	USD        float64 `json:"usd"`
+}
+
+// LoadPricing reads a Pricing JSON file, e.g.
+// {"twilio": {"1": 0.0079, "*": 0.08}}
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pricing Pricing
+	if err := json.Unmarshal(data, &pricing); err != nil {
+		return nil, fmt.Errorf("invalid SMS pricing %s: %w", path, err)
+	}
+	return pricing, nil
+}
+
+// Estimate prices a message to a number through a provider. Calling codes
+// are matched longest first, so "1" does not swallow "1876".
+func (p Pricing) Estimate(provider, phoneNumber string, info SegmentInfo) (CostEstimate, bool) {
+	rates, ok := p[provider]
+	if !ok {
+		return CostEstimate{}, false
+	}
+	digits := strings.TrimPrefix(phoneNumber, "+")
+	best := ""
+	rate, ok := rates["*"]
+	for code, r := range rates {
+		if code != "*" && strings.HasPrefix(digits, code) && len(code) > len(best) {
+			best, rate, ok = code, r, true
+		}
+	}
+	if !ok {
+		return CostEstimate{}, false
+	}
+	return CostEstimate{
+		Provider:   provider,
+		PerSegment: rate,
+		Segments:   info.Segments,
+		USD:        math.Round(rate*float64(info.Segments)*10000) / 10000,
+	}, true
+}
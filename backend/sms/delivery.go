@@ -0,0 +1,165 @@
+package sms
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/twilio/twilio-go/client"
+)
+
+// DeliveryReports receives delivery-report webhooks from both providers and
+// updates the outbox.
+//
+// Africa's Talking cannot sign its callbacks, so give it a callback URL
+// carrying ?token=<Token>. Twilio requests are checked against their
+// X-Twilio-Signature when TwilioAuthToken and PublicURL are set; otherwise
+// they need the token too. Without a token, Africa's Talking reports are
+// refused.
+type DeliveryReports struct {
+	Outbox          *Outbox
+	Token           string
+	TwilioAuthToken string
+	PublicURL       string // Externally visible base URL, e.g. https://api.africarailways.com
+}
+
+// Configured reports whether any request can be authenticated
+func (d *DeliveryReports) Configured() bool {
+	return webhookAuth(d.Token, d.TwilioAuthToken, d.PublicURL)
+}
+
+// Handler serves /africastalking and /twilio under the path it is mounted at
+func (d *DeliveryReports) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/africastalking", d.handleAfricasTalking)
+	mux.HandleFunc("/twilio", d.handleTwilio)
+	return mux
+}
+
+// handleAfricasTalking reads the form Africa's Talking posts:
+// id, status (Sent, Submitted, Buffered, Rejected, Success, Failed) and
+// failureReason
+func (d *DeliveryReports) handleAfricasTalking(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !checkToken(w, r, d.Token) {
+		return
+	}
+	status, ok := africasTalkingStatus(r.PostFormValue("status"))
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	d.update(w, ProviderAfricasTalking, r.PostFormValue("id"), status, r.PostFormValue("failureReason"))
+}
+
+func africasTalkingStatus(status string) (MessageStatus, bool) {
+	switch status {
+	case "Success":
+		return StatusDelivered, true
+	case "Failed", "Rejected":
+		return StatusFailed, true
+	case "Sent", "Submitted", "Buffered":
+		return StatusSent, true
+	}
+	return "", false
+}
+
+// handleTwilio reads Twilio's status callback: MessageSid, MessageStatus
+// (queued, sending, sent, delivered, undelivered, failed) and ErrorCode
+func (d *DeliveryReports) handleTwilio(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !checkTwilio(w, r, d.Token, d.TwilioAuthToken, d.PublicURL) {
+		return
+	}
+	status, ok := twilioStatus(r.PostFormValue("MessageStatus"))
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	reason := ""
+	if code := r.PostFormValue("ErrorCode"); code != "" {
+		reason = "Twilio error " + code
+	}
+	d.update(w, ProviderTwilio, r.PostFormValue("MessageSid"), status, reason)
+}
+
+func twilioStatus(status string) (MessageStatus, bool) {
+	switch status {
+	case "delivered":
+		return StatusDelivered, true
+	case "undelivered", "failed":
+		return StatusFailed, true
+	case "sent":
+		return StatusSent, true
+	}
+	return "", false
+}
+
+// checkTwilio parses a Twilio webhook and checks its X-Twilio-Signature
+// when authToken and publicURL are set, or the ?token= otherwise
+func checkTwilio(w http.ResponseWriter, r *http.Request, token, authToken, publicURL string) bool {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return false
+	}
+	if authToken == "" || publicURL == "" {
+		return checkToken(w, r, token)
+	}
+	params := make(map[string]string, len(r.PostForm))
+	for key := range r.PostForm {
+		params[key] = r.PostForm.Get(key)
+	}
+	validator := client.NewRequestValidator(authToken)
+	// r.RequestURI is the path Twilio signed, before any StripPrefix
+	url := strings.TrimRight(publicURL, "/") + r.RequestURI
+	if !validator.Validate(url, params, r.Header.Get("X-Twilio-Signature")) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// checkToken checks the ?token=; without a token every request is refused
+func checkToken(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		http.Error(w, "webhook token not configured", http.StatusForbidden)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) == 1 {
+		return true
+	}
+	http.Error(w, "invalid token", http.StatusForbidden)
+	return false
+}
+
+// webhookAuth reports whether a token or Twilio's signature check is set
+func webhookAuth(token, authToken, publicURL string) bool {
+	return token != "" || (authToken != "" && publicURL != "")
+}
+
+// update applies a report. Reports for unknown messages are acknowledged so
+// the provider does not keep retrying them.
+func (d *DeliveryReports) update(w http.ResponseWriter, provider, id string, status MessageStatus, reason string) {
+	if id == "" {
+		http.Error(w, "missing message id", http.StatusBadRequest)
+		return
+	}
+	err := d.Outbox.UpdateStatus(provider, id, status, reason)
+	switch {
+	case errors.Is(err, ErrUnknownMessage):
+		log.Printf("⚠️  Delivery report for unknown %s message %s: %s", provider, id, status)
+	case err != nil:
+		log.Printf("⚠️  Failed to record delivery report: %v", err)
+		http.Error(w, "failed to record report", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// FailoverProvider sends through the first provider that accepts a message.
+// Providers are tried in the default order unless a route matches the
+// recipient's number, e.g. Twilio first for +1 while Africa's Talking stays
+// first for African networks.
+type FailoverProvider struct {
+	providers map[string]SMSProvider
+	order     []string
+	routes    map[string][]string // Number prefix -> provider order
+}
+
+// NewFailoverProvider tries providers in the order given
+func NewFailoverProvider(providers ...SMSProvider) *FailoverProvider {
+	fp := &FailoverProvider{
+		providers: make(map[string]SMSProvider),
+		routes:    make(map[string][]string),
+	}
+	for _, p := range providers {
+		name := providerName(p)
+		fp.providers[name] = p
+		fp.order = append(fp.order, name)
+	}
+	return fp
+}
+
+// NewFailoverProviderFromEnv tries Africa's Talking then Twilio, with
+// per-prefix orders from SMS_ROUTES, e.g. "+1=twilio,africastalking;+44=twilio"
+func NewFailoverProviderFromEnv() (*FailoverProvider, error) {
+	fp := NewFailoverProvider(NewAfricasTalkingProvider(), NewTwilioProvider())
+	routes := strings.TrimSpace(os.Getenv("SMS_ROUTES"))
+	if routes == "" {
+		return fp, nil
+	}
+	for _, route := range strings.Split(routes, ";") {
+		prefix, order, ok := strings.Cut(route, "=")
+		if !ok {
+			return nil, fmt.Errorf("SMS_ROUTES entry %q: want prefix=provider,...", route)
+		}
+		if err := fp.Route(strings.TrimSpace(prefix), strings.Split(order, ",")...); err != nil {
+			return nil, err
+		}
+	}
+	return fp, nil
+}
+
+// Route sets the provider order for numbers starting with prefix. Providers
+// left out are tried afterwards in the default order.
+func (fp *FailoverProvider) Route(prefix string, order ...string) error {
+	prefix = strings.TrimPrefix(prefix, "+")
+	if prefix == "" {
+		return errors.New("route prefix is empty")
+	}
+	var names []string
+	for _, name := range order {
+		name = strings.TrimSpace(name)
+		if _, ok := fp.providers[name]; !ok {
+			return fmt.Errorf("route +%s: unknown SMS provider %q", prefix, name)
+		}
+		names = append(names, name)
+	}
+	for _, name := range fp.order {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	fp.routes[prefix] = names
+	return nil
+}
+
+// Order returns the providers a message to the number is tried with
+func (fp *FailoverProvider) Order(phoneNumber string) []string {
+	digits := strings.TrimPrefix(phoneNumber, "+")
+	best := ""
+	for prefix := range fp.routes {
+		if strings.HasPrefix(digits, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return fp.order
+	}
+	return fp.routes[best]
+}
+
+// Name identifies the provider in outbox records
+func (fp *FailoverProvider) Name() string { return ProviderFailover }
+
+// SendSMS sends through the first provider that accepts the message
+func (fp *FailoverProvider) SendSMS(to, message string) error {
+	_, err := fp.Send(to, message)
+	return err
+}
+
+// Send sends through the first provider that accepts the message and
+// reports which one it was
+func (fp *FailoverProvider) Send(to, message string) (SendResult, error) {
+	var failures []string
+	for i, name := range fp.Order(to) {
+		result, err := send(fp.providers[name], to, message)
+		if err == nil {
+			if i > 0 {
+				log.Printf("🔀 SMS to %s failed over to %s", to, name)
+			}
+			return result, nil
+		}
+		log.Printf("⚠️  SMS provider %s failed: %v", name, err)
+		failures = append(failures, err.Error())
+	}
+	return SendResult{}, fmt.Errorf("all SMS providers failed: %s", strings.Join(failures, "; "))
+}
+
+// send uses Sender when the provider supports it so the message ID is kept
+func send(p SMSProvider, to, message string) (SendResult, error) {
+	if s, ok := p.(Sender); ok {
+		return s.Send(to, message)
+	}
+	return SendResult{Provider: providerName(p)}, p.SendSMS(to, message)
+}
+
+// providerName returns the provider's Name, or its type for providers
+// without one
+func providerName(p SMSProvider) string {
+	if named, ok := p.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", p)
+}
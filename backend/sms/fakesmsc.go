@@ -0,0 +1,452 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeMessage is a message submitted to the fake SMSC
+type FakeMessage struct {
+	ID         string     `json:"id"`
+	API        string     `json:"api"` // africastalking or twilio
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Body       string     `json:"body"`
+	Segments   int        `json:"segments"`
+	Status     string     `json:"status"` // sent, rejected, delivered or failed
+	Callback   string     `json:"callback,omitempty"`
+	ReceivedAt time.Time  `json:"received_at"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+}
+
+// Fake message statuses
+const (
+	FakeSent      = "sent"
+	FakeRejected  = "rejected"
+	FakeDelivered = "delivered"
+	FakeFailed    = "failed"
+)
+
+// FakeSMSCConfig controls the failures and delivery reports the fake SMSC
+// simulates. It can be changed at runtime through /control.
+type FakeSMSCConfig struct {
+	// FailNext answers the next n submissions with a 503
+	FailNext int `json:"fail_next"`
+	// FailRate answers this fraction of submissions with a 503
+	FailRate float64 `json:"fail_rate"`
+	// Reject lists numbers the SMSC refuses as invalid
+	Reject []string `json:"reject"`
+	// Undeliverable lists numbers that are accepted but reported failed
+	Undeliverable []string `json:"undeliverable"`
+	// ReportDelayMS is how long after submission delivery reports are posted
+	ReportDelayMS int `json:"report_delay_ms"`
+	// ATCallbackURL receives Africa's Talking delivery reports, which the
+	// real service configures per account rather than per message
+	ATCallbackURL string `json:"at_callback_url"`
+}
+
+// FakeSMSC is an HTTP server that speaks enough of the Africa's Talking and
+// Twilio messaging APIs for both provider clients, pointed at it with
+// AT_BASE_URL and TWILIO_BASE_URL, to work offline. Accepted messages are
+// listed at /inbox and delivery reports are posted back like the real thing.
+type FakeSMSC struct {
+	config   FakeSMSCConfig
+	messages []FakeMessage
+	client   *http.Client
+	mux      *http.ServeMux
+	mu       sync.Mutex
+}
+
+// NewFakeSMSC creates a fake SMSC
+func NewFakeSMSC(config FakeSMSCConfig) *FakeSMSC {
+	f := &FakeSMSC{config: config, client: &http.Client{Timeout: 10 * time.Second}, mux: http.NewServeMux()}
+	f.mux.HandleFunc("POST /version1/messaging", f.handleAfricasTalking)
+	f.mux.HandleFunc("POST /2010-04-01/Accounts/{sid}/Messages.json", f.handleTwilio)
+	f.mux.HandleFunc("GET /inbox", f.handleInbox)
+	f.mux.HandleFunc("DELETE /inbox", f.handleClear)
+	f.mux.HandleFunc("GET /control", f.handleGetControl)
+	f.mux.HandleFunc("PUT /control", f.handlePutControl)
+	f.mux.Handle("GET /{$}", http.RedirectHandler("/inbox", http.StatusFound))
+	return f
+}
+
+func (f *FakeSMSC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.ServeHTTP(w, r)
+}
+
+// Messages returns what was submitted for a number, or everything if to is
+// empty, oldest first
+func (f *FakeSMSC) Messages(to string) []FakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var list []FakeMessage
+	for _, msg := range f.messages {
+		if to == "" || msg.To == to {
+			list = append(list, msg)
+		}
+	}
+	return list
+}
+
+// Clear empties the inbox
+func (f *FakeSMSC) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = nil
+}
+
+// Config returns the current simulation settings
+func (f *FakeSMSC) Config() FakeSMSCConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.config
+}
+
+// SetConfig replaces the simulation settings
+func (f *FakeSMSC) SetConfig(config FakeSMSCConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = config
+}
+
+// outage reports whether this submission should get a simulated 503
+func (f *FakeSMSC) outage() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.FailNext > 0 {
+		f.config.FailNext--
+		return true
+	}
+	return f.config.FailRate > 0 && mathrand.Float64() < f.config.FailRate
+}
+
+// accept records a message and returns its status
+func (f *FakeSMSC) accept(msg FakeMessage) FakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg.Status = FakeSent
+	if slices.Contains(f.config.Reject, msg.To) {
+		msg.Status = FakeRejected
+	}
+	msg.Segments = CountSegments(msg.Body).Segments
+	msg.ReceivedAt = time.Now()
+	f.messages = append(f.messages, msg)
+	log.Printf("📨 Fake SMSC %s %s to %s: %q", msg.API, msg.Status, msg.To, msg.Body)
+	return msg
+}
+
+// report settles a sent message as delivered or failed after the configured
+// delay and returns the outcome to post back
+func (f *FakeSMSC) report(id string) (FakeMessage, bool) {
+	f.mu.Lock()
+	delay := time.Duration(f.config.ReportDelayMS) * time.Millisecond
+	f.mu.Unlock()
+	time.Sleep(delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.messages {
+		msg := &f.messages[i]
+		if msg.ID != id || msg.Status != FakeSent {
+			continue
+		}
+		msg.Status = FakeDelivered
+		if slices.Contains(f.config.Undeliverable, msg.To) {
+			msg.Status = FakeFailed
+		}
+		now := time.Now()
+		msg.ReportedAt = &now
+		return *msg, true
+	}
+	return FakeMessage{}, false
+}
+
+type atRecipient struct {
+	Number     string `json:"number"`
+	Cost       string `json:"cost"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"statusCode"`
+	MessageID  string `json:"messageId"`
+}
+
+// handleAfricasTalking implements POST /version1/messaging, which takes a
+// comma-separated list of recipients
+func (f *FakeSMSC) handleAfricasTalking(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("apiKey") == "" || r.PostFormValue("username") == "" {
+		http.Error(w, "The supplied authentication is invalid", http.StatusUnauthorized)
+		return
+	}
+	if f.outage() {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var recipients []atRecipient
+	sent := 0
+	for _, to := range strings.Split(r.PostFormValue("to"), ",") {
+		to = strings.TrimSpace(to)
+		if to == "" {
+			continue
+		}
+		msg := f.accept(FakeMessage{
+			ID:       "ATXid_" + randomHex(16),
+			API:      ProviderAfricasTalking,
+			From:     r.PostFormValue("from"),
+			To:       to,
+			Body:     r.PostFormValue("message"),
+			Callback: f.Config().ATCallbackURL,
+		})
+		if msg.Status == FakeRejected {
+			recipients = append(recipients, atRecipient{Number: to, Cost: "0", Status: "InvalidPhoneNumber", StatusCode: 403, MessageID: "None"})
+			continue
+		}
+		sent++
+		recipients = append(recipients, atRecipient{
+			Number:     to,
+			Cost:       fmt.Sprintf("USD %.4f", 0.01*float64(msg.Segments)),
+			Status:     "Success",
+			StatusCode: 101,
+			MessageID:  msg.ID,
+		})
+		if msg.Callback != "" {
+			go f.postAfricasTalkingReport(msg.ID)
+		}
+	}
+
+	var resp struct {
+		SMSMessageData struct {
+			Message    string        `json:"Message"`
+			Recipients []atRecipient `json:"Recipients"`
+		} `json:"SMSMessageData"`
+	}
+	resp.SMSMessageData.Message = fmt.Sprintf("Sent to %d/%d", sent, len(recipients))
+	resp.SMSMessageData.Recipients = recipients
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (f *FakeSMSC) postAfricasTalkingReport(id string) {
+	msg, ok := f.report(id)
+	if !ok {
+		return
+	}
+	form := url.Values{
+		"id":          {msg.ID},
+		"status":      {"Success"},
+		"phoneNumber": {msg.To},
+		"networkCode": {"63902"},
+		"retryCount":  {"0"},
+	}
+	if msg.Status == FakeFailed {
+		form.Set("status", "Failed")
+		form.Set("failureReason", "DeliveryFailure")
+	}
+	f.post(msg.Callback, form, "")
+}
+
+// handleTwilio implements the Messages create endpoint
+func (f *FakeSMSC) handleTwilio(w http.ResponseWriter, r *http.Request) {
+	sid, authToken, ok := r.BasicAuth()
+	if !ok || sid != r.PathValue("sid") {
+		twilioError(w, http.StatusUnauthorized, 20003, "Authenticate")
+		return
+	}
+	if f.outage() {
+		twilioError(w, http.StatusServiceUnavailable, 20500, "Service unavailable")
+		return
+	}
+	to := r.PostFormValue("To")
+	if to == "" || r.PostFormValue("Body") == "" {
+		twilioError(w, http.StatusBadRequest, 21602, "Message body and 'To' number are required")
+		return
+	}
+
+	msg := f.accept(FakeMessage{
+		ID:       "SM" + randomHex(16),
+		API:      ProviderTwilio,
+		From:     r.PostFormValue("From"),
+		To:       to,
+		Body:     r.PostFormValue("Body"),
+		Callback: r.PostFormValue("StatusCallback"),
+	})
+	if msg.Status == FakeRejected {
+		twilioError(w, http.StatusBadRequest, 21211, fmt.Sprintf("The 'To' number %s is not a valid phone number.", to))
+		return
+	}
+	if msg.Callback != "" {
+		go f.postTwilioReport(msg.ID, sid, authToken)
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"sid":          msg.ID,
+		"account_sid":  sid,
+		"to":           msg.To,
+		"from":         msg.From,
+		"body":         msg.Body,
+		"status":       "queued",
+		"num_segments": fmt.Sprint(msg.Segments),
+		"direction":    "outbound-api",
+		"api_version":  "2010-04-01",
+	})
+}
+
+func (f *FakeSMSC) postTwilioReport(id, accountSID, authToken string) {
+	msg, ok := f.report(id)
+	if !ok {
+		return
+	}
+	form := url.Values{
+		"MessageSid":    {msg.ID},
+		"SmsSid":        {msg.ID},
+		"AccountSid":    {accountSID},
+		"From":          {msg.From},
+		"To":            {msg.To},
+		"MessageStatus": {"delivered"},
+		"ApiVersion":    {"2010-04-01"},
+	}
+	if msg.Status == FakeFailed {
+		form.Set("MessageStatus", "undelivered")
+		form.Set("ErrorCode", "30003")
+	}
+	f.post(msg.Callback, form, twilioSignature(authToken, msg.Callback, form))
+}
+
+// post delivers a report; failures are only logged, as a real SMSC would
+// give up too
+func (f *FakeSMSC) post(callback string, form url.Values, signature string) {
+	req, err := http.NewRequest(http.MethodPost, callback, strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Printf("⚠️  Fake SMSC callback %s: %v", callback, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if signature != "" {
+		req.Header.Set("X-Twilio-Signature", signature)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		log.Printf("⚠️  Fake SMSC callback %s: %v", callback, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️  Fake SMSC callback %s returned %d", callback, resp.StatusCode)
+	}
+}
+
+// twilioSignature signs a callback the way Twilio does: HMAC-SHA1 of the URL
+// followed by each form key and value in key order
+func twilioSignature(authToken, callback string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(callback)
+	for _, k := range keys {
+		b.WriteString(k + form.Get(k))
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func twilioError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"code":      code,
+		"message":   message,
+		"more_info": fmt.Sprintf("https://www.twilio.com/docs/errors/%d", code),
+		"status":    status,
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var inboxPage = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Fake SMSC inbox</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px 10px; text-align: left; vertical-align: top; }
+td.body { white-space: pre-wrap; font-family: monospace; }
+.rejected, .failed { color: #b00020; }
+.delivered { color: #1b7f3b; }
+</style>
+</head>
+<body>
+<h1>📨 Fake SMSC inbox</h1>
+<p>{{len .}} message(s). <a href="/inbox?format=json">JSON</a></p>
+<table>
+<tr><th>Received</th><th>API</th><th>From</th><th>To</th><th>Message</th><th>Segments</th><th>Status</th></tr>
+{{range .}}<tr>
+<td>{{.ReceivedAt.Format "15:04:05"}}</td><td>{{.API}}</td><td>{{.From}}</td><td>{{.To}}</td>
+<td class="body">{{.Body}}</td><td>{{.Segments}}</td><td class="{{.Status}}">{{.Status}}</td>
+</tr>{{else}}<tr><td colspan="7">No messages yet</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+// handleInbox lists messages, newest first, as HTML or as JSON for
+// ?format=json or an Accept: application/json request. ?to= filters by
+// recipient.
+func (f *FakeSMSC) handleInbox(w http.ResponseWriter, r *http.Request) {
+	messages := f.Messages(r.URL.Query().Get("to"))
+	slices.Reverse(messages)
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		if messages == nil {
+			messages = []FakeMessage{}
+		}
+		writeJSON(w, http.StatusOK, messages)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := inboxPage.Execute(w, messages); err != nil {
+		log.Printf("⚠️  Fake SMSC inbox: %v", err)
+	}
+}
+
+func (f *FakeSMSC) handleClear(w http.ResponseWriter, r *http.Request) {
+	f.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeSMSC) handleGetControl(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, f.Config())
+}
+
+func (f *FakeSMSC) handlePutControl(w http.ResponseWriter, r *http.Request) {
+	var config FakeSMSCConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "invalid config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config.FailRate < 0 || config.FailRate > 1 {
+		http.Error(w, "fail_rate must be between 0 and 1", http.StatusBadRequest)
+		return
+	}
+	f.SetConfig(config)
+	writeJSON(w, http.StatusOK, config)
+}
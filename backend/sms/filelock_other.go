@@ -0,0 +1,14 @@
+//go:build !unix
+
+package sms
+
+import "errors"
+
+// FileLock needs flock, which this platform does not have
+type FileLock struct {
+	Path string
+}
+
+func (l *FileLock) TryLock() (bool, error) {
+	return false, errors.New("file locks are only supported on Unix")
+}
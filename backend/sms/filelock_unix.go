@@ -0,0 +1,38 @@
+//go:build unix
+
+package sms
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// FileLock elects a leader with an exclusive flock on a file. Point every
+// replica at the same file on a shared volume; the kernel releases the lock
+// when the holder exits, however it exits.
+type FileLock struct {
+	Path string
+	file *os.File
+}
+
+func (l *FileLock) TryLock() (bool, error) {
+	if l.file != nil {
+		return true, nil
+	}
+	file, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return false, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return false, nil
+	}
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+	l.file = file
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// InboundSMS receives messages passengers text to the shortcode from both
+// providers and runs them as Commands. Authentication works like
+// DeliveryReports: a ?token= for Africa's Talking, X-Twilio-Signature for
+// Twilio. Commands act on passengers' tickets, so only mount it when
+// Configured.
+type InboundSMS struct {
+	Commands        *Commands
+	Token           string
+	TwilioAuthToken string
+	PublicURL       string
+	// Seen drops messages a provider delivers twice; optional
+	Seen SentLog
+}
+
+// Configured reports whether any request can be authenticated
+func (in *InboundSMS) Configured() bool {
+	return webhookAuth(in.Token, in.TwilioAuthToken, in.PublicURL)
+}
+
+// Handler serves /africastalking and /twilio under the path it is mounted at
+func (in *InboundSMS) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/africastalking", in.handleAfricasTalking)
+	mux.HandleFunc("/twilio", in.handleTwilio)
+	return mux
+}
+
+// handleAfricasTalking reads the form Africa's Talking posts for incoming
+// messages: from, to, text, date and id
+func (in *InboundSMS) handleAfricasTalking(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !checkToken(w, r, in.Token) {
+		return
+	}
+	in.handle(r.Context(), ProviderAfricasTalking, r.PostFormValue("id"), r.PostFormValue("from"), r.PostFormValue("text"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTwilio reads Twilio's incoming message webhook: MessageSid, From
+// and Body. The reply goes out through the notifier, so the TwiML response
+// is empty.
+func (in *InboundSMS) handleTwilio(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !checkTwilio(w, r, in.Token, in.TwilioAuthToken, in.PublicURL) {
+		return
+	}
+	in.handle(r.Context(), ProviderTwilio, r.PostFormValue("MessageSid"), r.PostFormValue("From"), r.PostFormValue("Body"))
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Response></Response>`))
+}
+
+// handle runs a message's command. Failures are logged rather than returned
+// to the provider: a retried CANCEL could otherwise be answered twice.
+func (in *InboundSMS) handle(ctx context.Context, provider, id, from, text string) {
+	phone := e164(from)
+	if phone == "" {
+		log.Printf("⚠️  Ignoring %s SMS %s from invalid number %q", provider, id, from)
+		return
+	}
+	if in.Seen != nil && id != "" {
+		first, err := in.Seen.MarkSent("inbound:"+provider+":"+id, 24*time.Hour)
+		if err != nil {
+			log.Printf("⚠️  Failed to record inbound SMS %s: %v", id, err)
+		} else if !first {
+			return
+		}
+	}
+	if err := in.Commands.Handle(ctx, phone, text); err != nil {
+		log.Printf("❌ SMS command from %s failed: %v", phone, err)
+	}
+}
+
+// e164 normalizes a sender number to +<digits>, as the gateway stores
+// MSISDNs, or returns "" if it is not a phone number (e.g. an alphanumeric
+// sender)
+func e164(raw string) string {
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, raw)
+	number = strings.TrimPrefix(number, "+")
+	if strings.HasPrefix(number, "00") {
+		number = number[2:]
+	}
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return ""
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return "+" + number
+}
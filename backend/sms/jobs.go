@@ -0,0 +1,167 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// UpcomingTicket is a live ticket a departure reminder may be sent for
+type UpcomingTicket struct {
+	Phone string
+	TicketDetails
+}
+
+// TicketSource finds tickets about to depart
+type TicketSource interface {
+	// Departing returns live tickets departing in [from, to)
+	Departing(ctx context.Context, from, to time.Time) ([]UpcomingTicket, error)
+}
+
+// WalletSummary is a passenger's AFRC activity for a day and balance now
+type WalletSummary struct {
+	Phone   string `json:"phone"`
+	Tickets int    `json:"tickets"`
+	Spent   int    `json:"spent"`
+	Balance int    `json:"balance"`
+}
+
+// WalletSource reports AFRC wallet activity and balances
+type WalletSource interface {
+	// Summaries returns every wallet's activity on day and its balance now
+	Summaries(ctx context.Context, day time.Time) ([]WalletSummary, error)
+}
+
+// DefaultReminderLeads are how long before departure reminders go out
+var DefaultReminderLeads = []time.Duration{24 * time.Hour, 2 * time.Hour}
+
+// NotificationJobs are the scheduled notifications. Each one is recorded in
+// Sent before it goes out, so overlapping runs and restarts cannot repeat it.
+type NotificationJobs struct {
+	Notifier *NotificationService
+	Sent     SentLog
+	Tickets  TicketSource
+	Wallets  WalletSource
+
+	// ReminderLeads defaults to DefaultReminderLeads
+	ReminderLeads []time.Duration
+	// LowBalance is the AFRC balance below which a wallet is alerted
+	LowBalance int
+}
+
+// DepartureReminders sends each reminder once its lead time is reached. A
+// ticket bought after a lead time has mostly passed skips that reminder: the
+// window is the last quarter of the lead, e.g. 24h down to 18h, 2h to 90m.
+// Run it every few minutes.
+func (j *NotificationJobs) DepartureReminders(ctx context.Context, now time.Time) error {
+	leads := j.ReminderLeads
+	if len(leads) == 0 {
+		leads = DefaultReminderLeads
+	}
+	longest := leads[0]
+	for _, lead := range leads {
+		longest = max(longest, lead)
+	}
+
+	tickets, err := j.Tickets.Departing(ctx, now, now.Add(longest))
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, ticket := range tickets {
+		remaining := ticket.Departure.Sub(now)
+		for _, lead := range leads {
+			if remaining > lead || remaining <= lead-lead/4 {
+				continue
+			}
+			key := fmt.Sprintf("reminder:%s:%s", lead, ticket.TicketID)
+			if err := j.sendOnce(key, lead+time.Hour, func() error {
+				return j.Notifier.SendDepartureReminder(ticket.Phone, ticket.TicketDetails)
+			}); err != nil {
+				log.Printf("⚠️  Reminder for ticket %s failed: %v", ticket.TicketID, err)
+				failed++
+			}
+		}
+	}
+	return failedErr(failed, "departure reminders")
+}
+
+// DailyDigests sends each passenger who travelled today a summary of the
+// day, skipping numbers that texted STOP. Schedule it in the evening.
+func (j *NotificationJobs) DailyDigests(ctx context.Context, now time.Time) error {
+	summaries, err := j.Wallets.Summaries(ctx, now)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	day := now.Format(time.DateOnly)
+	for _, s := range summaries {
+		if s.Tickets == 0 {
+			continue
+		}
+		optedOut, err := j.Notifier.OptedOut(s.Phone)
+		if err != nil {
+			return err
+		}
+		if optedOut {
+			continue
+		}
+		if err := j.sendOnce("digest:"+day+":"+s.Phone, 48*time.Hour, func() error {
+			return j.Notifier.SendDailyDigest(s.Phone, s.Tickets, s.Spent, s.Balance)
+		}); err != nil {
+			log.Printf("⚠️  Daily digest to %s failed: %v", s.Phone, err)
+			failed++
+		}
+	}
+	return failedErr(failed, "daily digests")
+}
+
+// LowBalanceAlerts warns wallets that have dropped below LowBalance. A
+// wallet is alerted once per drop: topping up above the threshold re-arms it.
+func (j *NotificationJobs) LowBalanceAlerts(ctx context.Context, now time.Time) error {
+	summaries, err := j.Wallets.Summaries(ctx, now)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, s := range summaries {
+		key := "low_balance:" + s.Phone
+		if s.Balance >= j.LowBalance {
+			if err := j.Sent.Forget(key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := j.sendOnce(key, 90*24*time.Hour, func() error {
+			return j.Notifier.SendLowBalanceAlert(s.Phone, s.Balance)
+		}); err != nil {
+			log.Printf("⚠️  Low balance alert to %s failed: %v", s.Phone, err)
+			failed++
+		}
+	}
+	return failedErr(failed, "low balance alerts")
+}
+
+// sendOnce sends unless key was already sent, and forgets the key again if
+// the send fails so the next run retries it
+func (j *NotificationJobs) sendOnce(key string, ttl time.Duration, send func() error) error {
+	first, err := j.Sent.MarkSent(key, ttl)
+	if err != nil || !first {
+		return err
+	}
+	if err := send(); err != nil {
+		if forgetErr := j.Sent.Forget(key); forgetErr != nil {
+			log.Printf("⚠️  Failed to clear %s after a failed send: %v", key, forgetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func failedErr(failed int, what string) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d %s failed", failed, what)
+}
@@ -0,0 +1,163 @@
+package sms
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// timeJournal persists a set of keys, each with a time, the way the outbox
+// persists messages: every change appends a JSON line, and once most lines
+// are superseded the journal is rewritten with the live keys only
+type timeJournal struct {
+	path    string
+	name    string // For logs and errors, e.g. "sent log"
+	file    *os.File
+	records int // Records in the journal
+}
+
+// timeRecord is a line of a timeJournal: a key and its time, or that the
+// key was removed
+type timeRecord struct {
+	Key     string    `json:"key"`
+	Time    time.Time `json:"time"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// openTimeJournal replays the journal at path into keys and opens it for
+// appending. A last line cut short by a crash is dropped.
+func openTimeJournal(path, name string, keys map[string]time.Time) (*timeJournal, error) {
+	j := &timeJournal{path: path, name: name}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	good := 0
+	for len(data[good:]) > 0 {
+		line := data[good:]
+		end := bytes.IndexByte(line, '\n')
+		if end < 0 {
+			log.Printf("⚠️  Dropping an incomplete record at the end of SMS %s %s", name, path)
+			break
+		}
+		var record timeRecord
+		if err := json.Unmarshal(line[:end], &record); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", name, path, err)
+		}
+		if record.Deleted {
+			delete(keys, record.Key)
+		} else {
+			keys[record.Key] = record.Time
+		}
+		j.records++
+		good += end + 1
+	}
+
+	j.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.file.Truncate(int64(good)); err != nil {
+		j.file.Close()
+		return nil, err
+	}
+	if _, err := j.file.Seek(int64(good), io.SeekStart); err != nil {
+		j.file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// append writes records and syncs them, compacting the journal to keys,
+// the live set after the change, once most of it is superseded
+func (j *timeJournal) append(keys map[string]time.Time, records ...timeRecord) error {
+	if j.file == nil {
+		return os.ErrClosed
+	}
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// A failed write may leave part of a line; cut it off so later records
+	// don't follow it
+	offset, err := j.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		j.file.Truncate(offset)
+		j.file.Seek(offset, io.SeekStart)
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.records += len(records)
+	if j.records > compactAfter && j.records > 4*len(keys) {
+		if err := j.compact(keys); err != nil {
+			log.Printf("⚠️  Failed to compact SMS %s: %v", j.name, err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the journal with one record per key
+func (j *timeJournal) compact(keys map[string]time.Time) error {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), "."+filepath.Base(j.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, key := range sorted {
+		if err := enc.Encode(timeRecord{Key: key, Time: keys[key]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	// The renamed file is the journal now, positioned at its end
+	j.file.Close()
+	j.file, j.records = tmp, len(sorted)
+	return nil
+}
+
+func (j *timeJournal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
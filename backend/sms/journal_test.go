@@ -0,0 +1,108 @@
+package sms
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSentLogJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms-sent.jsonl")
+	l, err := NewFileSentLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"digest:2026-03-01:+27821234567", "reminder:24h:10000001", "low_balance:+27821234567"} {
+		if ok, err := l.MarkSent(key, time.Hour); !ok || err != nil {
+			t.Fatalf("MarkSent(%s) = %v, %v", key, ok, err)
+		}
+	}
+	if ok, _ := l.MarkSent("reminder:24h:10000001", time.Hour); ok {
+		t.Error("marked a key twice")
+	}
+	if err := l.Forget("low_balance:+27821234567"); err != nil {
+		t.Fatal(err)
+	}
+	// Expired keys are not loaded again
+	if _, err := l.MarkSent("digest:2026-02-28:+27821234567", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// A crash mid-write leaves a partial last line, which is dropped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"key":"reminder:2h:1000`)
+	f.Close()
+
+	l, err = NewFileSentLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	want := map[string]bool{
+		"digest:2026-03-01:+27821234567": false,
+		"reminder:24h:10000001":          false,
+		"low_balance:+27821234567":       true,
+		"digest:2026-02-28:+27821234567": true,
+	}
+	for key, sendable := range want {
+		if ok, err := l.MarkSent(key, time.Hour); ok != sendable || err != nil {
+			t.Errorf("after reload MarkSent(%s) = %v, %v, want %v", key, ok, err, sendable)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) || bytes.Contains(data, []byte(`"reminder:2h:1000"`)) {
+		t.Errorf("journal kept the partial line:\n%s", data)
+	}
+}
+
+func TestFileOptOutsJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms-opt-outs.jsonl")
+	l, err := NewFileOptOuts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough STOP and START pairs to compact the journal
+	for i := 0; i < compactAfter; i++ {
+		if err := l.OptOut("+27821234567"); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.OptIn("+27821234567"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.OptOut(fmt.Sprintf("+2547000000%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > compactAfter {
+		t.Errorf("journal has %d lines for 3 numbers, want it compacted", lines)
+	}
+
+	l, err = NewFileOptOuts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for phone, want := range map[string]bool{"+27821234567": false, "+254700000000": true, "+254700000002": true} {
+		if got, _ := l.OptedOut(phone); got != want {
+			t.Errorf("OptedOut(%s) = %v after reload, want %v", phone, got, want)
+		}
+	}
+}
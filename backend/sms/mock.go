@@ -0,0 +1,108 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrMockFailure is returned by MockProvider for simulated failures
+var ErrMockFailure = errors.New("simulated SMS failure")
+
+// MockMessage is a message MockProvider accepted
+type MockMessage struct {
+	ID     string    `json:"id"`
+	To     string    `json:"to"`
+	Body   string    `json:"body"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// MockProvider records messages instead of sending them, for development and
+// tests. Failures can be injected to exercise failover and retries.
+type MockProvider struct {
+	messages    []MockMessage
+	seq         int
+	failNext    int
+	failNumbers map[string]bool
+	mu          sync.Mutex
+}
+
+// NewMockProvider creates an empty mock
+func NewMockProvider() *MockProvider {
+	return &MockProvider{failNumbers: make(map[string]bool)}
+}
+
+// Name identifies the provider in outbox records and routes
+func (m *MockProvider) Name() string { return ProviderMock }
+
+// SendSMS records a message
+func (m *MockProvider) SendSMS(to, message string) error {
+	_, err := m.Send(to, message)
+	return err
+}
+
+// Send records a message and returns its mock ID
+func (m *MockProvider) Send(to, message string) (SendResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failNext > 0 {
+		m.failNext--
+		return SendResult{}, ErrMockFailure
+	}
+	if m.failNumbers[to] {
+		return SendResult{}, fmt.Errorf("%w: %s is rejected", ErrMockFailure, to)
+	}
+	m.seq++
+	msg := MockMessage{ID: fmt.Sprintf("mock-%d", m.seq), To: to, Body: message, SentAt: time.Now()}
+	m.messages = append(m.messages, msg)
+	log.Printf("📥 Mock SMS %s to %s: %q", msg.ID, to, message)
+	return SendResult{Provider: ProviderMock, MessageID: msg.ID}, nil
+}
+
+// Messages returns what was sent to a number, or everything if to is empty,
+// oldest first
+func (m *MockProvider) Messages(to string) []MockMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []MockMessage
+	for _, msg := range m.messages {
+		if to == "" || msg.To == to {
+			list = append(list, msg)
+		}
+	}
+	return list
+}
+
+// Last returns the latest message sent to a number
+func (m *MockProvider) Last(to string) (MockMessage, bool) {
+	list := m.Messages(to)
+	if len(list) == 0 {
+		return MockMessage{}, false
+	}
+	return list[len(list)-1], true
+}
+
+// FailNext makes the next n sends fail
+func (m *MockProvider) FailNext(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failNext = n
+}
+
+// Reject makes every send to a number fail until Reset
+func (m *MockProvider) Reject(to string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failNumbers[to] = true
+}
+
+// Reset forgets messages and injected failures
+func (m *MockProvider) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+	m.failNext = 0
+	m.failNumbers = make(map[string]bool)
+}
@@ -1,12 +1,14 @@
 package sms
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
 	africastalking "github.com/tech-kenya/africastalkingsms"
 	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
@@ -15,11 +17,30 @@ type SMSProvider interface {
 	SendSMS(to, message string) error
 }
 
+// SendResult identifies a message a provider accepted, so delivery reports
+// can be matched back to it
+type SendResult struct {
+	Provider  string `json:"provider"`
+	MessageID string `json:"message_id"`
+}
+
+// Sender is implemented by providers that return the ID they gave a message
+type Sender interface {
+	Send(to, message string) (SendResult, error)
+}
+
+// Provider names, as used in SMS_PROVIDER and SMS_ROUTES
+const (
+	ProviderAfricasTalking = "africastalking"
+	ProviderTwilio         = "twilio"
+	ProviderFailover       = "failover"
+	ProviderMock           = "mock"
+)
+
 // AfricasTalkingProvider implements SMS using Africa's Talking
 type AfricasTalkingProvider struct {
-	username string
-	apiKey   string
-	sender   string
+	client *africastalking.SMSClient
+	err    error
 }
 
 // TwilioProvider implements SMS using Twilio
@@ -28,69 +49,131 @@ type TwilioProvider struct {
 	authToken  string
 	fromNumber string
 	client     *twilio.RestClient
+
+	// statusCallback is where Twilio posts delivery reports
+	statusCallback string
 }
 
 // NotificationService handles SMS notifications
 type NotificationService struct {
-	provider SMSProvider
+	provider    SMSProvider
+	outbox      *Outbox
+	templates   *Templates
+	links       ShortLinker
+	pricing     Pricing
+	locales     LocaleResolver
+	optOuts     OptOutList
+	maxSegments int
 }
 
+// DefaultMaxSegments caps how many concatenated segments a notification may use
+const DefaultMaxSegments = 3
+
 // NewAfricasTalkingProvider creates a new Africa's Talking SMS provider
 func NewAfricasTalkingProvider() *AfricasTalkingProvider {
-	return &AfricasTalkingProvider{
-		username: os.Getenv("AT_USERNAME"),
-		apiKey:   os.Getenv("AT_API_KEY"),
-		sender:   os.Getenv("AT_SENDER_ID"),
+	sandbox := "false"
+	if os.Getenv("AT_SANDBOX") == "true" {
+		sandbox = "true"
+	}
+	client, err := africastalking.NewSMSClient(os.Getenv("AT_API_KEY"), os.Getenv("AT_USERNAME"), os.Getenv("AT_SENDER_ID"), sandbox)
+	if err == nil {
+		if base := os.Getenv("AT_BASE_URL"); base != "" {
+			client.HTTPClient, err = newBaseURLClient(base)
+		}
 	}
+	return &AfricasTalkingProvider{client: client, err: err}
 }
 
 // NewTwilioProvider creates a new Twilio SMS provider
 func NewTwilioProvider() *TwilioProvider {
 	accountSID := os.Getenv("TWILIO_ACCOUNT_SID")
 	authToken := os.Getenv("TWILIO_AUTH_TOKEN")
+	params := twilio.ClientParams{
+		Username: accountSID,
+		Password: authToken,
+	}
+	if base := os.Getenv("TWILIO_BASE_URL"); base != "" {
+		httpClient, err := newBaseURLClient(base)
+		if err != nil {
+			log.Printf("⚠️  Ignoring TWILIO_BASE_URL: %v", err)
+		} else {
+			baseClient := &client.Client{Credentials: client.NewCredentials(accountSID, authToken), HTTPClient: httpClient}
+			baseClient.SetAccountSid(accountSID)
+			params.Client = baseClient
+		}
+	}
 	
 	return &TwilioProvider{
 		accountSID: accountSID,
 		authToken:  authToken,
 		fromNumber: os.Getenv("TWILIO_FROM_NUMBER"),
-		client:     twilio.NewRestClientWithParams(twilio.ClientParams{
-			Username: accountSID,
-			Password: authToken,
-		}),
+		client:     twilio.NewRestClientWithParams(params),
+		statusCallback: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
 	}
 }
 
+// Name identifies the provider in outbox records and routes
+func (at *AfricasTalkingProvider) Name() string { return ProviderAfricasTalking }
+
 // SendSMS sends an SMS using Africa's Talking
 func (at *AfricasTalkingProvider) SendSMS(to, message string) error {
-	// Initialize Africa's Talking
-	africastalking.Initialize(at.username, at.apiKey)
-	
-	// Send SMS
-	recipients := []string{to}
-	response, err := africastalking.SendSMS(message, recipients, at.sender)
-	
+	_, err := at.Send(to, message)
+	return err
+}
+
+// Send sends an SMS using Africa's Talking and returns its message ID
+func (at *AfricasTalkingProvider) Send(to, message string) (SendResult, error) {
+	if at.err != nil {
+		return SendResult{}, fmt.Errorf("Africa's Talking is not configured: %w", at.err)
+	}
+
+	response, err := at.client.SendSMS(to, message)
 	if err != nil {
-		return fmt.Errorf("failed to send SMS via Africa's Talking: %w", err)
+		return SendResult{}, fmt.Errorf("failed to send SMS via Africa's Talking: %w", err)
 	}
-	
-	log.Printf("✅ SMS sent via Africa's Talking: %+v", response)
-	return nil
+
+	result := SendResult{Provider: ProviderAfricasTalking}
+	if recipients := response.SMSMessageData.Recipients; len(recipients) > 0 {
+		result.MessageID = recipients[0].MessageID
+	}
+	log.Printf("✅ SMS sent via Africa's Talking: ID=%s", result.MessageID)
+	return result, nil
 }
 
+// Name identifies the provider in outbox records and routes
+func (tw *TwilioProvider) Name() string { return ProviderTwilio }
+
 // SendSMS sends an SMS using Twilio
 func (tw *TwilioProvider) SendSMS(to, message string) error {
+	_, err := tw.Send(to, message)
+	return err
+}
+
+// Send sends an SMS using Twilio and returns its message SID
+func (tw *TwilioProvider) Send(to, message string) (SendResult, error) {
 	params := &twilioApi.CreateMessageParams{}
 	params.SetTo(to)
 	params.SetFrom(tw.fromNumber)
 	params.SetBody(message)
-	
+	if tw.statusCallback != "" {
+		params.SetStatusCallback(tw.statusCallback)
+	}
+
 	resp, err := tw.client.Api.CreateMessage(params)
 	if err != nil {
-		return fmt.Errorf("failed to send SMS via Twilio: %w", err)
+		return SendResult{}, fmt.Errorf("failed to send SMS via Twilio: %w", err)
 	}
-	
-	log.Printf("✅ SMS sent via Twilio: SID=%s, Status=%s", *resp.Sid, *resp.Status)
-	return nil
+
+	result := SendResult{Provider: ProviderTwilio}
+	status := ""
+	if resp.Sid != nil {
+		result.MessageID = *resp.Sid
+	}
+	if resp.Status != nil {
+		status = *resp.Status
+	}
+	log.Printf("✅ SMS sent via Twilio: SID=%s, Status=%s", result.MessageID, status)
+	return result, nil
 }
 
 // NewNotificationService creates a new notification service
@@ -98,81 +181,188 @@ func NewNotificationService(providerType string) *NotificationService {
 	var provider SMSProvider
 	
 	switch providerType {
-	case "africastalking":
+	case ProviderAfricasTalking:
 		provider = NewAfricasTalkingProvider()
-	case "twilio":
+	case ProviderTwilio:
 		provider = NewTwilioProvider()
+	case ProviderFailover:
+		failover, err := NewFailoverProviderFromEnv()
+		if err != nil {
+			log.Printf("⚠️  Invalid SMS routes, using the default order: %v", err)
+			failover = NewFailoverProvider(NewAfricasTalkingProvider(), NewTwilioProvider())
+		}
+		provider = failover
+	case ProviderMock:
+		provider = NewMockProvider()
 	default:
 		log.Printf("⚠️  Unknown SMS provider: %s, defaulting to Africa's Talking", providerType)
 		provider = NewAfricasTalkingProvider()
 	}
 	
+	templates, err := LoadTemplates(os.Getenv("SMS_TEMPLATE_DIR"))
+	if err != nil {
+		log.Printf("⚠️  Failed to load SMS templates, using the built-in ones: %v", err)
+		templates = mustLoadTemplates("")
+	}
+
+	pricing := DefaultPricing
+	if path := os.Getenv("SMS_PRICING_FILE"); path != "" {
+		if pricing, err = LoadPricing(path); err != nil {
+			log.Printf("⚠️  Failed to load SMS pricing, using the defaults: %v", err)
+			pricing = DefaultPricing
+		}
+	}
+
+	verifyBase := os.Getenv("SMS_VERIFY_LINK_BASE")
+	if verifyBase == "" {
+		verifyBase = DefaultVerifyBase
+	}
+
 	return &NotificationService{
-		provider: provider,
+		provider:    provider,
+		templates:   templates,
+		links:       VerifyLinks{Base: verifyBase},
+		pricing:     pricing,
+		locales:     NewLocalePreferences(),
+		maxSegments: DefaultMaxSegments,
 	}
 }
 
-// SendTicketConfirmation sends a ticket purchase confirmation SMS
-func (ns *NotificationService) SendTicketConfirmation(phoneNumber, route string, amount int) error {
-	message := fmt.Sprintf(
-		"🎟️ Africa Railways Ticket Confirmed!\n"+
-			"Route: %s\n"+
-			"Amount: %d AFRC\n"+
-			"Thank you for traveling with us!",
-		route, amount,
-	)
-	
+// mustLoadTemplates loads templates that are known to be valid
+func mustLoadTemplates(dir string) *Templates {
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// Provider returns the provider messages are sent through
+func (ns *NotificationService) Provider() SMSProvider {
+	return ns.provider
+}
+
+// SetOutbox makes notifications queue in the outbox, which retries them and
+// tracks delivery, instead of being sent once inline
+func (ns *NotificationService) SetOutbox(outbox *Outbox) {
+	ns.outbox = outbox
+}
+
+// SetTemplates replaces the message templates
+func (ns *NotificationService) SetTemplates(templates *Templates) {
+	ns.templates = templates
+}
+
+// SetShortLinker changes how ticket verification links are made
+func (ns *NotificationService) SetShortLinker(links ShortLinker) {
+	ns.links = links
+}
+
+// SetPricing changes the rates used for cost estimates
+func (ns *NotificationService) SetPricing(pricing Pricing) {
+	ns.pricing = pricing
+}
+
+// SetLocaleResolver changes how recipients' languages are looked up
+func (ns *NotificationService) SetLocaleResolver(resolver LocaleResolver) {
+	ns.locales = resolver
+}
+
+// SetMaxSegments changes the per-message segment limit
+func (ns *NotificationService) SetMaxSegments(max int) {
+	ns.maxSegments = max
+}
+
+// SetOptOuts sets the numbers that texted STOP; marketing messages skip them
+func (ns *NotificationService) SetOptOuts(optOuts OptOutList) {
+	ns.optOuts = optOuts
+}
+
+// ErrOptedOut is returned for marketing messages to numbers that texted STOP
+var ErrOptedOut = errors.New("number opted out of marketing SMS")
+
+// OptedOut reports whether a number has opted out of marketing messages
+func (ns *NotificationService) OptedOut(phoneNumber string) (bool, error) {
+	if ns.optOuts == nil {
+		return false, nil
+	}
+	return ns.optOuts.OptedOut(phoneNumber)
+}
+
+// send renders a template for the recipient and sends it
+func (ns *NotificationService) send(phoneNumber, name string, data interface{}) error {
+	message, err := ns.templates.Render(ns.locales.Locale(phoneNumber), name, data)
+	if err != nil {
+		return err
+	}
+	return ns.SendText(phoneNumber, name, message)
+}
+
+// SendText sends a message that is already written, e.g. a USSD gateway
+// message in the caller's language. kind labels it in the outbox.
+func (ns *NotificationService) SendText(phoneNumber, kind, message string) error {
+	if err := ns.checkSegments(message); err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+	if ns.outbox != nil {
+		_, err := ns.outbox.Enqueue(phoneNumber, kind, message)
+		return err
+	}
 	return ns.provider.SendSMS(phoneNumber, message)
 }
 
+// ErrTooManySegments is returned for messages longer than the segment limit
+var ErrTooManySegments = errors.New("message is too long")
+
+// checkSegments rejects messages that would be split into more segments
+// than allowed
+func (ns *NotificationService) checkSegments(message string) error {
+	info := CountSegments(message)
+	if info.Segments > ns.maxSegments {
+		return fmt.Errorf("%w: needs %d %s segments, limit is %d", ErrTooManySegments, info.Segments, info.Encoding, ns.maxSegments)
+	}
+	return nil
+}
+
+// SendTicketConfirmation sends a ticket purchase confirmation SMS. A
+// verification link is added when the ticket has an ID but no link.
+func (ns *NotificationService) SendTicketConfirmation(phoneNumber string, ticket TicketDetails) error {
+	if ticket.VerifyURL == "" && ticket.TicketID != "" {
+		ticket.VerifyURL = ns.links.ShortLink(ticket.TicketID)
+	}
+	return ns.send(phoneNumber, TemplateTicketConfirmation, ticket)
+}
+
+// SendDepartureReminder reminds a passenger that their train leaves soon
+func (ns *NotificationService) SendDepartureReminder(phoneNumber string, ticket TicketDetails) error {
+	return ns.send(phoneNumber, TemplateDepartureReminder, ticket)
+}
+
 // SendWalletTopUp sends a wallet top-up confirmation SMS
 func (ns *NotificationService) SendWalletTopUp(phoneNumber string, amount, newBalance int) error {
-	message := fmt.Sprintf(
-		"💳 Wallet Top-Up Successful!\n"+
-			"Amount: +%d AFRC\n"+
-			"New Balance: %d AFRC\n"+
-			"Africa Railways",
-		amount, newBalance,
-	)
-	
-	return ns.provider.SendSMS(phoneNumber, message)
+	return ns.send(phoneNumber, TemplateWalletTopUp, WalletTopUp{Amount: amount, Balance: newBalance})
 }
 
 // SendLowBalanceAlert sends a low balance warning SMS
 func (ns *NotificationService) SendLowBalanceAlert(phoneNumber string, balance int) error {
-	message := fmt.Sprintf(
-		"⚠️ Low Balance Alert!\n"+
-			"Current Balance: %d AFRC\n"+
-			"Top up now to continue booking tickets.\n"+
-			"Africa Railways",
-		balance,
-	)
-	
-	return ns.provider.SendSMS(phoneNumber, message)
+	return ns.send(phoneNumber, TemplateLowBalance, BalanceAlert{Balance: balance})
 }
 
-// SendWelcomeSMS sends a welcome SMS to new users
-func (ns *NotificationService) SendWelcomeSMS(phoneNumber, userName string) error {
-	message := fmt.Sprintf(
-		"🚂 Welcome to Africa Railways, %s!\n"+
-			"Your sovereign wallet is ready with 1,250 AFRC.\n"+
-			"Book your first ticket today!",
-		userName,
-	)
-	
-	return ns.provider.SendSMS(phoneNumber, message)
+// SendWelcomeSMS sends a welcome SMS to new users. openingBalance is the AFRC
+// the new wallet was funded with; the amount is left out when it is 0.
+func (ns *NotificationService) SendWelcomeSMS(phoneNumber, userName string, openingBalance int) error {
+	return ns.send(phoneNumber, TemplateWelcome, Welcome{Name: userName, Bonus: openingBalance})
 }
 
-// SendDailyDigest sends a daily transaction summary
+// SendDailyDigest sends a daily transaction summary, unless the number
+// opted out
 func (ns *NotificationService) SendDailyDigest(phoneNumber string, ticketCount, totalSpent, balance int) error {
-	message := fmt.Sprintf(
-		"📊 Daily Summary - Africa Railways\n"+
-			"Tickets: %d\n"+
-			"Spent: %d AFRC\n"+
-			"Balance: %d AFRC\n"+
-			"Safe travels!",
-		ticketCount, totalSpent, balance,
-	)
-	
-	return ns.provider.SendSMS(phoneNumber, message)
+	optedOut, err := ns.OptedOut(phoneNumber)
+	if err != nil {
+		return err
+	}
+	if optedOut {
+		return ErrOptedOut
+	}
+	return ns.send(phoneNumber, TemplateDailyDigest, DailyDigest{Tickets: ticketCount, Spent: totalSpent, Balance: balance})
 }
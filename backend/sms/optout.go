@@ -0,0 +1,91 @@
+package sms
+
+import (
+	"sync"
+	"time"
+)
+
+// OptOutList records numbers that texted STOP. Only marketing messages,
+// such as daily digests, are withheld; tickets, reminders and alerts about
+// the passenger's own wallet still go out.
+type OptOutList interface {
+	OptOut(phone string) error
+	OptIn(phone string) error
+	OptedOut(phone string) (bool, error)
+}
+
+// FileOptOuts keeps opted-out numbers and when they opted out in a journal
+// file, one JSON line per STOP or START
+type FileOptOuts struct {
+	journal *timeJournal
+	numbers map[string]time.Time
+	mu      sync.Mutex
+}
+
+// NewFileOptOuts loads the list at path, or keeps it in memory if path is
+// empty
+func NewFileOptOuts(path string) (*FileOptOuts, error) {
+	l := &FileOptOuts{numbers: make(map[string]time.Time)}
+	if path == "" {
+		return l, nil
+	}
+	var err error
+	if l.journal, err = openTimeJournal(path, "opt-out list", l.numbers); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *FileOptOuts) OptOut(phone string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.numbers[phone]; ok {
+		return nil
+	}
+	l.numbers[phone] = time.Now().UTC()
+	if err := l.save(timeRecord{Key: phone, Time: l.numbers[phone]}); err != nil {
+		delete(l.numbers, phone)
+		return err
+	}
+	return nil
+}
+
+func (l *FileOptOuts) OptIn(phone string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	since, ok := l.numbers[phone]
+	if !ok {
+		return nil
+	}
+	delete(l.numbers, phone)
+	if err := l.save(timeRecord{Key: phone, Deleted: true}); err != nil {
+		l.numbers[phone] = since
+		return err
+	}
+	return nil
+}
+
+func (l *FileOptOuts) OptedOut(phone string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.numbers[phone]
+	return ok, nil
+}
+
+// Close closes the journal
+func (l *FileOptOuts) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.journal == nil {
+		return nil
+	}
+	return l.journal.close()
+}
+
+// save appends a change to the journal; callers hold l.mu
+func (l *FileOptOuts) save(record timeRecord) error {
+	if l.journal == nil {
+		return nil
+	}
+	return l.journal.append(l.numbers, record)
+}
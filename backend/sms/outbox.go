@@ -0,0 +1,524 @@
+package sms
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MessageStatus is where a message is in its life
+type MessageStatus string
+
+const (
+	StatusQueued    MessageStatus = "queued"    // Waiting for its next attempt
+	StatusSent      MessageStatus = "sent"      // Accepted by a provider
+	StatusDelivered MessageStatus = "delivered" // Handset confirmed receipt
+	StatusFailed    MessageStatus = "failed"    // Out of attempts, or rejected by the network
+)
+
+// final reports whether no further attempts or reports will change a status
+func (s MessageStatus) final() bool {
+	return s == StatusDelivered || s == StatusFailed
+}
+
+// Outbox defaults
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 15 * time.Second
+	DefaultMaxBackoff  = 15 * time.Minute
+	DefaultRetention   = 7 * 24 * time.Hour
+)
+
+// compactAfter is how many journal records the outbox appends before it
+// considers rewriting the journal with only the live messages
+const compactAfter = 1000
+
+// earlyReportTTL is how long a delivery report for an unknown message is
+// kept in case it raced the send it belongs to
+const earlyReportTTL = 10 * time.Minute
+
+// ErrUnknownMessage is returned for delivery reports that match no message
+var ErrUnknownMessage = errors.New("unknown SMS message")
+
+// OutboxMessage is a queued notification and its delivery state
+type OutboxMessage struct {
+	ID          string        `json:"id"`
+	To          string        `json:"to"`
+	Kind        string        `json:"kind"` // Catalogue key, e.g. "ticket_confirmation"
+	Body        string        `json:"body"`
+	Status      MessageStatus `json:"status"`
+	Attempts    int           `json:"attempts"`
+	NextAttempt time.Time     `json:"next_attempt,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	Provider    string        `json:"provider,omitempty"`
+	ProviderID  string        `json:"provider_message_id,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// deliveryReport is a provider's report on one of its messages
+type deliveryReport struct {
+	Status   MessageStatus
+	Reason   string
+	Received time.Time
+}
+
+// Outbox persists notifications to a journal and sends them in the
+// background, retrying with exponential backoff, so messages survive
+// provider outages and restarts. Delivery is at least once: a crash between
+// a provider accepting a message and the outbox saving that fact resends it.
+//
+// The journal is a JSON line per change, holding the message as it now is,
+// so recording a change costs one append whatever the outbox holds. Once it
+// is mostly superseded records it is rewritten with the live messages only.
+type Outbox struct {
+	provider SMSProvider
+	path     string
+	journal  *os.File
+	records  int // Records in the journal
+
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Retention   time.Duration
+
+	messages   map[string]*OutboxMessage
+	byProvider map[string]string         // provider/provider ID -> message ID
+	early      map[string]deliveryReport // reports that arrived before the send was recorded
+	wake       chan struct{}
+	mu         sync.Mutex
+}
+
+// NewOutbox loads the outbox at path, or keeps it in memory if path is empty
+func NewOutbox(path string, provider SMSProvider) (*Outbox, error) {
+	o := &Outbox{
+		provider:    provider,
+		path:        path,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		Retention:   DefaultRetention,
+		messages:    make(map[string]*OutboxMessage),
+		byProvider:  make(map[string]string),
+		early:       make(map[string]deliveryReport),
+		wake:        make(chan struct{}, 1),
+	}
+	if path == "" {
+		return o, nil
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, m := range o.messages {
+		if m.ProviderID != "" {
+			o.byProvider[providerKey(m.Provider, m.ProviderID)] = m.ID
+		}
+		if m.Status == StatusQueued {
+			pending++
+		}
+	}
+	log.Printf("📬 SMS outbox loaded: %d messages, %d pending", len(o.messages), pending)
+	return o, nil
+}
+
+// journalRecord is a line of the journal: a message as it now is, or that
+// it was dropped
+type journalRecord struct {
+	OutboxMessage
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// load replays the journal and opens it for appending. A last line cut
+// short by a crash is dropped.
+func (o *Outbox) load() error {
+	data, err := os.ReadFile(o.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	good := 0
+	for len(data[good:]) > 0 {
+		line := data[good:]
+		end := bytes.IndexByte(line, '\n')
+		if end < 0 {
+			log.Printf("⚠️  Dropping an incomplete record at the end of SMS outbox %s", o.path)
+			break
+		}
+		var record journalRecord
+		if err := json.Unmarshal(line[:end], &record); err != nil {
+			return fmt.Errorf("invalid SMS outbox %s: %w", o.path, err)
+		}
+		if record.Deleted {
+			delete(o.messages, record.ID)
+		} else {
+			m := record.OutboxMessage
+			o.messages[m.ID] = &m
+		}
+		o.records++
+		good += end + 1
+	}
+
+	o.journal, err = os.OpenFile(o.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := o.journal.Truncate(int64(good)); err != nil {
+		return err
+	}
+	_, err = o.journal.Seek(int64(good), io.SeekStart)
+	return err
+}
+
+// Close closes the journal
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.journal == nil {
+		return nil
+	}
+	err := o.journal.Close()
+	o.journal = nil
+	return err
+}
+
+func providerKey(provider, id string) string {
+	return provider + "/" + id
+}
+
+func newMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Enqueue saves a message for sending. Once it returns nil the message will
+// be attempted even if the process restarts.
+func (o *Outbox) Enqueue(to, kind, body string) (*OutboxMessage, error) {
+	now := time.Now()
+	m := &OutboxMessage{
+		ID:          newMessageID(),
+		To:          to,
+		Kind:        kind,
+		Body:        body,
+		Status:      StatusQueued,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	o.mu.Lock()
+	o.messages[m.ID] = m
+	err := o.save(m)
+	if err != nil {
+		delete(o.messages, m.ID)
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue SMS: %w", err)
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	queued := *m
+	return &queued, nil
+}
+
+// Get returns a copy of a message
+func (o *Outbox) Get(id string) (OutboxMessage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	m, ok := o.messages[id]
+	if !ok {
+		return OutboxMessage{}, false
+	}
+	return *m, true
+}
+
+// Messages returns copies of the messages with a status, or all messages
+// if status is empty, newest first
+func (o *Outbox) Messages(status MessageStatus) []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var list []OutboxMessage
+	for _, m := range o.messages {
+		if status == "" || m.Status == status {
+			list = append(list, *m)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Run sends due messages until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	log.Printf("📬 SMS outbox running (max %d attempts)", o.MaxAttempts)
+	for {
+		wait := o.flush(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// flush attempts every due message and returns how long to sleep
+func (o *Outbox) flush(ctx context.Context) time.Duration {
+	for _, m := range o.due() {
+		if ctx.Err() != nil {
+			break
+		}
+		result, err := send(o.provider, m.To, m.Body)
+		o.recordAttempt(m.ID, result, err)
+	}
+	return o.prune()
+}
+
+// due returns copies of the queued messages whose next attempt has come
+func (o *Outbox) due() []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	var list []OutboxMessage
+	for _, m := range o.messages {
+		if m.Status == StatusQueued && !m.NextAttempt.After(now) {
+			list = append(list, *m)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// recordAttempt stores the outcome of sending a message
+func (o *Outbox) recordAttempt(id string, result SendResult, sendErr error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	m, ok := o.messages[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	m.Attempts++
+	m.UpdatedAt = now
+
+	switch {
+	case sendErr == nil:
+		m.Status = StatusSent
+		m.LastError = ""
+		m.Provider = result.Provider
+		m.ProviderID = result.MessageID
+		if m.ProviderID != "" {
+			key := providerKey(m.Provider, m.ProviderID)
+			o.byProvider[key] = m.ID
+			if report, ok := o.early[key]; ok {
+				delete(o.early, key)
+				applyReport(m, report)
+			}
+		}
+	case m.Attempts >= o.MaxAttempts:
+		m.Status = StatusFailed
+		m.LastError = sendErr.Error()
+		log.Printf("❌ Giving up on %s SMS %s to %s after %d attempts: %v", m.Kind, m.ID, m.To, m.Attempts, sendErr)
+	default:
+		m.LastError = sendErr.Error()
+		m.NextAttempt = now.Add(o.backoff(m.Attempts))
+		log.Printf("⏳ %s SMS %s to %s failed (attempt %d/%d), retrying at %s: %v",
+			m.Kind, m.ID, m.To, m.Attempts, o.MaxAttempts, m.NextAttempt.Format(time.TimeOnly), sendErr)
+	}
+
+	if err := o.save(m); err != nil {
+		log.Printf("⚠️  Failed to save SMS outbox: %v", err)
+	}
+}
+
+// backoff doubles the wait after each failed attempt, up to MaxBackoff
+func (o *Outbox) backoff(attempts int) time.Duration {
+	wait := o.Backoff
+	for i := 1; i < attempts && wait < o.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, o.MaxBackoff)
+}
+
+// UpdateStatus applies a delivery report from a provider
+func (o *Outbox) UpdateStatus(provider, providerID string, status MessageStatus, reason string) error {
+	report := deliveryReport{Status: status, Reason: reason, Received: time.Now()}
+	key := providerKey(provider, providerID)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id, ok := o.byProvider[key]
+	if !ok {
+		o.early[key] = report
+		return fmt.Errorf("%w: %s", ErrUnknownMessage, key)
+	}
+	m := o.messages[id]
+	if !applyReport(m, report) {
+		return nil
+	}
+	switch m.Status {
+	case StatusDelivered:
+		log.Printf("📨 %s SMS %s delivered to %s", m.Kind, m.ID, m.To)
+	case StatusFailed:
+		log.Printf("❌ %s SMS %s to %s was not delivered: %s", m.Kind, m.ID, m.To, m.LastError)
+	}
+	return o.save(m)
+}
+
+// applyReport moves a message to the reported status. Reports can arrive out
+// of order, so a final status is never overwritten.
+func applyReport(m *OutboxMessage, report deliveryReport) bool {
+	if m.Status.final() || m.Status == report.Status {
+		return false
+	}
+	m.Status = report.Status
+	if report.Reason != "" {
+		m.LastError = report.Reason
+	}
+	m.UpdatedAt = report.Received
+	return true
+}
+
+// prune drops old finished messages and stale early reports, and returns
+// how long until the next queued message is due
+func (o *Outbox) prune() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	wait := time.Minute
+	var removed []string
+	for id, m := range o.messages {
+		switch {
+		case m.Status == StatusQueued:
+			wait = min(wait, max(m.NextAttempt.Sub(now), 0))
+		case now.Sub(m.UpdatedAt) > o.Retention && (m.Status.final() || m.Status == StatusSent):
+			delete(o.messages, id)
+			delete(o.byProvider, providerKey(m.Provider, m.ProviderID))
+			removed = append(removed, id)
+		}
+	}
+	for key, report := range o.early {
+		if now.Sub(report.Received) > earlyReportTTL {
+			delete(o.early, key)
+		}
+	}
+	if len(removed) > 0 {
+		if err := o.drop(removed); err != nil {
+			log.Printf("⚠️  Failed to save SMS outbox: %v", err)
+		}
+	}
+	return wait
+}
+
+// save appends a message's current state to the journal; callers hold o.mu
+func (o *Outbox) save(m *OutboxMessage) error {
+	return o.append(journalRecord{OutboxMessage: *m})
+}
+
+// drop records that messages were removed; callers hold o.mu
+func (o *Outbox) drop(ids []string) error {
+	records := make([]journalRecord, len(ids))
+	for i, id := range ids {
+		records[i] = journalRecord{OutboxMessage: OutboxMessage{ID: id}, Deleted: true}
+	}
+	return o.append(records...)
+}
+
+// append writes records to the journal and syncs it, compacting the journal
+// once most of it is superseded; callers hold o.mu
+func (o *Outbox) append(records ...journalRecord) error {
+	if o.path == "" {
+		return nil
+	}
+	if o.journal == nil {
+		return os.ErrClosed
+	}
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// A failed write may leave part of a line; cut it off so later records
+	// don't follow it
+	offset, err := o.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := o.journal.Write(buf.Bytes()); err != nil {
+		o.journal.Truncate(offset)
+		o.journal.Seek(offset, io.SeekStart)
+		return err
+	}
+	if err := o.journal.Sync(); err != nil {
+		return err
+	}
+	o.records += len(records)
+	if o.records > compactAfter && o.records > 4*len(o.messages) {
+		if err := o.compact(); err != nil {
+			log.Printf("⚠️  Failed to compact SMS outbox: %v", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the journal with one record per live message; callers
+// hold o.mu
+func (o *Outbox) compact() error {
+	messages := make([]*OutboxMessage, 0, len(o.messages))
+	for _, m := range o.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), ".outbox-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, m := range messages {
+		if err := enc.Encode(journalRecord{OutboxMessage: *m}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), o.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	// The renamed file is the journal now, positioned at its end
+	o.journal.Close()
+	o.journal, o.records = tmp, len(messages)
+	return nil
+}
@@ -0,0 +1,125 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Preview is a rendered message with what it will take to send
+type Preview struct {
+	Template string `json:"template"`
+	Locale   string `json:"locale"`
+	Text     string `json:"text"`
+	SegmentInfo
+	OverLimit bool          `json:"over_limit"` // Would be refused by the segment limit
+	Cost      *CostEstimate `json:"cost,omitempty"`
+}
+
+// Preview renders a template without sending it. The locale defaults to the
+// recipient's; with a phone number the cost through the provider that would
+// be tried first is estimated too.
+func (ns *NotificationService) Preview(locale, name, phoneNumber string, data interface{}) (Preview, error) {
+	if locale == "" {
+		locale = ns.locales.Locale(phoneNumber)
+	}
+	if ticket, ok := data.(*TicketDetails); ok && ticket.VerifyURL == "" && ticket.TicketID != "" {
+		ticket.VerifyURL = ns.links.ShortLink(ticket.TicketID)
+	}
+	text, err := ns.templates.Render(locale, name, data)
+	if err != nil {
+		return Preview{}, err
+	}
+	preview := Preview{Template: name, Locale: locale, Text: text, SegmentInfo: CountSegments(text)}
+	preview.OverLimit = preview.Segments > ns.maxSegments
+	if phoneNumber != "" {
+		if cost, ok := ns.pricing.Estimate(ns.firstProvider(phoneNumber), phoneNumber, preview.SegmentInfo); ok {
+			preview.Cost = &cost
+		}
+	}
+	return preview, nil
+}
+
+// firstProvider is the provider a message to the number goes to first
+func (ns *NotificationService) firstProvider(phoneNumber string) string {
+	if fp, ok := ns.provider.(*FailoverProvider); ok {
+		if order := fp.Order(phoneNumber); len(order) > 0 {
+			return order[0]
+		}
+	}
+	return providerName(ns.provider)
+}
+
+// previewRequest is the body of POST /preview. Fields left out of Data keep
+// their sample values, so {"template":"welcome"} alone previews the sample.
+type previewRequest struct {
+	Template string          `json:"template"`
+	Locale   string          `json:"locale"`
+	To       string          `json:"to"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// TemplatesHandler serves the template preview API:
+//
+//	GET  /         template names, locales and sample data
+//	POST /preview  render a template, count its segments and estimate its cost
+func (ns *NotificationService) TemplatesHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ns.handleTemplates)
+	mux.HandleFunc("/preview", ns.handlePreview)
+	return mux
+}
+
+func (ns *NotificationService) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	samples := make(map[string]interface{})
+	for _, name := range ns.templates.Names() {
+		if sample, ok := templateSamples[name]; ok {
+			samples[name] = sample()
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"templates": ns.templates.Names(),
+		"locales":   ns.templates.Locales(),
+		"samples":   samples,
+	})
+}
+
+func (ns *NotificationService) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req previewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	sample, ok := templateSamples[req.Template]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown template %q", req.Template), http.StatusNotFound)
+		return
+	}
+	data := sample()
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, data); err != nil {
+			http.Error(w, "invalid data: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	preview, err := ns.Preview(req.Locale, req.Template, req.To, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
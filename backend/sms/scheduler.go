@@ -0,0 +1,187 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is work the scheduler runs on a cron schedule
+type Job struct {
+	Name     string
+	Schedule *Schedule
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Locker elects the replica that runs jobs
+type Locker interface {
+	// TryLock takes the lock if it is free and reports whether this process
+	// holds it. Once taken it is held until the process exits.
+	TryLock() (bool, error)
+}
+
+// Scheduler runs jobs at the top of each minute they are due in. Only the
+// replica holding the lock runs them; the others keep trying so one takes
+// over if the leader dies.
+type Scheduler struct {
+	jobs   []Job
+	lock   Locker
+	leader bool
+}
+
+// NewScheduler creates a scheduler; a nil lock runs jobs unconditionally
+func NewScheduler(lock Locker) *Scheduler {
+	return &Scheduler{lock: lock}
+}
+
+// Add registers a job
+func (s *Scheduler) Add(name, spec string, loc *time.Location, run func(ctx context.Context, now time.Time) error) error {
+	schedule, err := ParseSchedule(spec, loc)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.jobs = append(s.jobs, Job{Name: name, Schedule: schedule, Run: run})
+	log.Printf("🗓️  Scheduled %s at %q (next %s)", name, spec, schedule.Next(time.Now()).Format(time.RFC3339))
+	return nil
+}
+
+// Run fires due jobs until ctx is cancelled. Jobs run one after another so a
+// slow one delays the rest rather than overlapping itself.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+		}
+		s.tick(ctx, next)
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	if !s.isLeader() {
+		return
+	}
+	for _, job := range s.jobs {
+		if !job.Schedule.Matches(now) || ctx.Err() != nil {
+			continue
+		}
+		start := time.Now()
+		if err := job.Run(ctx, now); err != nil {
+			log.Printf("❌ Job %s failed: %v", job.Name, err)
+			continue
+		}
+		log.Printf("✅ Job %s finished in %s", job.Name, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+func (s *Scheduler) isLeader() bool {
+	if s.lock == nil || s.leader {
+		return true
+	}
+	ok, err := s.lock.TryLock()
+	if err != nil {
+		log.Printf("⚠️  Failed to take the scheduler lock: %v", err)
+		return false
+	}
+	if ok {
+		s.leader = true
+		log.Println("👑 This replica now runs scheduled notifications")
+	}
+	return ok
+}
+
+// SentLog remembers which notifications have gone out so a rerun, a restart
+// or a second replica never sends one twice
+type SentLog interface {
+	// MarkSent records key and reports whether it was new. Keys are kept for
+	// ttl, which must outlast the window the notification can be sent in.
+	MarkSent(key string, ttl time.Duration) (bool, error)
+	// Forget removes key so the notification can be sent again
+	Forget(key string) error
+}
+
+// FileSentLog keeps sent keys and their expiry in a journal file, one JSON
+// line per change, so marking a key costs one append however many are kept
+type FileSentLog struct {
+	journal *timeJournal
+	keys    map[string]time.Time
+	mu      sync.Mutex
+}
+
+// NewFileSentLog loads the log at path, or keeps it in memory if path is empty
+func NewFileSentLog(path string) (*FileSentLog, error) {
+	l := &FileSentLog{keys: make(map[string]time.Time)}
+	if path == "" {
+		return l, nil
+	}
+	var err error
+	if l.journal, err = openTimeJournal(path, "sent log", l.keys); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for key, expires := range l.keys {
+		if !now.Before(expires) {
+			delete(l.keys, key)
+		}
+	}
+	return l, nil
+}
+
+func (l *FileSentLog) MarkSent(key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if expires, ok := l.keys[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+	for k, expires := range l.keys {
+		if !now.Before(expires) {
+			delete(l.keys, k)
+		}
+	}
+	l.keys[key] = now.Add(ttl)
+	if err := l.save(timeRecord{Key: key, Time: l.keys[key]}); err != nil {
+		delete(l.keys, key)
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *FileSentLog) Forget(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires, ok := l.keys[key]
+	if !ok {
+		return nil
+	}
+	delete(l.keys, key)
+	if err := l.save(timeRecord{Key: key, Deleted: true}); err != nil {
+		l.keys[key] = expires
+		return err
+	}
+	return nil
+}
+
+// Close closes the journal
+func (l *FileSentLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.journal == nil {
+		return nil
+	}
+	return l.journal.close()
+}
+
+// save appends a change to the journal; expired keys are simply left out
+// when it is compacted. Callers hold l.mu.
+func (l *FileSentLog) save(record timeRecord) error {
+	if l.journal == nil {
+		return nil
+	}
+	return l.journal.append(l.keys, record)
+}
@@ -0,0 +1,65 @@
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character set an SMS will be sent in
+type Encoding string
+
+const (
+	EncodingGSM7 Encoding = "GSM-7"
+	EncodingUCS2 Encoding = "UCS-2"
+)
+
+// Per-segment capacities. Concatenated messages lose room to the UDH header.
+const (
+	gsm7SingleLimit = 160
+	gsm7MultiLimit  = 153
+	ucs2SingleLimit = 70
+	ucs2MultiLimit  = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet (one septet each)
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters need an escape septet, so they count twice
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// SegmentInfo describes how a message will be split on the air interface
+type SegmentInfo struct {
+	Encoding   Encoding `json:"encoding"`
+	Units      int      `json:"units"` // Septets for GSM-7, UTF-16 code units for UCS-2
+	Segments   int      `json:"segments"`
+	PerSegment int      `json:"per_segment"`
+}
+
+// CountSegments works out the encoding and segment count for a message.
+// A single character outside GSM-7 (an emoji, a tilde vowel) switches the
+// whole message to UCS-2 and more than halves its capacity.
+func CountSegments(message string) SegmentInfo {
+	septets := 0
+	for _, r := range message {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			units := len(utf16.Encode([]rune(message)))
+			return segmentInfo(EncodingUCS2, units, ucs2SingleLimit, ucs2MultiLimit)
+		}
+	}
+	return segmentInfo(EncodingGSM7, septets, gsm7SingleLimit, gsm7MultiLimit)
+}
+
+func segmentInfo(encoding Encoding, units, single, multi int) SegmentInfo {
+	info := SegmentInfo{Encoding: encoding, Units: units, Segments: 1, PerSegment: single}
+	if units > single {
+		info.PerSegment = multi
+		info.Segments = (units + multi - 1) / multi
+	}
+	return info
+}
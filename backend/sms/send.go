@@ -0,0 +1,96 @@
+package sms
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// SendAPI lets other services, e.g. the USSD gateway, send SMS through the
+// notifier, so their messages are queued in the outbox with failover,
+// retries and delivery tracking. Every request needs Token as a Bearer
+// token; without one the API refuses them all.
+type SendAPI struct {
+	Notifier *NotificationService
+	Token    string
+}
+
+// Handler serves under the path it is mounted at:
+//
+//	POST /send                  {"to", "kind", "body"}, a message already written
+//	POST /ticket-confirmation   {"to", "ticket": TicketDetails}
+func (a *SendAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/send", a.handleSend)
+	mux.HandleFunc("/ticket-confirmation", a.handleTicketConfirmation)
+	return mux
+}
+
+func (a *SendAPI) handleSend(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !a.authorized(w, r) {
+		return
+	}
+	var req struct {
+		To   string `json:"to"`
+		Kind string `json:"kind"`
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Kind == "" || req.Body == "" {
+		http.Error(w, "expected JSON with to, kind and body", http.StatusBadRequest)
+		return
+	}
+	phone := e164(req.To)
+	if phone == "" {
+		http.Error(w, "invalid phone number", http.StatusBadRequest)
+		return
+	}
+	a.respond(w, a.Notifier.SendText(phone, req.Kind, req.Body))
+}
+
+func (a *SendAPI) handleTicketConfirmation(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r) || !a.authorized(w, r) {
+		return
+	}
+	var req struct {
+		To     string        `json:"to"`
+		Ticket TicketDetails `json:"ticket"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ticket.Route == "" {
+		http.Error(w, "expected JSON with to and ticket", http.StatusBadRequest)
+		return
+	}
+	phone := e164(req.To)
+	if phone == "" {
+		http.Error(w, "invalid phone number", http.StatusBadRequest)
+		return
+	}
+	a.respond(w, a.Notifier.SendTicketConfirmation(phone, req.Ticket))
+}
+
+func (a *SendAPI) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if a.Token == "" {
+		http.Error(w, "send token not configured", http.StatusForbidden)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(a.Token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// respond reports a queued message as 202 Accepted; one too long to send
+// is the caller's mistake, anything else is ours
+func (a *SendAPI) respond(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTooManySegments):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	}
+}
@@ -0,0 +1,265 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GatewayTickets reads tickets from the USSD gateway's admin API
+type GatewayTickets struct {
+	BaseURL    string // e.g. http://ussd-gateway:8081
+	AdminToken string // The gateway's USSD_ADMIN_TOKEN
+	Client     *http.Client
+}
+
+// Departing lists issued tickets departing in [from, to)
+func (g *GatewayTickets) Departing(ctx context.Context, from, to time.Time) ([]UpcomingTicket, error) {
+	query := url.Values{
+		"departing_from": {from.UTC().Format(time.RFC3339)},
+		"departing_to":   {to.UTC().Format(time.RFC3339)},
+	}
+	var tickets []GatewayTicket
+	if err := getJSON(ctx, g.Client, g.url("/tickets", query), g.AdminToken, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to list departing tickets: %w", err)
+	}
+
+	var upcoming []UpcomingTicket
+	for _, t := range tickets {
+		if t.Status != TicketIssued {
+			continue
+		}
+		upcoming = append(upcoming, UpcomingTicket{
+			Phone: t.MSISDN,
+			TicketDetails: TicketDetails{
+				TicketID:  t.TicketID,
+				Route:     t.RouteName(),
+				Departure: t.Departure,
+			},
+		})
+	}
+	return upcoming, nil
+}
+
+// WalletFeed reads wallet summaries from an HTTP endpoint returning a JSON
+// array of WalletSummary for ?date=YYYY-MM-DD. AFRC balances are kept by the
+// wallet ledger, not in this repository.
+type WalletFeed struct {
+	URL    string
+	Token  string // Sent as a bearer token if set
+	Client *http.Client
+}
+
+func (f *WalletFeed) Summaries(ctx context.Context, day time.Time) ([]WalletSummary, error) {
+	sep := "?"
+	if strings.Contains(f.URL, "?") {
+		sep = "&"
+	}
+	var summaries []WalletSummary
+	if err := getJSON(ctx, f.Client, f.URL+sep+"date="+day.Format(time.DateOnly), f.Token, &summaries); err != nil {
+		return nil, fmt.Errorf("failed to load wallet summaries: %w", err)
+	}
+	return summaries, nil
+}
+
+// GatewayTicket is a ticket as the gateway's admin API returns it
+type GatewayTicket struct {
+	TicketID  string       `json:"ticket_id"`
+	MSISDN    string       `json:"msisdn"`
+	Route     string       `json:"route"`
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Class     string       `json:"class"`
+	Departure time.Time    `json:"departure"`
+	Price     gatewayMoney `json:"price"`
+	Status    string       `json:"status"`
+	Refund    gatewayMoney `json:"refund"`
+}
+
+// gatewayMoney is the gateway's {"minor","currency","display"} amount; only
+// the display form is needed here
+type gatewayMoney struct {
+	Display string `json:"display"`
+}
+
+// RouteName is "From - To", or the route code for older tickets
+func (t *GatewayTicket) RouteName() string {
+	if t.From != "" && t.To != "" {
+		return t.From + " - " + t.To
+	}
+	return t.Route
+}
+
+// Registered reports whether a number has a passenger profile
+func (g *GatewayTickets) Registered(ctx context.Context, phone string) (bool, error) {
+	var passenger struct {
+		MSISDN string `json:"msisdn"`
+	}
+	err := getJSON(ctx, g.Client, g.url("/passengers", url.Values{"msisdn": {phone}}), g.AdminToken, &passenger)
+	if isStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up passenger: %w", err)
+	}
+	return true, nil
+}
+
+// Ticket loads a ticket by number
+func (g *GatewayTickets) Ticket(ctx context.Context, ticketID string) (*GatewayTicket, error) {
+	var ticket GatewayTicket
+	err := getJSON(ctx, g.Client, g.url("/tickets", url.Values{"id": {ticketID}}), g.AdminToken, &ticket)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ticket: %w", err)
+	}
+	return &ticket, nil
+}
+
+// PassengerTickets lists a passenger's tickets, newest first
+func (g *GatewayTickets) PassengerTickets(ctx context.Context, phone string) ([]GatewayTicket, error) {
+	var tickets []GatewayTicket
+	if err := getJSON(ctx, g.Client, g.url("/tickets", url.Values{"msisdn": {phone}}), g.AdminToken, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to list tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// QuoteCancel returns what cancelling a passenger's ticket now would refund
+func (g *GatewayTickets) QuoteCancel(ctx context.Context, phone, ticketID string) (RefundQuote, error) {
+	var quote struct {
+		Percent     float64      `json:"percent"`
+		Amount      gatewayMoney `json:"amount"`
+		PINRequired bool         `json:"pin_required"`
+	}
+	body := map[string]interface{}{"ticket_id": ticketID, "msisdn": phone, "quote": true}
+	if err := postJSON(ctx, g.Client, g.url("/admin/tickets/cancel", nil), g.AdminToken, body, &quote); err != nil {
+		return RefundQuote{}, cancelErr(err)
+	}
+	return RefundQuote{TicketID: ticketID, Percent: quote.Percent, Refund: quote.Amount.Display, PINRequired: quote.PINRequired}, nil
+}
+
+// Cancel cancels a passenger's ticket under the fare policy, once the
+// gateway has checked their PIN. The gateway's own confirmation SMS is
+// suppressed; the caller replies.
+func (g *GatewayTickets) Cancel(ctx context.Context, phone, ticketID, pin string) (RefundQuote, error) {
+	var ticket GatewayTicket
+	body := map[string]interface{}{"ticket_id": ticketID, "msisdn": phone, "reason": "sms", "quiet": true, "pin": pin}
+	if err := postJSON(ctx, g.Client, g.url("/admin/tickets/cancel", nil), g.AdminToken, body, &ticket); err != nil {
+		return RefundQuote{}, cancelErr(err)
+	}
+	return RefundQuote{TicketID: ticket.TicketID, Refund: ticket.Refund.Display}, nil
+}
+
+func (g *GatewayTickets) url(path string, query url.Values) string {
+	u := strings.TrimRight(g.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// cancelErr maps the gateway's cancellation responses to ticket errors
+func cancelErr(err error) error {
+	var status *statusError
+	if !errors.As(err, &status) {
+		return fmt.Errorf("failed to cancel ticket: %w", err)
+	}
+	switch {
+	case status.Code == http.StatusPreconditionRequired:
+		return ErrPINRequired
+	case status.Code == http.StatusUnprocessableEntity:
+		return ErrWrongPIN
+	case status.Code == http.StatusLocked:
+		return ErrPINLocked
+	case status.Code == http.StatusNotFound:
+		return ErrTicketNotFound
+	case status.Code == http.StatusForbidden:
+		return ErrNotTicketOwner
+	case status.Code == http.StatusConflict && strings.Contains(status.Body, "departure"):
+		return ErrTooLate
+	case status.Code == http.StatusConflict:
+		return ErrTicketClosed
+	}
+	return fmt.Errorf("failed to cancel ticket: %w", err)
+}
+
+// Balance finds a passenger's AFRC balance in today's summaries
+func (f *WalletFeed) Balance(ctx context.Context, phone string) (int, error) {
+	summaries, err := f.Summaries(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range summaries {
+		if s.Phone == phone {
+			return s.Balance, nil
+		}
+	}
+	return 0, ErrUnknownWallet
+}
+
+// statusError is a non-200 response from an internal API
+type statusError struct {
+	URL  string
+	Code int
+	Body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.URL, e.Code, e.Body)
+}
+
+func isStatus(err error, code int) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.Code == code
+}
+
+func getJSON(ctx context.Context, client *http.Client, url, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, token, v)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, token string, body, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(client, req, token, v)
+}
+
+func doJSON(client *http.Client, req *http.Request, token string, v interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{URL: req.URL.Redacted(), Code: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,346 @@
+package sms
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTemplates are the built-in templates, one file of {{define}} blocks
+// per locale
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Template names, one per notification
+const (
+	TemplateTicketConfirmation = "ticket_confirmation"
+	TemplateDepartureReminder  = "departure_reminder"
+	TemplateWalletTopUp        = "wallet_topup"
+	TemplateLowBalance         = "low_balance"
+	TemplateWelcome            = "welcome"
+	TemplateDailyDigest        = "daily_digest"
+
+	// Replies to SMS commands
+	TemplateCommandHelp   = "command_help"
+	TemplateNotRegistered = "not_registered"
+	TemplateTicketStatus  = "ticket_status"
+	TemplateMyTickets     = "my_tickets"
+	TemplateWalletBalance = "wallet_balance"
+	TemplateCancelQuote   = "cancel_quote"
+	TemplateCancelDone    = "cancel_done"
+	TemplateTicketRefused = "ticket_refused"
+	TemplateOptedOut      = "opted_out"
+	TemplateOptedIn       = "opted_in"
+)
+
+// TicketDetails is the data for ticket_confirmation and departure_reminder
+type TicketDetails struct {
+	TicketID  string    `json:"ticket_id"`
+	Route     string    `json:"route"`
+	Amount    int       `json:"amount"`          // AFRC
+	Price     string    `json:"price,omitempty"` // Written fare, e.g. "R150.00"; replaces Amount
+	Seat      string    `json:"seat,omitempty"`
+	Departure time.Time `json:"departure"` // Shown in its own time zone
+	VerifyURL string    `json:"verify_url,omitempty"`
+}
+
+// WalletTopUp is the data for wallet_topup
+type WalletTopUp struct {
+	Amount  int `json:"amount"`
+	Balance int `json:"balance"`
+}
+
+// BalanceAlert is the data for low_balance
+type BalanceAlert struct {
+	Balance int `json:"balance"`
+}
+
+// Welcome is the data for welcome
+type Welcome struct {
+	Name  string `json:"name"`
+	Bonus int    `json:"bonus"` // Opening AFRC balance, left out when 0
+}
+
+// DailyDigest is the data for daily_digest
+type DailyDigest struct {
+	Tickets int `json:"tickets"`
+	Spent   int `json:"spent"`
+	Balance int `json:"balance"`
+}
+
+// TicketStatus is the data for ticket_status and each ticket in my_tickets
+type TicketStatus struct {
+	TicketID  string    `json:"ticket_id"`
+	Route     string    `json:"route"`
+	Departure time.Time `json:"departure"`
+	Status    string    `json:"status"` // issued, cancelled or exchanged
+	Price     string    `json:"price"`  // Formatted, e.g. "R150.00"
+}
+
+// MyTickets is the data for my_tickets
+type MyTickets struct {
+	Tickets []TicketStatus `json:"tickets"` // Upcoming, soonest first
+	More    int            `json:"more"`    // Upcoming tickets left out
+}
+
+// WalletBalance is the data for wallet_balance
+type WalletBalance struct {
+	Balance     int  `json:"balance"`
+	Unavailable bool `json:"unavailable"`
+}
+
+// Reasons a ticket command is refused
+const (
+	ReasonNotFound = "not_found"
+	ReasonClosed   = "closed"
+	ReasonTooLate  = "too_late"
+
+	// CANCEL without the passenger's PIN, with a wrong one, or while their
+	// PIN is locked
+	ReasonPINRequired = "pin_required"
+	ReasonWrongPIN    = "wrong_pin"
+	ReasonPINLocked   = "pin_locked"
+)
+
+// TicketRefused is the data for ticket_refused
+type TicketRefused struct {
+	TicketID string `json:"ticket_id"`
+	Reason   string `json:"reason"`
+}
+
+// templateSamples returns example data for each template. Every template is
+// rendered with it at load time, so a typo in a field name fails at startup
+// rather than when a passenger is waiting for their ticket.
+var templateSamples = map[string]func() interface{}{
+	TemplateTicketConfirmation: func() interface{} {
+		return &TicketDetails{
+			TicketID:  "TKT-1042",
+			Route:     "Lusaka - Dar es Salaam",
+			Amount:    1250,
+			Seat:      "C4-17",
+			Departure: time.Date(2026, 3, 14, 8, 30, 0, 0, time.FixedZone("CAT", 2*60*60)),
+			VerifyURL: "https://africarailways.com/verify/TKT-1042",
+		}
+	},
+	TemplateDepartureReminder: func() interface{} {
+		return &TicketDetails{
+			TicketID:  "TKT-1042",
+			Route:     "Lusaka - Dar es Salaam",
+			Seat:      "C4-17",
+			Departure: time.Date(2026, 3, 14, 8, 30, 0, 0, time.FixedZone("CAT", 2*60*60)),
+		}
+	},
+	TemplateWalletTopUp: func() interface{} { return &WalletTopUp{Amount: 500, Balance: 1750} },
+	TemplateLowBalance:  func() interface{} { return &BalanceAlert{Balance: 30} },
+	TemplateWelcome:     func() interface{} { return &Welcome{Name: "Chanda", Bonus: 1250} },
+	TemplateDailyDigest: func() interface{} { return &DailyDigest{Tickets: 2, Spent: 250, Balance: 1000} },
+
+	TemplateCommandHelp:   func() interface{} { return nil },
+	TemplateNotRegistered: func() interface{} { return nil },
+	TemplateTicketStatus: func() interface{} {
+		return &TicketStatus{
+			TicketID:  "62472453",
+			Route:     "Johannesburg - Cape Town",
+			Departure: time.Date(2026, 3, 14, 8, 0, 0, 0, time.FixedZone("SAST", 2*60*60)),
+			Status:    TicketIssued,
+			Price:     "R150.00",
+		}
+	},
+	TemplateMyTickets: func() interface{} {
+		departure := time.Date(2026, 3, 14, 8, 0, 0, 0, time.FixedZone("SAST", 2*60*60))
+		return &MyTickets{
+			Tickets: []TicketStatus{
+				{TicketID: "62472453", Route: "Johannesburg - Cape Town", Departure: departure, Status: TicketIssued},
+				{TicketID: "81120967", Route: "Cape Town - Port Elizabeth", Departure: departure.AddDate(0, 0, 7), Status: TicketIssued},
+			},
+			More: 1,
+		}
+	},
+	TemplateWalletBalance: func() interface{} { return &WalletBalance{Balance: 1750} },
+	TemplateCancelQuote: func() interface{} {
+		return &RefundQuote{TicketID: "62472453", Percent: 75, Refund: "R112.50", PINRequired: true}
+	},
+	TemplateCancelDone:    func() interface{} { return &RefundQuote{TicketID: "62472453", Refund: "R112.50"} },
+	TemplateTicketRefused: func() interface{} { return &TicketRefused{TicketID: "62472453", Reason: ReasonTooLate} },
+	TemplateOptedOut:      func() interface{} { return nil },
+	TemplateOptedIn:       func() interface{} { return nil },
+}
+
+// Templates renders SMS text from text/template files, one set per locale
+type Templates struct {
+	sets map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates, then any <locale>.tmpl files
+// in dir. A {{define}} in dir replaces the built-in one of the same name, so
+// operators can reword a message without a rebuild; a new file adds a locale.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{sets: make(map[string]*template.Template)}
+	if err := t.parseFS(defaultTemplates, "templates"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := t.parseFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := t.sets[LocaleEnglish]; !ok {
+		return nil, errors.New("no English SMS templates")
+	}
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Templates) parseFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		locale := strings.TrimSuffix(path.Base(file), ".tmpl")
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		set, ok := t.sets[locale]
+		if !ok {
+			set = template.New(locale).Funcs(templateFuncs(locale))
+			t.sets[locale] = set
+		}
+		if _, err := set.Parse(string(data)); err != nil {
+			return fmt.Errorf("SMS templates %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// check renders every template with its sample data
+func (t *Templates) check() error {
+	for _, locale := range t.Locales() {
+		for _, name := range t.names(locale) {
+			sample, ok := templateSamples[name]
+			if !ok {
+				continue
+			}
+			if _, err := t.Render(locale, name, sample()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Render executes a template for a locale, falling back to English when the
+// locale or the template is missing
+func (t *Templates) Render(locale, name string, data interface{}) (string, error) {
+	tmpl := t.lookup(locale, name)
+	if tmpl == nil {
+		return "", fmt.Errorf("no SMS template %q", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("SMS template %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (t *Templates) lookup(locale, name string) *template.Template {
+	if set, ok := t.sets[locale]; ok {
+		if tmpl := set.Lookup(name); tmpl != nil {
+			return tmpl
+		}
+	}
+	return t.sets[LocaleEnglish].Lookup(name)
+}
+
+// Locales lists the locales with templates
+func (t *Templates) Locales() []string {
+	locales := make([]string, 0, len(t.sets))
+	for locale := range t.sets {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Names lists the English template names
+func (t *Templates) Names() []string {
+	return t.names(LocaleEnglish)
+}
+
+func (t *Templates) names(locale string) []string {
+	var names []string
+	for _, tmpl := range t.sets[locale].Templates() {
+		if tmpl.Name() != locale {
+			names = append(names, tmpl.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templateFuncs are the helpers templates can call, bound to a locale:
+//
+//	{{number 1250}}        1,250 (1.250 in Portuguese)
+//	{{datetime .Departure}} 14/03/2026 08:30
+//	{{plural .Tickets}}    "one" or "other"
+func templateFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"number": func(n int) string { return groupDigits(n, thousandsSeparator(locale)) },
+		"datetime": func(t time.Time) string {
+			return t.Format("02/01/2006 15:04")
+		},
+		"plural": func(n int) string { return PluralCategory(locale, n) },
+	}
+}
+
+func thousandsSeparator(locale string) string {
+	if locale == LocalePortuguese {
+		return "."
+	}
+	return ","
+}
+
+// groupDigits writes n with a separator every three digits
+func groupDigits(n int, sep string) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + sep + digits[i:]
+	}
+	return sign + digits
+}
+
+// ShortLinker makes the link printed on a ticket confirmation
+type ShortLinker interface {
+	ShortLink(ticketID string) string
+}
+
+// VerifyLinks appends the ticket ID to a base URL. Point the base at a short
+// domain that redirects to the verify page to save characters.
+type VerifyLinks struct {
+	Base string
+}
+
+// DefaultVerifyBase is the public ticket verification page
+const DefaultVerifyBase = "https://africarailways.com/verify/"
+
+func (v VerifyLinks) ShortLink(ticketID string) string {
+	return v.Base + url.PathEscape(ticketID)
+}
@@ -0,0 +1,42 @@
+package sms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLocalesDefineEveryTemplate(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := templates.Names()
+	for _, locale := range templates.Locales() {
+		if got := templates.names(locale); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s defines %v, want the English set %v", locale, got, want)
+		}
+	}
+}
+
+func TestTemplatesStayInGSM7(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, locale := range templates.Locales() {
+		for _, name := range templates.names(locale) {
+			sample, ok := templateSamples[name]
+			if !ok {
+				t.Errorf("no sample data for %s", name)
+				continue
+			}
+			text, err := templates.Render(locale, name, sample())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := CountSegments(text); info.Encoding != EncodingGSM7 {
+				t.Errorf("%s/%s renders as %s:\n%s", locale, name, info.Encoding, text)
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/ethereum/go-ethereum v1.13.15
 	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
+	github.com/mpolobe/africa-railways v0.0.0-00010101000000-000000000000
 	github.com/rs/cors v1.11.1
 	google.golang.org/api v0.154.0
 	google.golang.org/protobuf v1.31.0
@@ -61,3 +62,6 @@ require (
 	google.golang.org/grpc v1.60.0 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
+
+// pkg/price is shared with the root module
+replace github.com/mpolobe/africa-railways => ../
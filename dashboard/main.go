@@ -10,9 +10,11 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +25,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/pkg/price"
 	"github.com/rs/cors"
 	"google.golang.org/api/option"
 	"google.golang.org/protobuf/types/known/durationpb"
@@ -93,6 +96,8 @@ type WalletMetrics struct {
 	Address              string  `json:"address"`
 	BalancePOL           float64 `json:"balance_pol"`
 	BalanceUSD           float64 `json:"balance_usd"`
+	POLPriceUSD          float64 `json:"pol_usd"`
+	PriceSource          string  `json:"price_source"`
 	EstimatedTxRemaining int     `json:"estimated_tx_remaining"`
 	GasPriceCurrent      float64 `json:"gas_price_current_gwei"`
 	GasPriceAverage      float64 `json:"gas_price_average_gwei"`
@@ -189,6 +194,7 @@ var (
 	clients   = make(map[*websocket.Conn]bool)
 	clientsMu sync.Mutex
 	broadcast = make(chan SystemMetrics)
+	polPrice  price.Oracle
 )
 
 func main() {
@@ -207,6 +213,13 @@ func main() {
 	// Load configuration
 	config := loadConfig()
 
+	// POL/USD price for valuing the relayer wallet
+	var err error
+	if polPrice, err = price.NewOracleFromEnv(config.PolygonRPC); err != nil {
+		log.Printf("⚠️  Warning: %v, USD values are unavailable", err)
+		polPrice = nil
+	}
+
 	// Start metrics aggregation
 	go metricsAggregator(config)
 
@@ -259,6 +272,10 @@ func main() {
 	mux.HandleFunc("/api/blockchain/resync", handleBlockchainResync)
 	mux.HandleFunc("/api/blockchain/sparkline", handleBlockchainSparkline)
 
+	// Ticket artwork and metadata, fetched through the ticket verifier
+	mux.HandleFunc("/api/ipfs/", handleTicketContent)
+	mux.HandleFunc("/api/tickets/", handleTicketContent)
+
 	// Enable CORS
 	handler := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
@@ -442,8 +459,14 @@ func collectWalletMetrics(config Config) WalletMetrics {
 	balancePOL, _ := ethValue.Float64()
 	metrics.BalancePOL = balancePOL
 
-	// Estimate USD value (placeholder - would need price oracle)
-	metrics.BalanceUSD = balancePOL * 0.50 // Approximate POL price
+	// Value at the oracle price
+	if polPrice != nil {
+		if quote, err := polPrice.Price(context.Background()); err == nil {
+			metrics.BalanceUSD = quote.Value(balancePOL)
+			metrics.POLPriceUSD = quote.USD
+			metrics.PriceSource = quote.Source
+		}
+	}
 
 	// Get gas price
 	gasPrice, err := client.SuggestGasPrice(context.Background())
@@ -468,19 +491,70 @@ func collectWalletMetrics(config Config) WalletMetrics {
 	return metrics
 }
 
+// pinStats is the part of the pin manager's GET /stats the dashboard shows
+// (backend/cmd/pin-manager)
+type pinStats struct {
+	Provider        string  `json:"provider"`
+	TotalUploads    int64   `json:"total_uploads"`
+	UploadsToday    int64   `json:"uploads_today"`
+	FailedUploads   int64   `json:"failed_uploads"`
+	SuccessRate     float64 `json:"success_rate"`
+	AverageUploadMs int64   `json:"average_upload_ms"`
+	PinnedBytes     int64   `json:"pinned_bytes"`
+	Usage           *struct {
+		Bytes int64 `json:"bytes"`
+	} `json:"usage"`
+	UsageError string `json:"usage_error"`
+}
+
+// collectIPFSMetrics reads upload and storage numbers from the pin manager
+// at PIN_MANAGER_URL. Storage is what the provider reports when it can,
+// otherwise the size of the pins the manager has recorded.
 func collectIPFSMetrics(config Config) IPFSMetrics {
 	metrics := IPFSMetrics{
 		PinataConnected: config.IPFSAPIKey != "",
 	}
 
-	// TODO: Query Pinata API for actual stats
-	// For now, use placeholder values
-	metrics.TotalUploads = 0
-	metrics.UploadsToday = 0
-	metrics.StorageUsedMB = 0
-	metrics.UploadSuccessRate = 100.0
-	metrics.FailedUploads = 0
-	metrics.AverageUploadTime = 500
+	managerURL := os.Getenv("PIN_MANAGER_URL")
+	if managerURL == "" {
+		return metrics
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(managerURL, "/")+"/stats", nil)
+	if err != nil {
+		return metrics
+	}
+	if token := os.Getenv("PIN_MANAGER_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to reach pin manager: %v\n", err)
+		return metrics
+	}
+	defer resp.Body.Close()
+	var stats pinStats
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Pin manager returned %s\n", resp.Status)
+		return metrics
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		log.Printf("❌ Invalid pin manager stats: %v\n", err)
+		return metrics
+	}
+
+	metrics.TotalUploads = stats.TotalUploads
+	metrics.UploadsToday = stats.UploadsToday
+	metrics.FailedUploads = stats.FailedUploads
+	metrics.UploadSuccessRate = stats.SuccessRate
+	metrics.AverageUploadTime = stats.AverageUploadMs
+	storedBytes := stats.PinnedBytes
+	if stats.Usage != nil {
+		storedBytes = stats.Usage.Bytes
+	}
+	metrics.StorageUsedMB = float64(storedBytes) / (1024 * 1024)
+	if stats.Provider == "pinata" {
+		metrics.PinataConnected = stats.UsageError == ""
+	}
 
 	return metrics
 }
@@ -1217,6 +1291,38 @@ type USSDSession struct {
 	Duration    int64     `json:"duration_seconds"`
 }
 
+// handleTicketContent forwards /api/ipfs/<cid> and /api/tickets/<cid> to the
+// ticket verifier at TICKET_VERIFIER_URL, which races IPFS gateways, checks
+// the content against its CID and caches it
+func handleTicketContent(w http.ResponseWriter, r *http.Request) {
+	verifierURL := os.Getenv("TICKET_VERIFIER_URL")
+	if verifierURL == "" {
+		http.Error(w, "TICKET_VERIFIER_URL is not set", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(verifierURL, "/") + strings.TrimPrefix(r.URL.Path, "/api"))
+	if err != nil {
+		log.Printf("❌ Failed to reach ticket verifier: %v\n", err)
+		http.Error(w, "Ticket verifier unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Cache-Control", "Content-Security-Policy", "X-Content-Type-Options"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
 func handleUSSDStats(w http.ResponseWriter, r *http.Request) {
 	// In production, query Redis or database for real stats
 	stats := USSDStats{
@@ -1233,33 +1339,52 @@ func handleUSSDStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// ussdGatewayURL returns the gateway endpoint at path, beside the /health
+// endpoint USSD_HEALTH_URL points at
+func ussdGatewayURL(path string) (string, error) {
+	health := os.Getenv("USSD_HEALTH_URL")
+	if health == "" {
+		health = "http://localhost:8081/health"
+	}
+	u, err := url.Parse(health)
+	if err != nil {
+		return "", fmt.Errorf("invalid USSD_HEALTH_URL: %w", err)
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/health")
+	u.RawQuery = ""
+	return u.JoinPath(path).String(), nil
+}
+
 func handleUSSDSessions(w http.ResponseWriter, r *http.Request) {
-	// In production, query Redis or database for active sessions
-	sessions := []USSDSession{
-		{
-			SessionID:   "sess_abc123",
-			PhoneNumber: "+27821234567",
-			State:       "selecting_route",
-			LastCommand: "*123*1*2#",
-			StartTime:   time.Now().Add(-45 * time.Second),
-			Duration:    45,
-		},
-		{
-			SessionID:   "sess_def456",
-			PhoneNumber: "+27829876543",
-			State:       "payment_pending",
-			LastCommand: "*123*1*3*1#",
-			StartTime:   time.Now().Add(-2 * time.Minute),
-			Duration:    120,
-		},
-		{
-			SessionID:   "sess_ghi789",
-			PhoneNumber: "+27835551234",
-			State:       "main_menu",
-			LastCommand: "*123#",
-			StartTime:   time.Now().Add(-10 * time.Second),
-			Duration:    10,
-		},
+	// Sessions live in the gateway's session store (shared Redis across replicas)
+	ussdSessionsURL, err := ussdGatewayURL("sessions")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(ussdSessionsURL)
+	if err != nil {
+		http.Error(w, "Failed to fetch USSD sessions", http.StatusServiceUnavailable)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, "USSD session store unavailable", http.StatusBadGateway)
+		return
+	}
+
+	sessions := []USSDSession{}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		http.Error(w, "Invalid USSD sessions response", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	for i := range sessions {
+		sessions[i].Duration = int64(now.Sub(sessions[i].StartTime).Seconds())
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1268,16 +1393,14 @@ func handleUSSDSessions(w http.ResponseWriter, r *http.Request) {
 
 func handleUSSDRevenue(w http.ResponseWriter, r *http.Request) {
 	// Query USSD gateway for revenue metrics
-	ussdHealthURL := os.Getenv("USSD_HEALTH_URL")
-	if ussdHealthURL == "" {
-		ussdHealthURL = "http://localhost:8081/revenue"
-	} else {
-		// Replace /health with /revenue
-		ussdHealthURL = ussdHealthURL[:len(ussdHealthURL)-6] + "revenue"
+	ussdRevenueURL, err := ussdGatewayURL("revenue")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(ussdHealthURL)
+	resp, err := client.Get(ussdRevenueURL)
 	if err != nil {
 		http.Error(w, "Failed to fetch revenue data", http.StatusServiceUnavailable)
 		return
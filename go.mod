@@ -5,6 +5,7 @@ go 1.22.12
 require (
 	github.com/aws/aws-lambda-go v1.51.1
 	github.com/ethereum/go-ethereum v1.13.15
+	github.com/joho/godotenv v1.5.1
 )
 
 require (
@@ -21,7 +22,6 @@ require (
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/holiman/uint256 v1.2.4 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/mmcloughlin/addchain v0.4.0 // indirect
 	github.com/shirou/gopsutil v3.21.4-0.20210419000835-c7a38de76ee5+incompatible // indirect
 	github.com/supranational/blst v0.3.11 // indirect
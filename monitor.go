@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -18,6 +19,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joho/godotenv"
+	"github.com/mpolobe/africa-railways/pkg/price"
 )
 
 // Config holds monitoring configuration
@@ -33,6 +35,7 @@ type MonitoringMetrics struct {
 	Timestamp          time.Time
 	WalletBalance      float64
 	WalletBalanceUSD   float64
+	POLPrice           price.Quote
 	GasPrice           float64
 	EstimatedTxLeft    int
 	PolygonConnected   bool
@@ -56,8 +59,9 @@ const (
 )
 
 var (
-	config  Config
-	metrics MonitoringMetrics
+	config   Config
+	metrics  MonitoringMetrics
+	polPrice price.Oracle
 )
 
 func main() {
@@ -79,6 +83,14 @@ func main() {
 		log.Fatalf("❌ Failed to load config: %v", err)
 	}
 
+	// POL/USD price for valuing the wallet
+	var err error
+	if polPrice, err = price.NewOracleFromEnv(config.AlchemyEndpoint); errors.Is(err, price.ErrNotConfigured) {
+		log.Printf("⚠️  %v, USD values are unavailable", err)
+	} else if err != nil {
+		log.Fatalf("❌ Failed to configure POL price: %v", err)
+	}
+
 	log.Printf("✅ Configuration loaded")
 	log.Printf("   Relayer: %s", config.RelayerAddress)
 	log.Printf("   Gas Policy: %s", config.GasPolicyID)
@@ -258,8 +270,15 @@ func checkWalletBalance() {
 	balancePOL, _ := ethValue.Float64()
 	metrics.WalletBalance = balancePOL
 
-	// Estimate USD value (POL ≈ $0.50)
-	metrics.WalletBalanceUSD = balancePOL * 0.50
+	// Value at the oracle price
+	if polPrice != nil {
+		if quote, err := polPrice.Price(context.Background()); err == nil {
+			metrics.POLPrice = quote
+			metrics.WalletBalanceUSD = quote.Value(balancePOL)
+		} else {
+			log.Printf("⚠️  No POL price: %v", err)
+		}
+	}
 
 	// Get current gas price
 	gasPrice, err := client.SuggestGasPrice(context.Background())
@@ -560,6 +579,7 @@ func displaySummary() {
 	log.Printf("Gas Policy:    %s", statusIcon(metrics.GasPolicyActive))
 	log.Printf("IPFS:          %s", statusIcon(metrics.IPFSConnected))
 	log.Printf("Gas Price:     %.2f Gwei", metrics.GasPrice)
+	log.Printf("POL Price:     $%.4f (%s)", metrics.POLPrice.USD, metrics.POLPrice.Source)
 	log.Printf("TX Capacity:   ~%d mints", metrics.EstimatedTxLeft)
 
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
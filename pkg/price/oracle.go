@@ -0,0 +1,403 @@
+// Package price supplies the POL/USD price used to value the relayer wallet
+// and gas spend. Prices come from Chainlink, an HTTP feed, a file or a static
+// value, combined by median and cached.
+//
+// The backend and dashboard modules import it from the root module through a
+// replace directive.
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Defaults used by NewOracleFromEnv
+const (
+	DefaultMaxAge       = time.Hour
+	DefaultCacheTTL     = time.Minute
+	DefaultMaxDeviation = 0.05 // Two sources may differ by 5% of the lower price
+	// DefaultFeedField reads CoinGecko's simple price response
+	DefaultFeedField = "polygon-ecosystem-token.usd"
+)
+
+// Errors returned by oracles
+var (
+	ErrNoPrice       = errors.New("no price available")
+	ErrStale         = errors.New("price is stale")
+	ErrDisagree      = errors.New("price sources disagree")
+	ErrNotConfigured = errors.New("no POL price source configured")
+)
+
+// Quote is a POL price in USD and where it came from
+type Quote struct {
+	USD       float64   `json:"usd"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Value converts an amount of POL to USD
+func (q Quote) Value(pol float64) float64 {
+	return pol * q.USD
+}
+
+// Age is how old the price is
+func (q Quote) Age() time.Duration {
+	return time.Since(q.UpdatedAt)
+}
+
+// Oracle supplies the current POL/USD price
+type Oracle interface {
+	Price(ctx context.Context) (Quote, error)
+}
+
+// Static always returns the same price. It never goes stale, so it is only
+// used as a last resort when an operator sets one.
+type Static struct {
+	USD float64
+}
+
+func (s Static) Price(ctx context.Context) (Quote, error) {
+	if s.USD <= 0 {
+		return Quote{}, ErrNoPrice
+	}
+	return Quote{USD: s.USD, Source: "static", UpdatedAt: time.Now()}, nil
+}
+
+// File reads {"usd": 0.52, "updated_at": "..."} from a file that finance or a
+// cron job keeps up to date. Without updated_at the file's modification time
+// is used, so an abandoned file goes stale.
+type File struct {
+	Path string
+}
+
+func (f File) Price(ctx context.Context) (Quote, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return Quote{}, err
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return Quote{}, err
+	}
+	var quote Quote
+	if err := json.Unmarshal(data, &quote); err != nil {
+		return Quote{}, fmt.Errorf("invalid price file %s: %w", f.Path, err)
+	}
+	if quote.USD <= 0 {
+		return Quote{}, fmt.Errorf("invalid price file %s: usd must be positive", f.Path)
+	}
+	if quote.UpdatedAt.IsZero() {
+		quote.UpdatedAt = info.ModTime()
+	}
+	quote.Source = "file"
+	return quote, nil
+}
+
+// HTTPFeed reads the price from a JSON API. Field is a dotted path to the
+// number, e.g. "polygon-ecosystem-token.usd" for CoinGecko.
+type HTTPFeed struct {
+	URL    string
+	Field  string
+	Client *http.Client
+}
+
+func (h HTTPFeed) Price(ctx context.Context) (Quote, error) {
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return Quote{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Quote{}, fmt.Errorf("price feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Quote{}, fmt.Errorf("price feed: HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Quote{}, fmt.Errorf("price feed: %w", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return Quote{}, fmt.Errorf("price feed: %w", err)
+	}
+	field := h.Field
+	if field == "" {
+		field = DefaultFeedField
+	}
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return Quote{}, fmt.Errorf("price feed: no %q in response", field)
+		}
+		value = object[key]
+	}
+
+	var usd float64
+	switch v := value.(type) {
+	case float64:
+		usd = v
+	case string:
+		usd, err = strconv.ParseFloat(v, 64)
+	default:
+		err = fmt.Errorf("no %q in response", field)
+	}
+	if err != nil || usd <= 0 {
+		return Quote{}, fmt.Errorf("price feed: invalid price %v", value)
+	}
+	return Quote{USD: usd, Source: "http", UpdatedAt: time.Now()}, nil
+}
+
+// Chainlink reads a Chainlink price feed aggregator on Polygon, e.g. the
+// POL/USD feed. The RPC endpoint is dialled per read; wrap it in a Cache.
+type Chainlink struct {
+	RPCURL string
+	Feed   common.Address
+}
+
+// Aggregator function selectors
+var (
+	latestRoundDataSelector = []byte{0xfe, 0xaf, 0x96, 0x8c} // latestRoundData()
+	decimalsSelector        = []byte{0x31, 0x3c, 0xe5, 0x67} // decimals()
+)
+
+func (c Chainlink) Price(ctx context.Context) (Quote, error) {
+	client, err := ethclient.DialContext(ctx, c.RPCURL)
+	if err != nil {
+		return Quote{}, fmt.Errorf("chainlink: %w", err)
+	}
+	defer client.Close()
+
+	decimals, err := client.CallContract(ctx, ethereum.CallMsg{To: &c.Feed, Data: decimalsSelector}, nil)
+	if err != nil || len(decimals) < 32 {
+		return Quote{}, fmt.Errorf("chainlink: decimals: %v", err)
+	}
+	round, err := client.CallContract(ctx, ethereum.CallMsg{To: &c.Feed, Data: latestRoundDataSelector}, nil)
+	if err != nil || len(round) < 5*32 {
+		return Quote{}, fmt.Errorf("chainlink: latestRoundData: %v", err)
+	}
+
+	// (roundId, answer int256, startedAt, updatedAt, answeredInRound)
+	answer := new(big.Int).SetBytes(round[32:64])
+	if answer.Bit(255) == 1 {
+		return Quote{}, errors.New("chainlink: negative answer")
+	}
+	updatedAt := new(big.Int).SetBytes(round[96:128]).Int64()
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), new(big.Int).SetBytes(decimals[:32]), nil))
+	usd, _ := new(big.Float).Quo(new(big.Float).SetInt(answer), scale).Float64()
+	if usd <= 0 {
+		return Quote{}, ErrNoPrice
+	}
+	return Quote{USD: usd, Source: "chainlink", UpdatedAt: time.Unix(updatedAt, 0)}, nil
+}
+
+// Median asks every source and returns the median of the fresh prices, so
+// one bad feed cannot move the price on its own. Prices older than MaxAge
+// are ignored. A median needs three fresh prices; with only two there is no
+// majority, so they must agree within MaxDeviation (a fraction of the lower
+// price) and their mean is returned, otherwise ErrDisagree.
+type Median struct {
+	Sources      []Oracle
+	MaxAge       time.Duration
+	MaxDeviation float64 // DefaultMaxDeviation if zero
+}
+
+func (m Median) Price(ctx context.Context) (Quote, error) {
+	quotes := make([]Quote, len(m.Sources))
+	errs := make([]error, len(m.Sources))
+	var wg sync.WaitGroup
+	for i, source := range m.Sources {
+		wg.Add(1)
+		go func(i int, source Oracle) {
+			defer wg.Done()
+			quotes[i], errs[i] = source.Price(ctx)
+		}(i, source)
+	}
+	wg.Wait()
+
+	var fresh []Quote
+	var failures []string
+	for i, quote := range quotes {
+		switch {
+		case errs[i] != nil:
+			failures = append(failures, errs[i].Error())
+		case m.MaxAge > 0 && quote.Age() > m.MaxAge:
+			failures = append(failures, fmt.Sprintf("%s: %v (%s old)", quote.Source, ErrStale, quote.Age().Round(time.Second)))
+		default:
+			fresh = append(fresh, quote)
+		}
+	}
+	if len(fresh) == 0 {
+		return Quote{}, fmt.Errorf("%w: %s", ErrNoPrice, strings.Join(failures, "; "))
+	}
+
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].USD < fresh[j].USD })
+	if len(fresh) == 2 {
+		maxDeviation := m.MaxDeviation
+		if maxDeviation <= 0 {
+			maxDeviation = DefaultMaxDeviation
+		}
+		low, high := fresh[0], fresh[1]
+		if (high.USD-low.USD)/low.USD > maxDeviation {
+			return Quote{}, fmt.Errorf("%w: %s $%.4f, %s $%.4f", ErrDisagree, low.Source, low.USD, high.Source, high.USD)
+		}
+	}
+	mid := len(fresh) / 2
+	quote := fresh[mid]
+	if len(fresh)%2 == 0 {
+		quote.USD = (fresh[mid-1].USD + fresh[mid].USD) / 2
+		if fresh[mid-1].UpdatedAt.Before(quote.UpdatedAt) {
+			quote.UpdatedAt = fresh[mid-1].UpdatedAt
+		}
+	}
+	if len(fresh) > 1 {
+		sources := make([]string, len(fresh))
+		for i, q := range fresh {
+			sources[i] = q.Source
+		}
+		quote.Source = "median(" + strings.Join(sources, ",") + ")"
+	}
+	return quote, nil
+}
+
+// Fallback returns the first price any oracle can give
+type Fallback []Oracle
+
+func (f Fallback) Price(ctx context.Context) (Quote, error) {
+	var failures []string
+	for _, oracle := range f {
+		quote, err := oracle.Price(ctx)
+		if err == nil {
+			return quote, nil
+		}
+		failures = append(failures, err.Error())
+	}
+	return Quote{}, fmt.Errorf("%w: %s", ErrNoPrice, strings.Join(failures, "; "))
+}
+
+// Cache keeps a price for TTL. If a refresh fails, the last price is served
+// until it is MaxAge old.
+type Cache struct {
+	Oracle Oracle
+	TTL    time.Duration
+	MaxAge time.Duration
+
+	quote     Quote
+	fetchedAt time.Time
+	mu        sync.Mutex
+}
+
+func (c *Cache) Price(ctx context.Context) (Quote, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.TTL {
+		return c.quote, nil
+	}
+
+	quote, err := c.Oracle.Price(ctx)
+	if err != nil {
+		if !c.fetchedAt.IsZero() && (c.MaxAge <= 0 || c.quote.Age() <= c.MaxAge) {
+			return c.quote, nil
+		}
+		return Quote{}, err
+	}
+	c.quote, c.fetchedAt = quote, time.Now()
+	return quote, nil
+}
+
+// NewOracleFromEnv builds the POL/USD oracle from the environment:
+//
+//	POL_USD_CHAINLINK_FEED  aggregator address, read through rpcURL
+//	POL_USD_PRICE_URL       JSON price API, with POL_USD_PRICE_FIELD
+//	POL_USD_PRICE_FILE      price file, used when the live sources fail
+//	POL_USD_PRICE           static price of last resort, off unless set
+//	POL_USD_MAX_AGE         oldest usable price (default 1h)
+//	POL_USD_MAX_DEVIATION   how far two live sources may differ (default 0.05)
+//	POL_USD_CACHE_TTL       how long a price is reused (default 1m)
+//
+// Live sources are combined by median; the file and then the static price
+// are fallbacks. With none of them set it returns ErrNotConfigured, and
+// callers should report USD values as unavailable rather than guess.
+func NewOracleFromEnv(rpcURL string) (Oracle, error) {
+	maxAge, err := durationEnv("POL_USD_MAX_AGE", DefaultMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	maxDeviation := DefaultMaxDeviation
+	if value := os.Getenv("POL_USD_MAX_DEVIATION"); value != "" {
+		if maxDeviation, err = strconv.ParseFloat(value, 64); err != nil || maxDeviation <= 0 {
+			return nil, fmt.Errorf("invalid POL_USD_MAX_DEVIATION %q", value)
+		}
+	}
+	ttl, err := durationEnv("POL_USD_CACHE_TTL", DefaultCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var live []Oracle
+	if feed := os.Getenv("POL_USD_CHAINLINK_FEED"); feed != "" {
+		if !common.IsHexAddress(feed) {
+			return nil, fmt.Errorf("POL_USD_CHAINLINK_FEED is not an address: %q", feed)
+		}
+		if rpcURL == "" {
+			return nil, errors.New("POL_USD_CHAINLINK_FEED needs a Polygon RPC URL")
+		}
+		live = append(live, Chainlink{RPCURL: rpcURL, Feed: common.HexToAddress(feed)})
+	}
+	if url := os.Getenv("POL_USD_PRICE_URL"); url != "" {
+		live = append(live, HTTPFeed{URL: url, Field: os.Getenv("POL_USD_PRICE_FIELD")})
+	}
+
+	var chain Fallback
+	if len(live) > 0 {
+		chain = append(chain, Median{Sources: live, MaxAge: maxAge, MaxDeviation: maxDeviation})
+	}
+	if path := os.Getenv("POL_USD_PRICE_FILE"); path != "" {
+		chain = append(chain, Median{Sources: []Oracle{File{Path: path}}, MaxAge: maxAge})
+	}
+	if value := os.Getenv("POL_USD_PRICE"); value != "" {
+		static, err := strconv.ParseFloat(value, 64)
+		if err != nil || static <= 0 {
+			return nil, fmt.Errorf("invalid POL_USD_PRICE %q", value)
+		}
+		chain = append(chain, Static{USD: static})
+	}
+	if len(chain) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return &Cache{Oracle: chain, TTL: ttl, MaxAge: maxAge}, nil
+}
+
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/mpolobe/africa-railways/pkg/price"
 )
 
 // Config holds relayer configuration
@@ -99,6 +101,7 @@ var (
 	config          Config
 	state           RelayerState
 	sparklineData   SparklineHistory
+	polPrice        price.Oracle
 )
 
 func main() {
@@ -124,6 +127,14 @@ func main() {
 		log.Fatalf("❌ Failed to initialize Polygon: %v", err)
 	}
 
+	// POL/USD price for balance reports
+	var err error
+	if polPrice, err = price.NewOracleFromEnv(state.RPCURL); errors.Is(err, price.ErrNotConfigured) {
+		log.Printf("⚠️  %v, USD values are unavailable", err)
+	} else if err != nil {
+		log.Fatalf("❌ Failed to configure POL price: %v", err)
+	}
+
 	// Start HTTP server for health checks
 	go startHTTPServer()
 
@@ -521,14 +532,27 @@ func handleBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	balancePOL, _ := state.Balance.Float64()
-	balanceUSD := balancePOL * 0.50 // Approximate POL price
+
+	// Value the balance at the oracle price; without one the USD figure is null
+	balanceUSD, polUSD, priceSource := "null", "null", `""`
+	if polPrice != nil {
+		if quote, err := polPrice.Price(r.Context()); err == nil {
+			balanceUSD = fmt.Sprintf("%.2f", quote.Value(balancePOL))
+			polUSD = fmt.Sprintf("%.4f", quote.USD)
+			priceSource = fmt.Sprintf("%q", quote.Source)
+		} else {
+			log.Printf("⚠️  No POL price: %v", err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{
 		"balance_pol": %.4f,
-		"balance_usd": %.2f,
+		"balance_usd": %s,
+		"pol_usd": %s,
+		"price_source": %s,
 		"address": "%s"
-	}`, balancePOL, balanceUSD, state.RelayerAddress.Hex())
+	}`, balancePOL, balanceUSD, polUSD, priceSource, state.RelayerAddress.Hex())
 }
 
 func handleEvents(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requireAdmin protects an operator endpoint with the bearer token in
+// USSD_ADMIN_TOKEN. Without a token configured the endpoint is disabled.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("USSD_ADMIN_TOKEN")
+		if token == "" {
+			http.Error(w, "Admin API disabled: USSD_ADMIN_TOKEN not set", http.StatusServiceUnavailable)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleMSISDNList manages a blocklist or allowlist:
+// GET lists entries, POST {"msisdn","reason"} adds one, DELETE ?msisdn= removes one
+func handleMSISDNList(name string, list MSISDNList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		switch r.Method {
+		case http.MethodGet:
+			entries, err := list.List(ctx)
+			if err != nil {
+				http.Error(w, "Failed to load "+name, http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+
+		case http.MethodPost:
+			var entry ListEntry
+			if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			msisdn, err := normalizeMSISDN(entry.MSISDN)
+			if err != nil {
+				http.Error(w, "Invalid msisdn: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			entry.MSISDN = msisdn
+			entry.AddedAt = time.Now()
+			if err := list.Add(ctx, entry); err != nil {
+				http.Error(w, "Failed to update "+name, http.StatusServiceUnavailable)
+				return
+			}
+			log.Printf("🛡️  %s: added %s (%s)", name, entry.MSISDN, entry.Reason)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(entry)
+
+		case http.MethodDelete:
+			msisdn, err := normalizeMSISDN(r.URL.Query().Get("msisdn"))
+			if err != nil {
+				http.Error(w, "Invalid msisdn: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := list.Remove(ctx, msisdn); err != nil {
+				http.Error(w, "Failed to update "+name, http.StatusServiceUnavailable)
+				return
+			}
+			log.Printf("🛡️  %s: removed %s", name, msisdn)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// auditLogSize is how many events the audit log retains
+const auditLogSize = 10000
+
+// AuditEvent records a security-relevant action such as a failed PIN entry
+type AuditEvent struct {
+	Time        time.Time  `json:"time"`
+	MSISDN      string     `json:"msisdn"`
+	SessionID   string     `json:"session_id,omitempty"`
+	Action      string     `json:"action"`
+	Reason      string     `json:"reason"`
+	Level       string     `json:"level,omitempty"` // Alerts only: "critical", "warning"
+	Detail      string     `json:"detail,omitempty"`
+	Attempts    int        `json:"attempts,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// AuditLog is an append-only record of security events, newest first
+type AuditLog interface {
+	Record(ctx context.Context, event AuditEvent) error
+	Recent(ctx context.Context, limit int) ([]AuditEvent, error)
+}
+
+// newAuditLog returns a Redis-backed log when a client is given and an
+// in-memory log otherwise
+func newAuditLog(client *redis.Client) AuditLog {
+	if client == nil {
+		return NewMemoryAuditLog(auditLogSize)
+	}
+	return &RedisAuditLog{client: client, key: "ussd:audit", size: auditLogSize}
+}
+
+// recordAudit writes an event and logs it; a failing audit store never blocks
+// the caller
+func recordAudit(ctx context.Context, event AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	log.Printf("🔐 Audit: %s %s for %s (session %s)", event.Action, event.Reason, event.MSISDN, event.SessionID)
+	if err := auditLog.Record(ctx, event); err != nil {
+		log.Printf("❌ Failed to record audit event: %v", err)
+	}
+}
+
+// MemoryAuditLog keeps the most recent events in process memory
+type MemoryAuditLog struct {
+	events []AuditEvent
+	size   int
+	mu     sync.RWMutex
+}
+
+// NewMemoryAuditLog creates an in-process audit log holding up to size events
+func NewMemoryAuditLog(size int) *MemoryAuditLog {
+	return &MemoryAuditLog{size: size}
+}
+
+func (l *MemoryAuditLog) Record(ctx context.Context, event AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+	return nil
+}
+
+func (l *MemoryAuditLog) Recent(ctx context.Context, limit int) ([]AuditEvent, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	events := make([]AuditEvent, 0, limit)
+	for i := len(l.events) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, l.events[i])
+	}
+	return events, nil
+}
+
+// RedisAuditLog keeps events in a capped Redis list
+type RedisAuditLog struct {
+	client *redis.Client
+	key    string
+	size   int64
+}
+
+func (l *RedisAuditLog) Record(ctx context.Context, event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, l.key, data)
+		pipe.LTrim(ctx, l.key, 0, l.size-1)
+		return nil
+	})
+	return err
+}
+
+func (l *RedisAuditLog) Recent(ctx context.Context, limit int) ([]AuditEvent, error) {
+	values, err := l.client.LRange(ctx, l.key, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]AuditEvent, 0, len(values))
+	for _, value := range values {
+		var event AuditEvent
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parseAuditLimit reads ?limit= (default 100), writing a 400 if it is invalid
+func parseAuditLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 100, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > auditLogSize {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// handleAudit returns recent audit events (?limit=, default 100)
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseAuditLimit(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := auditLog.Recent(r.Context(), limit)
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleAlerts returns recent alerts (?limit=, default 100)
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseAuditLimit(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := auditLog.Recent(r.Context(), auditLogSize)
+	if err != nil {
+		http.Error(w, "Failed to load alerts", http.StatusServiceUnavailable)
+		return
+	}
+	alerts := make([]AuditEvent, 0, limit)
+	for _, event := range events {
+		if event.Action == "alert" && len(alerts) < limit {
+			alerts = append(alerts, event)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
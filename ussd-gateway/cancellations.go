@@ -0,0 +1,714 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Cancellation and exchange errors
+var (
+	ErrTicketClosed   = errors.New("ticket is already cancelled or exchanged")
+	ErrTooLate        = errors.New("too close to departure")
+	ErrNotTicketOwner = errors.New("ticket belongs to another passenger")
+	ErrSameTravelDate = errors.New("ticket is already for that date")
+)
+
+// RefundTier refunds Percent of the fare when a ticket is cancelled at least
+// HoursBefore hours before departure
+type RefundTier struct {
+	HoursBefore float64 `json:"hours_before"`
+	Percent     float64 `json:"percent"`
+}
+
+// FarePolicy sets what passengers get back when they cancel or change a trip
+type FarePolicy struct {
+	// Refunds maps a class to its tiers; "default" covers unlisted classes
+	Refunds map[string][]RefundTier `json:"refunds"`
+	// ExchangeHours is the latest a trip can be changed before departure
+	ExchangeHours float64 `json:"exchange_hours"`
+	// ExchangeFee is in major units of FeeCurrency (default ZAR) and is
+	// converted to the ticket's currency when charged
+	ExchangeFee float64 `json:"exchange_fee"`
+	FeeCurrency string  `json:"fee_currency,omitempty"`
+}
+
+// defaultFarePolicy is used when USSD_FARE_POLICY_FILE is not set
+var defaultFarePolicy = FarePolicy{
+	Refunds: map[string][]RefundTier{
+		"default":    {{HoursBefore: 48, Percent: 100}, {HoursBefore: 24, Percent: 75}, {HoursBefore: 2, Percent: 50}},
+		"Business":   {{HoursBefore: 24, Percent: 100}, {HoursBefore: 2, Percent: 75}},
+		"FirstClass": {{HoursBefore: 2, Percent: 100}, {HoursBefore: 0, Percent: 50}},
+	},
+	ExchangeHours: 2,
+	ExchangeFee:   20,
+	FeeCurrency:   defaultCurrency,
+}
+
+// loadFarePolicyFromEnv reads the policy from the JSON file in
+// USSD_FARE_POLICY_FILE, or returns the default policy
+func loadFarePolicyFromEnv() (*FarePolicy, error) {
+	policy := defaultFarePolicy
+	if path := os.Getenv("USSD_FARE_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		policy = FarePolicy{}
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return nil, fmt.Errorf("invalid fare policy %s: %w", path, err)
+		}
+	}
+
+	for class, tiers := range policy.Refunds {
+		for _, tier := range tiers {
+			if tier.Percent < 0 || tier.Percent > 100 || tier.HoursBefore < 0 {
+				return nil, fmt.Errorf("invalid refund tier for %s: %+v", class, tier)
+			}
+		}
+		sort.Slice(tiers, func(i, j int) bool { return tiers[i].HoursBefore > tiers[j].HoursBefore })
+	}
+	if policy.ExchangeHours < 0 || policy.ExchangeFee < 0 {
+		return nil, errors.New("exchange_hours and exchange_fee cannot be negative")
+	}
+	if policy.FeeCurrency == "" {
+		policy.FeeCurrency = defaultCurrency
+	}
+	if !validCurrency(policy.FeeCurrency) {
+		return nil, fmt.Errorf("unknown fee currency %q", policy.FeeCurrency)
+	}
+	return &policy, nil
+}
+
+// RefundQuote is what cancelling a ticket now would pay back
+type RefundQuote struct {
+	HoursBefore float64 `json:"hours_before"`
+	Percent     float64 `json:"percent"`
+	Amount      Money   `json:"amount"`
+}
+
+// Quote applies the first tier the cancellation time qualifies for. Tickets
+// cannot be cancelled once the train has left.
+func (p *FarePolicy) Quote(ticket *Ticket, now time.Time) (RefundQuote, error) {
+	hours := ticket.DepartureTime().Sub(now).Hours()
+	if hours <= 0 {
+		return RefundQuote{}, ErrTooLate
+	}
+	tiers, ok := p.Refunds[ticket.Class]
+	if !ok {
+		tiers = p.Refunds["default"]
+	}
+
+	quote := RefundQuote{HoursBefore: hours}
+	for _, tier := range tiers {
+		if hours >= tier.HoursBefore {
+			quote.Percent = tier.Percent
+			break
+		}
+	}
+	quote.Amount = ticket.Price.Percent(quote.Percent)
+	return quote, nil
+}
+
+// ExchangeQuote is the cost of moving a ticket to another travel date. A
+// positive Difference is charged, a negative one refunded.
+type ExchangeQuote struct {
+	TravelDate string     `json:"travel_date"`
+	NewPrice   Money      `json:"new_price"`
+	Fee        Money      `json:"fee"`
+	Difference Money      `json:"difference"`
+	Fare       *FareQuote `json:"fare"`
+}
+
+// TicketLedger voids the on-chain record of a cancelled or replaced ticket
+type TicketLedger interface {
+	Void(ctx context.Context, ticket *Ticket) (string, error)
+}
+
+// ErrNoTicketLedger is returned while no on-chain ledger is integrated
+var ErrNoTicketLedger = errors.New("no on-chain ticket ledger configured")
+
+// registryLedger stands in until tickets are minted on-chain. It cannot
+// burn anything, so every void fails and the ticket is left void_pending
+// until a ledger can void it.
+type registryLedger struct{}
+
+func (registryLedger) Void(ctx context.Context, ticket *Ticket) (string, error) {
+	return "", ErrNoTicketLedger
+}
+
+// CancelRequest describes who is cancelling a ticket and why
+type CancelRequest struct {
+	MSISDN    string // When set, the ticket must belong to this number
+	SessionID string
+	Actor     string // "passenger" or "operator"
+	Reason    string
+	// Override refunds the full fare regardless of timing, e.g. when the
+	// railway cancels the train
+	Override bool
+	// Quiet skips the confirmation SMS, for callers that answer the
+	// passenger themselves
+	Quiet bool
+}
+
+// ExchangeRequest describes a move to another travel date
+type ExchangeRequest struct {
+	MSISDN     string
+	SessionID  string
+	TravelDate string
+	Actor      string
+	Reason     string
+	Override   bool // Waives the exchange fee and cutoff
+}
+
+// CancellationService cancels and exchanges tickets: it voids the ticket,
+// settles money with the payment provider, returns the seat, adjusts revenue
+// and confirms by SMS
+type CancellationService struct {
+	policy   *FarePolicy
+	tickets  TicketStore
+	seats    SeatInventory
+	payments PaymentProvider
+	ledger   TicketLedger
+	sms      SMSSender
+}
+
+// NewCancellationService wires the cancellation flow
+func NewCancellationService(policy *FarePolicy, tickets TicketStore, seats SeatInventory,
+	payments PaymentProvider, ledger TicketLedger, sms SMSSender) *CancellationService {
+	return &CancellationService{
+		policy:   policy,
+		tickets:  tickets,
+		seats:    seats,
+		payments: payments,
+		ledger:   ledger,
+		sms:      sms,
+	}
+}
+
+// QuoteRefund returns what cancelling the ticket now would refund
+func (c *CancellationService) QuoteRefund(ticket *Ticket) (RefundQuote, error) {
+	if ticket.Status != TicketIssued {
+		return RefundQuote{}, ErrTicketClosed
+	}
+	return c.policy.Quote(ticket, time.Now())
+}
+
+// QuoteExchange returns the cost of moving the ticket to travelDate
+func (c *CancellationService) QuoteExchange(ctx context.Context, ticket *Ticket, travelDate string, override bool) (ExchangeQuote, error) {
+	if ticket.Status != TicketIssued {
+		return ExchangeQuote{}, ErrTicketClosed
+	}
+	if travelDate == ticket.TravelDate {
+		return ExchangeQuote{}, ErrSameTravelDate
+	}
+	departure, err := departureTime(ticket.Route, travelDate)
+	if err != nil {
+		return ExchangeQuote{}, fmt.Errorf("invalid travel date %q", travelDate)
+	}
+
+	now := time.Now()
+	if !departure.After(now) {
+		return ExchangeQuote{}, ErrTooLate
+	}
+	if !override && ticket.DepartureTime().Sub(now).Hours() < c.policy.ExchangeHours {
+		return ExchangeQuote{}, ErrTooLate
+	}
+
+	// The new date is priced for the same passenger category; promo codes
+	// do not carry over
+	fare, err := fareEngine.Quote(ctx, FareRequest{
+		Route:      ticket.Route,
+		Class:      ticket.Class,
+		TravelDate: travelDate,
+		Category:   ticket.Category,
+	})
+	if err != nil {
+		return ExchangeQuote{}, err
+	}
+	quote := ExchangeQuote{TravelDate: travelDate, NewPrice: fare.Total, Fee: Zero(fare.Total.Currency), Fare: fare}
+	if !override {
+		fee := NewMoney(c.policy.ExchangeFee, c.policy.FeeCurrency)
+		if quote.Fee, err = convertMoney(ctx, fxRates, fee, fare.Total.Currency); err != nil {
+			return ExchangeQuote{}, fmt.Errorf("exchange fee: %w", err)
+		}
+	}
+	// The route may be priced in another currency than the ticket was sold in
+	paid, err := convertMoney(ctx, fxRates, ticket.Price, fare.Total.Currency)
+	if err != nil {
+		return ExchangeQuote{}, fmt.Errorf("ticket price: %w", err)
+	}
+	cost, err := quote.NewPrice.Add(quote.Fee)
+	if err == nil {
+		quote.Difference, err = cost.Sub(paid)
+	}
+	if err != nil {
+		return ExchangeQuote{}, err
+	}
+	return quote, nil
+}
+
+// Cancel voids a ticket and refunds it according to the fare policy
+func (c *CancellationService) Cancel(ctx context.Context, ticketID string, req CancelRequest) (*Ticket, error) {
+	now := time.Now()
+	var cancelled Ticket
+	err := c.tickets.Update(ctx, ticketID, func(ticket *Ticket) error {
+		if req.MSISDN != "" && ticket.MSISDN != req.MSISDN {
+			return ErrNotTicketOwner
+		}
+		if ticket.Status != TicketIssued {
+			return ErrTicketClosed
+		}
+		quote := RefundQuote{Percent: 100, Amount: ticket.Price}
+		if !req.Override {
+			var err error
+			if quote, err = c.policy.Quote(ticket, now); err != nil {
+				return err
+			}
+		}
+		ticket.Status = TicketCancelled
+		ticket.ClosedAt = &now
+		ticket.Refund = quote.Amount
+		ticket.RefundPending = quote.Amount.IsPositive()
+		cancelled = *ticket
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.void(ctx, &cancelled)
+	if err := c.seats.Release(ctx, cancelled.Route, cancelled.Class, cancelled.TravelDate); err != nil {
+		log.Printf("⚠️  Failed to release seat for ticket %s: %v", cancelled.TicketID, err)
+	}
+	if cancelled.RefundPending {
+		c.refund(ctx, &cancelled, cancelled.Refund)
+	}
+
+	stats.TicketCancelled(ctx)
+	recordAudit(ctx, AuditEvent{
+		MSISDN:    cancelled.MSISDN,
+		SessionID: req.SessionID,
+		Action:    "ticket_cancelled",
+		Reason:    req.Actor,
+		Detail:    fmt.Sprintf("ticket %s refund %s %s", cancelled.TicketID, cancelled.Refund, req.Reason),
+	})
+
+	if !req.Quiet {
+		locale := resolveLocale(ctx, cancelled.MSISDN)
+		c.notify(ctx, cancelled.MSISDN, "ticket_cancelled", T(locale, "sms.cancelled", cancelled.TicketID, cancelled.Refund.String()))
+	}
+	return &cancelled, nil
+}
+
+// Exchange replaces a ticket with one for another travel date, charging or
+// refunding the fare difference
+func (c *CancellationService) Exchange(ctx context.Context, ticketID string, req ExchangeRequest) (*Ticket, error) {
+	old, err := c.tickets.Get(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if req.MSISDN != "" && old.MSISDN != req.MSISDN {
+		return nil, ErrNotTicketOwner
+	}
+	quote, err := c.QuoteExchange(ctx, old, req.TravelDate, req.Override)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.seats.Reserve(ctx, old.Route, old.Class, req.TravelDate); err != nil {
+		return nil, err
+	}
+
+	// Closing the old ticket first stops it being cancelled or exchanged twice
+	now := time.Now()
+	err = c.tickets.Update(ctx, ticketID, func(ticket *Ticket) error {
+		if ticket.Status != TicketIssued {
+			return ErrTicketClosed
+		}
+		ticket.Status = TicketExchanged
+		ticket.ClosedAt = &now
+		return nil
+	})
+	if err != nil {
+		c.seats.Release(ctx, old.Route, old.Class, req.TravelDate)
+		return nil, err
+	}
+
+	departure, _ := departureTime(old.Route, req.TravelDate)
+	replacement := &Ticket{
+		MSISDN:        old.MSISDN,
+		Owner:         old.Owner,
+		Route:         old.Route,
+		From:          old.From,
+		To:            old.To,
+		Class:         old.Class,
+		TravelDate:    req.TravelDate,
+		Departure:     departure,
+		Category:      old.Category,
+		Price:         quote.NewPrice,
+		Fare:          quote.Fare,
+		Status:        TicketIssued,
+		IssuedAt:      now,
+		ExchangedFrom: old.TicketID,
+	}
+	if err := issueTicket(ctx, replacement); err != nil {
+		c.reopen(ctx, old, req.TravelDate)
+		return nil, err
+	}
+
+	if quote.Difference.IsPositive() {
+		if _, err := c.payments.Charge(ctx, old.MSISDN, quote.Difference, "exchange "+old.TicketID); err != nil {
+			log.Printf("❌ Exchange charge for ticket %s failed: %v", old.TicketID, err)
+			c.tickets.Update(ctx, replacement.TicketID, func(ticket *Ticket) error {
+				ticket.Status = TicketCancelled
+				ticket.ClosedAt = &now
+				return nil
+			})
+			c.reopen(ctx, old, req.TravelDate)
+			return nil, err
+		}
+	}
+
+	refund := Zero(quote.Difference.Currency)
+	if quote.Difference.IsNegative() {
+		refund = quote.Difference.Neg()
+	}
+	c.tickets.Update(ctx, old.TicketID, func(ticket *Ticket) error {
+		ticket.ExchangedFor = replacement.TicketID
+		ticket.Refund = refund
+		ticket.RefundPending = refund.IsPositive()
+		return nil
+	})
+	old.ExchangedFor = replacement.TicketID
+	if refund.IsPositive() {
+		c.refund(ctx, old, refund)
+	}
+
+	c.void(ctx, old)
+	if err := c.seats.Release(ctx, old.Route, old.Class, old.TravelDate); err != nil {
+		log.Printf("⚠️  Failed to release seat for ticket %s: %v", old.TicketID, err)
+	}
+
+	// A refunded difference is taken off revenue by refund once it is paid
+	if quote.Difference.IsPositive() {
+		revenueTracker.adjustConfirmed(quote.Difference)
+	}
+	stats.TicketExchanged(ctx, quote.Difference)
+	recordAudit(ctx, AuditEvent{
+		MSISDN:    old.MSISDN,
+		SessionID: req.SessionID,
+		Action:    "ticket_exchanged",
+		Reason:    req.Actor,
+		Detail: fmt.Sprintf("ticket %s -> %s for %s difference %s %s",
+			old.TicketID, replacement.TicketID, req.TravelDate, quote.Difference, req.Reason),
+	})
+
+	locale := resolveLocale(ctx, old.MSISDN)
+	c.notify(ctx, old.MSISDN, "ticket_exchanged", T(locale, "sms.exchanged", old.TicketID, replacement.TicketID, replacement.Route, replacement.TravelDate))
+	return replacement, nil
+}
+
+// RetryRefund pays out a refund that failed earlier
+func (c *CancellationService) RetryRefund(ctx context.Context, ticketID string) (*Ticket, error) {
+	ticket, err := c.tickets.Get(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if !ticket.RefundPending {
+		return ticket, nil
+	}
+	c.refund(ctx, ticket, ticket.Refund)
+	return ticket, nil
+}
+
+// refund pays back amount and records the reference. Revenue and the day's
+// refunds are adjusted only once the money is paid; a failed refund leaves
+// the ticket marked RefundPending for an operator to retry.
+func (c *CancellationService) refund(ctx context.Context, ticket *Ticket, amount Money) {
+	ref, err := c.payments.Refund(ctx, ticket.MSISDN, amount, "ticket "+ticket.TicketID)
+	if err != nil {
+		log.Printf("❌ Refund of %s for ticket %s failed: %v", amount, ticket.TicketID, err)
+		emitAlert(ctx, "warning", AuditEvent{
+			MSISDN: ticket.MSISDN,
+			Reason: "refund_failed",
+			Detail: fmt.Sprintf("ticket %s %s: %v", ticket.TicketID, amount, err),
+		})
+		return
+	}
+	revenueTracker.adjustConfirmed(amount.Neg())
+	stats.RefundPaid(ctx, amount)
+	err = c.tickets.Update(ctx, ticket.TicketID, func(t *Ticket) error {
+		t.RefundRef = ref
+		t.RefundPending = false
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to record refund %s for ticket %s: %v", ref, ticket.TicketID, err)
+		return
+	}
+	ticket.RefundRef = ref
+	ticket.RefundPending = false
+}
+
+// void marks the ticket's on-chain record as void. A failed void leaves the
+// ticket VoidPending and, unless no ledger is configured at all, raises an
+// alert.
+func (c *CancellationService) void(ctx context.Context, ticket *Ticket) {
+	ref, err := c.ledger.Void(ctx, ticket)
+	if err != nil {
+		log.Printf("❌ Failed to void ticket %s on-chain: %v", ticket.TicketID, err)
+		if !errors.Is(err, ErrNoTicketLedger) {
+			emitAlert(ctx, "warning", AuditEvent{
+				MSISDN: ticket.MSISDN,
+				Reason: "void_failed",
+				Detail: fmt.Sprintf("ticket %s: %v", ticket.TicketID, err),
+			})
+		}
+	}
+	err = c.tickets.Update(ctx, ticket.TicketID, func(t *Ticket) error {
+		t.VoidRef = ref
+		t.VoidPending = ref == ""
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to record void of ticket %s: %v", ticket.TicketID, err)
+		return
+	}
+	ticket.VoidRef, ticket.VoidPending = ref, ref == ""
+}
+
+// reopen undoes closing a ticket when its exchange could not complete
+func (c *CancellationService) reopen(ctx context.Context, old *Ticket, travelDate string) {
+	c.seats.Release(ctx, old.Route, old.Class, travelDate)
+	err := c.tickets.Update(ctx, old.TicketID, func(ticket *Ticket) error {
+		ticket.Status = TicketIssued
+		ticket.ClosedAt = nil
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to reopen ticket %s after a failed exchange: %v", old.TicketID, err)
+	}
+}
+
+func (c *CancellationService) notify(ctx context.Context, msisdn, kind, message string) {
+	if err := c.sms.Send(ctx, msisdn, kind, message); err != nil {
+		log.Printf("⚠️  Failed to send confirmation SMS to %s: %v", msisdn, err)
+	}
+}
+
+// Errors for a passenger cancelling by SMS, whose PIN is checked as the USSD
+// menu checks it
+var (
+	ErrCancelPINRequired = errors.New("PIN required")
+	ErrCancelPINWrong    = errors.New("wrong PIN")
+	ErrCancelPINLocked   = errors.New("PIN locked")
+)
+
+// checkCancelPIN verifies pin for a passenger who has set one; passengers
+// without a PIN are not asked, as on USSD
+func checkCancelPIN(ctx context.Context, msisdn, pin string) error {
+	hasPIN, err := pins.HasPIN(ctx, msisdn)
+	if err != nil {
+		return err
+	}
+	if !hasPIN {
+		return nil
+	}
+	if pin == "" {
+		return ErrCancelPINRequired
+	}
+	check, err := pins.Verify(ctx, msisdn, "sms", pin)
+	switch {
+	case err != nil:
+		return err
+	case check.OK:
+		return nil
+	case check.RetryAfter > 0:
+		return ErrCancelPINLocked
+	}
+	return ErrCancelPINWrong
+}
+
+// ticketChangeStatus maps cancellation errors to HTTP statuses
+func ticketChangeStatus(err error) int {
+	switch err {
+	case ErrCancelPINRequired:
+		return http.StatusPreconditionRequired
+	case ErrCancelPINWrong:
+		return http.StatusUnprocessableEntity
+	case ErrCancelPINLocked:
+		return http.StatusLocked
+	case ErrTicketNotFound:
+		return http.StatusNotFound
+	case ErrTicketClosed, ErrTooLate, ErrSoldOut, ErrSameTravelDate:
+		return http.StatusConflict
+	case ErrNotTicketOwner:
+		return http.StatusForbidden
+	}
+	return http.StatusServiceUnavailable
+}
+
+// handleCancelTicket cancels a ticket:
+// POST {"ticket_id","reason","override"}; override refunds in full.
+// With "msisdn" the ticket is cancelled on the passenger's behalf, e.g. by an
+// SMS command: it must be theirs, the fare policy applies and "pin" must be
+// their PIN if they have set one. "quote" returns the refund without
+// cancelling, and whether a PIN will be needed, and "quiet" skips the
+// confirmation SMS.
+func handleCancelTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		TicketID string `json:"ticket_id"`
+		Reason   string `json:"reason"`
+		Override bool   `json:"override"`
+		MSISDN   string `json:"msisdn"`
+		Quote    bool   `json:"quote"`
+		Quiet    bool   `json:"quiet"`
+		PIN      string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TicketID == "" {
+		http.Error(w, "ticket_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if body.Quote {
+		quote, err := quoteCancellation(r.Context(), body.TicketID, body.MSISDN)
+		if err != nil {
+			http.Error(w, err.Error(), ticketChangeStatus(err))
+			return
+		}
+		hasPIN := false
+		if body.MSISDN != "" {
+			if hasPIN, err = pins.HasPIN(r.Context(), body.MSISDN); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			RefundQuote
+			PINRequired bool `json:"pin_required,omitempty"`
+		}{quote, hasPIN})
+		return
+	}
+
+	req := CancelRequest{
+		Actor:    "operator",
+		Reason:   body.Reason,
+		Override: body.Override,
+		Quiet:    body.Quiet,
+	}
+	if body.MSISDN != "" {
+		req.MSISDN = body.MSISDN
+		req.Actor = "passenger"
+		req.Override = false
+		if err := checkCancelPIN(r.Context(), body.MSISDN, body.PIN); err != nil {
+			http.Error(w, err.Error(), ticketChangeStatus(err))
+			return
+		}
+	}
+	ticket, err := cancellations.Cancel(r.Context(), body.TicketID, req)
+	if err != nil {
+		http.Error(w, err.Error(), ticketChangeStatus(err))
+		return
+	}
+	if req.MSISDN != "" {
+		log.Printf("🎫 Passenger %s cancelled ticket %s (refund %s)", req.MSISDN, ticket.TicketID, ticket.Refund)
+	} else {
+		log.Printf("🎫 Operator cancelled ticket %s (refund %s)", ticket.TicketID, ticket.Refund)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// quoteCancellation returns what cancelling a ticket now would refund,
+// checking it belongs to msisdn if one is given
+func quoteCancellation(ctx context.Context, ticketID, msisdn string) (RefundQuote, error) {
+	ticket, err := ticketStore.Get(ctx, ticketID)
+	if err != nil {
+		return RefundQuote{}, err
+	}
+	if msisdn != "" && ticket.MSISDN != msisdn {
+		return RefundQuote{}, ErrNotTicketOwner
+	}
+	return cancellations.QuoteRefund(ticket)
+}
+
+// handleExchangeTicket moves a ticket to another date:
+// POST {"ticket_id","travel_date","reason","override"}; override waives the
+// fee and cutoff
+func handleExchangeTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		TicketID   string `json:"ticket_id"`
+		TravelDate string `json:"travel_date"`
+		Reason     string `json:"reason"`
+		Override   bool   `json:"override"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TicketID == "" || body.TravelDate == "" {
+		http.Error(w, "ticket_id and travel_date are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", body.TravelDate); err != nil {
+		http.Error(w, "travel_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := cancellations.Exchange(r.Context(), body.TicketID, ExchangeRequest{
+		TravelDate: body.TravelDate,
+		Actor:      "operator",
+		Reason:     body.Reason,
+		Override:   body.Override,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), ticketChangeStatus(err))
+		return
+	}
+	log.Printf("🎫 Operator exchanged ticket %s for %s", body.TicketID, ticket.TicketID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// handleRetryRefund retries a failed refund: POST {"ticket_id"}
+func handleRetryRefund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		TicketID string `json:"ticket_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TicketID == "" {
+		http.Error(w, "ticket_id is required", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := cancellations.RetryRefund(r.Context(), body.TicketID)
+	if err != nil {
+		http.Error(w, err.Error(), ticketChangeStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// handleFarePolicy returns the refund and exchange policy in force
+func handleFarePolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cancellations.policy)
+}
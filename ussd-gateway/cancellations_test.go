@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyPayments refunds only once it is told the provider is back
+type flakyPayments struct {
+	up bool
+}
+
+func (p *flakyPayments) Charge(ctx context.Context, msisdn string, amount Money, reference string) (string, error) {
+	return "", ErrNoPaymentProvider
+}
+
+func (p *flakyPayments) Refund(ctx context.Context, msisdn string, amount Money, reference string) (string, error) {
+	if !p.up {
+		return "", errors.New("provider timeout")
+	}
+	return "MPESA-REF-1", nil
+}
+
+func TestCancelAdjustsRevenueOnceRefunded(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	stats = NewStatsRecorder(NewMemoryStatsStore(), time.UTC)
+	revenueTracker = NewRevenueTracker()
+	ctx := context.Background()
+
+	price := NewMoney(450, "ZAR")
+	revenueTracker.confirmPurchase(price)
+	tickets := NewMemoryTicketStore()
+	ticket := &Ticket{
+		TicketID:  "10000001",
+		MSISDN:    "+27821234567",
+		Route:     "JHB-CPT",
+		Class:     "Economy",
+		Departure: time.Now().Add(72 * time.Hour),
+		Price:     price,
+		Status:    TicketIssued,
+		IssuedAt:  time.Now(),
+	}
+	if err := tickets.Issue(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	payments := &flakyPayments{}
+	service := NewCancellationService(&defaultFarePolicy, tickets, NewMemorySeatInventory(), payments, registryLedger{}, nil)
+	cancelled, err := service.Cancel(ctx, ticket.TicketID, CancelRequest{Actor: "operator", Override: true, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled.RefundPending || cancelled.Refund != price {
+		t.Fatalf("cancelled ticket refund %s pending=%v, want %s pending", cancelled.Refund, cancelled.RefundPending, price)
+	}
+
+	// Nothing has been paid back yet, so revenue still includes the fare
+	today, err := stats.Today(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if today.Cancellations != 1 || len(today.RefundsByCurrency) != 0 {
+		t.Errorf("after a failed refund: %d cancellations, refunds %v, want 1 and none", today.Cancellations, today.RefundsByCurrency)
+	}
+	if got := revenueTracker.Confirmed["ZAR"]; got != price.Amount {
+		t.Errorf("confirmed revenue %d after a failed refund, want %d", got, price.Amount)
+	}
+
+	payments.up = true
+	retried, err := service.RetryRefund(ctx, ticket.TicketID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.RefundPending || retried.RefundRef != "MPESA-REF-1" {
+		t.Errorf("retried ticket pending=%v ref=%q", retried.RefundPending, retried.RefundRef)
+	}
+	if today, _ = stats.Today(ctx); len(today.RefundsByCurrency) != 1 || today.RefundsByCurrency[0] != price {
+		t.Errorf("refunds after the retry = %v, want %s", today.RefundsByCurrency, price)
+	}
+	if got := revenueTracker.Confirmed["ZAR"]; got != 0 {
+		t.Errorf("confirmed revenue %d after the refund, want 0", got)
+	}
+
+	// A second retry has nothing left to pay
+	if _, err := service.RetryRefund(ctx, ticket.TicketID); err != nil {
+		t.Fatal(err)
+	}
+	if got := revenueTracker.Confirmed["ZAR"]; got != 0 {
+		t.Errorf("confirmed revenue %d after a second retry, want 0", got)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Fare errors
+var (
+	ErrUnknownFare  = errors.New("no fare for this route and class")
+	ErrPromoInvalid = errors.New("promo code not valid")
+)
+
+// Passenger categories
+const (
+	CategoryAdult   = "adult"
+	CategoryChild   = "child"
+	CategoryStudent = "student"
+	CategorySenior  = "senior"
+)
+
+// passengerCategories is the order categories appear on the USSD menu
+var passengerCategories = []string{CategoryAdult, CategoryChild, CategoryStudent, CategorySenior}
+
+// TimeBand adjusts fares for departures within a daily window, e.g. +20%
+// in the commuter peak. Days are "mon".."sun"; empty means every day.
+type TimeBand struct {
+	Name    string   `json:"name"`
+	Days    []string `json:"days,omitempty"`
+	Start   string   `json:"start"` // "HH:MM", inclusive
+	End     string   `json:"end"`   // "HH:MM", exclusive
+	Percent float64  `json:"percent"`
+}
+
+// Holiday adjusts fares on a date, given as "YYYY-MM-DD" or "MM-DD" for
+// holidays that fall on the same day every year
+type Holiday struct {
+	Date    string  `json:"date"`
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+}
+
+// FareRules is the tariff the fare engine applies
+type FareRules struct {
+	BaseFares map[string]map[string]float64 `json:"base_fares"` // Route -> class -> fare
+	TimeBands []TimeBand                    `json:"time_bands"`
+	Holidays  []Holiday                     `json:"holidays"`
+	// Categories maps a passenger category to its discount percentage
+	Categories map[string]float64 `json:"categories"`
+	// Currencies maps a route to the currency its fares are in; base fares
+	// are major units of it. Unlisted routes are priced in ZAR.
+	Currencies map[string]string `json:"currencies,omitempty"`
+}
+
+// defaultFareRules is used when USSD_FARE_RULES_FILE is not set
+var defaultFareRules = FareRules{
+	BaseFares: map[string]map[string]float64{
+		"JHB-CPT": {"Economy": 150, "Business": 300, "FirstClass": 500},
+		"JHB-DBN": {"Economy": 120, "Business": 240, "FirstClass": 400},
+		"CPT-PE":  {"Economy": 100, "Business": 200, "FirstClass": 350},
+	},
+	TimeBands: []TimeBand{
+		{Name: "Morning peak", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "06:00", End: "09:00", Percent: 20},
+		{Name: "Evening peak", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "16:00", End: "19:00", Percent: 20},
+		{Name: "Off-peak", Days: []string{"tue", "wed", "thu"}, Start: "10:00", End: "15:00", Percent: -10},
+	},
+	Holidays: []Holiday{
+		{Date: "01-01", Name: "New Year's Day", Percent: 25},
+		{Date: "03-21", Name: "Human Rights Day", Percent: 25},
+		{Date: "04-27", Name: "Freedom Day", Percent: 25},
+		{Date: "05-01", Name: "Workers' Day", Percent: 25},
+		{Date: "06-16", Name: "Youth Day", Percent: 25},
+		{Date: "08-09", Name: "National Women's Day", Percent: 25},
+		{Date: "09-24", Name: "Heritage Day", Percent: 25},
+		{Date: "12-16", Name: "Day of Reconciliation", Percent: 25},
+		{Date: "12-25", Name: "Christmas Day", Percent: 25},
+		{Date: "12-26", Name: "Day of Goodwill", Percent: 25},
+	},
+	Categories: map[string]float64{
+		CategoryAdult:   0,
+		CategoryChild:   50,
+		CategoryStudent: 25,
+		CategorySenior:  40,
+	},
+}
+
+// loadFareRulesFromEnv reads the tariff from the JSON file in
+// USSD_FARE_RULES_FILE, or returns the default tariff
+func loadFareRulesFromEnv() (*FareRules, error) {
+	rules := defaultFareRules
+	if path := os.Getenv("USSD_FARE_RULES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = FareRules{}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("invalid fare rules %s: %w", path, err)
+		}
+	}
+
+	for _, band := range rules.TimeBands {
+		if _, err := time.Parse("15:04", band.Start); err != nil {
+			return nil, fmt.Errorf("time band %q: invalid start %q", band.Name, band.Start)
+		}
+		if _, err := time.Parse("15:04", band.End); err != nil {
+			return nil, fmt.Errorf("time band %q: invalid end %q", band.Name, band.End)
+		}
+	}
+	for route, currency := range rules.Currencies {
+		if !validCurrency(currency) {
+			return nil, fmt.Errorf("unknown currency %q for %s", currency, route)
+		}
+	}
+	for category, percent := range rules.Categories {
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid discount for %s: %v", category, percent)
+		}
+	}
+	return &rules, nil
+}
+
+// FareLine is one step of a fare calculation. Amount is the change it made.
+type FareLine struct {
+	Rule        string  `json:"rule"` // "base", "time_band", "holiday", "category", "promo"
+	Description string  `json:"description"`
+	Percent     float64 `json:"percent,omitempty"`
+	Amount      Money   `json:"amount"`
+}
+
+// FareQuote is a priced fare with the breakdown that produced it. Rules
+// identifies the tariff version so a price can be traced after the fact.
+type FareQuote struct {
+	Route      string     `json:"route"`
+	Class      string     `json:"class"`
+	TravelDate string     `json:"travel_date"`
+	Departure  time.Time  `json:"departure"`
+	Category   string     `json:"category"`
+	PromoCode  string     `json:"promo_code,omitempty"`
+	Lines      []FareLine `json:"lines"`
+	Total      Money      `json:"total"`
+	Rules      string     `json:"rules"`
+	QuotedAt   time.Time  `json:"quoted_at"`
+}
+
+// FareRequest is what a fare is quoted for
+type FareRequest struct {
+	Route      string
+	Class      string
+	TravelDate string // YYYY-MM-DD
+	Category   string // Defaults to adult
+	PromoCode  string
+	MSISDN     string // For per-passenger promo limits
+}
+
+// FareEngine prices tickets from the tariff and promo codes
+type FareEngine struct {
+	rules   *FareRules
+	version string
+	promos  PromoStore
+}
+
+// NewFareEngine creates an engine for a tariff
+func NewFareEngine(rules *FareRules, promos PromoStore) *FareEngine {
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	return &FareEngine{rules: rules, version: hex.EncodeToString(sum[:6]), promos: promos}
+}
+
+// Quote prices a fare. Time band and holiday adjustments apply to the base
+// fare; on a holiday the holiday replaces the time bands. The category
+// discount and then the promo code apply to the running total.
+func (e *FareEngine) Quote(ctx context.Context, req FareRequest) (*FareQuote, error) {
+	baseFare, ok := e.rules.BaseFares[req.Route][req.Class]
+	if !ok {
+		return nil, ErrUnknownFare
+	}
+	category := req.Category
+	if category == "" {
+		category = CategoryAdult
+	}
+	discount, ok := e.rules.Categories[category]
+	if !ok {
+		return nil, fmt.Errorf("unknown passenger category %q", category)
+	}
+	departure, err := departureTime(req.Route, req.TravelDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid travel date %q", req.TravelDate)
+	}
+
+	quote := &FareQuote{
+		Route:      req.Route,
+		Class:      req.Class,
+		TravelDate: req.TravelDate,
+		Departure:  departure,
+		Category:   category,
+		Rules:      e.version,
+		QuotedAt:   time.Now(),
+	}
+	base := NewMoney(baseFare, e.currency(req.Route))
+	total := base
+	quote.Lines = append(quote.Lines, FareLine{Rule: "base", Description: req.Route + " " + req.Class, Amount: base})
+
+	if holiday := e.holiday(departure); holiday != nil {
+		amount := base.Percent(holiday.Percent)
+		quote.Lines = append(quote.Lines, FareLine{Rule: "holiday", Description: holiday.Name, Percent: holiday.Percent, Amount: amount})
+		if total, err = total.Add(amount); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, band := range e.bands(departure) {
+			amount := base.Percent(band.Percent)
+			quote.Lines = append(quote.Lines, FareLine{Rule: "time_band", Description: band.Name, Percent: band.Percent, Amount: amount})
+			if total, err = total.Add(amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if discount > 0 {
+		amount := total.Percent(discount).Neg()
+		quote.Lines = append(quote.Lines, FareLine{Rule: "category", Description: category, Percent: -discount, Amount: amount})
+		if total, err = total.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if code := normalizePromoCode(req.PromoCode); code != "" {
+		promo, err := e.checkPromo(ctx, code, req)
+		if err != nil {
+			return nil, err
+		}
+		line := FareLine{Rule: "promo", Description: code}
+		if promo.Percent > 0 {
+			line.Percent = -promo.Percent
+			line.Amount = total.Percent(promo.Percent).Neg()
+		} else {
+			line.Amount = promo.AmountOff().Neg()
+		}
+		if line.Amount.Neg().Amount > total.Amount {
+			line.Amount = total.Neg()
+		}
+		quote.PromoCode = code
+		quote.Lines = append(quote.Lines, line)
+		if total, err = total.Add(line.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	quote.Total = total
+	return quote, nil
+}
+
+// Redeem counts the quote's promo code against its limits; call it when the
+// ticket is paid for
+func (e *FareEngine) Redeem(ctx context.Context, quote *FareQuote, msisdn string) error {
+	if quote.PromoCode == "" {
+		return nil
+	}
+	promo, err := e.promos.Get(ctx, quote.PromoCode)
+	if err == ErrPromoNotFound {
+		return fmt.Errorf("%w: withdrawn", ErrPromoInvalid)
+	}
+	if err != nil {
+		return err
+	}
+	if err := e.promos.Redeem(ctx, promo, msisdn); err == ErrPromoExhausted {
+		return fmt.Errorf("%w: %v", ErrPromoInvalid, err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Unredeem returns a promo use when the purchase failed after Redeem
+func (e *FareEngine) Unredeem(ctx context.Context, quote *FareQuote, msisdn string) {
+	if quote.PromoCode == "" {
+		return
+	}
+	e.promos.Release(ctx, quote.PromoCode, msisdn)
+}
+
+// checkPromo validates a code for a fare request without redeeming it
+func (e *FareEngine) checkPromo(ctx context.Context, code string, req FareRequest) (*PromoCode, error) {
+	promo, err := e.promos.Get(ctx, code)
+	if err == ErrPromoNotFound {
+		return nil, fmt.Errorf("%w: unknown code", ErrPromoInvalid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if promo.ValidFrom != nil && now.Before(*promo.ValidFrom) {
+		return nil, fmt.Errorf("%w: not yet valid", ErrPromoInvalid)
+	}
+	if promo.ValidUntil != nil && now.After(*promo.ValidUntil) {
+		return nil, fmt.Errorf("%w: expired", ErrPromoInvalid)
+	}
+	if len(promo.Routes) > 0 && !containsString(promo.Routes, req.Route) {
+		return nil, fmt.Errorf("%w: not valid on %s", ErrPromoInvalid, req.Route)
+	}
+	if currency := e.currency(req.Route); promo.Amount > 0 && promo.AmountOff().Currency != currency {
+		return nil, fmt.Errorf("%w: not valid for %s fares", ErrPromoInvalid, currency)
+	}
+
+	usage, err := e.promos.Usage(ctx, code, req.MSISDN)
+	if err != nil {
+		return nil, err
+	}
+	if (promo.MaxUses > 0 && usage.Total >= promo.MaxUses) ||
+		(promo.MaxPerPassenger > 0 && usage.Passenger >= promo.MaxPerPassenger) {
+		return nil, fmt.Errorf("%w: %v", ErrPromoInvalid, ErrPromoExhausted)
+	}
+	return promo, nil
+}
+
+// currency is the currency a route is priced in
+func (e *FareEngine) currency(route string) string {
+	if currency, ok := e.rules.Currencies[route]; ok {
+		return currency
+	}
+	return defaultCurrency
+}
+
+// holiday returns the holiday a departure falls on, if any
+func (e *FareEngine) holiday(departure time.Time) *Holiday {
+	date := departure.Format("2006-01-02")
+	for i, holiday := range e.rules.Holidays {
+		if holiday.Date == date || holiday.Date == date[5:] {
+			return &e.rules.Holidays[i]
+		}
+	}
+	return nil
+}
+
+// bands returns the time bands a departure falls in
+func (e *FareEngine) bands(departure time.Time) []TimeBand {
+	day := strings.ToLower(departure.Weekday().String()[:3])
+	clock := departure.Format("15:04")
+	var matched []TimeBand
+	for _, band := range e.rules.TimeBands {
+		if len(band.Days) > 0 && !containsString(band.Days, day) {
+			continue
+		}
+		if clock >= band.Start && clock < band.End {
+			matched = append(matched, band)
+		}
+	}
+	return matched
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleFareQuote prices a fare without buying it:
+// GET ?route=&class=&date=&category=&promo=&msisdn=
+func handleFareQuote(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := FareRequest{
+		Route:      query.Get("route"),
+		Class:      query.Get("class"),
+		TravelDate: query.Get("date"),
+		Category:   query.Get("category"),
+		PromoCode:  query.Get("promo"),
+		MSISDN:     query.Get("msisdn"),
+	}
+	if req.TravelDate == "" {
+		req.TravelDate = time.Now().In(operatorLoc).Format("2006-01-02")
+	}
+
+	quote, err := fareEngine.Quote(r.Context(), req)
+	switch {
+	case err == ErrUnknownFare:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrPromoInvalid):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// handleFareRules returns the tariff in force
+func handleFareRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": fareEngine.version,
+		"rules":   fareEngine.rules,
+	})
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Abuse thresholds
+const (
+	msisdnRateLimit     = 30 // Requests per minute from one number
+	sessionRateLimit    = 20 // Hops per minute in one session
+	maxPurchasesPerHour = 5
+	maxRoutesPerHour    = 3 // Distinct routes bought by one number per hour
+	// maxPurchaseAttemptsPerHour bounds attempts whether or not they end in
+	// a ticket, e.g. payments that fail or trains that are sold out
+	maxPurchaseAttemptsPerHour = 15
+	// maxUSSDInput bounds the menu path; real navigation never gets close
+	maxUSSDInput = 182
+)
+
+// Flag reasons
+const (
+	FlagBlocklisted      = "blocklisted"
+	FlagMSISDNRate       = "msisdn_rate"
+	FlagSessionRate      = "session_rate"
+	FlagPurchaseVelocity = "purchase_velocity"
+	FlagRouteVelocity    = "route_velocity"
+	FlagPurchaseAttempts = "purchase_attempts"
+)
+
+// Flag explains why a request was refused. Alert is false for repeat hits
+// within the same window so a flood produces one alert, not thousands.
+type Flag struct {
+	Reason string
+	Detail string
+	Alert  bool
+}
+
+// normalizeMSISDN converts a provider phone number to E.164 (+ and 8-15
+// digits). Aggregators variously send "+254...", "254...", "00254..." or
+// a form-decoded " 254..." where the plus became a space.
+func normalizeMSISDN(raw string) (string, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, raw)
+
+	switch {
+	case strings.HasPrefix(cleaned, "+"):
+		cleaned = cleaned[1:]
+	case strings.HasPrefix(cleaned, "00"):
+		cleaned = cleaned[2:]
+	case strings.HasPrefix(cleaned, "0"):
+		return "", errors.New("national number without country code")
+	}
+
+	if len(cleaned) < 8 || len(cleaned) > 15 {
+		return "", fmt.Errorf("expected 8-15 digits, got %d", len(cleaned))
+	}
+	for _, r := range cleaned {
+		if r < '0' || r > '9' {
+			return "", errors.New("number contains non-digits")
+		}
+	}
+	if cleaned[0] == '0' {
+		return "", errors.New("country code cannot start with 0")
+	}
+	return "+" + cleaned, nil
+}
+
+// CounterStore keeps fixed-window counters for rate and velocity checks
+type CounterStore interface {
+	// Incr counts one event for key and returns the total in the current window
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	// AddDistinct adds member to key's set and returns the set size in the
+	// current window
+	AddDistinct(ctx context.Context, key, member string, window time.Duration) (int64, error)
+	// Count returns key's total in the current window without counting
+	Count(ctx context.Context, key string) (int64, error)
+	// Distinct returns the size of key's set in the current window and
+	// whether member is in it, without adding it
+	Distinct(ctx context.Context, key, member string) (int64, bool, error)
+}
+
+// newCounterStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newCounterStore(client *redis.Client) CounterStore {
+	if client == nil {
+		return NewMemoryCounterStore()
+	}
+	return &RedisCounterStore{client: client, prefix: "ussd:counter:"}
+}
+
+// MSISDNList is an admin-managed set of phone numbers
+type MSISDNList interface {
+	Add(ctx context.Context, entry ListEntry) error
+	Remove(ctx context.Context, msisdn string) error
+	Contains(ctx context.Context, msisdn string) (bool, error)
+	List(ctx context.Context) ([]ListEntry, error)
+}
+
+// ListEntry is a number on the blocklist or allowlist
+type ListEntry struct {
+	MSISDN  string    `json:"msisdn"`
+	Reason  string    `json:"reason,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// newMSISDNList returns a Redis-backed list when a client is given and an
+// in-memory list otherwise
+func newMSISDNList(client *redis.Client, name string) MSISDNList {
+	if client == nil {
+		return NewMemoryMSISDNList()
+	}
+	return &RedisMSISDNList{client: client, key: "ussd:" + name}
+}
+
+// FraudGuard applies blocklists, rate limits and purchase velocity checks.
+// Allowlisted numbers (staff, test handsets) skip rate and velocity checks
+// but never the blocklist.
+type FraudGuard struct {
+	counters  CounterStore
+	blocklist MSISDNList
+	allowlist MSISDNList
+}
+
+// NewFraudGuard creates a guard over the given stores
+func NewFraudGuard(counters CounterStore, blocklist, allowlist MSISDNList) *FraudGuard {
+	return &FraudGuard{counters: counters, blocklist: blocklist, allowlist: allowlist}
+}
+
+// CheckRequest runs on every USSD hop. Store failures are logged and the
+// request is let through so an outage does not lock out every caller.
+func (g *FraudGuard) CheckRequest(ctx context.Context, msisdn, sessionID string) *Flag {
+	blocked, err := g.blocklist.Contains(ctx, msisdn)
+	if err != nil {
+		log.Printf("⚠️  Blocklist unavailable: %v", err)
+	}
+	if blocked {
+		// Alert on the first attempt each hour rather than on every hop
+		attempts, _ := g.counters.Incr(ctx, "blocked:"+msisdn, time.Hour)
+		return &Flag{Reason: FlagBlocklisted, Alert: attempts <= 1}
+	}
+	if g.allowed(ctx, msisdn) {
+		return nil
+	}
+
+	if flag := g.limit(ctx, "msisdn:"+msisdn, time.Minute, msisdnRateLimit, FlagMSISDNRate); flag != nil {
+		return flag
+	}
+	return g.limit(ctx, "session:"+sessionID, time.Minute, sessionRateLimit, FlagSessionRate)
+}
+
+// CheckPurchase runs before a ticket is issued. Every attempt counts
+// towards its own, looser limit; the purchase and route velocity limits
+// only count tickets RecordPurchase confirms, so failed payments and
+// sold-out trains do not use them up.
+func (g *FraudGuard) CheckPurchase(ctx context.Context, msisdn, route string) *Flag {
+	if g.allowed(ctx, msisdn) {
+		return nil
+	}
+	if flag := g.limit(ctx, "purchase_attempts:"+msisdn, time.Hour, maxPurchaseAttemptsPerHour, FlagPurchaseAttempts); flag != nil {
+		return flag
+	}
+
+	purchases, err := g.counters.Count(ctx, "purchases:"+msisdn)
+	if err != nil {
+		log.Printf("⚠️  Velocity counters unavailable: %v", err)
+		return nil
+	}
+	if purchases >= maxPurchasesPerHour {
+		return &Flag{
+			Reason: FlagPurchaseVelocity,
+			Detail: fmt.Sprintf("%d purchases in the last hour (limit %d)", purchases, maxPurchasesPerHour),
+			Alert:  g.FirstInWindow(ctx, FlagPurchaseVelocity+":"+msisdn, time.Hour),
+		}
+	}
+
+	routes, bought, err := g.counters.Distinct(ctx, "routes:"+msisdn, route)
+	if err != nil {
+		log.Printf("⚠️  Velocity counters unavailable: %v", err)
+		return nil
+	}
+	if !bought && routes >= maxRoutesPerHour {
+		return &Flag{
+			Reason: FlagRouteVelocity,
+			Detail: fmt.Sprintf("%d distinct routes in the last hour, then %s", routes, route),
+			Alert:  g.FirstInWindow(ctx, FlagRouteVelocity+":"+msisdn, time.Hour),
+		}
+	}
+	return nil
+}
+
+// RecordPurchase counts an issued ticket towards the purchase and route
+// velocity limits
+func (g *FraudGuard) RecordPurchase(ctx context.Context, msisdn, route string) {
+	if g.allowed(ctx, msisdn) {
+		return
+	}
+	if _, err := g.counters.Incr(ctx, "purchases:"+msisdn, time.Hour); err != nil {
+		log.Printf("⚠️  Failed to count purchase by %s: %v", msisdn, err)
+	}
+	if _, err := g.counters.AddDistinct(ctx, "routes:"+msisdn, route, time.Hour); err != nil {
+		log.Printf("⚠️  Failed to count route bought by %s: %v", msisdn, err)
+	}
+}
+
+// FirstInWindow reports whether this is the first event for key in the
+// window, for throttling alerts that have no per-number flag
+func (g *FraudGuard) FirstInWindow(ctx context.Context, key string, window time.Duration) bool {
+	count, err := g.counters.Incr(ctx, "first:"+key, window)
+	return err != nil || count == 1
+}
+
+func (g *FraudGuard) allowed(ctx context.Context, msisdn string) bool {
+	allowed, err := g.allowlist.Contains(ctx, msisdn)
+	if err != nil {
+		log.Printf("⚠️  Allowlist unavailable: %v", err)
+	}
+	return allowed
+}
+
+func (g *FraudGuard) limit(ctx context.Context, key string, window time.Duration, max int64, reason string) *Flag {
+	count, err := g.counters.Incr(ctx, key, window)
+	if err != nil {
+		log.Printf("⚠️  Rate counters unavailable: %v", err)
+		return nil
+	}
+	if count <= max {
+		return nil
+	}
+	return &Flag{
+		Reason: reason,
+		Detail: fmt.Sprintf("%d events in %s (limit %d)", count, window, max),
+		Alert:  count == max+1,
+	}
+}
+
+// emitAlert records an alert in the audit log and, when
+// USSD_ALERT_WEBHOOK_URL is set, posts it there in the background
+func emitAlert(ctx context.Context, level string, event AuditEvent) {
+	event.Action = "alert"
+	event.Level = level
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	log.Printf("🚨 USSD alert (%s): %s %s %s", level, event.Reason, event.MSISDN, event.Detail)
+	if err := auditLog.Record(ctx, event); err != nil {
+		log.Printf("❌ Failed to record alert: %v", err)
+	}
+
+	webhookURL := os.Getenv("USSD_ALERT_WEBHOOK_URL")
+	if webhookURL == "" {
+		return
+	}
+	go func() {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("⚠️  Alert webhook failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// MemoryCounterStore keeps counters in process memory
+type MemoryCounterStore struct {
+	counters map[string]*memoryCounter
+	mu       sync.Mutex
+}
+
+type memoryCounter struct {
+	count     int64
+	members   map[string]bool
+	expiresAt time.Time
+}
+
+// NewMemoryCounterStore creates an in-process counter store
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{counters: make(map[string]*memoryCounter)}
+}
+
+// window returns the live counter for key, starting a new window if the old
+// one has ended. Expired counters are swept opportunistically. Caller holds mu.
+func (s *MemoryCounterStore) window(key string, window time.Duration) *memoryCounter {
+	now := time.Now()
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		if len(s.counters) > 10000 {
+			for k, c := range s.counters {
+				if now.After(c.expiresAt) {
+					delete(s.counters, k)
+				}
+			}
+		}
+		counter = &memoryCounter{members: make(map[string]bool), expiresAt: now.Add(window)}
+		s.counters[key] = counter
+	}
+	return counter
+}
+
+func (s *MemoryCounterStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.window(key, window)
+	counter.count++
+	return counter.count, nil
+}
+
+func (s *MemoryCounterStore) AddDistinct(ctx context.Context, key, member string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.window(key, window)
+	counter.members[member] = true
+	return int64(len(counter.members)), nil
+}
+
+// live returns key's counter if its window is still open. Caller holds mu.
+func (s *MemoryCounterStore) live(key string) (*memoryCounter, bool) {
+	counter, ok := s.counters[key]
+	if !ok || time.Now().After(counter.expiresAt) {
+		return nil, false
+	}
+	return counter, true
+}
+
+func (s *MemoryCounterStore) Count(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counter, ok := s.live(key); ok {
+		return counter.count, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryCounterStore) Distinct(ctx context.Context, key, member string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counter, ok := s.live(key); ok {
+		return int64(len(counter.members)), counter.members[member], nil
+	}
+	return 0, false, nil
+}
+
+// RedisCounterStore keeps counters as Redis keys that expire with their window
+type RedisCounterStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// incrCounterScript counts a hit and starts the window on the first one.
+// Checking the TTL rather than the count also repairs a key that lost it.
+var incrCounterScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// addDistinctScript adds a member to the window's set and returns its size
+var addDistinctScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return redis.call('SCARD', KEYS[1])
+`)
+
+func (s *RedisCounterStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := incrCounterScript.Run(ctx, s.client, []string{s.prefix + key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", key, err)
+	}
+	return count, nil
+}
+
+func (s *RedisCounterStore) AddDistinct(ctx context.Context, key, member string, window time.Duration) (int64, error) {
+	size, err := addDistinctScript.Run(ctx, s.client, []string{s.prefix + key}, member, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", key, err)
+	}
+	return size, nil
+}
+
+func (s *RedisCounterStore) Count(ctx context.Context, key string) (int64, error) {
+	count, err := s.client.Get(ctx, s.prefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return count, nil
+}
+
+func (s *RedisCounterStore) Distinct(ctx context.Context, key, member string) (int64, bool, error) {
+	var size *redis.IntCmd
+	var isMember *redis.BoolCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		size = pipe.SCard(ctx, s.prefix+key)
+		isMember = pipe.SIsMember(ctx, s.prefix+key, member)
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return size.Val(), isMember.Val(), nil
+}
+
+// MemoryMSISDNList keeps a number list in process memory
+type MemoryMSISDNList struct {
+	entries map[string]ListEntry
+	mu      sync.RWMutex
+}
+
+// NewMemoryMSISDNList creates an in-process number list
+func NewMemoryMSISDNList() *MemoryMSISDNList {
+	return &MemoryMSISDNList{entries: make(map[string]ListEntry)}
+}
+
+func (l *MemoryMSISDNList) Add(ctx context.Context, entry ListEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[entry.MSISDN] = entry
+	return nil
+}
+
+func (l *MemoryMSISDNList) Remove(ctx context.Context, msisdn string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, msisdn)
+	return nil
+}
+
+func (l *MemoryMSISDNList) Contains(ctx context.Context, msisdn string) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.entries[msisdn]
+	return ok, nil
+}
+
+func (l *MemoryMSISDNList) List(ctx context.Context) ([]ListEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := make([]ListEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].MSISDN < entries[j].MSISDN })
+	return entries, nil
+}
+
+// RedisMSISDNList keeps a number list in a Redis hash of JSON entries
+type RedisMSISDNList struct {
+	client *redis.Client
+	key    string
+}
+
+func (l *RedisMSISDNList) Add(ctx context.Context, entry ListEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return l.client.HSet(ctx, l.key, entry.MSISDN, data).Err()
+}
+
+func (l *RedisMSISDNList) Remove(ctx context.Context, msisdn string) error {
+	return l.client.HDel(ctx, l.key, msisdn).Err()
+}
+
+func (l *RedisMSISDNList) Contains(ctx context.Context, msisdn string) (bool, error) {
+	return l.client.HExists(ctx, l.key, msisdn).Result()
+}
+
+func (l *RedisMSISDNList) List(ctx context.Context) ([]ListEntry, error) {
+	values, err := l.client.HGetAll(ctx, l.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ListEntry, 0, len(values))
+	for _, value := range values {
+		var entry ListEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].MSISDN < entries[j].MSISDN })
+	return entries, nil
+}
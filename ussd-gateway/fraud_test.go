@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCounterStoreWindows(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := &RedisCounterStore{client: client, prefix: "ussd:counter:"}
+
+	for want := int64(1); want <= 3; want++ {
+		count, err := store.Incr(ctx, "hops", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Fatalf("Incr = %d, want %d", count, want)
+		}
+	}
+	if ttl := mr.TTL("ussd:counter:hops"); ttl != time.Minute {
+		t.Errorf("counter TTL = %s, want the 1m window", ttl)
+	}
+
+	for _, member := range []string{"s1", "s2", "s1"} {
+		if _, err := store.AddDistinct(ctx, "sessions", member, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, err := store.AddDistinct(ctx, "sessions", "s3", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3 {
+		t.Errorf("AddDistinct = %d, want 3", size)
+	}
+	if ttl := mr.TTL("ussd:counter:sessions"); ttl != time.Minute {
+		t.Errorf("set TTL = %s, want the 1m window", ttl)
+	}
+
+	// A new window starts from scratch
+	mr.FastForward(2 * time.Minute)
+	if count, err := store.Incr(ctx, "hops", time.Minute); err != nil || count != 1 {
+		t.Errorf("Incr after the window = %d, %v, want 1", count, err)
+	}
+	if size, err := store.AddDistinct(ctx, "sessions", "s1", time.Minute); err != nil || size != 1 {
+		t.Errorf("AddDistinct after the window = %d, %v, want 1", size, err)
+	}
+
+	// A key that lost its TTL gets one back rather than counting forever
+	if err := client.Persist(ctx, "ussd:counter:hops").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Incr(ctx, "hops", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("ussd:counter:hops"); ttl != time.Minute {
+		t.Errorf("TTL after repair = %s, want 1m", ttl)
+	}
+}
+
+func TestRedisCounterStoreReads(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := &RedisCounterStore{client: client, prefix: "ussd:counter:"}
+
+	if count, err := store.Count(ctx, "purchases"); err != nil || count != 0 {
+		t.Errorf("Count of an unused key = %d, %v, want 0", count, err)
+	}
+	store.Incr(ctx, "purchases", time.Hour)
+	store.Incr(ctx, "purchases", time.Hour)
+	if count, err := store.Count(ctx, "purchases"); err != nil || count != 2 {
+		t.Errorf("Count = %d, %v, want 2", count, err)
+	}
+
+	store.AddDistinct(ctx, "routes", "JHB-CPT", time.Hour)
+	size, member, err := store.Distinct(ctx, "routes", "JHB-CPT")
+	if err != nil || size != 1 || !member {
+		t.Errorf("Distinct(member) = %d, %v, %v", size, member, err)
+	}
+	if size, member, err = store.Distinct(ctx, "routes", "CPT-PE"); err != nil || size != 1 || member {
+		t.Errorf("Distinct(other) = %d, %v, %v", size, member, err)
+	}
+	if size, _, _ := store.Distinct(ctx, "routes", "CPT-PE"); size != 1 {
+		t.Errorf("Distinct added its member: size %d", size)
+	}
+}
+
+func TestCheckPurchaseCountsIssuedTickets(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	guard := NewFraudGuard(NewMemoryCounterStore(), NewMemoryMSISDNList(), NewMemoryMSISDNList())
+	msisdn := "+27821234567"
+
+	// Attempts that never issue a ticket leave the purchase limit alone
+	for i := 0; i < maxPurchasesPerHour+2; i++ {
+		if flag := guard.CheckPurchase(ctx, msisdn, "JHB-CPT"); flag != nil {
+			t.Fatalf("attempt %d refused: %s", i+1, flag.Reason)
+		}
+	}
+
+	for i := 0; i < maxPurchasesPerHour; i++ {
+		guard.RecordPurchase(ctx, msisdn, "JHB-CPT")
+	}
+	flag := guard.CheckPurchase(ctx, msisdn, "JHB-CPT")
+	if flag == nil || flag.Reason != FlagPurchaseVelocity || !flag.Alert {
+		t.Fatalf("after %d tickets = %+v, want an alerting purchase_velocity flag", maxPurchasesPerHour, flag)
+	}
+	if flag := guard.CheckPurchase(ctx, msisdn, "JHB-CPT"); flag == nil || flag.Alert {
+		t.Errorf("repeat refusal = %+v, want refused without another alert", flag)
+	}
+
+	// Attempts have a limit of their own
+	var last *Flag
+	for i := 0; i < maxPurchaseAttemptsPerHour; i++ {
+		last = guard.CheckPurchase(ctx, msisdn, "JHB-CPT")
+	}
+	if last == nil || last.Reason != FlagPurchaseAttempts {
+		t.Errorf("attempts past their limit = %+v, want purchase_attempts", last)
+	}
+}
+
+func TestCheckPurchaseRoutes(t *testing.T) {
+	ctx := context.Background()
+	guard := NewFraudGuard(NewMemoryCounterStore(), NewMemoryMSISDNList(), NewMemoryMSISDNList())
+	msisdn := "+27821234567"
+
+	for _, route := range []string{"JHB-CPT", "JHB-DBN", "CPT-PE"} {
+		if flag := guard.CheckPurchase(ctx, msisdn, route); flag != nil {
+			t.Fatalf("%s refused: %s", route, flag.Reason)
+		}
+		guard.RecordPurchase(ctx, msisdn, route)
+	}
+	if flag := guard.CheckPurchase(ctx, msisdn, "PE-DBN"); flag == nil || flag.Reason != FlagRouteVelocity {
+		t.Errorf("fourth route = %+v, want route_velocity", flag)
+	}
+	// A route already bought this hour is not a new one
+	if flag := guard.CheckPurchase(ctx, msisdn, "JHB-CPT"); flag != nil {
+		t.Errorf("repeat route refused: %s", flag.Reason)
+	}
+}
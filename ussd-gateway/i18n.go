@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Supported USSD locales
+const (
+	LocaleEnglish    = "en"
+	LocaleSwahili    = "sw"
+	LocaleBemba      = "bem"
+	LocaleZulu       = "zu"
+	LocalePortuguese = "pt"
+)
+
+// ussdMaxLength is the longest screen most networks display in one USSD page
+const ussdMaxLength = 182
+
+// languageMenu lists locales in the order shown on the language screen.
+// Names are written in their own language so anyone can find theirs.
+var languageMenu = []struct {
+	Locale string
+	Name   string
+}{
+	{LocaleEnglish, "English"},
+	{LocaleSwahili, "Kiswahili"},
+	{LocaleBemba, "Ichibemba"},
+	{LocaleZulu, "isiZulu"},
+	{LocalePortuguese, "Portugues"},
+}
+
+// ussdCatalogue holds every USSD screen per locale. Screens are kept to the
+// GSM-7 character set (no emoji, Portuguese without cedillas or tildes) so
+// they render on every handset. Plural forms use ".one"/".other" suffixes.
+var ussdCatalogue = map[string]map[string]string{
+	LocaleEnglish: {
+		"menu.main":           "Welcome to Africa Railways\n1. Buy Ticket\n2. Check Ticket\n3. My Tickets\n4. Help\n5. Language\n6. PIN",
+		"menu.route":          "Select Route:\n1. Johannesburg - Cape Town\n2. Johannesburg - Durban\n3. Cape Town - Port Elizabeth\n0. Back",
+		"menu.date":           "Select Date:\n1. Today\n2. Tomorrow\n3. Choose Date\n0. Back",
+		"menu.class":          "Select Class:\n1. %s (%s)\n2. %s (%s)\n3. %s (%s)\n0. Back",
+		"menu.category":       "Passenger type:\n1. Adult\n2. Child\n3. Student\n4. Senior\n0. Back",
+		"promo.prompt":        "Enter promo code:",
+		"promo.invalid":       "Promo code not valid.",
+		"fare.changed":        "The fare has changed since it was shown.\nPlease dial *123# to try again.",
+		"menu.confirm":        "Confirm Purchase:\nRoute: %s - %s\nDate: %s\nClass: %s\nPrice: %s\n\n1. Pay with M-Pesa\n2. Pay with Card\n3. Promo code\n0. Cancel",
+		"menu.language":       "Select Language:",
+		"menu.back":           "Back",
+		"class.Economy":       "Economy",
+		"class.Business":      "Business",
+		"class.FirstClass":    "First Class",
+		"date.today":          "Today",
+		"date.tomorrow":       "Tomorrow",
+		"payment.initiated":   "Payment initiated!\nTicket: %s\nAmount: %s\nWallet: %s\nYou will receive an SMS with your ticket details.",
+		"ticket.prompt":       "Enter your ticket number:",
+		"ticket.details":      "Ticket %s\nRoute: %s\nDate: %s\nClass: %s\nStatus: %s",
+		"ticket.notfound":     "Ticket %s not found. Check the number and try again.",
+		"status.issued":       "Valid",
+		"status.cancelled":    "Cancelled",
+		"status.exchanged":    "Replaced",
+		"ticket.actions":      "1. Cancel ticket\n2. Change date\n0. Back",
+		"cancel.quote":        "Cancel ticket %s?\nRefund: %s (%.0f%%)\n1. Confirm\n0. Back",
+		"cancel.done":         "Ticket %s cancelled.\nRefund: %s\nYou will receive an SMS confirmation.",
+		"cancel.late":         "Ticket %s can no longer be cancelled or changed.",
+		"exchange.date":       "Select new date:",
+		"exchange.pay":        "Change ticket %s to %s?\nTo pay: %s\n1. Confirm\n0. Back",
+		"exchange.refund":     "Change ticket %s to %s?\nRefund: %s\n1. Confirm\n0. Back",
+		"exchange.done":       "Ticket %s replaced by ticket %s for %s.\nYou will receive an SMS confirmation.",
+		"error.soldout":       "Sorry, this train is fully booked.\nPlease choose another date.",
+		"sms.cancelled":       "Africa Railways: ticket %s has been cancelled. Refund: %s.",
+		"sms.exchanged":       "Africa Railways: ticket %s has been replaced by ticket %s (%s, %s).",
+		"tickets.count.one":   "You have %d ticket:",
+		"tickets.count.other": "You have %d tickets:",
+		"tickets.stored":      "Tickets are stored in your wallet.",
+		"tickets.none":        "You have no tickets yet. Dial again and choose 1 to buy one.",
+		"help":                "Africa Railways Help:\nCall: 0800 RAILWAY\nWhatsApp: +27 82 123 4567\nEmail: help@africarailways.com",
+		"pin.enter":           "Enter your PIN to pay:",
+		"pin.new":             "Choose a 4-6 digit PIN:",
+		"pin.confirm":         "Enter the PIN again to confirm:",
+		"pin.current":         "Enter your current PIN:",
+		"pin.menu":            "PIN settings:\n1. Change PIN\n2. Forgot PIN\n0. Back",
+		"pin.saved":           "Your PIN has been saved. You will need it to confirm payments.",
+		"pin.mismatch":        "The PINs did not match. Please try again.",
+		"pin.invalid":         "PIN must be 4-6 digits and not easy to guess (e.g. 1111 or 1234).",
+		"pin.wrong.one":       "Wrong PIN. %d attempt left.",
+		"pin.wrong.other":     "Wrong PIN. %d attempts left.",
+		"pin.locked.one":      "Too many wrong PINs. Try again in %d minute.",
+		"pin.locked.other":    "Too many wrong PINs. Try again in %d minutes.",
+		"otp.sent":            "We sent a reset code by SMS.\nEnter the code:",
+		"otp.wrong":           "The code is wrong or has expired. Choose Forgot PIN to get a new code.",
+		"sms.otp":             "Your Africa Railways PIN reset code is %s. It expires in 5 minutes. Do not share it.",
+		"language.saved":      "Language set to English.",
+		"error.invalid":       "Invalid selection.\nPlease dial *123# to try again.",
+		"error.unavailable":   "Service temporarily unavailable.\nPlease try again later.",
+		"error.busy":          "Your request is already being processed.\nPlease try again.",
+		"error.blocked":       "We cannot process this request right now. Please call 0800 RAILWAY for help.",
+		"error.rate":          "Too many requests. Please wait a minute and dial again.",
+		"error.number":        "We could not recognise your phone number. Please contact your network.",
+	},
+	LocaleSwahili: {
+		"menu.main":           "Karibu Africa Railways\n1. Nunua Tiketi\n2. Angalia Tiketi\n3. Tiketi Zangu\n4. Msaada\n5. Lugha\n6. PIN",
+		"menu.route":          "Chagua Njia:\n1. Johannesburg - Cape Town\n2. Johannesburg - Durban\n3. Cape Town - Port Elizabeth\n0. Rudi",
+		"menu.date":           "Chagua Tarehe:\n1. Leo\n2. Kesho\n3. Chagua Tarehe\n0. Rudi",
+		"menu.class":          "Chagua Daraja:\n1. %s (%s)\n2. %s (%s)\n3. %s (%s)\n0. Rudi",
+		"menu.category":       "Aina ya abiria:\n1. Mtu mzima\n2. Mtoto\n3. Mwanafunzi\n4. Mzee\n0. Rudi",
+		"promo.prompt":        "Weka msimbo wa ofa:",
+		"promo.invalid":       "Msimbo wa ofa si halali.",
+		"fare.changed":        "Nauli imebadilika.\nTafadhali piga *123# kujaribu tena.",
+		"menu.confirm":        "Thibitisha Ununuzi:\nNjia: %s - %s\nTarehe: %s\nDaraja: %s\nBei: %s\n\n1. Lipa kwa M-Pesa\n2. Lipa kwa Kadi\n3. Msimbo wa ofa\n0. Ghairi",
+		"menu.language":       "Chagua Lugha:",
+		"menu.back":           "Rudi",
+		"class.Economy":       "Kawaida",
+		"class.Business":      "Biashara",
+		"class.FirstClass":    "Daraja la Kwanza",
+		"date.today":          "Leo",
+		"date.tomorrow":       "Kesho",
+		"payment.initiated":   "Malipo yameanzishwa!\nTiketi: %s\nKiasi: %s\nPochi: %s\nUtapokea SMS yenye maelezo ya tiketi yako.",
+		"ticket.prompt":       "Weka namba ya tiketi yako:",
+		"ticket.details":      "Tiketi %s\nNjia: %s\nTarehe: %s\nDaraja: %s\nHali: %s",
+		"ticket.notfound":     "Tiketi %s haikupatikana. Hakikisha namba na ujaribu tena.",
+		"status.issued":       "Halali",
+		"status.cancelled":    "Imeghairiwa",
+		"status.exchanged":    "Imebadilishwa",
+		"ticket.actions":      "1. Ghairi tiketi\n2. Badilisha tarehe\n0. Rudi",
+		"cancel.quote":        "Ghairi tiketi %s?\nMarejesho: %s (%.0f%%)\n1. Thibitisha\n0. Rudi",
+		"cancel.done":         "Tiketi %s imeghairiwa.\nMarejesho: %s\nUtapokea SMS ya uthibitisho.",
+		"cancel.late":         "Tiketi %s haiwezi tena kughairiwa au kubadilishwa.",
+		"exchange.date":       "Chagua tarehe mpya:",
+		"exchange.pay":        "Badilisha tiketi %s kwenda %s?\nKulipa: %s\n1. Thibitisha\n0. Rudi",
+		"exchange.refund":     "Badilisha tiketi %s kwenda %s?\nMarejesho: %s\n1. Thibitisha\n0. Rudi",
+		"exchange.done":       "Tiketi %s imebadilishwa na tiketi %s ya %s.\nUtapokea SMS ya uthibitisho.",
+		"error.soldout":       "Samahani, treni hii imejaa.\nTafadhali chagua tarehe nyingine.",
+		"sms.cancelled":       "Africa Railways: tiketi %s imeghairiwa. Marejesho: %s.",
+		"sms.exchanged":       "Africa Railways: tiketi %s imebadilishwa na tiketi %s (%s, %s).",
+		"tickets.count.one":   "Una tiketi %d:",
+		"tickets.count.other": "Una tiketi %d:",
+		"tickets.stored":      "Tiketi zimehifadhiwa kwenye pochi yako.",
+		"tickets.none":        "Bado huna tiketi. Piga tena uchague 1 kununua.",
+		"help":                "Msaada wa Africa Railways:\nPiga: 0800 RAILWAY\nWhatsApp: +27 82 123 4567\nBarua pepe: help@africarailways.com",
+		"pin.enter":           "Weka PIN yako kulipa:",
+		"pin.new":             "Chagua PIN ya tarakimu 4-6:",
+		"pin.confirm":         "Weka PIN tena kuthibitisha:",
+		"pin.current":         "Weka PIN yako ya sasa:",
+		"pin.menu":            "Mipangilio ya PIN:\n1. Badilisha PIN\n2. Umesahau PIN\n0. Rudi",
+		"pin.saved":           "PIN yako imehifadhiwa. Utaihitaji kuthibitisha malipo.",
+		"pin.mismatch":        "PIN hazilingani. Tafadhali jaribu tena.",
+		"pin.invalid":         "PIN lazima iwe tarakimu 4-6 na isiwe rahisi kubahatisha (mf. 1111 au 1234).",
+		"pin.wrong.one":       "PIN si sahihi. Jaribio %d limebaki.",
+		"pin.wrong.other":     "PIN si sahihi. Majaribio %d yamebaki.",
+		"pin.locked.one":      "Umekosea PIN mara nyingi. Jaribu tena baada ya dakika %d.",
+		"pin.locked.other":    "Umekosea PIN mara nyingi. Jaribu tena baada ya dakika %d.",
+		"otp.sent":            "Tumekutumia namba ya kuweka upya kwa SMS.\nWeka namba hiyo:",
+		"otp.wrong":           "Namba si sahihi au imeisha muda. Chagua Umesahau PIN kupata namba mpya.",
+		"sms.otp":             "Namba yako ya kuweka upya PIN ya Africa Railways ni %s. Itaisha baada ya dakika 5. Usimpe mtu.",
+		"language.saved":      "Lugha imewekwa: Kiswahili.",
+		"error.invalid":       "Chaguo si sahihi.\nTafadhali piga *123# kujaribu tena.",
+		"error.unavailable":   "Huduma haipatikani kwa sasa.\nTafadhali jaribu tena baadaye.",
+		"error.busy":          "Ombi lako tayari linashughulikiwa.\nTafadhali jaribu tena.",
+		"error.blocked":       "Hatuwezi kushughulikia ombi hili sasa. Tafadhali piga 0800 RAILWAY kwa msaada.",
+		"error.rate":          "Maombi mengi mno. Tafadhali subiri dakika moja kisha upige tena.",
+		"error.number":        "Hatukuweza kutambua namba yako ya simu. Tafadhali wasiliana na mtandao wako.",
+	},
+	LocaleBemba: {
+		"menu.main":           "Mwaiseni ku Africa Railways\n1. Shita Tiketi\n2. Moneka Tiketi\n3. Amatiketi Yandi\n4. Ubwafwilisho\n5. Ululimi\n6. PIN",
+		"menu.route":          "Saleni Inshila:\n1. Johannesburg - Cape Town\n2. Johannesburg - Durban\n3. Cape Town - Port Elizabeth\n0. Bwelela",
+		"menu.date":           "Saleni Ubushiku:\n1. Lelo\n2. Mailo\n3. Saleni Ubushiku\n0. Bwelela",
+		"menu.class":          "Saleni Ikalasi:\n1. %s (%s)\n2. %s (%s)\n3. %s (%s)\n0. Bwelela",
+		"menu.category":       "Umwenshi:\n1. Umukalamba\n2. Umwana\n3. Umusambi\n4. Umukote\n0. Bwelela",
+		"promo.prompt":        "Lembeni kodi ya promo:",
+		"promo.invalid":       "Kodi ya promo taileboma.",
+		"fare.changed":        "Umutengo naualuka.\nItileni *123# ukwesha na kabili.",
+		"menu.confirm":        "Sininkisheni Ukushita:\nInshila: %s - %s\nUbushiku: %s\nIkalasi: %s\nUmutengo: %s\n\n1. Lipileni na M-Pesa\n2. Lipileni na Kadi\n3. Kodi ya promo\n0. Lekeni",
+		"menu.language":       "Saleni Ululimi:",
+		"menu.back":           "Bwelela",
+		"class.Economy":       "Economy",
+		"class.Business":      "Business",
+		"class.FirstClass":    "First Class",
+		"date.today":          "Lelo",
+		"date.tomorrow":       "Mailo",
+		"payment.initiated":   "Ukulipila kwatendeka!\nTiketi: %s\nIndalama: %s\nWallet: %s\nMukapokelela SMS iyakwata ifya tiketi yenu.",
+		"ticket.prompt":       "Lembeni inambala ya tiketi yenu:",
+		"ticket.details":      "Tiketi %s\nInshila: %s\nUbushiku: %s\nIcipande: %s\nUko ili: %s",
+		"ticket.notfound":     "Tiketi %s taisangilwe. Moneni inambala no kwesha nakabili.",
+		"status.issued":       "Ilebomba",
+		"status.cancelled":    "Yalekwa",
+		"status.exchanged":    "Yapyanikwa",
+		"ticket.actions":      "1. Lekeni tiketi\n2. Alula ubushiku\n0. Bwelela",
+		"cancel.quote":        "Lekeni tiketi %s?\nIndalama ishibwelela: %s (%.0f%%)\n1. Sininkisheni\n0. Bwelela",
+		"cancel.done":         "Tiketi %s yalekwa.\nIndalama ishibwelela: %s\nMukapokelela SMS.",
+		"cancel.late":         "Tiketi %s tailelekwa nangu ukwalulwa nomba.",
+		"exchange.date":       "Saleni ubushiku ubupya:",
+		"exchange.pay":        "Alula tiketi %s ku %s?\nUkulipila: %s\n1. Sininkisheni\n0. Bwelela",
+		"exchange.refund":     "Alula tiketi %s ku %s?\nIndalama ishibwelela: %s\n1. Sininkisheni\n0. Bwelela",
+		"exchange.done":       "Tiketi %s yapyanikwa ne tiketi %s iya %s.\nMukapokelela SMS.",
+		"error.soldout":       "Mutulekelele, sitima iyi naiisula.\nSaleni ubushiku bumbi.",
+		"sms.cancelled":       "Africa Railways: tiketi %s yalekwa. Indalama ishibwelela: %s.",
+		"sms.exchanged":       "Africa Railways: tiketi %s yapyanikwa ne tiketi %s (%s, %s).",
+		"tickets.count.one":   "Mwakwata tiketi %d:",
+		"tickets.count.other": "Mwakwata amatiketi %d:",
+		"tickets.stored":      "Amatiketi yasungwa mu wallet yenu.",
+		"tickets.none":        "Tamulakwata tiketi. Itileni nakabili no kusala 1 ukushita.",
+		"help":                "Ubwafwilisho bwa Africa Railways:\nItileni: 0800 RAILWAY\nWhatsApp: +27 82 123 4567\nEmail: help@africarailways.com",
+		"pin.enter":           "Lembeni PIN yenu pa kulipila:",
+		"pin.new":             "Saleni PIN iya nambala 4-6:",
+		"pin.confirm":         "Lembeni PIN nakabili pa kushininkisha:",
+		"pin.current":         "Lembeni PIN yenu iya nomba:",
+		"pin.menu":            "Ifya PIN:\n1. Alula PIN\n2. Nalabile PIN\n0. Bwelela",
+		"pin.saved":           "PIN yenu yasungwa. Mukalaikabila pa kushininkisha ukulipila.",
+		"pin.mismatch":        "Ama PIN tayalingene. Esheni nakabili.",
+		"pin.invalid":         "PIN ifwile ukuba ne nambala 4-6 kabili iyashayanguka ukwelenganya (nga 1111 nangu 1234).",
+		"pin.wrong.one":       "PIN taili bwino. Mwashala no kwesha %d.",
+		"pin.wrong.other":     "PIN taili bwino. Mwashala ne fyeshi %d.",
+		"pin.locked.one":      "Mwalufyanya PIN imiku iingi. Esheni nakabili pa numa ya miniti %d.",
+		"pin.locked.other":    "Mwalufyanya PIN imiku iingi. Esheni nakabili pa numa ya maminiti %d.",
+		"otp.sent":            "Twamutumina inambala ya kwalula pa SMS.\nLembeni iyo nambala:",
+		"otp.wrong":           "Inambala taili bwino nangu yapwa. Saleni Nalabile PIN pa kupoka inambala ipya.",
+		"sms.otp":             "Inambala yenu iya kwalula PIN ya Africa Railways ni %s. Ikapwa pa maminiti 5. Mwilanga umbi.",
+		"language.saved":      "Ululimi lwasalwa: Ichibemba.",
+		"error.invalid":       "Ico mwasala tacilungeme.\nItileni *123# ukwesha na kabili.",
+		"error.unavailable":   "Imilimo taileboneka nomba.\nEsheni na kabili pali bukumo.",
+		"error.busy":          "Ukulomba kwenu kuleyalwa kale.\nEsheni na kabili.",
+		"error.blocked":       "Tatulekwanisha ukubomba ili pe lyo. Itileni 0800 RAILWAY pa bwafwilisho.",
+		"error.rate":          "Mwatuma imiku iingi. Lindileni miniti imo elyo mwitile nakabili.",
+		"error.number":        "Tatulemwishiba inambala ya foni yenu. Ipusheni ku network yenu.",
+	},
+	LocaleZulu: {
+		"menu.main":           "Siyakwamukela ku-Africa Railways\n1. Thenga Ithikithi\n2. Hlola Ithikithi\n3. Amathikithi Ami\n4. Usizo\n5. Ulimi\n6. PIN",
+		"menu.route":          "Khetha Umzila:\n1. Johannesburg - Cape Town\n2. Johannesburg - Durban\n3. Cape Town - Port Elizabeth\n0. Emuva",
+		"menu.date":           "Khetha Usuku:\n1. Namuhla\n2. Kusasa\n3. Khetha Usuku\n0. Emuva",
+		"menu.class":          "Khetha Isigaba:\n1. %s (%s)\n2. %s (%s)\n3. %s (%s)\n0. Emuva",
+		"menu.category":       "Uhlobo lomgibeli:\n1. Omdala\n2. Ingane\n3. Umfundi\n4. Osekhulile\n0. Emuva",
+		"promo.prompt":        "Faka ikhodi yephromo:",
+		"promo.invalid":       "Ikhodi yephromo ayivumelekile.",
+		"fare.changed":        "Imali yokugibela ishintshile.\nSicela ushaye *123# uzame futhi.",
+		"menu.confirm":        "Qinisekisa Ukuthenga:\nUmzila: %s - %s\nUsuku: %s\nIsigaba: %s\nIntengo: %s\n\n1. Khokha nge-M-Pesa\n2. Khokha ngekhadi\n3. Ikhodi yephromo\n0. Khansela",
+		"menu.language":       "Khetha Ulimi:",
+		"menu.back":           "Emuva",
+		"class.Economy":       "Economy",
+		"class.Business":      "Business",
+		"class.FirstClass":    "First Class",
+		"date.today":          "Namuhla",
+		"date.tomorrow":       "Kusasa",
+		"payment.initiated":   "Inkokhelo iqalile!\nIthikithi: %s\nInani: %s\nI-wallet: %s\nUzothola i-SMS enemininingwane yethikithi lakho.",
+		"ticket.prompt":       "Faka inombolo yethikithi lakho:",
+		"ticket.details":      "Ithikithi %s\nUmzila: %s\nUsuku: %s\nIsigaba: %s\nIsimo: %s",
+		"ticket.notfound":     "Ithikithi %s alitholakalanga. Hlola inombolo uzame futhi.",
+		"status.issued":       "Livumelekile",
+		"status.cancelled":    "Likhanseliwe",
+		"status.exchanged":    "Lishintshiwe",
+		"ticket.actions":      "1. Khansela ithikithi\n2. Shintsha usuku\n0. Emuva",
+		"cancel.quote":        "Khansela ithikithi %s?\nImbuyiselo: %s (%.0f%%)\n1. Qinisekisa\n0. Emuva",
+		"cancel.done":         "Ithikithi %s likhanseliwe.\nImbuyiselo: %s\nUzothola i-SMS yokuqinisekisa.",
+		"cancel.late":         "Ithikithi %s alisakwazi ukukhanselwa noma ukushintshwa.",
+		"exchange.date":       "Khetha usuku olusha:",
+		"exchange.pay":        "Shintsha ithikithi %s libe ngelomhla ka-%s?\nOkokukhokha: %s\n1. Qinisekisa\n0. Emuva",
+		"exchange.refund":     "Shintsha ithikithi %s libe ngelomhla ka-%s?\nImbuyiselo: %s\n1. Qinisekisa\n0. Emuva",
+		"exchange.done":       "Ithikithi %s lithathelwe indawo yithikithi %s lomhla ka-%s.\nUzothola i-SMS yokuqinisekisa.",
+		"error.soldout":       "Uxolo, lesi sitimela sigcwele.\nSicela ukhethe olunye usuku.",
+		"sms.cancelled":       "Africa Railways: ithikithi %s likhanseliwe. Imbuyiselo: %s.",
+		"sms.exchanged":       "Africa Railways: ithikithi %s lithathelwe indawo yithikithi %s (%s, %s).",
+		"tickets.count.one":   "Unethikithi elingu-%d:",
+		"tickets.count.other": "Unamathikithi angu-%d:",
+		"tickets.stored":      "Amathikithi agcinwe ku-wallet yakho.",
+		"tickets.none":        "Awukabi nawo amathikithi. Shayela futhi ukhethe 1 ukuthenga.",
+		"help":                "Usizo lwe-Africa Railways:\nShaya: 0800 RAILWAY\nWhatsApp: +27 82 123 4567\nI-imeyili: help@africarailways.com",
+		"pin.enter":           "Faka i-PIN yakho ukuze ukhokhe:",
+		"pin.new":             "Khetha i-PIN yezinombolo ezi-4 kuya kwezi-6:",
+		"pin.confirm":         "Faka i-PIN futhi ukuze uqinisekise:",
+		"pin.current":         "Faka i-PIN yakho yamanje:",
+		"pin.menu":            "Izilungiselelo ze-PIN:\n1. Shintsha i-PIN\n2. Ngikhohlwe i-PIN\n0. Emuva",
+		"pin.saved":           "I-PIN yakho igciniwe. Uzoyidinga ukuze uqinisekise izinkokhelo.",
+		"pin.mismatch":        "Ama-PIN awafani. Sicela uzame futhi.",
+		"pin.invalid":         "I-PIN kumele ibe yizinombolo ezi-4 kuya kwezi-6 futhi ingaqageleki kalula (isb. 1111 noma 1234).",
+		"pin.wrong.one":       "I-PIN ayilungile. Kusele umzamo ongu-%d.",
+		"pin.wrong.other":     "I-PIN ayilungile. Kusele imizamo engu-%d.",
+		"pin.locked.one":      "Ufake i-PIN engalungile kaningi. Zama futhi emva komzuzu ongu-%d.",
+		"pin.locked.other":    "Ufake i-PIN engalungile kaningi. Zama futhi emva kwemizuzu engu-%d.",
+		"otp.sent":            "Sikuthumelele ikhodi yokusetha kabusha nge-SMS.\nFaka ikhodi:",
+		"otp.wrong":           "Ikhodi ayilungile noma iphelelwe yisikhathi. Khetha Ngikhohlwe i-PIN ukuze uthole ikhodi entsha.",
+		"sms.otp":             "Ikhodi yakho yokusetha kabusha i-PIN ye-Africa Railways ngu-%s. Iphelelwa emizuzwini emi-5. Ungayabelani nomuntu.",
+		"language.saved":      "Ulimi lusethwe ku-isiZulu.",
+		"error.invalid":       "Ukukhetha okungalungile.\nSicela ushaye *123# uzame futhi.",
+		"error.unavailable":   "Isevisi ayitholakali okwamanje.\nSicela uzame futhi emuva kwesikhathi.",
+		"error.busy":          "Isicelo sakho sisacutshungulwa.\nSicela uzame futhi.",
+		"error.blocked":       "Asikwazi ukucubungula lesi sicelo manje. Sicela ushayele u-0800 RAILWAY ukuthola usizo.",
+		"error.rate":          "Izicelo eziningi kakhulu. Sicela ulinde umzuzu bese uyashayela futhi.",
+		"error.number":        "Asikwazanga ukubona inombolo yakho yocingo. Sicela uxhumane nenethiwekhi yakho.",
+	},
+	LocalePortuguese: {
+		"menu.main":           "Bem-vindo a Africa Railways\n1. Comprar Bilhete\n2. Verificar Bilhete\n3. Meus Bilhetes\n4. Ajuda\n5. Idioma\n6. PIN",
+		"menu.route":          "Selecione a Rota:\n1. Johannesburg - Cape Town\n2. Johannesburg - Durban\n3. Cape Town - Port Elizabeth\n0. Voltar",
+		"menu.date":           "Selecione a Data:\n1. Hoje\n2. Amanha\n3. Escolher Data\n0. Voltar",
+		"menu.class":          "Selecione a Classe:\n1. %s (%s)\n2. %s (%s)\n3. %s (%s)\n0. Voltar",
+		"menu.category":       "Tipo de passageiro:\n1. Adulto\n2. Crianca\n3. Estudante\n4. Idoso\n0. Voltar",
+		"promo.prompt":        "Introduza o codigo promocional:",
+		"promo.invalid":       "Codigo promocional invalido.",
+		"fare.changed":        "O preco mudou desde que foi mostrado.\nMarque *123# para tentar novamente.",
+		"menu.confirm":        "Confirmar Compra:\nRota: %s - %s\nData: %s\nClasse: %s\nPreco: %s\n\n1. Pagar com M-Pesa\n2. Pagar com Cartao\n3. Codigo promocional\n0. Cancelar",
+		"menu.language":       "Selecione o Idioma:",
+		"menu.back":           "Voltar",
+		"class.Economy":       "Economica",
+		"class.Business":      "Executiva",
+		"class.FirstClass":    "Primeira Classe",
+		"date.today":          "Hoje",
+		"date.tomorrow":       "Amanha",
+		"payment.initiated":   "Pagamento iniciado!\nBilhete: %s\nValor: %s\nCarteira: %s\nVai receber um SMS com os detalhes do bilhete.",
+		"ticket.prompt":       "Introduza o numero do seu bilhete:",
+		"ticket.details":      "Bilhete %s\nRota: %s\nData: %s\nClasse: %s\nEstado: %s",
+		"ticket.notfound":     "Bilhete %s nao encontrado. Verifique o numero e tente novamente.",
+		"status.issued":       "Valido",
+		"status.cancelled":    "Cancelado",
+		"status.exchanged":    "Substituido",
+		"ticket.actions":      "1. Cancelar bilhete\n2. Alterar data\n0. Voltar",
+		"cancel.quote":        "Cancelar bilhete %s?\nReembolso: %s (%.0f%%)\n1. Confirmar\n0. Voltar",
+		"cancel.done":         "Bilhete %s cancelado.\nReembolso: %s\nVai receber uma SMS de confirmacao.",
+		"cancel.late":         "O bilhete %s ja nao pode ser cancelado nem alterado.",
+		"exchange.date":       "Selecione a nova data:",
+		"exchange.pay":        "Alterar bilhete %s para %s?\nA pagar: %s\n1. Confirmar\n0. Voltar",
+		"exchange.refund":     "Alterar bilhete %s para %s?\nReembolso: %s\n1. Confirmar\n0. Voltar",
+		"exchange.done":       "O bilhete %s foi substituido pelo bilhete %s para %s.\nVai receber uma SMS de confirmacao.",
+		"error.soldout":       "Lamentamos, este comboio esta esgotado.\nEscolha outra data.",
+		"sms.cancelled":       "Africa Railways: o bilhete %s foi cancelado. Reembolso: %s.",
+		"sms.exchanged":       "Africa Railways: o bilhete %s foi substituido pelo bilhete %s (%s, %s).",
+		"tickets.count.one":   "Tem %d bilhete:",
+		"tickets.count.other": "Tem %d bilhetes:",
+		"tickets.stored":      "Os bilhetes estao guardados na sua carteira.",
+		"tickets.none":        "Ainda nao tem bilhetes. Ligue de novo e escolha 1 para comprar.",
+		"help":                "Ajuda Africa Railways:\nLigue: 0800 RAILWAY\nWhatsApp: +27 82 123 4567\nEmail: help@africarailways.com",
+		"pin.enter":           "Introduza o seu PIN para pagar:",
+		"pin.new":             "Escolha um PIN de 4 a 6 digitos:",
+		"pin.confirm":         "Introduza o PIN novamente para confirmar:",
+		"pin.current":         "Introduza o seu PIN atual:",
+		"pin.menu":            "Definicoes do PIN:\n1. Alterar PIN\n2. Esqueci o PIN\n0. Voltar",
+		"pin.saved":           "O seu PIN foi guardado. Vai precisar dele para confirmar pagamentos.",
+		"pin.mismatch":        "Os PINs nao coincidem. Tente novamente.",
+		"pin.invalid":         "O PIN deve ter 4 a 6 digitos e nao ser facil de adivinhar (ex. 1111 ou 1234).",
+		"pin.wrong.one":       "PIN errado. Resta %d tentativa.",
+		"pin.wrong.other":     "PIN errado. Restam %d tentativas.",
+		"pin.locked.one":      "Demasiados PINs errados. Tente novamente dentro de %d minuto.",
+		"pin.locked.other":    "Demasiados PINs errados. Tente novamente dentro de %d minutos.",
+		"otp.sent":            "Enviamos um codigo por SMS.\nIntroduza o codigo:",
+		"otp.wrong":           "O codigo esta errado ou expirou. Escolha Esqueci o PIN para receber um novo codigo.",
+		"sms.otp":             "O seu codigo para redefinir o PIN da Africa Railways e %s. Expira em 5 minutos. Nao o partilhe.",
+		"language.saved":      "Idioma definido: Portugues.",
+		"error.invalid":       "Selecao invalida.\nMarque *123# para tentar novamente.",
+		"error.unavailable":   "Servico temporariamente indisponivel.\nTente novamente mais tarde.",
+		"error.busy":          "O seu pedido ja esta a ser processado.\nTente novamente.",
+		"error.blocked":       "Nao podemos processar este pedido agora. Ligue 0800 RAILWAY para obter ajuda.",
+		"error.rate":          "Demasiados pedidos. Aguarde um minuto e marque novamente.",
+		"error.number":        "Nao foi possivel reconhecer o seu numero. Contacte a sua operadora.",
+	},
+}
+
+// T renders a catalogue entry, falling back to English for unknown locales or keys
+func T(locale, key string, args ...interface{}) string {
+	format, ok := ussdCatalogue[locale][key]
+	if !ok {
+		format, ok = ussdCatalogue[LocaleEnglish][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Tn renders the plural form of key that matches n. The count is passed as
+// the first format argument.
+func Tn(locale, key string, n int, args ...interface{}) string {
+	return T(locale, key+"."+pluralCategory(locale, n), append([]interface{}{n}, args...)...)
+}
+
+// pluralCategory returns the CLDR plural category for a cardinal count.
+// Portuguese treats 0 and 1 as singular; the other supported locales only
+// use the singular for exactly 1.
+func pluralCategory(locale string, n int) string {
+	switch locale {
+	case LocalePortuguese:
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// defaultLocale guesses a locale from the MSISDN country code for callers
+// who have not picked a language yet
+func defaultLocale(msisdn string) string {
+	digits := strings.TrimPrefix(msisdn, "+")
+	switch {
+	case strings.HasPrefix(digits, "254"), strings.HasPrefix(digits, "255"), strings.HasPrefix(digits, "256"):
+		return LocaleSwahili
+	case strings.HasPrefix(digits, "258"), strings.HasPrefix(digits, "244"):
+		return LocalePortuguese
+	default:
+		return LocaleEnglish
+	}
+}
+
+// LanguageStore remembers each caller's chosen locale by MSISDN
+type LanguageStore interface {
+	// Get returns the stored locale, or "" if the caller never chose one
+	Get(ctx context.Context, msisdn string) (string, error)
+	Set(ctx context.Context, msisdn, locale string) error
+}
+
+// newLanguageStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newLanguageStore(client *redis.Client) LanguageStore {
+	if client == nil {
+		return NewMemoryLanguageStore()
+	}
+	return &RedisLanguageStore{client: client, prefix: "ussd:lang:"}
+}
+
+// MemoryLanguageStore keeps language preferences in process memory
+type MemoryLanguageStore struct {
+	locales map[string]string
+	mu      sync.RWMutex
+}
+
+// NewMemoryLanguageStore creates an in-process language store
+func NewMemoryLanguageStore() *MemoryLanguageStore {
+	return &MemoryLanguageStore{locales: make(map[string]string)}
+}
+
+func (s *MemoryLanguageStore) Get(ctx context.Context, msisdn string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.locales[msisdn], nil
+}
+
+func (s *MemoryLanguageStore) Set(ctx context.Context, msisdn, locale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locales[msisdn] = locale
+	return nil
+}
+
+// RedisLanguageStore keeps language preferences in Redis without expiry
+type RedisLanguageStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *RedisLanguageStore) Get(ctx context.Context, msisdn string) (string, error) {
+	locale, err := s.client.Get(ctx, s.prefix+msisdn).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return locale, err
+}
+
+func (s *RedisLanguageStore) Set(ctx context.Context, msisdn, locale string) error {
+	return s.client.Set(ctx, s.prefix+msisdn, locale, 0).Err()
+}
+
+// resolveLocale returns the caller's chosen locale or a default for their country
+func resolveLocale(ctx context.Context, msisdn string) string {
+	locale, err := languageStore.Get(ctx, msisdn)
+	if err != nil || locale == "" {
+		return defaultLocale(msisdn)
+	}
+	return locale
+}
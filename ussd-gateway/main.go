@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,97 +22,134 @@ type Session struct {
 	PhoneNumber string    `json:"phone_number"`
 	State       string    `json:"state"`
 	LastCommand string    `json:"last_command"`
+	Locale      string    `json:"locale"`
 	StartTime   time.Time `json:"start_time"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"version"` // Optimistic lock counter
 	Data        map[string]interface{} `json:"data"`
 }
 
-// SessionStore manages active USSD sessions
-type SessionStore struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
-}
-
-// Stats tracks USSD gateway statistics
-type Stats struct {
-	TotalSessionsToday int64
-	SuccessfulSessions int64
-	FailedSessions     int64
-	TotalResponseTime  int64
-	RequestCount       int64
-	StartTime          time.Time
-}
-
-// RevenueTracker tracks revenue metrics
+// RevenueTracker tracks revenue metrics in each currency sold in; reports
+// convert them to the reporting currency
 type RevenueTracker struct {
-	ConfirmedTotal float64 // Transactions successful on Sui/Polygon
-	PendingTotal   float64 // Sum of ticket prices in active sessions
-	TotalRevenue   float64 // All-time revenue
-	RevenueToday   float64 // Today's revenue
-	TicketsSold    int64   // Total tickets sold
-	TicketsToday   int64   // Tickets sold today
-	ConversionRate float64 // Successful purchases / total sessions
+	Confirmed      MoneyTotals // Transactions successful on Sui/Polygon
+	Pending        MoneyTotals // Sum of ticket prices in active sessions
+	Total          MoneyTotals // All-time revenue
+	TicketsSold    int64       // Total tickets sold
+	ConversionRate float64     // Successful purchases / total sessions
 	mu             sync.RWMutex
 }
 
-// TicketPrice represents pricing for different routes and classes
-type TicketPrice struct {
-	Route string
-	Class string
-	Price float64
+// NewRevenueTracker creates an empty tracker
+func NewRevenueTracker() *RevenueTracker {
+	return &RevenueTracker{Confirmed: MoneyTotals{}, Pending: MoneyTotals{}, Total: MoneyTotals{}}
 }
 
 var (
-	sessionStore = &SessionStore{
-		sessions: make(map[string]*Session),
-	}
-	stats = &Stats{
-		StartTime: time.Now(),
-	}
-	statsMu sync.RWMutex
-	
-	revenueTracker = &RevenueTracker{}
+	sessionStore  SessionStore  = NewMemorySessionStore(sessionTTL)
+	languageStore LanguageStore = NewMemoryLanguageStore()
+	ticketStore   TicketStore   = NewMemoryTicketStore()
+	seatInventory SeatInventory = NewMemorySeatInventory()
+	auditLog      AuditLog      = NewMemoryAuditLog(auditLogSize)
+	passengers    *PassengerRegistry
+	pins          *PINManager
+	fraudGuard    = NewFraudGuard(NewMemoryCounterStore(), NewMemoryMSISDNList(), NewMemoryMSISDNList())
+	cancellations *CancellationService
+	smsSender     SMSSender = logSMSSender{}
+	operatorLoc   = time.UTC
+	stats         = NewStatsRecorder(NewMemoryStatsStore(), time.UTC)
 	
-	// Ticket pricing table
-	ticketPrices = map[string]map[string]float64{
-		"JHB-CPT": {
-			"Economy":     150.00,
-			"Business":    300.00,
-			"FirstClass":  500.00,
-		},
-		"JHB-DBN": {
-			"Economy":     120.00,
-			"Business":    240.00,
-			"FirstClass":  400.00,
-		},
-		"CPT-PE": {
-			"Economy":     100.00,
-			"Business":    200.00,
-			"FirstClass":  350.00,
-		},
-	}
+	revenueTracker = NewRevenueTracker()
+	fareEngine     = NewFareEngine(&defaultFareRules, NewMemoryPromoStore())
+
+	// Exchange rates, and the currency revenue is reported in
+	fxRates           FXProvider = &FXRates{Base: defaultCurrency}
+	reportingCurrency            = defaultCurrency
 )
 
 func main() {
 	log.Println("📱 Africa Railways USSD Gateway Starting...")
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
+	// Connect stores (shared Redis when configured)
+	redisClient, err := newRedisClientFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize session store: %v", err)
+	}
+	sessionStore = newSessionStore(redisClient)
+	languageStore = newLanguageStore(redisClient)
+	ticketStore = newTicketStore(redisClient)
+	seatInventory = newSeatInventory(redisClient)
+	operatorLoc = operatorLocationFromEnv()
+
+	walletKeys, err := newWalletKeySourceFromEnv(redisClient != nil)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize passenger wallets: %v", err)
+	}
+	passengers = NewPassengerRegistry(newPassengerStore(redisClient), walletKeys)
+	auditLog = newAuditLog(redisClient)
+	smsSender = newSMSSenderFromEnv()
+	pins = NewPINManager(newPINStore(redisClient), smsSender)
+	fraudGuard = NewFraudGuard(newCounterStore(redisClient),
+		newMSISDNList(redisClient, "blocklist"), newMSISDNList(redisClient, "allowlist"))
+	if fxRates, err = newFXProviderFromEnv(); err != nil {
+		log.Fatalf("❌ Failed to load FX rates: %v", err)
+	}
+	if reportingCurrency, err = reportingCurrencyFromEnv(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	stats = NewStatsRecorder(newStatsStore(redisClient), operatorLoc)
+	go stats.Run(context.Background())
+
+	farePolicy, err := loadFarePolicyFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Failed to load fare policy: %v", err)
+	}
+	fareRules, err := loadFareRulesFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Failed to load fare rules: %v", err)
+	}
+	fareEngine = NewFareEngine(fareRules, newPromoStore(redisClient))
+	cancellations = NewCancellationService(farePolicy, ticketStore, seatInventory,
+		logPaymentProvider{}, registryLedger{}, smsSender)
+	log.Println("⚠️  No payment provider or on-chain ticket ledger: refunds and voids are left pending")
+
 	// Setup routes
 	mux := http.NewServeMux()
 	
-	// USSD webhook endpoint (receives requests from telecom)
+	// USSD webhook endpoints (receive requests from telecom aggregators)
 	mux.HandleFunc("/ussd", handleUSSD)
+	mux.HandleFunc("/ussd/", handleUSSD)
 	
 	// Health check endpoint (for OCC dashboard)
 	mux.HandleFunc("/health", handleHealth)
 	
 	// Stats endpoint
 	mux.HandleFunc("/stats", handleStats)
+	mux.HandleFunc("/stats/history", handleStatsHistory)
 	
 	// Active sessions endpoint
 	mux.HandleFunc("/sessions", handleSessions)
 	
 	// Revenue endpoint
 	mux.HandleFunc("/revenue", handleRevenue)
+	
+	// Fare quotes with a full price breakdown
+	mux.HandleFunc("/fares/quote", handleFareQuote)
+	
+	// Operator endpoints (require USSD_ADMIN_TOKEN)
+	mux.HandleFunc("/passengers", requireAdmin(handlePassengers))
+	mux.HandleFunc("/tickets", requireAdmin(handleTickets))
+	mux.HandleFunc("/audit", requireAdmin(handleAudit))
+	mux.HandleFunc("/alerts", requireAdmin(handleAlerts))
+	mux.HandleFunc("/admin/blocklist", requireAdmin(handleMSISDNList("blocklist", fraudGuard.blocklist)))
+	mux.HandleFunc("/admin/allowlist", requireAdmin(handleMSISDNList("allowlist", fraudGuard.allowlist)))
+	mux.HandleFunc("/admin/tickets/cancel", requireAdmin(handleCancelTicket))
+	mux.HandleFunc("/admin/tickets/exchange", requireAdmin(handleExchangeTicket))
+	mux.HandleFunc("/admin/tickets/refund", requireAdmin(handleRetryRefund))
+	mux.HandleFunc("/admin/fare-policy", requireAdmin(handleFarePolicy))
+	mux.HandleFunc("/admin/fare-rules", requireAdmin(handleFareRules))
+	mux.HandleFunc("/admin/promos", requireAdmin(handlePromos))
 
 	// Enable CORS
 	handler := cors.New(cors.Options{
@@ -127,66 +168,141 @@ func main() {
 	log.Printf("   Health: http://localhost:%s/health\n", port)
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
-	// Start session cleanup goroutine
-	go cleanupSessions()
-
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
 
 // handleUSSD processes incoming USSD requests from telecom gateway
 func handleUSSD(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	
-	// Parse USSD request (format varies by provider)
-	// Common parameters: sessionId, phoneNumber, text, serviceCode
-	sessionID := r.FormValue("sessionId")
-	phoneNumber := r.FormValue("phoneNumber")
-	text := r.FormValue("text")
-	serviceCode := r.FormValue("serviceCode")
 
-	log.Printf("📱 USSD Request: Session=%s, Phone=%s, Text=%s, Code=%s", 
-		sessionID, phoneNumber, text, serviceCode)
+	// Request format varies by provider; the adapter normalizes it
+	provider, err := selectUSSDProvider(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	req, err := provider.ParseRequest(r)
+	if err != nil {
+		log.Printf("❌ %s USSD request rejected: %v", provider.Name(), err)
+		http.Error(w, "Invalid USSD request", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Everything downstream is keyed by the E.164 form of the number
+	msisdn, err := normalizeMSISDN(req.PhoneNumber)
+	if err != nil {
+		log.Printf("⚠️  %s USSD request with invalid MSISDN %q: %v", provider.Name(), req.PhoneNumber, err)
+		if fraudGuard.FirstInWindow(ctx, "invalid_msisdn", time.Minute) {
+			emitAlert(ctx, "warning", AuditEvent{SessionID: req.SessionID, Reason: "invalid_msisdn", Detail: err.Error()})
+		}
+		provider.WriteResponse(w, req, USSDResponse{Message: T(LocaleEnglish, "error.number")})
+		return
+	}
+	req.PhoneNumber = msisdn
+
+	if flag := fraudGuard.CheckRequest(ctx, msisdn, req.SessionID); flag != nil {
+		sessionStore.Remove(ctx, req.SessionID)
+		message := flaggedMessage(ctx, resolveLocale(ctx, msisdn), msisdn, req.SessionID, flag)
+		provider.WriteResponse(w, req, USSDResponse{Message: message})
+		return
+	}
 
 	// Get or create session
-	session := sessionStore.GetOrCreate(sessionID, phoneNumber)
-	session.LastCommand = text
+	session, err := sessionStore.GetOrCreate(ctx, req.SessionID, req.PhoneNumber)
+	if err != nil {
+		log.Printf("❌ Session store unavailable: %v", err)
+		provider.WriteResponse(w, req, USSDResponse{Message: T(defaultLocale(req.PhoneNumber), "error.unavailable")})
+		return
+	}
+
+	if session.Version == 0 && session.LastCommand == "" {
+		stats.SessionStarted(ctx)
+	}
+
+	// Providers that only send the latest hop get the path rebuilt from the session
+	text := req.Text
+	if !req.Cumulative {
+		text = req.Input
+		if session.LastCommand != "" {
+			text = session.LastCommand + "*" + req.Input
+		}
+		req.Text = text
+	}
+
+	if len(text) > maxUSSDInput {
+		log.Printf("⚠️  Oversized USSD input (%d chars) from %s", len(text), msisdn)
+		sessionStore.Remove(ctx, req.SessionID)
+		provider.WriteResponse(w, req, USSDResponse{Message: T(resolveLocale(ctx, msisdn), "error.invalid")})
+		return
+	}
+
+	log.Printf("📱 USSD Request (%s): Session=%s, Phone=%s, Text=%s, Code=%s",
+		provider.Name(), req.SessionID, req.PhoneNumber, redactInput(text), req.ServiceCode)
+
+	if req.Release {
+		sessionStore.Remove(ctx, req.SessionID)
+		provider.WriteResponse(w, req, USSDResponse{Continue: false})
+		return
+	}
+
+	// The path is replayed on the next hop for providers that send only the
+	// latest input; the PIN menus do not need earlier PINs or codes back
+	session.LastCommand = redactInput(text)
+
+	if session.Locale == "" {
+		session.Locale = resolveLocale(ctx, session.PhoneNumber)
+	}
 
 	// Process USSD menu
-	response := processUSSDMenu(session, text)
+	screen := processUSSDMenu(ctx, session, text)
+	if len(screen) > ussdMaxLength+4 {
+		log.Printf("⚠️  USSD screen is %d chars, may be truncated by the network", len(screen)-4)
+	}
+	response := parseMenuResponse(screen)
+
+	// Finished sessions are dropped; live ones are written back with a fresh TTL
+	if response.Continue {
+		err = sessionStore.Save(ctx, session)
+	} else {
+		err = sessionStore.Remove(ctx, session.SessionID)
+	}
+	if err == ErrSessionConflict {
+		log.Printf("⚠️  Concurrent update on session %s, rejecting hop", session.SessionID)
+		stats.SessionFailed(ctx)
+		response = USSDResponse{Message: T(session.Locale, "error.busy")}
+	} else if err != nil {
+		log.Printf("❌ Failed to persist session %s: %v", session.SessionID, err)
+	}
 
 	// Update stats
-	statsMu.Lock()
-	stats.RequestCount++
-	stats.TotalResponseTime += time.Since(start).Milliseconds()
-	statsMu.Unlock()
+	stats.Request(ctx, time.Since(start))
 
 	// Send response
-	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprint(w, response)
+	if err := provider.WriteResponse(w, req, response); err != nil {
+		log.Printf("❌ Failed to write %s response: %v", provider.Name(), err)
+		return
+	}
 
 	log.Printf("✅ Response sent in %dms", time.Since(start).Milliseconds())
 }
 
 // processUSSDMenu handles the USSD menu logic
-func processUSSDMenu(session *Session, input string) string {
+func processUSSDMenu(ctx context.Context, session *Session, input string) string {
+	locale := session.Locale
+
 	// Main menu
 	if input == "" {
 		session.State = "main_menu"
-		return "CON Welcome to Africa Railways\n" +
-			"1. Buy Ticket\n" +
-			"2. Check Ticket\n" +
-			"3. My Tickets\n" +
-			"4. Help"
+		return "CON " + T(locale, "menu.main")
 	}
 
 	// Buy ticket flow
 	if input == "1" {
 		session.State = "select_route"
-		return "CON Select Route:\n" +
-			"1. Johannesburg - Cape Town\n" +
-			"2. Johannesburg - Durban\n" +
-			"3. Cape Town - Port Elizabeth\n" +
-			"0. Back"
+		return "CON " + T(locale, "menu.route")
 	}
 
 	if input == "1*1" {
@@ -196,160 +312,664 @@ func processUSSDMenu(session *Session, input string) string {
 			"from":  "Johannesburg",
 			"to":    "Cape Town",
 		}
-		return "CON Select Date:\n" +
-			"1. Today\n" +
-			"2. Tomorrow\n" +
-			"3. Choose Date\n" +
-			"0. Back"
+		return "CON " + T(locale, "menu.date")
 	}
 
 	if input == "1*1*1" {
 		session.State = "select_class"
-		session.Data["date"] = time.Now().Format("2006-01-02")
-		return "CON Select Class:\n" +
-			"1. Economy (R150)\n" +
-			"2. Business (R300)\n" +
-			"3. First Class (R500)\n" +
-			"0. Back"
+		session.Data["date"] = time.Now().In(operatorLoc).Format("2006-01-02")
+		return "CON " + T(locale, "menu.class",
+			T(locale, "class.Economy"), classFare(ctx, session, "Economy"),
+			T(locale, "class.Business"), classFare(ctx, session, "Business"),
+			T(locale, "class.FirstClass"), classFare(ctx, session, "FirstClass"))
 	}
 
-	if input == "1*1*1*1" {
-		session.State = "confirm_payment"
+	// Passenger type, promo code, confirmation and payment
+	if input == "1*1*1*1" || strings.HasPrefix(input, "1*1*1*1*") {
 		session.Data["class"] = "Economy"
-		route := session.Data["route"].(string)
-		price := getTicketPrice(route, "Economy")
-		session.Data["price"] = price
-		
-		// Add to potential revenue
-		revenueTracker.addPotentialRevenue(price)
-		
-		return fmt.Sprintf("CON Confirm Purchase:\n"+
-			"Route: Johannesburg - Cape Town\n"+
-			"Date: Today\n"+
-			"Class: Economy\n"+
-			"Price: R%.2f\n\n"+
-			"1. Pay with M-Pesa\n"+
-			"2. Pay with Card\n"+
-			"0. Cancel", price)
-	}
-
-	if input == "1*1*1*1*1" {
-		// Process payment and mint ticket
-		session.State = "payment_processing"
-		
-		// Get ticket price
-		price, ok := session.Data["price"].(float64)
-		if !ok {
-			price = 150.00 // Default fallback
-		}
-		
-		// In production:
-		// 1. Initiate M-Pesa payment
-		// 2. Wait for payment confirmation
-		// 3. Mint NFT ticket on Polygon
-		// 4. Upload metadata to IPFS
-		// 5. Send ticket to user's wallet
-		
-		// Update revenue tracking
-		revenueTracker.confirmPurchase(price)
-		
-		statsMu.Lock()
-		stats.SuccessfulSessions++
-		stats.TotalSessionsToday++
-		statsMu.Unlock()
-		
-		// Clean up session
-		sessionStore.Remove(session.SessionID)
-		
-		return fmt.Sprintf("END Payment initiated!\n"+
-			"Amount: R%.2f\n"+
-			"You will receive an SMS with your ticket details.\n"+
-			"Wallet: 0x%s\n"+
-			"Thank you for choosing Africa Railways!", price, generateMockWallet())
+		return processPurchaseMenu(ctx, session, strings.Split(input, "*")[4:])
 	}
 
 	// Check ticket
 	if input == "2" {
 		session.State = "check_ticket"
-		return "CON Enter your ticket number:"
+		return "CON " + T(locale, "ticket.prompt")
+	}
+
+	// Ticket details, with cancel and change options for the owner
+	if strings.HasPrefix(input, "2*") {
+		steps := strings.Split(input, "*")[1:]
+		return processTicketMenu(ctx, session, steps)
 	}
 
 	// My tickets
 	if input == "3" {
 		session.State = "my_tickets"
-		return "END Your Tickets:\n" +
-			"1. JHB-CPT (Today, 14:00)\n" +
-			"2. CPT-JHB (Tomorrow, 09:00)\n\n" +
-			"Tickets are stored in your wallet."
+		tickets, err := ticketStore.ListByPassenger(ctx, session.PhoneNumber)
+		if err != nil {
+			log.Printf("❌ Failed to list tickets for %s: %v", session.PhoneNumber, err)
+			return "END " + T(locale, "error.unavailable")
+		}
+		if len(tickets) == 0 {
+			return "END " + T(locale, "tickets.none")
+		}
+		
+		screen := Tn(locale, "tickets.count", len(tickets))
+		for i, ticket := range tickets {
+			if i == maxTicketsListed {
+				break
+			}
+			screen += fmt.Sprintf("\n%d. %s %s #%s", i+1, ticket.Route, ticket.TravelDate, ticket.TicketID)
+		}
+		return "END " + screen + "\n" + T(locale, "tickets.stored")
 	}
 
 	// Help
 	if input == "4" {
-		return "END Africa Railways Help:\n" +
-			"Call: 0800 RAILWAY\n" +
-			"WhatsApp: +27 82 123 4567\n" +
-			"Email: help@africarailways.com"
+		return "END " + T(locale, "help")
+	}
+
+	// Language selection
+	if input == "5" {
+		session.State = "select_language"
+		screen := T(locale, "menu.language")
+		for i, lang := range languageMenu {
+			screen += fmt.Sprintf("\n%d. %s", i+1, lang.Name)
+		}
+		return "CON " + screen + "\n0. " + T(locale, "menu.back")
+	}
+
+	if strings.HasPrefix(input, "5*") && input != "5*0" {
+		choice, err := strconv.Atoi(strings.TrimPrefix(input, "5*"))
+		if err == nil && choice >= 1 && choice <= len(languageMenu) {
+			chosen := languageMenu[choice-1].Locale
+			if err := languageStore.Set(ctx, session.PhoneNumber, chosen); err != nil {
+				log.Printf("❌ Failed to save language for %s: %v", session.PhoneNumber, err)
+				return "END " + T(locale, "error.unavailable")
+			}
+			session.Locale = chosen
+			return "END " + T(chosen, "language.saved")
+		}
+	}
+
+	// PIN settings
+	if input == "6" || strings.HasPrefix(input, "6*") {
+		steps := strings.Split(input, "*")[1:]
+		return processPINMenu(ctx, session, steps)
 	}
 
 	// Back to main menu
 	if input == "0" || input[len(input)-1:] == "0" {
 		session.State = "main_menu"
-		return processUSSDMenu(session, "")
+		return processUSSDMenu(ctx, session, "")
 	}
 
 	// Invalid input
-	return "END Invalid selection.\nPlease dial *123# to try again."
+	return "END " + T(locale, "error.invalid")
+}
+
+// processPurchaseMenu asks for the passenger type and an optional promo
+// code, then confirms the quoted fare and takes payment. steps follow the
+// class choice: <type>[*3*<promo>][*<pay>[*<pin>]]
+func processPurchaseMenu(ctx context.Context, session *Session, steps []string) string {
+	locale := session.Locale
+	if len(steps) == 0 {
+		session.State = "select_category"
+		return "CON " + T(locale, "menu.category")
+	}
+	if steps[0] == "0" {
+		return processUSSDMenu(ctx, session, "")
+	}
+	choice, err := strconv.Atoi(steps[0])
+	if err != nil || choice < 1 || choice > len(passengerCategories) {
+		return "END " + T(locale, "error.invalid")
+	}
+	session.Data["category"] = passengerCategories[choice-1]
+
+	rest := steps[1:]
+	delete(session.Data, "promo")
+	if len(rest) > 0 && rest[0] == "3" {
+		if len(rest) == 1 {
+			session.State = "enter_promo"
+			return "CON " + T(locale, "promo.prompt")
+		}
+		session.Data["promo"] = normalizePromoCode(rest[1])
+		rest = rest[2:]
+	}
+
+	// The fare is quoted afresh on every hop; payment only goes ahead at the
+	// price the caller was shown
+	quote, note, err := purchaseQuote(ctx, session)
+	if err != nil {
+		log.Printf("❌ Failed to quote fare for %s: %v", session.PhoneNumber, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	// Kept as text so it compares the same after a round trip through Redis
+	shown, _ := session.Data["price"].(string)
+	session.Data["price"] = quote.Total.String()
+	session.Data["currency"] = quote.Total.Currency
+	session.Data["price_minor"] = quote.Total.Amount
+
+	if len(rest) == 0 {
+		session.State = "confirm_payment"
+		revenueTracker.addPotentialRevenue(quote.Total)
+		return "CON " + note + T(locale, "menu.confirm",
+			session.Data["from"], session.Data["to"],
+			T(locale, "date.today"), T(locale, "class."+quote.Class), quote.Total.String())
+	}
+
+	switch rest[0] {
+	case "0":
+		revenueTracker.cancelPurchase(quote.Total)
+		return processUSSDMenu(ctx, session, "")
+	case "1", "2":
+		if shown != quote.Total.String() {
+			return "END " + T(locale, "fare.changed")
+		}
+		if screen, ok := confirmWithPIN(ctx, session, rest[1:]); !ok {
+			return screen
+		}
+		return completePurchase(ctx, session, quote)
+	}
+	return "END " + T(locale, "error.invalid")
+}
+
+// purchaseQuote prices the fare being bought. An unusable promo code is
+// dropped and note explains why to the caller.
+func purchaseQuote(ctx context.Context, session *Session) (*FareQuote, string, error) {
+	req := FareRequest{MSISDN: session.PhoneNumber}
+	req.Route, _ = session.Data["route"].(string)
+	req.Class, _ = session.Data["class"].(string)
+	req.TravelDate, _ = session.Data["date"].(string)
+	req.Category, _ = session.Data["category"].(string)
+	req.PromoCode, _ = session.Data["promo"].(string)
+
+	quote, err := fareEngine.Quote(ctx, req)
+	if errors.Is(err, ErrPromoInvalid) {
+		log.Printf("🏷️  Promo code rejected for %s: %v", session.PhoneNumber, err)
+		delete(session.Data, "promo")
+		req.PromoCode = ""
+		quote, err = fareEngine.Quote(ctx, req)
+		return quote, T(session.Locale, "promo.invalid") + "\n", err
+	}
+	return quote, "", err
+}
+
+// classFare is the adult fare shown on the class menu
+func classFare(ctx context.Context, session *Session, class string) string {
+	req := FareRequest{Class: class}
+	req.Route, _ = session.Data["route"].(string)
+	req.TravelDate, _ = session.Data["date"].(string)
+	quote, err := fareEngine.Quote(ctx, req)
+	if err != nil {
+		return "-"
+	}
+	return quote.Total.Short()
+}
+
+// completePurchase takes payment for the confirmed ticket and issues it to
+// the caller's wallet
+func completePurchase(ctx context.Context, session *Session, quote *FareQuote) string {
+	locale := session.Locale
+	
+	// Process payment and mint ticket
+	session.State = "payment_processing"
+	price := quote.Total
+	
+	// In production:
+	// 1. Initiate M-Pesa payment
+	// 2. Wait for payment confirmation
+	// 3. Mint NFT ticket on Polygon
+	// 4. Upload metadata to IPFS
+	// 5. Send ticket to user's wallet
+	
+	route := quote.Route
+	if flag := fraudGuard.CheckPurchase(ctx, session.PhoneNumber, route); flag != nil {
+		return "END " + flaggedMessage(ctx, locale, session.PhoneNumber, session.SessionID, flag)
+	}
+	
+	passenger, err := passengers.Register(ctx, session.PhoneNumber)
+	if err != nil {
+		log.Printf("❌ Failed to register passenger %s: %v", session.PhoneNumber, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	
+	from, _ := session.Data["from"].(string)
+	to, _ := session.Data["to"].(string)
+	class, travelDate := quote.Class, quote.TravelDate
+	
+	if err := fareEngine.Redeem(ctx, quote, session.PhoneNumber); errors.Is(err, ErrPromoInvalid) {
+		return "END " + T(locale, "promo.invalid")
+	} else if err != nil {
+		log.Printf("❌ Failed to redeem promo code for %s: %v", session.PhoneNumber, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	
+	if err := seatInventory.Reserve(ctx, route, class, travelDate); err != nil {
+		fareEngine.Unredeem(ctx, quote, session.PhoneNumber)
+		if err == ErrSoldOut {
+			return "END " + T(locale, "error.soldout")
+		}
+		log.Printf("❌ Failed to reserve seat for %s: %v", session.PhoneNumber, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	
+	ticket := &Ticket{
+		MSISDN:     passenger.MSISDN,
+		Owner:      passenger.Address,
+		Route:      route,
+		From:       from,
+		To:         to,
+		Class:      class,
+		TravelDate: travelDate,
+		Departure:  quote.Departure,
+		Category:   quote.Category,
+		Price:      price,
+		Fare:       quote,
+		Status:     TicketIssued,
+		IssuedAt:   time.Now(),
+	}
+	if err := issueTicket(ctx, ticket); err != nil {
+		log.Printf("❌ Failed to issue ticket for %s: %v", session.PhoneNumber, err)
+		seatInventory.Release(ctx, route, class, travelDate)
+		fareEngine.Unredeem(ctx, quote, session.PhoneNumber)
+		return "END " + T(locale, "error.unavailable")
+	}
+	
+	// Update revenue tracking
+	revenueTracker.confirmPurchase(price)
+	stats.TicketSold(ctx, price)
+	fraudGuard.RecordPurchase(ctx, session.PhoneNumber, route)
+
+	// Confirm by SMS in the background; the USSD session must end quickly
+	if confirmer, ok := smsSender.(ticketConfirmer); ok {
+		go func(ticket Ticket) {
+			if err := confirmer.ConfirmTicket(context.WithoutCancel(ctx), &ticket); err != nil {
+				log.Printf("⚠️  Failed to send ticket confirmation SMS for %s: %v", ticket.TicketID, err)
+			}
+		}(*ticket)
+	}
+	
+	return "END " + T(locale, "payment.initiated", ticket.TicketID, price.String(), shortAddress(passenger.Address))
+}
+
+// flaggedMessage alerts on a request the fraud guard refused and returns the
+// message shown to the caller
+func flaggedMessage(ctx context.Context, locale, msisdn, sessionID string, flag *Flag) string {
+	level := "warning"
+	if flag.Reason == FlagPurchaseVelocity || flag.Reason == FlagRouteVelocity {
+		level = "critical"
+	}
+	if flag.Alert {
+		emitAlert(ctx, level, AuditEvent{MSISDN: msisdn, SessionID: sessionID, Reason: flag.Reason, Detail: flag.Detail})
+	}
+	if flag.Reason == FlagMSISDNRate || flag.Reason == FlagSessionRate || flag.Reason == FlagPurchaseAttempts {
+		return T(locale, "error.rate")
+	}
+	return T(locale, "error.blocked")
+}
+
+// processPINMenu handles option 6. Without a PIN it sets one (new, confirm);
+// with a PIN it offers change (current, new, confirm) and reset by SMS code
+// (code, new, confirm). Earlier PINs and codes reach this masked, so each
+// step is checked as it is entered and the PIN store carries the change.
+func processPINMenu(ctx context.Context, session *Session, steps []string) string {
+	locale := session.Locale
+	msisdn := session.PhoneNumber
+
+	hasPIN, err := pins.HasPIN(ctx, msisdn)
+	if err != nil {
+		log.Printf("❌ Failed to load PIN for %s: %v", msisdn, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+
+	if !hasPIN {
+		session.State = "set_pin"
+		switch len(steps) {
+		case 0:
+			return "CON " + T(locale, "pin.new")
+		case 1:
+			return newPINScreen(ctx, session, steps[0])
+		}
+		return pinSavedScreen(locale, msisdn, pins.ConfirmNewPIN(ctx, msisdn, session.SessionID, steps[1]))
+	}
+
+	if len(steps) == 0 {
+		session.State = "pin_settings"
+		return "CON " + T(locale, "pin.menu")
+	}
+
+	switch steps[0] {
+	case "0":
+		return processUSSDMenu(ctx, session, "")
+
+	case "1":
+		session.State = "change_pin"
+		switch len(steps) {
+		case 1:
+			return "CON " + T(locale, "pin.current")
+		case 2:
+			check, err := pins.BeginChange(ctx, msisdn, session.SessionID, steps[1])
+			if screen, ok := pinCheckScreen(locale, check, err, ""); !ok {
+				return screen
+			}
+			return "CON " + T(locale, "pin.new")
+		case 3:
+			return newPINScreen(ctx, session, steps[2])
+		}
+		return pinSavedScreen(locale, msisdn, pins.ConfirmNewPIN(ctx, msisdn, session.SessionID, steps[3]))
+
+	case "2":
+		session.State = "reset_pin"
+		switch len(steps) {
+		case 1:
+			if err := pins.StartReset(ctx, msisdn, locale); err != nil {
+				log.Printf("❌ Failed to send PIN reset code to %s: %v", msisdn, err)
+				return "END " + T(locale, "error.unavailable")
+			}
+			return "CON " + T(locale, "otp.sent")
+		case 2:
+			err := pins.BeginReset(ctx, msisdn, session.SessionID, steps[1])
+			if err == ErrOTPInvalid {
+				return "END " + T(locale, "otp.wrong")
+			}
+			if err != nil {
+				log.Printf("❌ Failed to check PIN reset code for %s: %v", msisdn, err)
+				return "END " + T(locale, "error.unavailable")
+			}
+			return "CON " + T(locale, "pin.new")
+		case 3:
+			return newPINScreen(ctx, session, steps[2])
+		}
+		return pinSavedScreen(locale, msisdn, pins.ConfirmNewPIN(ctx, msisdn, session.SessionID, steps[3]))
+	}
+
+	return "END " + T(locale, "error.invalid")
+}
+
+// newPINScreen holds a new PIN and asks for it again
+func newPINScreen(ctx context.Context, session *Session, pin string) string {
+	err := pins.EnterNewPIN(ctx, session.PhoneNumber, session.SessionID, pin)
+	if err != nil {
+		return pinSavedScreen(session.Locale, session.PhoneNumber, err)
+	}
+	return "CON " + T(session.Locale, "pin.confirm")
+}
+
+// processTicketMenu shows a ticket and lets its owner cancel it or change
+// the travel date; steps start with the ticket number
+func processTicketMenu(ctx context.Context, session *Session, steps []string) string {
+	locale := session.Locale
+	session.State = "check_ticket"
+
+	ticket, err := ticketStore.Get(ctx, steps[0])
+	if err == ErrTicketNotFound {
+		return "END " + T(locale, "ticket.notfound", steps[0])
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load ticket %s: %v", steps[0], err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	details := T(locale, "ticket.details", ticket.TicketID, ticket.Route,
+		ticket.TravelDate, T(locale, "class."+ticket.Class), T(locale, "status."+ticket.Status))
+
+	// Only the owner of a ticket that has not yet departed can change it
+	if ticket.MSISDN != session.PhoneNumber || ticket.Status != TicketIssued ||
+		!time.Now().Before(ticket.DepartureTime()) {
+		return "END " + details
+	}
+	if len(steps) == 1 {
+		session.State = "manage_ticket"
+		return "CON " + details + "\n" + T(locale, "ticket.actions")
+	}
+	if steps[len(steps)-1] == "0" {
+		return processUSSDMenu(ctx, session, "")
+	}
+
+	switch steps[1] {
+	case "1":
+		return processCancelMenu(ctx, session, ticket, steps[2:])
+	case "2":
+		return processExchangeMenu(ctx, session, ticket, steps[2:])
+	}
+	return "END " + T(locale, "error.invalid")
+}
+
+// processCancelMenu quotes the refund for a ticket and cancels it once confirmed
+func processCancelMenu(ctx context.Context, session *Session, ticket *Ticket, steps []string) string {
+	locale := session.Locale
+	quote, err := cancellations.QuoteRefund(ticket)
+	if err != nil {
+		return ticketChangeScreen(locale, ticket.TicketID, err)
+	}
+
+	if len(steps) == 0 {
+		session.State = "confirm_cancel"
+		return "CON " + T(locale, "cancel.quote", ticket.TicketID, quote.Amount.String(), quote.Percent)
+	}
+	if steps[0] != "1" {
+		return "END " + T(locale, "error.invalid")
+	}
+	if screen, ok := confirmWithPIN(ctx, session, steps[1:]); !ok {
+		return screen
+	}
+
+	cancelled, err := cancellations.Cancel(ctx, ticket.TicketID, CancelRequest{
+		MSISDN:    session.PhoneNumber,
+		SessionID: session.SessionID,
+		Actor:     "passenger",
+	})
+	if err != nil {
+		return ticketChangeScreen(locale, ticket.TicketID, err)
+	}
+	return "END " + T(locale, "cancel.done", cancelled.TicketID, cancelled.Refund.String())
+}
+
+// processExchangeMenu offers the next few travel dates and moves the ticket
+// to the chosen one once the fare difference is confirmed
+func processExchangeMenu(ctx context.Context, session *Session, ticket *Ticket, steps []string) string {
+	locale := session.Locale
+	dates := exchangeDates(ticket)
+
+	if len(steps) == 0 {
+		session.State = "select_exchange_date"
+		screen := T(locale, "exchange.date")
+		for i, date := range dates {
+			screen += fmt.Sprintf("\n%d. %s", i+1, date)
+		}
+		return "CON " + screen + "\n0. " + T(locale, "menu.back")
+	}
+
+	choice, err := strconv.Atoi(steps[0])
+	if err != nil || choice < 1 || choice > len(dates) {
+		return "END " + T(locale, "error.invalid")
+	}
+	travelDate := dates[choice-1]
+	quote, err := cancellations.QuoteExchange(ctx, ticket, travelDate, false)
+	if err != nil {
+		return ticketChangeScreen(locale, ticket.TicketID, err)
+	}
+
+	if len(steps) == 1 {
+		session.State = "confirm_exchange"
+		if quote.Difference.IsNegative() {
+			return "CON " + T(locale, "exchange.refund", ticket.TicketID, travelDate, quote.Difference.Neg().String())
+		}
+		return "CON " + T(locale, "exchange.pay", ticket.TicketID, travelDate, quote.Difference.String())
+	}
+	if steps[1] != "1" {
+		return "END " + T(locale, "error.invalid")
+	}
+	if screen, ok := confirmWithPIN(ctx, session, steps[2:]); !ok {
+		return screen
+	}
+
+	replacement, err := cancellations.Exchange(ctx, ticket.TicketID, ExchangeRequest{
+		MSISDN:     session.PhoneNumber,
+		SessionID:  session.SessionID,
+		TravelDate: travelDate,
+		Actor:      "passenger",
+	})
+	if err != nil {
+		return ticketChangeScreen(locale, ticket.TicketID, err)
+	}
+	return "END " + T(locale, "exchange.done", ticket.TicketID, replacement.TicketID, travelDate)
+}
+
+// exchangeDates lists the next three travel dates other than the ticket's own
+func exchangeDates(ticket *Ticket) []string {
+	day := time.Now().In(operatorLoc)
+	dates := make([]string, 0, 3)
+	for len(dates) < 3 {
+		day = day.AddDate(0, 0, 1)
+		if date := day.Format("2006-01-02"); date != ticket.TravelDate {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// ticketChangeScreen explains why a cancellation or exchange was refused
+func ticketChangeScreen(locale, ticketID string, err error) string {
+	switch err {
+	case ErrTicketClosed, ErrTooLate, ErrNotTicketOwner:
+		return "END " + T(locale, "cancel.late", ticketID)
+	case ErrSoldOut:
+		return "END " + T(locale, "error.soldout")
+	}
+	log.Printf("❌ Failed to change ticket %s: %v", ticketID, err)
+	return "END " + T(locale, "error.unavailable")
+}
+
+// confirmWithPIN asks for the caller's PIN, when they have set one, before a
+// payment or ticket change. steps are the inputs after the confirm choice;
+// ok is true when the action can go ahead.
+func confirmWithPIN(ctx context.Context, session *Session, steps []string) (string, bool) {
+	locale := session.Locale
+	if len(steps) == 0 {
+		hasPIN, err := pins.HasPIN(ctx, session.PhoneNumber)
+		if err != nil {
+			log.Printf("❌ Failed to load PIN for %s: %v", session.PhoneNumber, err)
+			return "END " + T(locale, "error.unavailable"), false
+		}
+		if !hasPIN {
+			return "", true
+		}
+		session.State = "enter_pin"
+		return "CON " + T(locale, "pin.enter"), false
+	}
+
+	check, err := pins.Verify(ctx, session.PhoneNumber, session.SessionID, steps[len(steps)-1])
+	return pinCheckScreen(locale, check, err, "pin.enter")
+}
+
+// pinSavedScreen reports the outcome of storing a new PIN
+func pinSavedScreen(locale, msisdn string, err error) string {
+	switch err {
+	case ErrPINInvalid:
+		return "END " + T(locale, "pin.invalid")
+	case ErrPINMismatch:
+		return "END " + T(locale, "pin.mismatch")
+	case ErrPINChangeExpired:
+		return "END " + T(locale, "error.invalid")
+	}
+	if err != nil {
+		log.Printf("❌ Failed to save PIN for %s: %v", msisdn, err)
+		return "END " + T(locale, "error.unavailable")
+	}
+	return "END " + T(locale, "pin.saved")
+}
+
+// pinCheckScreen returns the screen for a rejected PIN, re-prompting with
+// retryKey when attempts remain. ok is true when the PIN was accepted.
+func pinCheckScreen(locale string, check PINCheck, err error, retryKey string) (string, bool) {
+	switch {
+	case err != nil:
+		log.Printf("❌ PIN check failed: %v", err)
+		return "END " + T(locale, "error.unavailable"), false
+	case check.OK:
+		return "", true
+	case check.RetryAfter > 0:
+		minutes := int((check.RetryAfter + time.Minute - 1) / time.Minute)
+		return "END " + Tn(locale, "pin.locked", minutes), false
+	case retryKey != "":
+		return "CON " + Tn(locale, "pin.wrong", check.AttemptsLeft) + "\n" + T(locale, retryKey), false
+	default:
+		return "END " + Tn(locale, "pin.wrong", check.AttemptsLeft), false
+	}
+}
+
+// redactInput masks PINs and reset codes in a menu path before it is
+// logged, kept in the session or exposed over the API
+func redactInput(text string) string {
+	parts := strings.Split(text, "*")
+	from := len(parts)
+	switch {
+	case parts[0] == "6":
+		from = 1
+	case strings.HasPrefix(text, "1*1*1*1*"):
+		from = 5 // 1*1*1*1*<type>*[3*<promo>*]<pay>*<pin>
+		if len(parts) > 5 && parts[5] == "3" {
+			from = 7 // Promo codes are not secret and later hops need them
+		}
+	case parts[0] == "2" && len(parts) > 3 && parts[2] == "1":
+		from = 4 // 2*<ticket>*1*1*<pin>
+	case parts[0] == "2" && len(parts) > 4 && parts[2] == "2":
+		from = 5 // 2*<ticket>*2*<date>*1*<pin>
+	}
+	for i := from; i < len(parts); i++ {
+		if len(parts[i]) >= 4 {
+			parts[i] = "####"
+		}
+	}
+	return strings.Join(parts, "*")
 }
 
 // handleHealth returns health status for OCC dashboard
 func handleHealth(w http.ResponseWriter, r *http.Request) {
-	sessionStore.mu.RLock()
-	activeSessions := len(sessionStore.sessions)
-	sessionStore.mu.RUnlock()
-
-	statsMu.RLock()
-	totalSessions := stats.TotalSessionsToday
-	successRate := 0.0
-	if stats.RequestCount > 0 {
-		successRate = (float64(stats.SuccessfulSessions) / float64(stats.TotalSessionsToday)) * 100
+	sessions, err := sessionStore.List(r.Context())
+	if err != nil {
+		log.Printf("⚠️  Failed to list sessions: %v", err)
 	}
-	avgResponseTime := int64(0)
-	if stats.RequestCount > 0 {
-		avgResponseTime = stats.TotalResponseTime / stats.RequestCount
+	activeSessions := len(sessions)
+	stats.ObserveActive(r.Context(), activeSessions)
+
+	today, err := stats.Today(r.Context())
+	if err != nil {
+		log.Printf("⚠️  Failed to load today's stats: %v", err)
+		today = &DailyStats{}
 	}
-	uptime := time.Since(stats.StartTime)
-	uptimePercent := 99.7 // Mock uptime
-	statsMu.RUnlock()
 
 	// Find last session time
 	lastSessionTime := time.Time{}
-	sessionStore.mu.RLock()
-	for _, session := range sessionStore.sessions {
+	for _, session := range sessions {
 		if session.StartTime.After(lastSessionTime) {
 			lastSessionTime = session.StartTime
 		}
 	}
-	sessionStore.mu.RUnlock()
 
 	// Get revenue metrics
-	liveRevenue := calculateLiveRevenue()
+	liveRevenue := calculateLiveRevenue(sessions)
+	confirmed, _ := liveRevenue.Confirmed.Convert(r.Context(), fxRates, reportingCurrency)
+	pending, _ := liveRevenue.Pending.Convert(r.Context(), fxRates, reportingCurrency)
 	
 	health := map[string]interface{}{
 		"connected":                true,
 		"active_sessions":          activeSessions,
-		"total_sessions_today":     totalSessions,
-		"success_rate":             successRate,
-		"average_response_time_ms": avgResponseTime,
-		"peak_sessions":            activeSessions, // Mock
-		"failed_sessions":          stats.FailedSessions,
+		"total_sessions_today":     today.Sessions,
+		"success_rate":             today.SuccessRate,
+		"average_response_time_ms": today.AverageResponseTime,
+		"peak_sessions":            today.PeakSessions,
+		"failed_sessions":          today.FailedSessions,
 		"last_session_time":        lastSessionTime,
-		"uptime_percent":           uptimePercent,
-		"uptime_duration":          uptime.String(),
+		"uptime_percent":           today.UptimePercent,
+		"uptime_duration":          stats.Uptime().String(),
 		"revenue": map[string]interface{}{
-			"confirmed_total": liveRevenue.ConfirmedTotal,
-			"pending_total":   liveRevenue.PendingTotal,
-			"revenue_today":   liveRevenue.RevenueToday,
-			"tickets_today":   liveRevenue.TicketsToday,
+			"currency":        reportingCurrency,
+			"confirmed_total": confirmed.Major(),
+			"pending_total":   pending.Major(),
+			"revenue_today":   today.Revenue.Major(),
+			"tickets_today":   today.TicketsSold,
 		},
 	}
 
@@ -357,197 +977,130 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
-// handleStats returns detailed statistics
+// handleStats returns today's statistics in the operator timezone
 func handleStats(w http.ResponseWriter, r *http.Request) {
-	statsMu.RLock()
-	defer statsMu.RUnlock()
+	today, err := stats.Today(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load stats", http.StatusServiceUnavailable)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone":        stats.loc.String(),
+		"today":           today,
+		"uptime_duration": stats.Uptime().String(),
+	})
 }
 
 // handleSessions returns active sessions
 func handleSessions(w http.ResponseWriter, r *http.Request) {
-	sessionStore.mu.RLock()
-	defer sessionStore.mu.RUnlock()
-
-	sessions := make([]*Session, 0, len(sessionStore.sessions))
-	for _, session := range sessionStore.sessions {
-		sessions = append(sessions, session)
+	sessions, err := sessionStore.List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load sessions", http.StatusServiceUnavailable)
+		return
+	}
+	for _, session := range sessions {
+		session.LastCommand = redactInput(session.LastCommand)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(sessions)
 }
 
-// SessionStore methods
-func (s *SessionStore) GetOrCreate(sessionID, phoneNumber string) *Session {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if session, exists := s.sessions[sessionID]; exists {
-		return session
-	}
-
-	session := &Session{
-		SessionID:   sessionID,
-		PhoneNumber: phoneNumber,
-		State:       "main_menu",
-		StartTime:   time.Now(),
-		Data:        make(map[string]interface{}),
-	}
-	s.sessions[sessionID] = session
-	return session
-}
-
-func (s *SessionStore) Remove(sessionID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.sessions, sessionID)
-}
-
-// cleanupSessions removes stale sessions (older than 5 minutes)
-func cleanupSessions() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		sessionStore.mu.Lock()
-		now := time.Now()
-		for id, session := range sessionStore.sessions {
-			if now.Sub(session.StartTime) > 5*time.Minute {
-				delete(sessionStore.sessions, id)
-				log.Printf("🧹 Cleaned up stale session: %s", id)
-			}
-		}
-		sessionStore.mu.Unlock()
-	}
-}
-
-// generateMockWallet generates a mock wallet address for demo
-func generateMockWallet() string {
-	return fmt.Sprintf("%x", time.Now().UnixNano())[:40]
-}
-
-// getTicketPrice returns the price for a route and class
-func getTicketPrice(route, class string) float64 {
-	if prices, ok := ticketPrices[route]; ok {
-		if price, ok := prices[class]; ok {
-			return price
-		}
+// shortAddress abbreviates a wallet address to fit on a USSD screen
+func shortAddress(address string) string {
+	if len(address) <= 14 {
+		return address
 	}
-	return 150.00 // Default price
+	return address[:8] + "..." + address[len(address)-4:]
 }
 
 // RevenueTracker methods
-func (rt *RevenueTracker) addPotentialRevenue(amount float64) {
+func (rt *RevenueTracker) addPotentialRevenue(amount Money) {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
-	rt.PendingTotal += amount
+	rt.Pending.Add(amount)
 }
 
-func (rt *RevenueTracker) removePotentialRevenue(amount float64) {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-	rt.PendingTotal -= amount
-	if rt.PendingTotal < 0 {
-		rt.PendingTotal = 0
+// removePending takes amount off pending revenue without going below zero
+func (rt *RevenueTracker) removePending(amount Money) {
+	rt.Pending.Add(amount.Neg())
+	if rt.Pending[amount.Currency] < 0 {
+		rt.Pending[amount.Currency] = 0
 	}
 }
 
-func (rt *RevenueTracker) confirmPurchase(amount float64) {
+func (rt *RevenueTracker) confirmPurchase(amount Money) {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
 	
-	// Remove from pending
-	rt.PendingTotal -= amount
-	if rt.PendingTotal < 0 {
-		rt.PendingTotal = 0
-	}
+	rt.removePending(amount)
 	
 	// Add to confirmed
-	rt.ConfirmedTotal += amount
-	rt.TotalRevenue += amount
-	rt.RevenueToday += amount
+	rt.Confirmed.Add(amount)
+	rt.Total.Add(amount)
 	rt.TicketsSold++
-	rt.TicketsToday++
 }
 
-func (rt *RevenueTracker) cancelPurchase(amount float64) {
+// adjustConfirmed applies a refund (negative) or extra charge (positive) to
+// confirmed revenue
+func (rt *RevenueTracker) adjustConfirmed(delta Money) {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
-	
-	// Remove from pending
-	rt.PendingTotal -= amount
-	if rt.PendingTotal < 0 {
-		rt.PendingTotal = 0
-	}
+	rt.Confirmed.Add(delta)
+	rt.Total.Add(delta)
 }
 
-func (rt *RevenueTracker) getMetrics() map[string]interface{} {
-	rt.mu.RLock()
-	defer rt.mu.RUnlock()
-	
-	// Calculate conversion rate
-	statsMu.RLock()
-	totalSessions := stats.TotalSessionsToday
-	successfulSessions := stats.SuccessfulSessions
-	statsMu.RUnlock()
-	
-	conversionRate := 0.0
-	if totalSessions > 0 {
-		conversionRate = (float64(successfulSessions) / float64(totalSessions)) * 100
-	}
-	
-	averageTicketPrice := 0.0
-	if rt.TicketsSold > 0 {
-		averageTicketPrice = rt.TotalRevenue / float64(rt.TicketsSold)
+func (rt *RevenueTracker) cancelPurchase(amount Money) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.removePending(amount)
+}
+
+// sessionPrice is the fare a session was last shown. Session data goes
+// through JSON in Redis, so the minor amount may come back as a float64.
+func sessionPrice(session *Session) (Money, bool) {
+	currency, _ := session.Data["currency"].(string)
+	if currency == "" {
+		return Money{}, false
 	}
-	
-	return map[string]interface{}{
-		"confirmed_total":      rt.ConfirmedTotal,
-		"pending_total":        rt.PendingTotal,
-		"total_revenue":        rt.TotalRevenue,
-		"revenue_today":        rt.RevenueToday,
-		"tickets_sold":         rt.TicketsSold,
-		"tickets_today":        rt.TicketsToday,
-		"conversion_rate":      conversionRate,
-		"average_ticket_price": averageTicketPrice,
+	switch amount := session.Data["price_minor"].(type) {
+	case int64:
+		return Money{Amount: amount, Currency: currency}, true
+	case float64:
+		return Money{Amount: int64(amount), Currency: currency}, true
 	}
+	return Money{}, false
 }
 
 // calculateLiveRevenue recalculates pending revenue from active sessions
-func calculateLiveRevenue() RevenueTracker {
-	sessionStore.mu.RLock()
-	defer sessionStore.mu.RUnlock()
-	
-	var pending float64
+func calculateLiveRevenue(sessions []*Session) RevenueTracker {
+	pending := MoneyTotals{}
 	
 	// Iterate through active sessions
-	for _, session := range sessionStore.sessions {
+	for _, session := range sessions {
 		// Check if session has reached payment confirmation stage
 		if session.State == "confirm_payment" || session.State == "payment_processing" {
-			if price, ok := session.Data["price"].(float64); ok {
-				pending += price
+			if price, ok := sessionPrice(session); ok {
+				pending.Add(price)
 			}
 		}
 	}
 	
 	revenueTracker.mu.Lock()
-	revenueTracker.PendingTotal = pending
+	revenueTracker.Pending = pending
 	revenueTracker.mu.Unlock()
 	
-	// Return current state
+	// Return a copy of the current state
 	revenueTracker.mu.RLock()
 	defer revenueTracker.mu.RUnlock()
 	
 	return RevenueTracker{
-		ConfirmedTotal: revenueTracker.ConfirmedTotal,
-		PendingTotal:   pending,
-		TotalRevenue:   revenueTracker.TotalRevenue,
-		RevenueToday:   revenueTracker.RevenueToday,
+		Confirmed:      revenueTracker.Confirmed.Clone(),
+		Pending:        pending.Clone(),
+		Total:          revenueTracker.Total.Clone(),
 		TicketsSold:    revenueTracker.TicketsSold,
-		TicketsToday:   revenueTracker.TicketsToday,
 		ConversionRate: revenueTracker.ConversionRate,
 	}
 }
@@ -555,25 +1108,54 @@ func calculateLiveRevenue() RevenueTracker {
 // handleRevenue returns revenue metrics
 func handleRevenue(w http.ResponseWriter, r *http.Request) {
 	// Recalculate live revenue
-	liveRevenue := calculateLiveRevenue()
+	sessions, err := sessionStore.List(r.Context())
+	if err != nil {
+		log.Printf("⚠️  Failed to list sessions: %v", err)
+	}
+	liveRevenue := calculateLiveRevenue(sessions)
+	today, err := stats.Today(r.Context())
+	if err != nil {
+		log.Printf("⚠️  Failed to load today's stats: %v", err)
+		today = &DailyStats{}
+	}
+	
+	ctx := r.Context()
+	confirmed, unconfirmed := liveRevenue.Confirmed.Convert(ctx, fxRates, reportingCurrency)
+	pending, unpending := liveRevenue.Pending.Convert(ctx, fxRates, reportingCurrency)
+	total, untotal := liveRevenue.Total.Convert(ctx, fxRates, reportingCurrency)
 	
+	// The plain totals are major units of the reporting currency, as the
+	// dashboard expects; the by-currency figures are exact
 	metrics := map[string]interface{}{
-		"confirmed_total":      liveRevenue.ConfirmedTotal,
-		"pending_total":        liveRevenue.PendingTotal,
-		"total_revenue":        liveRevenue.TotalRevenue,
-		"revenue_today":        liveRevenue.RevenueToday,
+		"currency":             reportingCurrency,
+		"confirmed_total":      confirmed.Major(),
+		"pending_total":        pending.Major(),
+		"total_revenue":        total.Major(),
+		"revenue_today":        today.Revenue.Major(),
 		"tickets_sold":         liveRevenue.TicketsSold,
-		"tickets_today":        liveRevenue.TicketsToday,
-		"conversion_rate":      liveRevenue.ConversionRate,
+		"tickets_today":        today.TicketsSold,
+		"conversion_rate":      today.SuccessRate,
 		"average_ticket_price": 0.0,
+		"by_currency": map[string]interface{}{
+			"confirmed": liveRevenue.Confirmed.List(),
+			"pending":   liveRevenue.Pending.List(),
+			"total":     liveRevenue.Total.List(),
+			"today":     today.RevenueByCurrency,
+		},
+		"unconverted": map[string]interface{}{
+			"confirmed": unconfirmed,
+			"pending":   unpending,
+			"total":     untotal,
+		},
 	}
 	
 	if liveRevenue.TicketsSold > 0 {
-		metrics["average_ticket_price"] = liveRevenue.TotalRevenue / float64(liveRevenue.TicketsSold)
+		average := Money{Amount: total.Amount / liveRevenue.TicketsSold, Currency: total.Currency}
+		metrics["average_ticket_price"] = average.Major()
 	}
 	
 	// Add breakdown by route
-	metrics["pricing"] = ticketPrices
+	metrics["pricing"] = fareEngine.rules.BaseFares
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metrics)
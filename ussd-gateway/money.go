@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCurrency prices routes without a configured currency
+const defaultCurrency = "ZAR"
+
+// Money errors
+var (
+	ErrNoRate           = errors.New("no exchange rate")
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+)
+
+// currencyInfo describes how a currency is written
+type currencyInfo struct {
+	Symbol string
+	Digits int  // Minor unit digits
+	Suffix bool // Symbol goes after the amount
+}
+
+// currencies are the currencies the railway sells and settles in
+var currencies = map[string]currencyInfo{
+	"ZAR":  {Symbol: "R", Digits: 2},
+	"ZMW":  {Symbol: "K", Digits: 2},
+	"TZS":  {Symbol: "TSh", Digits: 2},
+	"KES":  {Symbol: "KSh", Digits: 2},
+	"AFRC": {Symbol: "AFRC", Digits: 2, Suffix: true},
+}
+
+// validCurrency reports whether code is a currency we handle
+func validCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+func minorScale(currency string) float64 {
+	return math.Pow10(currencies[currency].Digits)
+}
+
+// Money is an amount in integer minor units (cents) of a currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney converts a major-unit amount from configuration, e.g. 150 or
+// 12.5, rounding to the nearest minor unit
+func NewMoney(major float64, currency string) Money {
+	return Money{Amount: int64(math.Round(major * minorScale(currency))), Currency: currency}
+}
+
+// Zero is no money in a currency
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// currencyOf lets the zero Money value combine with any currency. Other
+// currencies must be converted first, with convertMoney.
+func (m Money) currencyOf(other Money) (string, error) {
+	switch {
+	case m.Currency == "":
+		return other.Currency, nil
+	case other.Currency != "" && other.Currency != m.Currency:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return m.Currency, nil
+}
+
+// Add returns m+other, or ErrCurrencyMismatch unless both are in the same
+// currency
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.currencyOf(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: currency}, nil
+}
+
+// Sub returns m-other, or ErrCurrencyMismatch unless both are in the same
+// currency
+func (m Money) Sub(other Money) (Money, error) {
+	currency, err := m.currencyOf(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: currency}, nil
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Percent returns percent of m, rounded half away from zero
+func (m Money) Percent(percent float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * percent / 100)), Currency: m.Currency}
+}
+
+// IsZero reports whether m is nothing
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// IsPositive reports whether m is more than nothing
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+
+// IsNegative reports whether m is less than nothing
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Major is the amount in major units, for display and legacy JSON fields only
+func (m Money) Major() float64 {
+	return float64(m.Amount) / minorScale(m.Currency)
+}
+
+// digits renders the amount without a symbol, e.g. "150.00"
+func (m Money) digits() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	places := currencies[m.Currency].Digits
+	if places == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+	scale := int64(math.Pow10(places))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, places, amount%scale)
+}
+
+func (m Money) format(digits string) string {
+	info, ok := currencies[m.Currency]
+	switch {
+	case !ok:
+		return strings.TrimSpace(digits + " " + m.Currency)
+	case info.Suffix:
+		return digits + " " + info.Symbol
+	}
+	if strings.HasPrefix(digits, "-") {
+		return "-" + info.Symbol + digits[1:]
+	}
+	return info.Symbol + digits
+}
+
+// String formats m for people, e.g. "R150.00" or "50.00 AFRC"
+func (m Money) String() string {
+	return m.format(m.digits())
+}
+
+// Short formats m without zero cents, e.g. "R150", for tight USSD menus
+func (m Money) Short() string {
+	digits := m.digits()
+	if i := strings.IndexByte(digits, '.'); i >= 0 && strings.Trim(digits[i+1:], "0") == "" {
+		digits = digits[:i]
+	}
+	return m.format(digits)
+}
+
+type moneyJSON struct {
+	Minor    int64  `json:"minor"`
+	Currency string `json:"currency"`
+	Display  string `json:"display,omitempty"`
+}
+
+// MarshalJSON writes {"minor":15000,"currency":"ZAR","display":"R150.00"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Minor: m.Amount, Currency: m.Currency, Display: m.String()})
+}
+
+// UnmarshalJSON reads the object form written by MarshalJSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = Money{Amount: v.Minor, Currency: v.Currency}
+	return nil
+}
+
+// MoneyTotals sums amounts per currency
+type MoneyTotals map[string]int64
+
+// Add adds m to its currency's total
+func (t MoneyTotals) Add(m Money) {
+	if m.Currency == "" {
+		return
+	}
+	t[m.Currency] += m.Amount
+}
+
+// Clone copies the totals
+func (t MoneyTotals) Clone() MoneyTotals {
+	clone := make(MoneyTotals, len(t))
+	for currency, amount := range t {
+		clone[currency] = amount
+	}
+	return clone
+}
+
+// List returns the totals ordered by currency code
+func (t MoneyTotals) List() []Money {
+	list := make([]Money, 0, len(t))
+	for currency, amount := range t {
+		list = append(list, Money{Amount: amount, Currency: currency})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Currency < list[j].Currency })
+	return list
+}
+
+// Convert sums the totals in one currency. Totals with no rate are
+// returned as unconverted so they are reported rather than dropped.
+func (t MoneyTotals) Convert(ctx context.Context, fx FXProvider, to string) (Money, []Money) {
+	sum := Zero(to)
+	var unconverted []Money
+	for _, m := range t.List() {
+		converted, err := convertMoney(ctx, fx, m, to)
+		if err == nil {
+			converted, err = sum.Add(converted)
+		}
+		if err != nil {
+			unconverted = append(unconverted, m)
+			continue
+		}
+		sum = converted
+	}
+	return sum, unconverted
+}
+
+// FXProvider supplies exchange rates
+type FXProvider interface {
+	// Rate returns how many units of to one unit of from buys
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// convertMoney converts m into another currency at the provider's rate
+func convertMoney(ctx context.Context, fx FXProvider, m Money, to string) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	rate, err := fx.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(m.Major()*rate, to), nil
+}
+
+// FXRates is a rate table: Rates holds how many units of each currency one
+// unit of Base buys
+type FXRates struct {
+	Base  string             `json:"base"`
+	AsOf  *time.Time         `json:"as_of,omitempty"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+func (r *FXRates) Rate(ctx context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	rate := func(currency string) (float64, bool) {
+		if currency == r.Base {
+			return 1, true
+		}
+		value, ok := r.Rates[currency]
+		return value, ok && value > 0
+	}
+	fromRate, ok := rate(from)
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, from)
+	}
+	toRate, ok := rate(to)
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// FileFXProvider serves rates from a JSON file in the FXRates format,
+// reloading it when it changes. Finance can drop in the day's rates, and
+// tests can run against fixed rates offline.
+type FileFXProvider struct {
+	path    string
+	rates   *FXRates
+	modTime time.Time
+	mu      sync.Mutex
+}
+
+// NewFileFXProvider loads a rates file
+func NewFileFXProvider(path string) (*FileFXProvider, error) {
+	p := &FileFXProvider{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileFXProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	if p.rates != nil && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var rates FXRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return fmt.Errorf("invalid FX rates %s: %w", p.path, err)
+	}
+	if !validCurrency(rates.Base) {
+		return fmt.Errorf("invalid FX rates %s: unknown base %q", p.path, rates.Base)
+	}
+	p.rates = &rates
+	p.modTime = info.ModTime()
+	return nil
+}
+
+func (p *FileFXProvider) Rate(ctx context.Context, from, to string) (float64, error) {
+	p.mu.Lock()
+	if err := p.reload(); err != nil {
+		log.Printf("⚠️  Failed to reload FX rates, using the last ones loaded: %v", err)
+	}
+	rates := p.rates
+	p.mu.Unlock()
+	return rates.Rate(ctx, from, to)
+}
+
+// newFXProviderFromEnv loads rates from USSD_FX_RATES_FILE. Without a file
+// only same-currency amounts convert, so other currencies are reported
+// separately rather than at a made-up rate.
+func newFXProviderFromEnv() (FXProvider, error) {
+	path := os.Getenv("USSD_FX_RATES_FILE")
+	if path == "" {
+		return &FXRates{Base: defaultCurrency}, nil
+	}
+	return NewFileFXProvider(path)
+}
+
+// reportingCurrencyFromEnv reads USSD_REPORTING_CURRENCY (default ZAR)
+func reportingCurrencyFromEnv() (string, error) {
+	currency := strings.ToUpper(os.Getenv("USSD_REPORTING_CURRENCY"))
+	if currency == "" {
+		return defaultCurrency, nil
+	}
+	if !validCurrency(currency) {
+		return "", fmt.Errorf("unknown reporting currency %q", currency)
+	}
+	return currency, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrPassengerNotFound is returned when no passenger is registered for a
+// phone number or address
+var ErrPassengerNotFound = errors.New("passenger not found")
+
+// errPassengerExists is returned by Create when the MSISDN is already taken
+var errPassengerExists = errors.New("passenger already registered")
+
+// Passenger is a phone-number account with a custodial Polygon wallet
+type Passenger struct {
+	MSISDN       string    `json:"msisdn"`
+	Address      string    `json:"address"`
+	KeySource    string    `json:"key_source"`
+	KeyIndex     uint32    `json:"key_index"`
+	Name         string    `json:"name,omitempty"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// PassengerStore persists passenger profiles
+type PassengerStore interface {
+	Get(ctx context.Context, msisdn string) (*Passenger, error)
+	GetByAddress(ctx context.Context, address string) (*Passenger, error)
+	// Create stores a new passenger and fails if the MSISDN is registered
+	Create(ctx context.Context, passenger *Passenger) error
+	// NextKeyIndex reserves the next unused HD key index
+	NextKeyIndex(ctx context.Context) (uint32, error)
+}
+
+// newPassengerStore returns a Redis-backed store when a client is given and
+// an in-memory store otherwise
+func newPassengerStore(client *redis.Client) PassengerStore {
+	if client == nil {
+		return NewMemoryPassengerStore()
+	}
+	return &RedisPassengerStore{client: client, prefix: "ussd:passenger:"}
+}
+
+// PassengerRegistry maps MSISDNs to custodial wallets, creating the wallet on
+// first use
+type PassengerRegistry struct {
+	store PassengerStore
+	keys  WalletKeySource
+}
+
+// NewPassengerRegistry creates a registry over a store and key source
+func NewPassengerRegistry(store PassengerStore, keys WalletKeySource) *PassengerRegistry {
+	return &PassengerRegistry{store: store, keys: keys}
+}
+
+// Lookup returns the passenger registered for an MSISDN
+func (r *PassengerRegistry) Lookup(ctx context.Context, msisdn string) (*Passenger, error) {
+	return r.store.Get(ctx, msisdn)
+}
+
+// LookupAddress returns the passenger owning a wallet address
+func (r *PassengerRegistry) LookupAddress(ctx context.Context, address string) (*Passenger, error) {
+	return r.store.GetByAddress(ctx, address)
+}
+
+// Register returns the passenger for an MSISDN, allocating a wallet if the
+// number has not been seen before
+func (r *PassengerRegistry) Register(ctx context.Context, msisdn string) (*Passenger, error) {
+	passenger, err := r.store.Get(ctx, msisdn)
+	if err == nil {
+		return passenger, nil
+	}
+	if err != ErrPassengerNotFound {
+		return nil, err
+	}
+
+	index, err := r.store.NextKeyIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve key index: %w", err)
+	}
+	address, err := r.keys.NewAddress(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+
+	passenger = &Passenger{
+		MSISDN:       msisdn,
+		Address:      address.Hex(),
+		KeySource:    r.keys.Name(),
+		KeyIndex:     index,
+		RegisteredAt: time.Now(),
+	}
+	if err := r.store.Create(ctx, passenger); err == errPassengerExists {
+		// Registered concurrently by another request; the reserved index is skipped
+		return r.store.Get(ctx, msisdn)
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Printf("👤 Registered passenger %s with wallet %s", msisdn, passenger.Address)
+	return passenger, nil
+}
+
+// MemoryPassengerStore keeps passengers in process memory
+type MemoryPassengerStore struct {
+	byMSISDN  map[string]*Passenger
+	byAddress map[string]string
+	nextIndex uint32
+	mu        sync.RWMutex
+}
+
+// NewMemoryPassengerStore creates an in-process passenger store
+func NewMemoryPassengerStore() *MemoryPassengerStore {
+	return &MemoryPassengerStore{
+		byMSISDN:  make(map[string]*Passenger),
+		byAddress: make(map[string]string),
+	}
+}
+
+func (s *MemoryPassengerStore) Get(ctx context.Context, msisdn string) (*Passenger, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	passenger, ok := s.byMSISDN[msisdn]
+	if !ok {
+		return nil, ErrPassengerNotFound
+	}
+	copied := *passenger
+	return &copied, nil
+}
+
+func (s *MemoryPassengerStore) GetByAddress(ctx context.Context, address string) (*Passenger, error) {
+	s.mu.RLock()
+	msisdn, ok := s.byAddress[strings.ToLower(address)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrPassengerNotFound
+	}
+	return s.Get(ctx, msisdn)
+}
+
+func (s *MemoryPassengerStore) Create(ctx context.Context, passenger *Passenger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byMSISDN[passenger.MSISDN]; ok {
+		return errPassengerExists
+	}
+	copied := *passenger
+	s.byMSISDN[passenger.MSISDN] = &copied
+	s.byAddress[strings.ToLower(passenger.Address)] = passenger.MSISDN
+	return nil
+}
+
+func (s *MemoryPassengerStore) NextKeyIndex(ctx context.Context) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.nextIndex
+	s.nextIndex++
+	return index, nil
+}
+
+// RedisPassengerStore keeps passengers in Redis without expiry. Profiles are
+// JSON under {prefix}{msisdn} with an address index beside them.
+type RedisPassengerStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *RedisPassengerStore) Get(ctx context.Context, msisdn string) (*Passenger, error) {
+	raw, err := s.client.Get(ctx, s.prefix+msisdn).Bytes()
+	if err == redis.Nil {
+		return nil, ErrPassengerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passenger: %w", err)
+	}
+	var passenger Passenger
+	if err := json.Unmarshal(raw, &passenger); err != nil {
+		return nil, fmt.Errorf("corrupt passenger record: %w", err)
+	}
+	return &passenger, nil
+}
+
+func (s *RedisPassengerStore) GetByAddress(ctx context.Context, address string) (*Passenger, error) {
+	msisdn, err := s.client.Get(ctx, s.prefix+"address:"+strings.ToLower(address)).Result()
+	if err == redis.Nil {
+		return nil, ErrPassengerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up address: %w", err)
+	}
+	return s.Get(ctx, msisdn)
+}
+
+func (s *RedisPassengerStore) Create(ctx context.Context, passenger *Passenger) error {
+	data, err := json.Marshal(passenger)
+	if err != nil {
+		return err
+	}
+	created, err := s.client.SetNX(ctx, s.prefix+passenger.MSISDN, data, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store passenger: %w", err)
+	}
+	if !created {
+		return errPassengerExists
+	}
+	addressKey := s.prefix + "address:" + strings.ToLower(passenger.Address)
+	if err := s.client.Set(ctx, addressKey, passenger.MSISDN, 0).Err(); err != nil {
+		return fmt.Errorf("failed to index passenger address: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisPassengerStore) NextKeyIndex(ctx context.Context) (uint32, error) {
+	n, err := s.client.Incr(ctx, s.prefix+"next_index").Result()
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n - 1), nil
+}
+
+// handlePassengers looks up a passenger by ?msisdn= or ?address=
+func handlePassengers(w http.ResponseWriter, r *http.Request) {
+	var (
+		passenger *Passenger
+		err       error
+	)
+	query := r.URL.Query()
+	switch {
+	case query.Get("msisdn") != "":
+		passenger, err = passengers.Lookup(r.Context(), query.Get("msisdn"))
+	case query.Get("address") != "":
+		passenger, err = passengers.LookupAddress(r.Context(), query.Get("address"))
+	default:
+		http.Error(w, "msisdn or address is required", http.StatusBadRequest)
+		return
+	}
+
+	if err == ErrPassengerNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Passenger lookup failed: %v", err)
+		http.Error(w, "Failed to load passenger", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passenger)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// PaymentProvider moves money for ticket changes. Charge collects a fare
+// difference and Refund pays money back; both return the provider's
+// transaction reference.
+type PaymentProvider interface {
+	Charge(ctx context.Context, msisdn string, amount Money, reference string) (string, error)
+	Refund(ctx context.Context, msisdn string, amount Money, reference string) (string, error)
+}
+
+// ErrNoPaymentProvider is returned while no payment provider is integrated
+var ErrNoPaymentProvider = errors.New("no payment provider configured")
+
+// logPaymentProvider stands in until M-Pesa is integrated. It moves no
+// money, so it fails every transaction rather than report one that never
+// happened: refunds stay pending for an operator to settle and retry, and
+// exchanges that cost more are refused.
+type logPaymentProvider struct{}
+
+func (logPaymentProvider) Charge(ctx context.Context, msisdn string, amount Money, reference string) (string, error) {
+	log.Printf("⚠️  No payment provider configured: cannot charge %s to %s for %s", amount, msisdn, reference)
+	return "", ErrNoPaymentProvider
+}
+
+func (logPaymentProvider) Refund(ctx context.Context, msisdn string, amount Money, reference string) (string, error) {
+	log.Printf("⚠️  No payment provider configured: refund of %s to %s for %s left pending", amount, msisdn, reference)
+	return "", ErrNoPaymentProvider
+}
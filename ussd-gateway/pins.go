@@ -0,0 +1,565 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// maxPINAttempts wrong PINs in a row trigger a lockout
+	maxPINAttempts = 3
+	// pinLockoutBase is the first lockout; each further lockout doubles it
+	pinLockoutBase = time.Minute
+	pinLockoutMax  = 24 * time.Hour
+
+	otpTTL         = 5 * time.Minute
+	otpMaxAttempts = 3
+	// otpResendAfter throttles reset SMS so the menu cannot be used to spam a number
+	otpResendAfter = time.Minute
+
+	// pinChangeTTL bounds how long a session may take to enter and confirm
+	// a new PIN once it has proved it may change it
+	pinChangeTTL = sessionTTL
+)
+
+// argon2id parameters (OWASP minimum: 19 MiB, 2 passes)
+const (
+	pinHashTime    = 2
+	pinHashMemory  = 19 * 1024
+	pinHashThreads = 1
+	pinHashKeyLen  = 32
+)
+
+var (
+	// ErrPINNotSet is returned when a caller without a PIN tries to change it
+	ErrPINNotSet = errors.New("no PIN configured")
+	// ErrPINExists is returned when setting a first PIN over an existing one
+	ErrPINExists = errors.New("PIN already configured")
+	// ErrPINInvalid is returned for PINs that are malformed or too easy to guess
+	ErrPINInvalid = errors.New("PIN must be 4-6 digits and not trivially guessable")
+	// ErrOTPInvalid is returned for wrong, expired or exhausted reset codes
+	ErrOTPInvalid = errors.New("reset code is wrong or expired")
+	// ErrPINMismatch is returned when the confirmation differs from the new PIN
+	ErrPINMismatch = errors.New("PIN confirmation does not match")
+	// ErrPINChangeExpired is returned when a session confirms a new PIN it
+	// did not enter, or entered too long ago
+	ErrPINChangeExpired = errors.New("no PIN change in progress for this session")
+
+	// errPINStale means the record changed between hashing and recording
+	errPINStale = errors.New("PIN record changed while verifying")
+)
+
+// PINRecord is the PIN state stored per MSISDN
+type PINRecord struct {
+	Hash           string    `json:"hash"` // argon2id PHC string
+	FailedAttempts int       `json:"failed_attempts"`
+	Lockouts       int       `json:"lockouts"`
+	LockedUntil    time.Time `json:"locked_until"`
+	OTPHash        string    `json:"otp_hash,omitempty"`
+	OTPExpiresAt   time.Time `json:"otp_expires_at"`
+	OTPSentAt      time.Time `json:"otp_sent_at"`
+	OTPAttempts    int       `json:"otp_attempts"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// A PIN change in progress. The USSD menu is replayed from a session
+	// path with PINs and codes masked, so the new PIN waits here for its
+	// confirmation rather than in the session.
+	ChangeSession   string    `json:"change_session,omitempty"`
+	ChangeFrom      string    `json:"change_from,omitempty"` // Hash being replaced
+	ChangeHash      string    `json:"change_hash,omitempty"` // New PIN, unconfirmed
+	ChangeExpiresAt time.Time `json:"change_expires_at"`
+}
+
+// openChange lets sessionID set a new PIN in place of the current one
+func (r *PINRecord) openChange(sessionID string) {
+	r.ChangeSession = sessionID
+	r.ChangeFrom = r.Hash
+	r.ChangeHash = ""
+	r.ChangeExpiresAt = time.Now().Add(pinChangeTTL)
+}
+
+func (r *PINRecord) clearChange() {
+	r.ChangeSession, r.ChangeFrom, r.ChangeHash = "", "", ""
+	r.ChangeExpiresAt = time.Time{}
+}
+
+// changeOpen reports whether sessionID may still set a new PIN
+func (r *PINRecord) changeOpen(sessionID string) bool {
+	return r.ChangeSession == sessionID && r.ChangeFrom == r.Hash &&
+		time.Now().Before(r.ChangeExpiresAt)
+}
+
+// PINStore persists PIN records
+type PINStore interface {
+	Get(ctx context.Context, msisdn string) (*PINRecord, error)
+	// Update applies fn to the stored record (a zero record if none exists)
+	// atomically with respect to other updates for the same MSISDN
+	Update(ctx context.Context, msisdn string, fn func(record *PINRecord) error) error
+}
+
+// newPINStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newPINStore(client *redis.Client) PINStore {
+	if client == nil {
+		return NewMemoryPINStore()
+	}
+	return &RedisPINStore{client: client, prefix: "ussd:pin:"}
+}
+
+// PINCheck is the outcome of a PIN verification
+type PINCheck struct {
+	OK           bool
+	AttemptsLeft int
+	RetryAfter   time.Duration // Non-zero while locked out
+}
+
+// PINManager implements PIN set, change, verification and OTP reset
+type PINManager struct {
+	store PINStore
+	sms   SMSSender
+}
+
+// NewPINManager creates a PIN manager that sends reset codes through sms
+func NewPINManager(store PINStore, sms SMSSender) *PINManager {
+	return &PINManager{store: store, sms: sms}
+}
+
+// HasPIN reports whether a PIN is configured for an MSISDN
+func (m *PINManager) HasPIN(ctx context.Context, msisdn string) (bool, error) {
+	record, err := m.store.Get(ctx, msisdn)
+	if err != nil {
+		return false, err
+	}
+	return record != nil && record.Hash != "", nil
+}
+
+// SetPIN configures the first PIN for an MSISDN
+func (m *PINManager) SetPIN(ctx context.Context, msisdn, pin string) error {
+	hash, err := newPINHash(pin)
+	if err != nil {
+		return err
+	}
+	return m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		if record.Hash != "" {
+			return ErrPINExists
+		}
+		record.Hash = hash
+		return nil
+	})
+}
+
+// BeginChange verifies the current PIN and lets the session enter a new one
+func (m *PINManager) BeginChange(ctx context.Context, msisdn, sessionID, pin string) (PINCheck, error) {
+	check, verified, err := m.verify(ctx, msisdn, sessionID, pin)
+	if err != nil || !check.OK {
+		return check, err
+	}
+	return check, m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		if record.Hash != verified {
+			// Changed or reset since the PIN was checked
+			return ErrSessionConflict
+		}
+		record.openChange(sessionID)
+		return nil
+	})
+}
+
+// EnterNewPIN holds a new PIN until the session confirms it. A caller
+// without a PIN may always enter one; otherwise the session must first
+// pass BeginChange or BeginReset.
+func (m *PINManager) EnterNewPIN(ctx context.Context, msisdn, sessionID, pin string) error {
+	hash, err := newPINHash(pin)
+	if err != nil {
+		return err
+	}
+	return m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		// A first PIN needs no proof
+		if record.Hash == "" && !record.changeOpen(sessionID) {
+			record.openChange(sessionID)
+		}
+		if !record.changeOpen(sessionID) {
+			return ErrPINChangeExpired
+		}
+		record.ChangeHash = hash
+		return nil
+	})
+}
+
+// ConfirmNewPIN replaces the PIN with the one the session entered, provided
+// pin repeats it, and clears any lockout. A mismatch abandons the change.
+func (m *PINManager) ConfirmNewPIN(ctx context.Context, msisdn, sessionID, pin string) error {
+	record, err := m.store.Get(ctx, msisdn)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.ChangeHash == "" || !record.changeOpen(sessionID) {
+		return ErrPINChangeExpired
+	}
+	// argon2id is slow; hash outside the store's lock, as verify does
+	entered := record.ChangeHash
+	match := verifyPINHash(entered, pin)
+
+	err = m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		if record.ChangeHash != entered || !record.changeOpen(sessionID) {
+			return ErrPINChangeExpired
+		}
+		if !match {
+			record.clearChange()
+			return nil
+		}
+		record.Hash = entered
+		record.FailedAttempts = 0
+		record.Lockouts = 0
+		record.LockedUntil = time.Time{}
+		record.clearChange()
+		return nil
+	})
+	if err == nil && !match {
+		return ErrPINMismatch
+	}
+	return err
+}
+
+// Verify checks a PIN, counting failures and applying exponential lockout.
+// Every failure, including attempts made while locked, is audited.
+func (m *PINManager) Verify(ctx context.Context, msisdn, sessionID, pin string) (PINCheck, error) {
+	check, _, err := m.verify(ctx, msisdn, sessionID, pin)
+	return check, err
+}
+
+// verify checks a PIN and returns the hash it was checked against. argon2id
+// is slow by design, so the PIN is hashed before the store's lock is taken
+// and only the outcome is recorded under it, provided the hash is unchanged.
+func (m *PINManager) verify(ctx context.Context, msisdn, sessionID, pin string) (PINCheck, string, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		record, err := m.store.Get(ctx, msisdn)
+		if err != nil {
+			return PINCheck{}, "", err
+		}
+		if record == nil || record.Hash == "" {
+			return PINCheck{}, "", ErrPINNotSet
+		}
+		// Locked callers are refused without hashing
+		hashed, match := false, false
+		if !time.Now().Before(record.LockedUntil) {
+			hashed, match = true, verifyPINHash(record.Hash, pin)
+		}
+		check, err := m.recordVerify(ctx, msisdn, sessionID, record.Hash, hashed, match)
+		if err != errPINStale {
+			return check, record.Hash, err
+		}
+	}
+	return PINCheck{}, "", ErrSessionConflict
+}
+
+// recordVerify applies the outcome of checking a PIN against hash
+func (m *PINManager) recordVerify(ctx context.Context, msisdn, sessionID, hash string, hashed, match bool) (PINCheck, error) {
+	var (
+		check PINCheck
+		event *AuditEvent
+	)
+	err := m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		check, event = PINCheck{}, nil
+		if record.Hash == "" {
+			return ErrPINNotSet
+		}
+
+		now := time.Now()
+		if now.Before(record.LockedUntil) {
+			check.RetryAfter = record.LockedUntil.Sub(now)
+			lockedUntil := record.LockedUntil
+			event = &AuditEvent{Action: "pin_verify", Reason: "locked", LockedUntil: &lockedUntil}
+			return nil
+		}
+		if !hashed || record.Hash != hash {
+			return errPINStale
+		}
+
+		if match {
+			record.FailedAttempts = 0
+			record.Lockouts = 0
+			check.OK = true
+			return nil
+		}
+
+		record.FailedAttempts++
+		event = &AuditEvent{Action: "pin_verify", Reason: "wrong_pin", Attempts: record.FailedAttempts}
+		if record.FailedAttempts >= maxPINAttempts {
+			lockout := pinLockoutBase << record.Lockouts
+			if lockout > pinLockoutMax || lockout <= 0 {
+				lockout = pinLockoutMax
+			}
+			record.Lockouts++
+			record.FailedAttempts = 0
+			record.LockedUntil = now.Add(lockout)
+			check.RetryAfter = lockout
+			lockedUntil := record.LockedUntil
+			event.LockedUntil = &lockedUntil
+			return nil
+		}
+		check.AttemptsLeft = maxPINAttempts - record.FailedAttempts
+		return nil
+	})
+
+	if event != nil {
+		event.MSISDN = msisdn
+		event.SessionID = sessionID
+		recordAudit(ctx, *event)
+	}
+	return check, err
+}
+
+// StartReset sends a one-time reset code by SMS. Repeat requests within
+// otpResendAfter reuse the code already sent.
+func (m *PINManager) StartReset(ctx context.Context, msisdn, locale string) error {
+	code, err := newOTP()
+	if err != nil {
+		return err
+	}
+
+	send := false
+	err = m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		now := time.Now()
+		send = false
+		if record.OTPHash != "" && now.Sub(record.OTPSentAt) < otpResendAfter {
+			return nil
+		}
+		record.OTPHash = hashOTP(msisdn, code)
+		record.OTPExpiresAt = now.Add(otpTTL)
+		record.OTPSentAt = now
+		record.OTPAttempts = 0
+		send = true
+		return nil
+	})
+	if err != nil || !send {
+		return err
+	}
+	return m.sms.Send(ctx, msisdn, "otp", T(locale, "sms.otp", code))
+}
+
+// BeginReset consumes a reset code and lets the session enter a new PIN
+func (m *PINManager) BeginReset(ctx context.Context, msisdn, sessionID, code string) error {
+	return m.useOTP(ctx, msisdn, sessionID, code, func(record *PINRecord) {
+		record.OTPHash = ""
+		record.openChange(sessionID)
+	})
+}
+
+func (m *PINManager) useOTP(ctx context.Context, msisdn, sessionID, code string, onSuccess func(*PINRecord)) error {
+	var event *AuditEvent
+	err := m.store.Update(ctx, msisdn, func(record *PINRecord) error {
+		event = nil
+		if record.OTPHash == "" || time.Now().After(record.OTPExpiresAt) {
+			event = &AuditEvent{Action: "otp_verify", Reason: "expired_otp"}
+			return ErrOTPInvalid
+		}
+		if subtle.ConstantTimeCompare([]byte(record.OTPHash), []byte(hashOTP(msisdn, code))) != 1 {
+			record.OTPAttempts++
+			event = &AuditEvent{Action: "otp_verify", Reason: "wrong_otp", Attempts: record.OTPAttempts}
+			if record.OTPAttempts >= otpMaxAttempts {
+				record.OTPHash = ""
+			}
+			// Persist the attempt count; the caller still sees a failure
+			return nil
+		}
+		if onSuccess != nil {
+			onSuccess(record)
+		}
+		return nil
+	})
+
+	if event != nil {
+		event.MSISDN = msisdn
+		event.SessionID = sessionID
+		recordAudit(ctx, *event)
+		if err == nil {
+			err = ErrOTPInvalid
+		}
+	}
+	return err
+}
+
+// validatePIN rejects PINs that are not 4-6 digits, repeat one digit or run
+// in sequence (1234, 9876)
+func validatePIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 6 {
+		return ErrPINInvalid
+	}
+	same, ascending, descending := true, true, true
+	for i := 0; i < len(pin); i++ {
+		if pin[i] < '0' || pin[i] > '9' {
+			return ErrPINInvalid
+		}
+		if i == 0 {
+			continue
+		}
+		same = same && pin[i] == pin[i-1]
+		ascending = ascending && pin[i] == pin[i-1]+1
+		descending = descending && pin[i] == pin[i-1]-1
+	}
+	if same || ascending || descending {
+		return ErrPINInvalid
+	}
+	return nil
+}
+
+// newPINHash validates a PIN and returns its salted argon2id hash
+func newPINHash(pin string) (string, error) {
+	if err := validatePIN(pin); err != nil {
+		return "", err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pin), salt, pinHashTime, pinHashMemory, pinHashThreads, pinHashKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		pinHashMemory, pinHashTime, pinHashThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPINHash checks a PIN against a PHC string, honouring the parameters
+// it was hashed with
+func verifyPINHash(encoded, pin string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+	var memory, passes uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &passes, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(pin), salt, passes, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// newOTP returns a 6-digit one-time code
+func newOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOTP binds a code to its MSISDN; codes are short-lived and attempt
+// limited, so a fast hash is enough
+func hashOTP(msisdn, code string) string {
+	sum := sha256.Sum256([]byte(msisdn + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryPINStore keeps PIN records in process memory
+type MemoryPINStore struct {
+	records map[string]PINRecord
+	mu      sync.Mutex
+}
+
+// NewMemoryPINStore creates an in-process PIN store
+func NewMemoryPINStore() *MemoryPINStore {
+	return &MemoryPINStore{records: make(map[string]PINRecord)}
+}
+
+func (s *MemoryPINStore) Get(ctx context.Context, msisdn string) (*PINRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[msisdn]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (s *MemoryPINStore) Update(ctx context.Context, msisdn string, fn func(record *PINRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[msisdn]
+	if err := fn(&record); err != nil {
+		return err
+	}
+	record.UpdatedAt = time.Now()
+	s.records[msisdn] = record
+	return nil
+}
+
+// RedisPINStore keeps PIN records as JSON under {prefix}{msisdn}
+type RedisPINStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *RedisPINStore) Get(ctx context.Context, msisdn string) (*PINRecord, error) {
+	raw, err := s.client.Get(ctx, s.prefix+msisdn).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PIN record: %w", err)
+	}
+	var record PINRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, fmt.Errorf("corrupt PIN record: %w", err)
+	}
+	return &record, nil
+}
+
+func (s *RedisPINStore) Update(ctx context.Context, msisdn string, fn func(record *PINRecord) error) error {
+	key := s.prefix + msisdn
+	update := func(tx *redis.Tx) error {
+		var record PINRecord
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return fmt.Errorf("corrupt PIN record: %w", err)
+			}
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+		record.UpdatedAt = time.Now()
+		data, err := json.Marshal(&record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}
+
+	// Retry a few times if another request changed the record under us
+	for attempt := 0; attempt < 5; attempt++ {
+		err := s.client.Watch(ctx, update, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrSessionConflict
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// resetOnce changes the PIN behind the caller's back just before its first
+// Update, as a reset on another replica would
+type resetOnce struct {
+	PINStore
+	hash string
+	done bool
+}
+
+func (s *resetOnce) Update(ctx context.Context, msisdn string, fn func(record *PINRecord) error) error {
+	if !s.done {
+		s.done = true
+		err := s.PINStore.Update(ctx, msisdn, func(record *PINRecord) error {
+			record.Hash = s.hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.PINStore.Update(ctx, msisdn, fn)
+}
+
+func TestPINVerifyAndLockout(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	pins := NewPINManager(NewMemoryPINStore(), nil)
+	if err := pins.SetPIN(ctx, "+260971234567", "2580"); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := pins.Verify(ctx, "+260971234567", "s1", "2580")
+	if err != nil || !check.OK {
+		t.Fatalf("right PIN = %+v, %v", check, err)
+	}
+	for left := maxPINAttempts - 1; left > 0; left-- {
+		check, err := pins.Verify(ctx, "+260971234567", "s1", "1357")
+		if err != nil || check.OK || check.AttemptsLeft != left {
+			t.Fatalf("wrong PIN = %+v, %v, want %d attempts left", check, err, left)
+		}
+	}
+	check, err = pins.Verify(ctx, "+260971234567", "s1", "1357")
+	if err != nil || check.RetryAfter != pinLockoutBase {
+		t.Fatalf("last wrong PIN = %+v, %v, want a %s lockout", check, err, pinLockoutBase)
+	}
+	check, err = pins.Verify(ctx, "+260971234567", "s1", "2580")
+	if err != nil || check.OK || check.RetryAfter <= 0 {
+		t.Errorf("right PIN while locked = %+v, %v, want refused", check, err)
+	}
+}
+
+func TestPINChange(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	pins := NewPINManager(NewMemoryPINStore(), nil)
+	if err := pins.SetPIN(ctx, "+260971234567", "2580"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pins.EnterNewPIN(ctx, "+260971234567", "s1", "4826"); err != ErrPINChangeExpired {
+		t.Fatalf("new PIN before the current one = %v, want ErrPINChangeExpired", err)
+	}
+	check, err := pins.BeginChange(ctx, "+260971234567", "s1", "2580")
+	if err != nil || !check.OK {
+		t.Fatalf("BeginChange = %+v, %v", check, err)
+	}
+	if err := pins.EnterNewPIN(ctx, "+260971234567", "s2", "4826"); err != ErrPINChangeExpired {
+		t.Errorf("new PIN from another session = %v, want ErrPINChangeExpired", err)
+	}
+	if err := pins.EnterNewPIN(ctx, "+260971234567", "s1", "4826"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.ConfirmNewPIN(ctx, "+260971234567", "s1", "4826"); err != nil {
+		t.Fatalf("ConfirmNewPIN = %v", err)
+	}
+	if check, _ := pins.Verify(ctx, "+260971234567", "s1", "2580"); check.OK {
+		t.Error("old PIN still accepted")
+	}
+	if check, _ := pins.Verify(ctx, "+260971234567", "s1", "4826"); !check.OK {
+		t.Error("new PIN refused")
+	}
+}
+
+func TestPINVerifyRechecksAChangedHash(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	store := NewMemoryPINStore()
+	if err := NewPINManager(store, nil).SetPIN(ctx, "+260971234567", "2580"); err != nil {
+		t.Fatal(err)
+	}
+	reset, err := newPINHash("4826")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old PIN matched the hash that was read, but not the one stored
+	// when the outcome is recorded
+	pins := NewPINManager(&resetOnce{PINStore: store, hash: reset}, nil)
+	check, err := pins.Verify(ctx, "+260971234567", "s1", "2580")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.OK {
+		t.Fatal("PIN accepted against a hash that was replaced")
+	}
+	if check.AttemptsLeft != maxPINAttempts-1 {
+		t.Errorf("attempts left = %d, want %d", check.AttemptsLeft, maxPINAttempts-1)
+	}
+}
+
+func TestCheckCancelPIN(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	pins = NewPINManager(NewMemoryPINStore(), nil)
+
+	// Passengers without a PIN confirm with YES, as on USSD
+	if err := checkCancelPIN(ctx, "+260971234567", ""); err != nil {
+		t.Fatalf("no PIN set: %v", err)
+	}
+
+	if err := pins.SetPIN(ctx, "+260971234567", "2580"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCancelPIN(ctx, "+260971234567", ""); err != ErrCancelPINRequired {
+		t.Errorf("without a PIN = %v, want ErrCancelPINRequired", err)
+	}
+	if err := checkCancelPIN(ctx, "+260971234567", "2580"); err != nil {
+		t.Errorf("right PIN = %v", err)
+	}
+	for i := 0; i < maxPINAttempts-1; i++ {
+		if err := checkCancelPIN(ctx, "+260971234567", "1357"); err != ErrCancelPINWrong {
+			t.Fatalf("wrong PIN = %v, want ErrCancelPINWrong", err)
+		}
+	}
+	if err := checkCancelPIN(ctx, "+260971234567", "1357"); err != ErrCancelPINLocked {
+		t.Errorf("last wrong PIN = %v, want ErrCancelPINLocked", err)
+	}
+	if err := checkCancelPIN(ctx, "+260971234567", "2580"); err != ErrCancelPINLocked {
+		t.Errorf("right PIN while locked = %v, want ErrCancelPINLocked", err)
+	}
+}
+
+// hop sends one input the way a provider without cumulative paths does,
+// replaying the session's masked path
+func hop(ctx context.Context, session *Session, input string) string {
+	text := input
+	if session.LastCommand != "" {
+		text = session.LastCommand + "*" + input
+	}
+	session.LastCommand = redactInput(text)
+	return processUSSDMenu(ctx, session, text)
+}
+
+func TestPINMenuFromMaskedPath(t *testing.T) {
+	auditLog = NewMemoryAuditLog(100)
+	ctx := context.Background()
+	pins = NewPINManager(NewMemoryPINStore(), nil)
+	session := newSession("s1", "+260971234567")
+	session.Locale = LocaleEnglish
+
+	for _, input := range []string{"6", "2580"} {
+		hop(ctx, session, input)
+	}
+	if screen := hop(ctx, session, "2580"); screen != "END "+T(LocaleEnglish, "pin.saved") {
+		t.Fatalf("set PIN ended with %q", screen)
+	}
+	if session.LastCommand != "6*####*####" {
+		t.Errorf("session kept %q, want the PINs masked", session.LastCommand)
+	}
+
+	session = newSession("s2", "+260971234567")
+	session.Locale = LocaleEnglish
+	for _, input := range []string{"6", "1", "2580", "4826"} {
+		hop(ctx, session, input)
+	}
+	if screen := hop(ctx, session, "4862"); screen != "END "+T(LocaleEnglish, "pin.mismatch") {
+		t.Fatalf("mismatched confirmation ended with %q", screen)
+	}
+	if check, _ := pins.Verify(ctx, "+260971234567", "s2", "2580"); !check.OK {
+		t.Error("a mismatched change replaced the PIN")
+	}
+
+	session = newSession("s3", "+260971234567")
+	session.Locale = LocaleEnglish
+	for _, input := range []string{"6", "1", "2580", "4826"} {
+		hop(ctx, session, input)
+	}
+	if screen := hop(ctx, session, "4826"); screen != "END "+T(LocaleEnglish, "pin.saved") {
+		t.Fatalf("change PIN ended with %q", screen)
+	}
+	if check, _ := pins.Verify(ctx, "+260971234567", "s3", "4826"); !check.OK {
+		t.Error("new PIN refused after the change")
+	}
+}
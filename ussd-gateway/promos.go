@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Promo code errors
+var (
+	ErrPromoNotFound  = errors.New("promo code not found")
+	ErrPromoExhausted = errors.New("promo code usage limit reached")
+)
+
+// PromoCode discounts a fare by a percentage or a fixed amount
+type PromoCode struct {
+	Code        string     `json:"code"`
+	Description string     `json:"description,omitempty"`
+	Percent     float64    `json:"percent,omitempty"`
+	Amount      float64    `json:"amount,omitempty"`   // Major units of Currency
+	Currency    string     `json:"currency,omitempty"` // For Amount; defaults to ZAR
+	Routes      []string   `json:"routes,omitempty"`   // Empty means every route
+	ValidFrom   *time.Time `json:"valid_from,omitempty"`
+	ValidUntil  *time.Time `json:"valid_until,omitempty"`
+	// Usage limits; zero means unlimited
+	MaxUses         int `json:"max_uses,omitempty"`
+	MaxPerPassenger int `json:"max_per_passenger,omitempty"`
+	Uses            int `json:"uses"` // Filled in on read
+}
+
+// AmountOff is the fixed discount of an amount code
+func (p *PromoCode) AmountOff() Money {
+	currency := p.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return NewMoney(p.Amount, currency)
+}
+
+// PromoUsage is how often a code has been redeemed, overall and by one number
+type PromoUsage struct {
+	Total     int
+	Passenger int
+}
+
+// PromoStore holds promo codes and counts their redemptions
+type PromoStore interface {
+	Get(ctx context.Context, code string) (*PromoCode, error)
+	Put(ctx context.Context, promo *PromoCode) error
+	Delete(ctx context.Context, code string) error
+	List(ctx context.Context) ([]*PromoCode, error)
+	Usage(ctx context.Context, code, msisdn string) (PromoUsage, error)
+	// Redeem records one use by msisdn, failing with ErrPromoExhausted when
+	// either limit has been reached
+	Redeem(ctx context.Context, promo *PromoCode, msisdn string) error
+	// Release gives back a use when the purchase did not go through
+	Release(ctx context.Context, code, msisdn string) error
+}
+
+// newPromoStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newPromoStore(client *redis.Client) PromoStore {
+	if client == nil {
+		return NewMemoryPromoStore()
+	}
+	return &RedisPromoStore{client: client, prefix: "ussd:promo:"}
+}
+
+// normalizePromoCode makes codes case-insensitive
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// MemoryPromoStore keeps promo codes in process memory
+type MemoryPromoStore struct {
+	promos map[string]PromoCode
+	uses   map[string]map[string]int // code -> msisdn -> uses
+	mu     sync.Mutex
+}
+
+// NewMemoryPromoStore creates an in-process promo store
+func NewMemoryPromoStore() *MemoryPromoStore {
+	return &MemoryPromoStore{
+		promos: make(map[string]PromoCode),
+		uses:   make(map[string]map[string]int),
+	}
+}
+
+func (s *MemoryPromoStore) total(code string) int {
+	total := 0
+	for _, n := range s.uses[code] {
+		total += n
+	}
+	return total
+}
+
+func (s *MemoryPromoStore) Get(ctx context.Context, code string) (*PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	promo, ok := s.promos[code]
+	if !ok {
+		return nil, ErrPromoNotFound
+	}
+	promo.Uses = s.total(code)
+	return &promo, nil
+}
+
+func (s *MemoryPromoStore) Put(ctx context.Context, promo *PromoCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.promos[promo.Code] = *promo
+	return nil
+}
+
+func (s *MemoryPromoStore) Delete(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.promos, code)
+	delete(s.uses, code)
+	return nil
+}
+
+func (s *MemoryPromoStore) List(ctx context.Context) ([]*PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	promos := make([]*PromoCode, 0, len(s.promos))
+	for code, promo := range s.promos {
+		promo.Uses = s.total(code)
+		promos = append(promos, &promo)
+	}
+	sort.Slice(promos, func(i, j int) bool { return promos[i].Code < promos[j].Code })
+	return promos, nil
+}
+
+func (s *MemoryPromoStore) Usage(ctx context.Context, code, msisdn string) (PromoUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return PromoUsage{Total: s.total(code), Passenger: s.uses[code][msisdn]}, nil
+}
+
+func (s *MemoryPromoStore) Redeem(ctx context.Context, promo *PromoCode, msisdn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if promo.MaxUses > 0 && s.total(promo.Code) >= promo.MaxUses {
+		return ErrPromoExhausted
+	}
+	if promo.MaxPerPassenger > 0 && s.uses[promo.Code][msisdn] >= promo.MaxPerPassenger {
+		return ErrPromoExhausted
+	}
+	if s.uses[promo.Code] == nil {
+		s.uses[promo.Code] = make(map[string]int)
+	}
+	s.uses[promo.Code][msisdn]++
+	return nil
+}
+
+func (s *MemoryPromoStore) Release(ctx context.Context, code, msisdn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uses[code][msisdn] > 0 {
+		s.uses[code][msisdn]--
+	}
+	return nil
+}
+
+// RedisPromoStore keeps codes as JSON in one hash and usage in a hash per
+// code holding a "total" field and a count per MSISDN
+type RedisPromoStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// redeemPromoScript checks both limits and counts the use in one step
+var redeemPromoScript = redis.NewScript(`
+local total = tonumber(redis.call('HGET', KEYS[1], 'total') or '0')
+local mine = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > 0 and total >= tonumber(ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 and mine >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], 'total', 1)
+redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+return 1
+`)
+
+// releasePromoScript undoes one use without going below zero
+var releasePromoScript = redis.NewScript(`
+if tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0') > 0 then
+	redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+	redis.call('HINCRBY', KEYS[1], 'total', -1)
+end
+return 1
+`)
+
+func (s *RedisPromoStore) usesKey(code string) string {
+	return s.prefix + "uses:" + code
+}
+
+func (s *RedisPromoStore) Get(ctx context.Context, code string) (*PromoCode, error) {
+	raw, err := s.client.HGet(ctx, s.prefix+"codes", code).Bytes()
+	if err == redis.Nil {
+		return nil, ErrPromoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load promo code: %w", err)
+	}
+	var promo PromoCode
+	if err := json.Unmarshal(raw, &promo); err != nil {
+		return nil, fmt.Errorf("corrupt promo code: %w", err)
+	}
+	promo.Uses, _ = s.client.HGet(ctx, s.usesKey(code), "total").Int()
+	return &promo, nil
+}
+
+func (s *RedisPromoStore) Put(ctx context.Context, promo *PromoCode) error {
+	data, err := json.Marshal(promo)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.prefix+"codes", promo.Code, data).Err()
+}
+
+func (s *RedisPromoStore) Delete(ctx context.Context, code string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.prefix+"codes", code)
+		pipe.Del(ctx, s.usesKey(code))
+		return nil
+	})
+	return err
+}
+
+func (s *RedisPromoStore) List(ctx context.Context) ([]*PromoCode, error) {
+	values, err := s.client.HGetAll(ctx, s.prefix+"codes").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promo codes: %w", err)
+	}
+	promos := make([]*PromoCode, 0, len(values))
+	for code, raw := range values {
+		var promo PromoCode
+		if err := json.Unmarshal([]byte(raw), &promo); err != nil {
+			continue
+		}
+		promo.Uses, _ = s.client.HGet(ctx, s.usesKey(code), "total").Int()
+		promos = append(promos, &promo)
+	}
+	sort.Slice(promos, func(i, j int) bool { return promos[i].Code < promos[j].Code })
+	return promos, nil
+}
+
+func (s *RedisPromoStore) Usage(ctx context.Context, code, msisdn string) (PromoUsage, error) {
+	values, err := s.client.HMGet(ctx, s.usesKey(code), "total", msisdn).Result()
+	if err != nil {
+		return PromoUsage{}, err
+	}
+	var usage PromoUsage
+	if v, ok := values[0].(string); ok {
+		fmt.Sscan(v, &usage.Total)
+	}
+	if v, ok := values[1].(string); ok {
+		fmt.Sscan(v, &usage.Passenger)
+	}
+	return usage, nil
+}
+
+func (s *RedisPromoStore) Redeem(ctx context.Context, promo *PromoCode, msisdn string) error {
+	redeemed, err := redeemPromoScript.Run(ctx, s.client, []string{s.usesKey(promo.Code)},
+		msisdn, promo.MaxUses, promo.MaxPerPassenger).Int()
+	if err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	if redeemed == 0 {
+		return ErrPromoExhausted
+	}
+	return nil
+}
+
+func (s *RedisPromoStore) Release(ctx context.Context, code, msisdn string) error {
+	return releasePromoScript.Run(ctx, s.client, []string{s.usesKey(code)}, msisdn).Err()
+}
+
+// handlePromos manages promo codes:
+// GET lists codes with their use counts, POST adds or replaces a code,
+// DELETE ?code= removes one
+func handlePromos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		promos, err := fareEngine.promos.List(ctx)
+		if err != nil {
+			http.Error(w, "Failed to load promo codes", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(promos)
+
+	case http.MethodPost:
+		var promo PromoCode
+		if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		promo.Code = normalizePromoCode(promo.Code)
+		promo.Currency = strings.ToUpper(promo.Currency)
+		switch {
+		case promo.Code == "":
+			http.Error(w, "code is required", http.StatusBadRequest)
+			return
+		case (promo.Percent > 0) == (promo.Amount > 0):
+			http.Error(w, "exactly one of percent or amount is required", http.StatusBadRequest)
+			return
+		case promo.Percent > 100 || promo.MaxUses < 0 || promo.MaxPerPassenger < 0:
+			http.Error(w, "percent must be at most 100 and limits cannot be negative", http.StatusBadRequest)
+			return
+		case promo.Currency != "" && !validCurrency(promo.Currency):
+			http.Error(w, "unknown currency", http.StatusBadRequest)
+			return
+		}
+		promo.Uses = 0
+		if err := fareEngine.promos.Put(ctx, &promo); err != nil {
+			http.Error(w, "Failed to save promo code", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("🏷️  Promo code %s saved", promo.Code)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(promo)
+
+	case http.MethodDelete:
+		code := normalizePromoCode(r.URL.Query().Get("code"))
+		if code == "" {
+			http.Error(w, "code is required", http.StatusBadRequest)
+			return
+		}
+		if err := fareEngine.promos.Delete(ctx, code); err != nil {
+			http.Error(w, "Failed to delete promo code", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("🏷️  Promo code %s deleted", code)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
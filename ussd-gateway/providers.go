@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// USSDRequest is a provider-neutral view of an inbound USSD hop
+type USSDRequest struct {
+	SessionID   string
+	PhoneNumber string
+	ServiceCode string
+	Text        string // Full menu path, e.g. "1*1*2"
+	Input       string // Latest subscriber input only
+	Cumulative  bool   // True when Text already holds the full path
+	NewSession  bool
+	Release     bool // Subscriber or network ended the session
+}
+
+// USSDResponse is a provider-neutral outbound USSD screen
+type USSDResponse struct {
+	Message  string
+	Continue bool
+}
+
+// USSDProvider normalizes inbound requests and renders responses for one aggregator
+type USSDProvider interface {
+	Name() string
+	ParseRequest(r *http.Request) (*USSDRequest, error)
+	WriteResponse(w http.ResponseWriter, req *USSDRequest, resp USSDResponse) error
+}
+
+// ussdProviders holds every registered adapter keyed by name
+var ussdProviders = map[string]USSDProvider{
+	"africastalking": &AfricasTalkingUSSD{},
+	"hubtel":         &HubtelUSSD{},
+	"comviva":        &ComvivaUSSD{},
+}
+
+// selectUSSDProvider picks an adapter from the X-USSD-Provider header or
+// the /ussd/{provider} route, falling back to Africa's Talking
+func selectUSSDProvider(r *http.Request) (USSDProvider, error) {
+	name := strings.ToLower(r.Header.Get("X-USSD-Provider"))
+	if name == "" {
+		name = strings.Trim(strings.TrimPrefix(r.URL.Path, "/ussd"), "/")
+	}
+	if name == "" {
+		name = "africastalking"
+	}
+
+	provider, ok := ussdProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown USSD provider: %s", name)
+	}
+	return provider, nil
+}
+
+// parseMenuResponse splits a "CON ..."/"END ..." menu screen into a neutral response
+func parseMenuResponse(screen string) USSDResponse {
+	if strings.HasPrefix(screen, "CON ") {
+		return USSDResponse{Message: strings.TrimPrefix(screen, "CON "), Continue: true}
+	}
+	return USSDResponse{Message: strings.TrimPrefix(screen, "END "), Continue: false}
+}
+
+// lastInput returns the final "*"-separated segment of a menu path
+func lastInput(text string) string {
+	if i := strings.LastIndex(text, "*"); i >= 0 {
+		return text[i+1:]
+	}
+	return text
+}
+
+// AfricasTalkingUSSD implements the Africa's Talking form-post dialect
+type AfricasTalkingUSSD struct{}
+
+func (p *AfricasTalkingUSSD) Name() string { return "africastalking" }
+
+func (p *AfricasTalkingUSSD) ParseRequest(r *http.Request) (*USSDRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid form body: %w", err)
+	}
+
+	text := r.FormValue("text")
+	return &USSDRequest{
+		SessionID:   r.FormValue("sessionId"),
+		PhoneNumber: r.FormValue("phoneNumber"),
+		ServiceCode: r.FormValue("serviceCode"),
+		Text:        text,
+		Input:       lastInput(text),
+		Cumulative:  true,
+		NewSession:  text == "",
+	}, nil
+}
+
+func (p *AfricasTalkingUSSD) WriteResponse(w http.ResponseWriter, req *USSDRequest, resp USSDResponse) error {
+	prefix := "END "
+	if resp.Continue {
+		prefix = "CON "
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := fmt.Fprint(w, prefix+resp.Message)
+	return err
+}
+
+// HubtelUSSD implements the Hubtel JSON dialect
+type HubtelUSSD struct{}
+
+type hubtelRequest struct {
+	Type        string `json:"Type"` // "Initiation", "Response", "Release", "Timeout"
+	Mobile      string `json:"Mobile"`
+	SessionID   string `json:"SessionId"`
+	ServiceCode string `json:"ServiceCode"`
+	Message     string `json:"Message"`
+	Operator    string `json:"Operator"`
+	Sequence    int    `json:"Sequence"`
+	ClientState string `json:"ClientState"`
+}
+
+type hubtelResponse struct {
+	Type        string `json:"Type"` // "Response" or "Release"
+	Message     string `json:"Message"`
+	ClientState string `json:"ClientState,omitempty"`
+}
+
+func (p *HubtelUSSD) Name() string { return "hubtel" }
+
+func (p *HubtelUSSD) ParseRequest(r *http.Request) (*USSDRequest, error) {
+	var body hubtelRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid Hubtel JSON: %w", err)
+	}
+
+	req := &USSDRequest{
+		SessionID:   body.SessionID,
+		PhoneNumber: body.Mobile,
+		ServiceCode: body.ServiceCode,
+	}
+
+	switch body.Type {
+	case "Initiation":
+		// Message carries the dialled string on initiation, not a menu choice
+		req.NewSession = true
+		req.Cumulative = true
+	case "Release", "Timeout":
+		req.Release = true
+	default:
+		req.Input = body.Message
+		// ClientState echoes the path we returned on the previous hop
+		if body.ClientState != "" {
+			req.Text = body.ClientState + "*" + body.Message
+			req.Cumulative = true
+		}
+	}
+	return req, nil
+}
+
+func (p *HubtelUSSD) WriteResponse(w http.ResponseWriter, req *USSDRequest, resp USSDResponse) error {
+	out := hubtelResponse{Type: "Release", Message: resp.Message}
+	if resp.Continue {
+		out.Type = "Response"
+		out.ClientState = req.Text
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(out)
+}
+
+// ComvivaUSSD implements the Comviva/Flares-style XML dialect with a
+// freeflow continue (FC) or break (FB) flag
+type ComvivaUSSD struct{}
+
+type comvivaRequest struct {
+	XMLName         xml.Name `xml:"request"`
+	MSISDN          string   `xml:"msisdn"`
+	SessionID       string   `xml:"sessionId"`
+	ServiceCode     string   `xml:"serviceCode"`
+	NewRequest      string   `xml:"newRequest"`
+	SubscriberInput string   `xml:"subscriberInput"`
+	Type            string   `xml:"type"` // "abort" when the subscriber hangs up
+}
+
+type comvivaResponse struct {
+	XMLName             xml.Name `xml:"response"`
+	MSISDN              string   `xml:"msisdn"`
+	SessionID           string   `xml:"sessionId"`
+	ApplicationResponse string   `xml:"applicationResponse"`
+	Freeflow            struct {
+		State string `xml:"freeflowState"`
+	} `xml:"freeflow"`
+}
+
+func (p *ComvivaUSSD) Name() string { return "comviva" }
+
+func (p *ComvivaUSSD) ParseRequest(r *http.Request) (*USSDRequest, error) {
+	var body comvivaRequest
+	if err := xml.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid Comviva XML: %w", err)
+	}
+
+	req := &USSDRequest{
+		SessionID:   body.SessionID,
+		PhoneNumber: body.MSISDN,
+		ServiceCode: body.ServiceCode,
+		NewSession:  body.NewRequest == "1",
+		Release:     strings.EqualFold(body.Type, "abort"),
+	}
+	if req.NewSession {
+		req.Cumulative = true
+	} else {
+		req.Input = body.SubscriberInput
+	}
+	return req, nil
+}
+
+func (p *ComvivaUSSD) WriteResponse(w http.ResponseWriter, req *USSDRequest, resp USSDResponse) error {
+	out := comvivaResponse{
+		MSISDN:              req.PhoneNumber,
+		SessionID:           req.SessionID,
+		ApplicationResponse: resp.Message,
+	}
+	out.Freeflow.State = "FB"
+	if resp.Continue {
+		out.Freeflow.State = "FC"
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden response files in testdata")
+
+// Each case parses testdata/providers/<provider>/<name>.request and, when it
+// has a response, compares what the provider writes for it with
+// <name>.response
+func TestProviderCodecs(t *testing.T) {
+	tests := []struct {
+		provider    string
+		name        string
+		contentType string
+		want        USSDRequest
+		response    *USSDResponse
+	}{
+		{
+			provider:    "africastalking",
+			name:        "new_session",
+			contentType: "application/x-www-form-urlencoded",
+			want: USSDRequest{
+				SessionID:   "ATUid_1a2b",
+				PhoneNumber: "+260971234567",
+				ServiceCode: "*384*123#",
+				Cumulative:  true,
+				NewSession:  true,
+			},
+			response: &USSDResponse{Message: "Welcome to Africa Railways\n1. Buy ticket\n2. My tickets", Continue: true},
+		},
+		{
+			provider:    "africastalking",
+			name:        "menu_choice",
+			contentType: "application/x-www-form-urlencoded",
+			want: USSDRequest{
+				SessionID:   "ATUid_1a2b",
+				PhoneNumber: "+260971234567",
+				ServiceCode: "*384*123#",
+				Text:        "1*2",
+				Input:       "2",
+				Cumulative:  true,
+			},
+			response: &USSDResponse{Message: "Ticket booked. You will receive an SMS."},
+		},
+		{
+			provider:    "hubtel",
+			name:        "initiation",
+			contentType: "application/json",
+			want: USSDRequest{
+				SessionID:   "3c5dbd9a2f6b4c6e",
+				PhoneNumber: "233244123456",
+				ServiceCode: "713",
+				Cumulative:  true,
+				NewSession:  true,
+			},
+			response: &USSDResponse{Message: "Welcome to Africa Railways\n1. Buy ticket\n2. My tickets", Continue: true},
+		},
+		{
+			provider:    "hubtel",
+			name:        "response",
+			contentType: "application/json",
+			want: USSDRequest{
+				SessionID:   "3c5dbd9a2f6b4c6e",
+				PhoneNumber: "233244123456",
+				ServiceCode: "713",
+				Text:        "1*2",
+				Input:       "2",
+				Cumulative:  true,
+			},
+			response: &USSDResponse{Message: "Select class\n1. Economy\n2. Business", Continue: true},
+		},
+		{
+			provider:    "hubtel",
+			name:        "release",
+			contentType: "application/json",
+			want: USSDRequest{
+				SessionID:   "3c5dbd9a2f6b4c6e",
+				PhoneNumber: "233244123456",
+				ServiceCode: "713",
+				Release:     true,
+			},
+		},
+		{
+			provider:    "comviva",
+			name:        "new_request",
+			contentType: "application/xml",
+			want: USSDRequest{
+				SessionID:   "1702391234",
+				PhoneNumber: "255754123456",
+				ServiceCode: "*150*88#",
+				Cumulative:  true,
+				NewSession:  true,
+			},
+			response: &USSDResponse{Message: "Welcome to Africa Railways\n1. Buy ticket\n2. My tickets", Continue: true},
+		},
+		{
+			provider:    "comviva",
+			name:        "input",
+			contentType: "application/xml",
+			want: USSDRequest{
+				SessionID:   "1702391234",
+				PhoneNumber: "255754123456",
+				ServiceCode: "*150*88#",
+				Input:       "3",
+			},
+			response: &USSDResponse{Message: "Thank you for travelling with Africa Railways"},
+		},
+		{
+			provider:    "comviva",
+			name:        "abort",
+			contentType: "application/xml",
+			want: USSDRequest{
+				SessionID:   "1702391234",
+				PhoneNumber: "255754123456",
+				ServiceCode: "*150*88#",
+				Release:     true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.name, func(t *testing.T) {
+			dir := filepath.Join("testdata", "providers", tt.provider)
+			body, err := os.ReadFile(filepath.Join(dir, tt.name+".request"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/ussd/"+tt.provider, bytes.NewReader(body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			provider, err := selectUSSDProvider(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider.Name() != tt.provider {
+				t.Fatalf("selected %s, want %s", provider.Name(), tt.provider)
+			}
+			req, err := provider.ParseRequest(r)
+			if err != nil {
+				t.Fatalf("ParseRequest: %v", err)
+			}
+			if *req != tt.want {
+				t.Errorf("ParseRequest:\n got %+v\nwant %+v", *req, tt.want)
+			}
+
+			if tt.response == nil {
+				return
+			}
+			w := httptest.NewRecorder()
+			if err := provider.WriteResponse(w, req, *tt.response); err != nil {
+				t.Fatalf("WriteResponse: %v", err)
+			}
+			golden := filepath.Join(dir, tt.name+".response")
+			if *update {
+				if err := os.WriteFile(golden, w.Body.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.Body.Bytes(), want) {
+				t.Errorf("WriteResponse:\n got %q\nwant %q", w.Body.String(), want)
+			}
+		})
+	}
+}
+
+func TestSelectUSSDProvider(t *testing.T) {
+	tests := []struct {
+		path, header, want string
+	}{
+		{"/ussd", "", "africastalking"},
+		{"/ussd/hubtel", "", "hubtel"},
+		{"/ussd", "Comviva", "comviva"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set("X-USSD-Provider", tt.header)
+		}
+		provider, err := selectUSSDProvider(r)
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.path, tt.header, err)
+			continue
+		}
+		if provider.Name() != tt.want {
+			t.Errorf("%s %q: selected %s, want %s", tt.path, tt.header, provider.Name(), tt.want)
+		}
+	}
+
+	if _, err := selectUSSDProvider(httptest.NewRequest(http.MethodPost, "/ussd/unknown", nil)); err == nil {
+		t.Error("unknown provider was accepted")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrSoldOut is returned when a train has no seats left in a class
+var ErrSoldOut = errors.New("no seats left")
+
+// seatCapacity is the number of seats per class on each departure
+var seatCapacity = map[string]int{
+	"Economy":    300,
+	"Business":   80,
+	"FirstClass": 24,
+}
+
+// seatRetention keeps seat counts around after travel for reconciliation
+const seatRetention = 90 * 24 * time.Hour
+
+// SeatInventory counts seats sold per route, travel date and class
+type SeatInventory interface {
+	// Reserve takes a seat and fails with ErrSoldOut when the class is full
+	Reserve(ctx context.Context, route, class, date string) error
+	// Release returns a seat from a cancelled or exchanged ticket
+	Release(ctx context.Context, route, class, date string) error
+}
+
+// newSeatInventory returns a Redis-backed inventory when a client is given
+// and an in-memory inventory otherwise
+func newSeatInventory(client *redis.Client) SeatInventory {
+	if client == nil {
+		return NewMemorySeatInventory()
+	}
+	return &RedisSeatInventory{client: client, prefix: "ussd:seats:"}
+}
+
+func seatCapacityFor(class string) int {
+	if capacity, ok := seatCapacity[class]; ok {
+		return capacity
+	}
+	return seatCapacity["Economy"]
+}
+
+// MemorySeatInventory keeps seat counts in process memory
+type MemorySeatInventory struct {
+	sold map[string]int
+	mu   sync.Mutex
+}
+
+// NewMemorySeatInventory creates an in-process seat inventory
+func NewMemorySeatInventory() *MemorySeatInventory {
+	return &MemorySeatInventory{sold: make(map[string]int)}
+}
+
+func (s *MemorySeatInventory) Reserve(ctx context.Context, route, class, date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := route + ":" + date + ":" + class
+	if s.sold[key] >= seatCapacityFor(class) {
+		return ErrSoldOut
+	}
+	s.sold[key]++
+	return nil
+}
+
+func (s *MemorySeatInventory) Release(ctx context.Context, route, class, date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := route + ":" + date + ":" + class
+	if s.sold[key] > 0 {
+		s.sold[key]--
+	}
+	return nil
+}
+
+// RedisSeatInventory keeps a hash per departure with a sold count per class
+type RedisSeatInventory struct {
+	client *redis.Client
+	prefix string
+}
+
+// reserveSeatScript takes a seat only while the class is below capacity
+var reserveSeatScript = redis.NewScript(`
+local sold = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if sold >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// releaseSeatScript gives a seat back without going below zero
+var releaseSeatScript = redis.NewScript(`
+local sold = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if sold > 0 then
+	redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+end
+return 1
+`)
+
+func (s *RedisSeatInventory) Reserve(ctx context.Context, route, class, date string) error {
+	reserved, err := reserveSeatScript.Run(ctx, s.client, []string{s.prefix + route + ":" + date},
+		class, seatCapacityFor(class), seatRetention.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to reserve seat: %w", err)
+	}
+	if reserved == 0 {
+		return ErrSoldOut
+	}
+	return nil
+}
+
+func (s *RedisSeatInventory) Release(ctx context.Context, route, class, date string) error {
+	err := releaseSeatScript.Run(ctx, s.client, []string{s.prefix + route + ":" + date}, class).Err()
+	if err != nil {
+		return fmt.Errorf("failed to release seat: %w", err)
+	}
+	return nil
+}
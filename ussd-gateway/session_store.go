@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sessionTTL is how long an idle USSD session lives before it expires
+const sessionTTL = 5 * time.Minute
+
+// ErrSessionConflict is returned when a session was updated by another
+// request (or replica) since it was loaded
+var ErrSessionConflict = errors.New("session modified concurrently")
+
+// SessionStore persists USSD sessions between hops
+type SessionStore interface {
+	// GetOrCreate loads a session, creating it if it does not exist
+	GetOrCreate(ctx context.Context, sessionID, phoneNumber string) (*Session, error)
+	// Save writes a session back if its Version still matches the stored copy
+	// and refreshes its TTL. A session saved before whose copy has expired
+	// or been removed is a conflict too.
+	Save(ctx context.Context, session *Session) error
+	Remove(ctx context.Context, sessionID string) error
+	List(ctx context.Context) ([]*Session, error)
+}
+
+// newRedisClientFromEnv connects to USSD_REDIS_URL. It returns a nil client
+// when the variable is unset so callers fall back to in-memory stores.
+func newRedisClientFromEnv() (*redis.Client, error) {
+	redisURL := os.Getenv("USSD_REDIS_URL")
+	if redisURL == "" {
+		log.Println("⚠️  USSD_REDIS_URL not set, using in-memory stores")
+		return nil, nil
+	}
+
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid USSD_REDIS_URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redis not reachable: %w", err)
+	}
+
+	log.Printf("✅ Using Redis stores at %s", opts.Addr)
+	return client, nil
+}
+
+// newSessionStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newSessionStore(client *redis.Client) SessionStore {
+	if client == nil {
+		return NewMemorySessionStore(sessionTTL)
+	}
+	return NewRedisSessionStore(client, sessionTTL)
+}
+
+func newSession(sessionID, phoneNumber string) *Session {
+	now := time.Now()
+	return &Session{
+		SessionID:   sessionID,
+		PhoneNumber: phoneNumber,
+		State:       "main_menu",
+		StartTime:   now,
+		UpdatedAt:   now,
+		Data:        make(map[string]interface{}),
+	}
+}
+
+func decodeSession(raw []byte) (*Session, error) {
+	var session Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, fmt.Errorf("corrupt session record: %w", err)
+	}
+	if session.Data == nil {
+		session.Data = make(map[string]interface{})
+	}
+	return &session, nil
+}
+
+// MemorySessionStore keeps sessions in process memory. Sessions are stored
+// serialized so callers get the same copy semantics as the Redis store.
+type MemorySessionStore struct {
+	sessions map[string]memorySessionEntry
+	ttl      time.Duration
+	mu       sync.Mutex
+}
+
+type memorySessionEntry struct {
+	data      []byte
+	version   int64
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore creates an in-process session store
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]memorySessionEntry),
+		ttl:      ttl,
+	}
+}
+
+// lookup returns a live entry, evicting it if its TTL has passed. Caller holds mu.
+func (s *MemorySessionStore) lookup(sessionID string, now time.Time) (memorySessionEntry, bool) {
+	entry, ok := s.sessions[sessionID]
+	if ok && now.After(entry.expiresAt) {
+		delete(s.sessions, sessionID)
+		return memorySessionEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *MemorySessionStore) GetOrCreate(ctx context.Context, sessionID, phoneNumber string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := s.lookup(sessionID, now); ok {
+		return decodeSession(entry.data)
+	}
+
+	session := newSession(sessionID, phoneNumber)
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[sessionID] = memorySessionEntry{data: data, expiresAt: now.Add(s.ttl)}
+	return session, nil
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.lookup(session.SessionID, now)
+	if ok && entry.version != session.Version {
+		return ErrSessionConflict
+	}
+	if !ok && session.Version > 0 {
+		// Saved before, so it expired or was removed meanwhile
+		return ErrSessionConflict
+	}
+
+	next := *session
+	next.Version++
+	next.UpdatedAt = now
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+
+	s.sessions[session.SessionID] = memorySessionEntry{
+		data:      data,
+		version:   next.Version,
+		expiresAt: now.Add(s.ttl),
+	}
+	session.Version = next.Version
+	session.UpdatedAt = now
+	return nil
+}
+
+func (s *MemorySessionStore) Remove(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func (s *MemorySessionStore) List(ctx context.Context) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for id := range s.sessions {
+		entry, ok := s.lookup(id, now)
+		if !ok {
+			continue
+		}
+		session, err := decodeSession(entry.data)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RedisSessionStore shares sessions across gateway replicas using any
+// Redis-protocol server. Each session is a JSON value with its own TTL.
+type RedisSessionStore struct {
+	client *redis.Client
+	ttl    time.Duration
+	prefix string
+}
+
+// NewRedisSessionStore creates a Redis-backed session store
+func NewRedisSessionStore(client *redis.Client, ttl time.Duration) *RedisSessionStore {
+	return &RedisSessionStore{
+		client: client,
+		ttl:    ttl,
+		prefix: "ussd:session:",
+	}
+}
+
+func (s *RedisSessionStore) key(sessionID string) string {
+	return s.prefix + sessionID
+}
+
+func (s *RedisSessionStore) GetOrCreate(ctx context.Context, sessionID, phoneNumber string) (*Session, error) {
+	key := s.key(sessionID)
+
+	raw, err := s.client.Get(ctx, key).Bytes()
+	if err == nil {
+		return decodeSession(raw)
+	}
+	if err != redis.Nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	session := newSession(sessionID, phoneNumber)
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.client.SetNX(ctx, key, data, s.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if !created {
+		// Another replica created it between our GET and SETNX
+		raw, err := s.client.Get(ctx, key).Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		return decodeSession(raw)
+	}
+	return session, nil
+}
+
+func (s *RedisSessionStore) Save(ctx context.Context, session *Session) error {
+	key := s.key(session.SessionID)
+	next := *session
+	next.Version++
+	next.UpdatedAt = time.Now()
+
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil && session.Version > 0 {
+			// Saved before, so it expired or was removed meanwhile
+			return ErrSessionConflict
+		}
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			stored, err := decodeSession(raw)
+			if err != nil {
+				return err
+			}
+			if stored.Version != session.Version {
+				return ErrSessionConflict
+			}
+		}
+
+		data, err := json.Marshal(&next)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, s.ttl)
+			return nil
+		})
+		return err
+	}, key)
+
+	if err == redis.TxFailedErr {
+		return ErrSessionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	session.Version = next.Version
+	session.UpdatedAt = next.UpdatedAt
+	return nil
+}
+
+func (s *RedisSessionStore) Remove(ctx context.Context, sessionID string) error {
+	return s.client.Del(ctx, s.key(sessionID)).Err()
+}
+
+func (s *RedisSessionStore) List(ctx context.Context) ([]*Session, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan sessions: %w", err)
+	}
+	if len(keys) == 0 {
+		return []*Session{}, nil
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(values))
+	for _, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue // expired between SCAN and MGET
+		}
+		session, err := decodeSession([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testSessionTTL = time.Minute
+
+// sessionStoreCase is a store under test and a way to move its clock past
+// the session TTL
+type sessionStoreCase struct {
+	name   string
+	store  SessionStore
+	expire func()
+}
+
+func sessionStores(t *testing.T) []sessionStoreCase {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// The memory store reads the wall clock, so give it a TTL to sleep past
+	memoryTTL := 20 * time.Millisecond
+	return []sessionStoreCase{
+		{
+			name:   "memory",
+			store:  NewMemorySessionStore(memoryTTL),
+			expire: func() { time.Sleep(2 * memoryTTL) },
+		},
+		{
+			name:   "redis",
+			store:  NewRedisSessionStore(client, testSessionTTL),
+			expire: func() { mr.FastForward(2 * testSessionTTL) },
+		},
+	}
+}
+
+func TestSessionStoreConflict(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range sessionStores(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			first, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first.State = "select_route"
+			if err := tc.store.Save(ctx, first); err != nil {
+				t.Fatalf("first save: %v", err)
+			}
+			if first.Version != 1 {
+				t.Errorf("version after save = %d, want 1", first.Version)
+			}
+
+			second.State = "my_tickets"
+			if err := tc.store.Save(ctx, second); !errors.Is(err, ErrSessionConflict) {
+				t.Fatalf("stale save = %v, want ErrSessionConflict", err)
+			}
+
+			stored, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.State != "select_route" || stored.Version != 1 {
+				t.Errorf("stored %s v%d, want select_route v1", stored.State, stored.Version)
+			}
+			if err := tc.store.Save(ctx, stored); err != nil {
+				t.Errorf("save of the latest copy: %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range sessionStores(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			session, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.State = "select_route"
+			if err := tc.store.Save(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+
+			tc.expire()
+
+			// A saved session must not come back once it has expired
+			session.State = "confirm"
+			if err := tc.store.Save(ctx, session); !errors.Is(err, ErrSessionConflict) {
+				t.Fatalf("save after expiry = %v, want ErrSessionConflict", err)
+			}
+			fresh, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fresh.State != "main_menu" || fresh.Version != 0 {
+				t.Errorf("after expiry got %s v%d, want a new main_menu session", fresh.State, fresh.Version)
+			}
+		})
+	}
+}
+
+func TestSessionStoreRemovedSession(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range sessionStores(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			session, err := tc.store.GetOrCreate(ctx, "s1", "+260971234567")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Save(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Remove(ctx, "s1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Save(ctx, session); !errors.Is(err, ErrSessionConflict) {
+				t.Fatalf("save after remove = %v, want ErrSessionConflict", err)
+			}
+
+			// A session never saved has nothing to conflict with
+			unsaved := newSession("s2", "+260971234567")
+			if err := tc.store.Save(ctx, unsaved); err != nil {
+				t.Errorf("first save of a new session: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMSSender delivers text messages such as PIN reset codes. kind labels the
+// message, e.g. "otp", in the SMS outbox.
+type SMSSender interface {
+	Send(ctx context.Context, to, kind, message string) error
+}
+
+// ticketConfirmer is implemented by senders that can confirm a purchase
+// with the backend's ticket_confirmation template
+type ticketConfirmer interface {
+	ConfirmTicket(ctx context.Context, ticket *Ticket) error
+}
+
+// ErrNoSMSProvider is returned while no way to send SMS is configured
+var ErrNoSMSProvider = errors.New("no SMS provider configured")
+
+// newSMSSenderFromEnv sends through the backend's SMS scheduler when
+// SMS_SCHEDULER_URL is set, so messages get its outbox: provider failover,
+// retries and delivery reports. Failing that it sends once through Africa's
+// Talking when AT_USERNAME and AT_API_KEY are set, and otherwise sends
+// nothing.
+func newSMSSenderFromEnv() SMSSender {
+	if base := os.Getenv("SMS_SCHEDULER_URL"); base != "" {
+		log.Printf("📨 Sending SMS through the scheduler at %s", base)
+		return NewSchedulerSMS(base, os.Getenv("SMS_SEND_TOKEN"))
+	}
+	username := os.Getenv("AT_USERNAME")
+	apiKey := os.Getenv("AT_API_KEY")
+	if username == "" || apiKey == "" {
+		log.Println("⚠️  Neither SMS_SCHEDULER_URL nor AT_USERNAME/AT_API_KEY set, SMS will not be delivered")
+		return logSMSSender{}
+	}
+	log.Println("⚠️  SMS_SCHEDULER_URL not set, SMS is sent once through Africa's Talking without retries")
+	sender := NewAfricasTalkingSMS(username, apiKey, os.Getenv("AT_SENDER_ID"))
+	if base := os.Getenv("AT_BASE_URL"); base != "" {
+		// e.g. the fake SMSC in backend/cmd/fake-smsc for offline development
+		sender.endpoint = strings.TrimRight(base, "/") + "/version1/messaging"
+		log.Printf("📨 Sending SMS through %s", sender.endpoint)
+	}
+	return sender
+}
+
+// AfricasTalkingSMS sends SMS through the Africa's Talking messaging API
+type AfricasTalkingSMS struct {
+	username string
+	apiKey   string
+	senderID string
+	endpoint string
+	client   *http.Client
+}
+
+// NewAfricasTalkingSMS creates a sender; the "sandbox" username targets the
+// sandbox environment
+func NewAfricasTalkingSMS(username, apiKey, senderID string) *AfricasTalkingSMS {
+	endpoint := "https://api.africastalking.com/version1/messaging"
+	if username == "sandbox" {
+		endpoint = "https://api.sandbox.africastalking.com/version1/messaging"
+	}
+	return &AfricasTalkingSMS{
+		username: username,
+		apiKey:   apiKey,
+		senderID: senderID,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *AfricasTalkingSMS) Send(ctx context.Context, to, kind, message string) error {
+	form := url.Values{
+		"username": {s.username},
+		"to":       {to},
+		"message":  {message},
+	}
+	if s.senderID != "" {
+		form.Set("from", s.senderID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apiKey", s.apiKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS via Africa's Talking: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Africa's Talking SMS returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// SchedulerSMS sends through the backend's SMS scheduler (cmd/sms-scheduler),
+// which queues messages in its outbox. token is its SMS_SEND_TOKEN.
+type SchedulerSMS struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewSchedulerSMS creates a sender for the scheduler at baseURL
+func NewSchedulerSMS(baseURL, token string) *SchedulerSMS {
+	return &SchedulerSMS{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *SchedulerSMS) Send(ctx context.Context, to, kind, message string) error {
+	return s.post(ctx, "/sms/send", map[string]string{"to": to, "kind": kind, "body": message})
+}
+
+// ConfirmTicket sends the ticket_confirmation template in the passenger's
+// language, with the fare as sold
+func (s *SchedulerSMS) ConfirmTicket(ctx context.Context, ticket *Ticket) error {
+	route := ticket.Route
+	if ticket.From != "" && ticket.To != "" {
+		route = ticket.From + " - " + ticket.To
+	}
+	return s.post(ctx, "/sms/ticket-confirmation", map[string]interface{}{
+		"to": ticket.MSISDN,
+		"ticket": map[string]interface{}{
+			"ticket_id": ticket.TicketID,
+			"route":     route,
+			"departure": ticket.DepartureTime(),
+			"price":     ticket.Price.String(),
+		},
+	})
+}
+
+func (s *SchedulerSMS) post(ctx context.Context, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the SMS scheduler: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS scheduler returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// logSMSSender stands in when no SMS provider is configured. It never logs
+// the message body, which may contain a one-time code, and fails so callers
+// know the passenger was not told.
+type logSMSSender struct{}
+
+func (logSMSSender) Send(ctx context.Context, to, kind, message string) error {
+	log.Printf("⚠️  %s SMS to %s not delivered (%d chars): no SMS provider configured", kind, to, len(message))
+	return ErrNoSMSProvider
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Operator timezones must resolve in slim containers too
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStatsTimezone = "Africa/Johannesburg"
+	statsRetention       = 400 * 24 * time.Hour
+	statsSampleInterval  = 15 * time.Second
+	maxStatsHistoryDays  = 366
+	statsDayLayout       = "2006-01-02"
+)
+
+// Daily aggregate fields
+const (
+	statSessions   = "sessions"
+	statSuccessful = "successful"
+	statFailed     = "failed"
+	statRequests   = "requests"
+	statResponseMs = "response_ms"
+	statPeak       = "peak_sessions"
+	statPeakAt     = "peak_at"
+	statTickets    = "tickets"
+	statRevenue    = "revenue:" // Followed by the currency; minor units
+	statRefunds    = "refunds:"
+	statCancelled  = "cancellations"
+	statExchanges  = "exchanges"
+	statFirstSeen  = "first_seen" // Minute of the day the gateway was first up
+)
+
+// DailyStats is one operator-local day of gateway activity. Money is
+// counted in the currency it was taken in and converted to the reporting
+// currency at current rates when the day is read; currencies with no rate
+// are listed in Unconverted instead.
+type DailyStats struct {
+	Date                string     `json:"date"`
+	Sessions            int64      `json:"sessions"`
+	SuccessfulSessions  int64      `json:"successful_sessions"`
+	FailedSessions      int64      `json:"failed_sessions"`
+	Requests            int64      `json:"requests"`
+	AverageResponseTime int64      `json:"average_response_time_ms"`
+	SuccessRate         float64    `json:"success_rate"`
+	PeakSessions        int64      `json:"peak_sessions"`
+	PeakAt              *time.Time `json:"peak_at,omitempty"`
+	TicketsSold         int64      `json:"tickets_sold"`
+	Revenue             Money      `json:"revenue"`
+	Refunds             Money      `json:"refunds"`
+	NetRevenue          Money      `json:"net_revenue"`
+	RevenueByCurrency   []Money    `json:"revenue_by_currency"`
+	RefundsByCurrency   []Money    `json:"refunds_by_currency"`
+	Unconverted         []Money    `json:"unconverted,omitempty"` // Net revenue with no rate
+	Cancellations       int64      `json:"cancellations"`
+	Exchanges           int64      `json:"exchanges"`
+	UpMinutes           int        `json:"up_minutes"`
+	UptimePercent       float64    `json:"uptime_percent"`
+}
+
+// StatsStore keeps per-day integer counters: counts, milliseconds, Unix
+// times and money in minor units, so sums are exact. Days are
+// operator-local dates, so a new day starts with fresh counters at local
+// midnight.
+type StatsStore interface {
+	Add(ctx context.Context, day, field string, delta int64) error
+	// Max raises field to value if it is higher and reports whether it did
+	Max(ctx context.Context, day, field string, value int64) (bool, error)
+	Set(ctx context.Context, day, field string, value int64) error
+	SetNX(ctx context.Context, day, field string, value int64) error
+	// MarkUp records that a gateway was running during a minute of the day
+	MarkUp(ctx context.Context, day string, minute int) error
+	Get(ctx context.Context, day string) (map[string]int64, int, error)
+}
+
+// newStatsStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newStatsStore(client *redis.Client) StatsStore {
+	if client == nil {
+		return NewMemoryStatsStore()
+	}
+	return &RedisStatsStore{client: client, prefix: "ussd:stats:"}
+}
+
+// operatorLocationFromEnv loads USSD_TIMEZONE, falling back to South African
+// time when it is unset or unknown
+func operatorLocationFromEnv() *time.Location {
+	name := os.Getenv("USSD_TIMEZONE")
+	if name == "" {
+		name = defaultStatsTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("⚠️  Unknown USSD_TIMEZONE %q, using %s", name, defaultStatsTimezone)
+		loc, _ = time.LoadLocation(defaultStatsTimezone)
+	}
+	return loc
+}
+
+// StatsRecorder tracks gateway activity per operator-local day
+type StatsRecorder struct {
+	store     StatsStore
+	loc       *time.Location
+	startTime time.Time
+}
+
+// NewStatsRecorder creates a recorder whose days roll over at midnight in loc
+func NewStatsRecorder(store StatsStore, loc *time.Location) *StatsRecorder {
+	return &StatsRecorder{store: store, loc: loc, startTime: time.Now()}
+}
+
+func (s *StatsRecorder) day(t time.Time) string {
+	return t.In(s.loc).Format(statsDayLayout)
+}
+
+func (s *StatsRecorder) minuteOfDay(t time.Time) int {
+	local := t.In(s.loc)
+	return local.Hour()*60 + local.Minute()
+}
+
+// add bumps a counter for today; a failing stats store never blocks the caller
+func (s *StatsRecorder) add(ctx context.Context, field string, delta int64) {
+	if err := s.store.Add(ctx, s.day(time.Now()), field, delta); err != nil {
+		log.Printf("⚠️  Failed to record %s stat: %v", field, err)
+	}
+}
+
+// SessionStarted counts a new USSD session
+func (s *StatsRecorder) SessionStarted(ctx context.Context) {
+	s.add(ctx, statSessions, 1)
+}
+
+// SessionFailed counts a session that ended in an error
+func (s *StatsRecorder) SessionFailed(ctx context.Context) {
+	s.add(ctx, statFailed, 1)
+}
+
+// Request counts one USSD hop and how long it took to answer
+func (s *StatsRecorder) Request(ctx context.Context, elapsed time.Duration) {
+	s.add(ctx, statRequests, 1)
+	s.add(ctx, statResponseMs, elapsed.Milliseconds())
+}
+
+// TicketSold counts a completed purchase
+func (s *StatsRecorder) TicketSold(ctx context.Context, price Money) {
+	s.add(ctx, statSuccessful, 1)
+	s.add(ctx, statTickets, 1)
+	s.add(ctx, statRevenue+price.Currency, price.Amount)
+}
+
+// TicketCancelled counts a cancellation. Its refund is counted by
+// RefundPaid once the payment provider has paid it.
+func (s *StatsRecorder) TicketCancelled(ctx context.Context) {
+	s.add(ctx, statCancelled, 1)
+}
+
+// TicketExchanged counts an exchange and a positive difference, which was
+// charged; a negative one is counted by RefundPaid once paid
+func (s *StatsRecorder) TicketExchanged(ctx context.Context, difference Money) {
+	s.add(ctx, statExchanges, 1)
+	if difference.IsPositive() {
+		s.add(ctx, statRevenue+difference.Currency, difference.Amount)
+	}
+}
+
+// RefundPaid counts money paid back to a passenger on the day it was paid
+func (s *StatsRecorder) RefundPaid(ctx context.Context, amount Money) {
+	s.add(ctx, statRefunds+amount.Currency, amount.Amount)
+}
+
+// ObserveActive records the number of concurrent sessions, keeping the peak
+func (s *StatsRecorder) ObserveActive(ctx context.Context, active int) {
+	if active == 0 {
+		return
+	}
+	now := time.Now()
+	day := s.day(now)
+	raised, err := s.store.Max(ctx, day, statPeak, int64(active))
+	if err != nil {
+		log.Printf("⚠️  Failed to record peak sessions: %v", err)
+		return
+	}
+	if raised {
+		s.store.Set(ctx, day, statPeakAt, now.Unix())
+	}
+}
+
+// heartbeat marks the current minute as up and samples concurrent sessions
+func (s *StatsRecorder) heartbeat(ctx context.Context) {
+	now := time.Now()
+	day := s.day(now)
+	minute := s.minuteOfDay(now)
+	if err := s.store.SetNX(ctx, day, statFirstSeen, int64(minute)); err != nil {
+		log.Printf("⚠️  Failed to record uptime: %v", err)
+		return
+	}
+	if err := s.store.MarkUp(ctx, day, minute); err != nil {
+		log.Printf("⚠️  Failed to record uptime: %v", err)
+	}
+
+	sessions, err := sessionStore.List(ctx)
+	if err != nil {
+		log.Printf("⚠️  Failed to list sessions: %v", err)
+		return
+	}
+	s.ObserveActive(ctx, len(sessions))
+}
+
+// Run samples uptime and concurrency until ctx is cancelled
+func (s *StatsRecorder) Run(ctx context.Context) {
+	s.heartbeat(ctx)
+	ticker := time.NewTicker(statsSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.heartbeat(ctx)
+		}
+	}
+}
+
+// Today returns the aggregate for the current operator-local day
+func (s *StatsRecorder) Today(ctx context.Context) (*DailyStats, error) {
+	return s.load(ctx, time.Now().In(s.loc))
+}
+
+// History returns the last days aggregates, oldest first and ending today
+func (s *StatsRecorder) History(ctx context.Context, days int) ([]*DailyStats, error) {
+	now := time.Now().In(s.loc)
+	history := make([]*DailyStats, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		daily, err := s.load(ctx, now.AddDate(0, 0, -i))
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, daily)
+	}
+	return history, nil
+}
+
+// Uptime is how long this gateway process has been running
+func (s *StatsRecorder) Uptime() time.Duration {
+	return time.Since(s.startTime)
+}
+
+func (s *StatsRecorder) load(ctx context.Context, t time.Time) (*DailyStats, error) {
+	day := s.day(t)
+	fields, upMinutes, err := s.store.Get(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+
+	daily := &DailyStats{
+		Date:               day,
+		Sessions:           fields[statSessions],
+		SuccessfulSessions: fields[statSuccessful],
+		FailedSessions:     fields[statFailed],
+		Requests:           fields[statRequests],
+		PeakSessions:       fields[statPeak],
+		TicketsSold:        fields[statTickets],
+		Cancellations:      fields[statCancelled],
+		Exchanges:          fields[statExchanges],
+		UpMinutes:          upMinutes,
+	}
+	s.money(ctx, daily, fields)
+	if daily.Requests > 0 {
+		daily.AverageResponseTime = fields[statResponseMs] / daily.Requests
+	}
+	if daily.Sessions > 0 {
+		daily.SuccessRate = float64(daily.SuccessfulSessions) / float64(daily.Sessions) * 100
+	}
+	if peakAt, ok := fields[statPeakAt]; ok {
+		at := time.Unix(peakAt, 0).In(s.loc)
+		daily.PeakAt = &at
+	}
+
+	// Uptime counts from the first minute any gateway was seen that day, so
+	// the day of the first deployment is not reported as mostly down
+	if firstSeen, ok := fields[statFirstSeen]; ok {
+		lastMinute := 24*60 - 1
+		if day == s.day(time.Now()) {
+			lastMinute = s.minuteOfDay(time.Now())
+		}
+		if window := lastMinute - int(firstSeen) + 1; window > 0 {
+			daily.UptimePercent = float64(upMinutes) / float64(window) * 100
+			if daily.UptimePercent > 100 {
+				daily.UptimePercent = 100
+			}
+		}
+	}
+	return daily, nil
+}
+
+// money fills in the day's revenue and refunds
+func (s *StatsRecorder) money(ctx context.Context, daily *DailyStats, fields map[string]int64) {
+	revenue, refunds, net := MoneyTotals{}, MoneyTotals{}, MoneyTotals{}
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, statRevenue):
+			m := Money{Amount: value, Currency: field[len(statRevenue):]}
+			revenue.Add(m)
+			net.Add(m)
+		case strings.HasPrefix(field, statRefunds):
+			m := Money{Amount: value, Currency: field[len(statRefunds):]}
+			refunds.Add(m)
+			net.Add(m.Neg())
+		}
+	}
+
+	daily.RevenueByCurrency = revenue.List()
+	daily.RefundsByCurrency = refunds.List()
+	daily.Revenue, _ = revenue.Convert(ctx, fxRates, reportingCurrency)
+	daily.Refunds, _ = refunds.Convert(ctx, fxRates, reportingCurrency)
+	daily.NetRevenue, daily.Unconverted = net.Convert(ctx, fxRates, reportingCurrency)
+}
+
+// MemoryStatsStore keeps daily aggregates in process memory
+type MemoryStatsStore struct {
+	days map[string]map[string]int64
+	up   map[string]map[int]bool
+	mu   sync.Mutex
+}
+
+// NewMemoryStatsStore creates an in-process stats store
+func NewMemoryStatsStore() *MemoryStatsStore {
+	return &MemoryStatsStore{
+		days: make(map[string]map[string]int64),
+		up:   make(map[string]map[int]bool),
+	}
+}
+
+func (s *MemoryStatsStore) fields(day string) map[string]int64 {
+	fields, ok := s.days[day]
+	if !ok {
+		fields = make(map[string]int64)
+		s.days[day] = fields
+	}
+	return fields
+}
+
+func (s *MemoryStatsStore) Add(ctx context.Context, day, field string, delta int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fields(day)[field] += delta
+	return nil
+}
+
+func (s *MemoryStatsStore) Max(ctx context.Context, day, field string, value int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := s.fields(day)
+	if current, ok := fields[field]; ok && value <= current {
+		return false, nil
+	}
+	fields[field] = value
+	return true, nil
+}
+
+func (s *MemoryStatsStore) Set(ctx context.Context, day, field string, value int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fields(day)[field] = value
+	return nil
+}
+
+func (s *MemoryStatsStore) SetNX(ctx context.Context, day, field string, value int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := s.fields(day)
+	if _, ok := fields[field]; !ok {
+		fields[field] = value
+	}
+	return nil
+}
+
+func (s *MemoryStatsStore) MarkUp(ctx context.Context, day string, minute int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	minutes, ok := s.up[day]
+	if !ok {
+		minutes = make(map[int]bool)
+		s.up[day] = minutes
+	}
+	minutes[minute] = true
+	return nil
+}
+
+func (s *MemoryStatsStore) Get(ctx context.Context, day string) (map[string]int64, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := make(map[string]int64, len(s.days[day]))
+	for field, value := range s.days[day] {
+		fields[field] = value
+	}
+	return fields, len(s.up[day]), nil
+}
+
+// RedisStatsStore keeps each day in a hash plus a set of up minutes, so
+// aggregates survive restarts and are shared across replicas
+type RedisStatsStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// maxScript raises a hash field only when the new value is higher
+var maxScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+if current and current >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+func (s *RedisStatsStore) key(day string) string {
+	return s.prefix + day
+}
+
+func (s *RedisStatsStore) Add(ctx context.Context, day, field string, delta int64) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, s.key(day), field, delta)
+		pipe.Expire(ctx, s.key(day), statsRetention)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStatsStore) Max(ctx context.Context, day, field string, value int64) (bool, error) {
+	raised, err := maxScript.Run(ctx, s.client, []string{s.key(day)},
+		field, value, statsRetention.Milliseconds()).Int()
+	return raised == 1, err
+}
+
+func (s *RedisStatsStore) Set(ctx context.Context, day, field string, value int64) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.key(day), field, value)
+		pipe.Expire(ctx, s.key(day), statsRetention)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStatsStore) SetNX(ctx context.Context, day, field string, value int64) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, s.key(day), field, value)
+		pipe.Expire(ctx, s.key(day), statsRetention)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStatsStore) MarkUp(ctx context.Context, day string, minute int) error {
+	upKey := s.key(day) + ":up"
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, upKey, minute)
+		pipe.Expire(ctx, upKey, statsRetention)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStatsStore) Get(ctx context.Context, day string) (map[string]int64, int, error) {
+	var values *redis.MapStringStringCmd
+	var upMinutes *redis.IntCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.HGetAll(ctx, s.key(day))
+		upMinutes = pipe.SCard(ctx, s.key(day)+":up")
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fields := make(map[string]int64, len(values.Val()))
+	for field, raw := range values.Val() {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		fields[field] = value
+	}
+	return fields, int(upMinutes.Val()), nil
+}
+
+// handleStatsHistory returns daily aggregates for the last ?days= days
+// (default 30), oldest first
+func handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxStatsHistoryDays {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	history, err := stats.History(r.Context(), days)
+	if err != nil {
+		http.Error(w, "Failed to load stats history", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone": stats.loc.String(),
+		"days":     history,
+	})
+}
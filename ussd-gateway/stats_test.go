@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisStatsStoreMinorUnits(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	recorder := NewStatsRecorder(newStatsStore(client), time.UTC)
+
+	// Amounts that do not add up exactly as floats
+	for i := 0; i < 10; i++ {
+		recorder.TicketSold(ctx, NewMoney(0.1, "ZAR"))
+	}
+	recorder.TicketSold(ctx, NewMoney(1250, "KES"))
+	recorder.RefundPaid(ctx, NewMoney(0.3, "ZAR"))
+
+	day := recorder.day(time.Now())
+	if got := mr.HGet("ussd:stats:"+day, statRevenue+"ZAR"); got != "100" {
+		t.Errorf("stored ZAR revenue = %q, want 100 minor units", got)
+	}
+
+	today, err := recorder.Today(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRevenue := []Money{{Amount: 125000, Currency: "KES"}, {Amount: 100, Currency: "ZAR"}}
+	if !reflect.DeepEqual(today.RevenueByCurrency, wantRevenue) {
+		t.Errorf("revenue = %v, want %v", today.RevenueByCurrency, wantRevenue)
+	}
+	if want := []Money{{Amount: 30, Currency: "ZAR"}}; !reflect.DeepEqual(today.RefundsByCurrency, want) {
+		t.Errorf("refunds = %v, want %v", today.RefundsByCurrency, want)
+	}
+	if today.TicketsSold != 11 {
+		t.Errorf("tickets sold = %d, want 11", today.TicketsSold)
+	}
+
+	// The peak only ever rises
+	recorder.ObserveActive(ctx, 7)
+	recorder.ObserveActive(ctx, 3)
+	if today, _ = recorder.Today(ctx); today.PeakSessions != 7 || today.PeakAt == nil {
+		t.Errorf("peak = %d at %v, want 7 with a time", today.PeakSessions, today.PeakAt)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTicketNotFound is returned for unknown ticket numbers
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// errTicketExists is returned by Issue when a ticket number is already used
+var errTicketExists = errors.New("ticket number already issued")
+
+// Ticket statuses
+const (
+	TicketIssued    = "issued"
+	TicketCancelled = "cancelled"
+	TicketExchanged = "exchanged" // Replaced by the ticket in ExchangedFor
+)
+
+// maxTicketsListed caps "My Tickets" so the screen fits on one USSD page
+const maxTicketsListed = 3
+
+// Ticket is a purchased ticket held in a passenger's wallet
+type Ticket struct {
+	TicketID   string     `json:"ticket_id"`
+	MSISDN     string     `json:"msisdn"`
+	Owner      string     `json:"owner"` // Passenger wallet address
+	Route      string     `json:"route"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Class      string     `json:"class"`
+	TravelDate string     `json:"travel_date"`
+	Departure  time.Time  `json:"departure"`
+	Category   string     `json:"category,omitempty"` // Passenger category the fare was quoted for
+	Price      Money      `json:"price"`
+	Fare       *FareQuote `json:"fare,omitempty"` // Breakdown of Price
+	Status     string     `json:"status"`
+	IssuedAt   time.Time  `json:"issued_at"`
+
+	// Set when the ticket is cancelled or exchanged
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+	Refund        Money      `json:"refund"`
+	RefundRef     string     `json:"refund_ref,omitempty"`
+	RefundPending bool       `json:"refund_pending,omitempty"`
+	VoidRef       string     `json:"void_ref,omitempty"`
+	VoidPending   bool       `json:"void_pending,omitempty"` // Not yet voided on-chain
+	ExchangedFor  string     `json:"exchanged_for,omitempty"`
+	ExchangedFrom string     `json:"exchanged_from,omitempty"`
+}
+
+// routeDepartures is the daily departure time of each route in operator time
+var routeDepartures = map[string]string{
+	"JHB-CPT": "08:00",
+	"JHB-DBN": "18:30",
+	"CPT-PE":  "09:15",
+}
+
+// departureTime returns when a route departs on a travel date (YYYY-MM-DD)
+func departureTime(route, travelDate string) (time.Time, error) {
+	clock, ok := routeDepartures[route]
+	if !ok {
+		clock = "08:00"
+	}
+	return time.ParseInLocation("2006-01-02 15:04", travelDate+" "+clock, operatorLoc)
+}
+
+// DepartureTime returns the ticket's departure, deriving it from the travel
+// date for tickets issued before departures were recorded
+func (t *Ticket) DepartureTime() time.Time {
+	if !t.Departure.IsZero() {
+		return t.Departure
+	}
+	departure, err := departureTime(t.Route, t.TravelDate)
+	if err != nil {
+		return t.IssuedAt
+	}
+	return departure
+}
+
+// TicketStore is the registry of issued tickets
+type TicketStore interface {
+	// Issue stores a new ticket and fails if its number is taken
+	Issue(ctx context.Context, ticket *Ticket) error
+	Get(ctx context.Context, ticketID string) (*Ticket, error)
+	// ListByPassenger returns a passenger's tickets, newest first
+	ListByPassenger(ctx context.Context, msisdn string) ([]*Ticket, error)
+	// ListDeparting returns tickets departing in [from, to), soonest first
+	ListDeparting(ctx context.Context, from, to time.Time) ([]*Ticket, error)
+	// Update applies fn to a ticket atomically; fn's error aborts the change
+	Update(ctx context.Context, ticketID string, fn func(ticket *Ticket) error) error
+}
+
+// newTicketStore returns a Redis-backed store when a client is given and an
+// in-memory store otherwise
+func newTicketStore(client *redis.Client) TicketStore {
+	if client == nil {
+		return NewMemoryTicketStore()
+	}
+	return &RedisTicketStore{client: client, prefix: "ussd:ticket:"}
+}
+
+// newTicketID returns an 8-digit ticket number that is easy to key in on a
+// phone keypad
+func newTicketID() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(90000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", 10000000+n.Int64()), nil
+}
+
+// issueTicket assigns a ticket number and records the ticket, retrying on
+// the rare number collision
+func issueTicket(ctx context.Context, ticket *Ticket) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		id, err := newTicketID()
+		if err != nil {
+			return err
+		}
+		ticket.TicketID = id
+		err = ticketStore.Issue(ctx, ticket)
+		if err != errTicketExists {
+			return err
+		}
+	}
+	return errors.New("could not allocate a ticket number")
+}
+
+// MemoryTicketStore keeps tickets in process memory
+type MemoryTicketStore struct {
+	tickets  map[string]*Ticket
+	byMSISDN map[string][]string
+	mu       sync.RWMutex
+}
+
+// NewMemoryTicketStore creates an in-process ticket store
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{
+		tickets:  make(map[string]*Ticket),
+		byMSISDN: make(map[string][]string),
+	}
+}
+
+func (s *MemoryTicketStore) Issue(ctx context.Context, ticket *Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[ticket.TicketID]; ok {
+		return errTicketExists
+	}
+	copied := *ticket
+	s.tickets[ticket.TicketID] = &copied
+	s.byMSISDN[ticket.MSISDN] = append(s.byMSISDN[ticket.MSISDN], ticket.TicketID)
+	return nil
+}
+
+func (s *MemoryTicketStore) Get(ctx context.Context, ticketID string) (*Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ticket, ok := s.tickets[ticketID]
+	if !ok {
+		return nil, ErrTicketNotFound
+	}
+	copied := *ticket
+	return &copied, nil
+}
+
+func (s *MemoryTicketStore) ListByPassenger(ctx context.Context, msisdn string) ([]*Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.byMSISDN[msisdn]
+	tickets := make([]*Ticket, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		copied := *s.tickets[ids[i]]
+		tickets = append(tickets, &copied)
+	}
+	return tickets, nil
+}
+
+func (s *MemoryTicketStore) ListDeparting(ctx context.Context, from, to time.Time) ([]*Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tickets []*Ticket
+	for _, ticket := range s.tickets {
+		departure := ticket.DepartureTime()
+		if !departure.Before(from) && departure.Before(to) {
+			copied := *ticket
+			tickets = append(tickets, &copied)
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].DepartureTime().Before(tickets[j].DepartureTime())
+	})
+	return tickets, nil
+}
+
+func (s *MemoryTicketStore) Update(ctx context.Context, ticketID string, fn func(ticket *Ticket) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticket, ok := s.tickets[ticketID]
+	if !ok {
+		return ErrTicketNotFound
+	}
+	copied := *ticket
+	if err := fn(&copied); err != nil {
+		return err
+	}
+	s.tickets[ticketID] = &copied
+	return nil
+}
+
+// RedisTicketStore keeps tickets as JSON under {prefix}{id}, with a sorted set
+// per passenger ordered by issue time and one of all tickets ordered by
+// departure
+type RedisTicketStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *RedisTicketStore) Issue(ctx context.Context, ticket *Ticket) error {
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	created, err := s.client.SetNX(ctx, s.prefix+ticket.TicketID, data, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store ticket: %w", err)
+	}
+	if !created {
+		return errTicketExists
+	}
+	err = s.client.ZAdd(ctx, s.prefix+"passenger:"+ticket.MSISDN, redis.Z{
+		Score:  float64(ticket.IssuedAt.UnixNano()),
+		Member: ticket.TicketID,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to index ticket: %w", err)
+	}
+	err = s.client.ZAdd(ctx, s.prefix+"departures", redis.Z{
+		Score:  float64(ticket.DepartureTime().Unix()),
+		Member: ticket.TicketID,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to index ticket departure: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisTicketStore) Get(ctx context.Context, ticketID string) (*Ticket, error) {
+	raw, err := s.client.Get(ctx, s.prefix+ticketID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ticket: %w", err)
+	}
+	var ticket Ticket
+	if err := json.Unmarshal(raw, &ticket); err != nil {
+		return nil, fmt.Errorf("corrupt ticket record: %w", err)
+	}
+	return &ticket, nil
+}
+
+func (s *RedisTicketStore) ListByPassenger(ctx context.Context, msisdn string) ([]*Ticket, error) {
+	ids, err := s.client.ZRevRange(ctx, s.prefix+"passenger:"+msisdn, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tickets: %w", err)
+	}
+	tickets := make([]*Ticket, 0, len(ids))
+	for _, id := range ids {
+		ticket, err := s.Get(ctx, id)
+		if err == ErrTicketNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+func (s *RedisTicketStore) ListDeparting(ctx context.Context, from, to time.Time) ([]*Ticket, error) {
+	ids, err := s.client.ZRangeByScore(ctx, s.prefix+"departures", &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: "(" + strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list departing tickets: %w", err)
+	}
+	tickets := make([]*Ticket, 0, len(ids))
+	for _, id := range ids {
+		ticket, err := s.Get(ctx, id)
+		if err == ErrTicketNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+func (s *RedisTicketStore) Update(ctx context.Context, ticketID string, fn func(ticket *Ticket) error) error {
+	key := s.prefix + ticketID
+	update := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return ErrTicketNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var ticket Ticket
+		if err := json.Unmarshal(raw, &ticket); err != nil {
+			return fmt.Errorf("corrupt ticket record: %w", err)
+		}
+		if err := fn(&ticket); err != nil {
+			return err
+		}
+		data, err := json.Marshal(&ticket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}
+
+	// Retry a few times if another request changed the ticket under us
+	for attempt := 0; attempt < 5; attempt++ {
+		err := s.client.Watch(ctx, update, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrSessionConflict
+}
+
+// handleTickets returns one ticket by ?id= or a passenger's tickets by ?msisdn=
+func handleTickets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var (
+		result interface{}
+		err    error
+	)
+	switch {
+	case query.Get("id") != "":
+		result, err = ticketStore.Get(r.Context(), query.Get("id"))
+	case query.Get("msisdn") != "":
+		result, err = ticketStore.ListByPassenger(r.Context(), query.Get("msisdn"))
+	case query.Get("departing_from") != "" && query.Get("departing_to") != "":
+		from, fromErr := time.Parse(time.RFC3339, query.Get("departing_from"))
+		to, toErr := time.Parse(time.RFC3339, query.Get("departing_to"))
+		if fromErr != nil || toErr != nil {
+			http.Error(w, "departing_from and departing_to must be RFC 3339 times", http.StatusBadRequest)
+			return
+		}
+		result, err = ticketStore.ListDeparting(r.Context(), from, to)
+	default:
+		http.Error(w, "id, msisdn or departing_from and departing_to are required", http.StatusBadRequest)
+		return
+	}
+
+	if err == ErrTicketNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ticket lookup failed: %v", err)
+		http.Error(w, "Failed to load tickets", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
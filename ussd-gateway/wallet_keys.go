@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WalletKeySource creates and unlocks the custodial Polygon keys held for
+// passengers
+type WalletKeySource interface {
+	Name() string
+	// NewAddress allocates the key for a passenger's key index and returns
+	// its address
+	NewAddress(index uint32) (common.Address, error)
+	// PrivateKey returns the signing key for a registered passenger
+	PrivateKey(passenger *Passenger) (*ecdsa.PrivateKey, error)
+}
+
+// newWalletKeySourceFromEnv picks the key source from the environment:
+// USSD_WALLET_SEED (hex seed or BIP-39 mnemonic) for HD derivation, or
+// USSD_KEYSTORE_DIR with USSD_KEYSTORE_PASSPHRASE for one keystore file per
+// passenger. Without either, a throwaway seed is generated, which is only
+// allowed when passengers are not persisted.
+func newWalletKeySourceFromEnv(persistent bool) (WalletKeySource, error) {
+	if seed := os.Getenv("USSD_WALLET_SEED"); seed != "" {
+		return NewHDKeySource(seed)
+	}
+
+	if dir := os.Getenv("USSD_KEYSTORE_DIR"); dir != "" {
+		passphrase := os.Getenv("USSD_KEYSTORE_PASSPHRASE")
+		if passphrase == "" {
+			return nil, errors.New("USSD_KEYSTORE_PASSPHRASE is required with USSD_KEYSTORE_DIR")
+		}
+		log.Printf("✅ Passenger keys held in keystore %s", dir)
+		return NewKeystoreKeySource(dir, passphrase), nil
+	}
+
+	if persistent {
+		return nil, errors.New("USSD_WALLET_SEED or USSD_KEYSTORE_DIR must be set when passengers are stored in Redis")
+	}
+
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	log.Println("⚠️  No wallet seed configured, passenger wallets will not survive a restart")
+	return NewHDKeySource(hex.EncodeToString(seed))
+}
+
+// HDKeySource derives passenger keys from one BIP-32 seed along the Ethereum
+// path m/44'/60'/0'/0/{index}
+type HDKeySource struct {
+	accountKey   []byte
+	accountChain []byte
+}
+
+const hardenedOffset = 0x80000000
+
+// NewHDKeySource accepts a hex-encoded seed or a BIP-39 mnemonic
+func NewHDKeySource(seed string) (*HDKeySource, error) {
+	seedBytes, err := hex.DecodeString(strings.TrimPrefix(seed, "0x"))
+	if err != nil {
+		words := strings.Fields(seed)
+		if len(words) < 12 {
+			return nil, errors.New("wallet seed must be hex or a BIP-39 mnemonic")
+		}
+		// BIP-39: PBKDF2-HMAC-SHA512, 2048 rounds, salt "mnemonic"
+		seedBytes = pbkdf2.Key([]byte(strings.Join(words, " ")), []byte("mnemonic"), 2048, 64, sha512.New)
+	}
+	if len(seedBytes) < 16 || len(seedBytes) > 64 {
+		return nil, fmt.Errorf("wallet seed must be 16-64 bytes, got %d", len(seedBytes))
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seedBytes)
+	sum := mac.Sum(nil)
+	key, chain := sum[:32], sum[32:]
+
+	// Walk to the account node once; passenger keys are its children
+	for _, index := range []uint32{44 + hardenedOffset, 60 + hardenedOffset, hardenedOffset, 0} {
+		key, chain, err = deriveChildKey(key, chain, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &HDKeySource{accountKey: key, accountChain: chain}, nil
+}
+
+// deriveChildKey implements BIP-32 private parent to private child derivation
+func deriveChildKey(key, chain []byte, index uint32) ([]byte, []byte, error) {
+	var data []byte
+	if index >= hardenedOffset {
+		data = append([]byte{0}, key...)
+	} else {
+		parent, err := crypto.ToECDSA(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = crypto.CompressPubkey(&parent.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, chain)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	child := tweak.Add(tweak, new(big.Int).SetBytes(key))
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	return child.FillBytes(make([]byte, 32)), sum[32:], nil
+}
+
+func (s *HDKeySource) Name() string { return "hd" }
+
+func (s *HDKeySource) key(index uint32) (*ecdsa.PrivateKey, error) {
+	if index >= hardenedOffset {
+		return nil, fmt.Errorf("key index %d out of range", index)
+	}
+	key, _, err := deriveChildKey(s.accountKey, s.accountChain, index)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ToECDSA(key)
+}
+
+func (s *HDKeySource) NewAddress(index uint32) (common.Address, error) {
+	key, err := s.key(index)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+func (s *HDKeySource) PrivateKey(passenger *Passenger) (*ecdsa.PrivateKey, error) {
+	key, err := s.key(passenger.KeyIndex)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(key.PublicKey) != common.HexToAddress(passenger.Address) {
+		return nil, fmt.Errorf("seed does not match wallet for %s", passenger.MSISDN)
+	}
+	return key, nil
+}
+
+// KeystoreKeySource stores a separate encrypted key file per passenger
+type KeystoreKeySource struct {
+	ks         *keystore.KeyStore
+	passphrase string
+}
+
+// NewKeystoreKeySource opens (or creates) a keystore directory
+func NewKeystoreKeySource(dir, passphrase string) *KeystoreKeySource {
+	return &KeystoreKeySource{
+		ks:         keystore.NewKeyStore(dir, keystore.StandardScryptN, keystore.StandardScryptP),
+		passphrase: passphrase,
+	}
+}
+
+func (s *KeystoreKeySource) Name() string { return "keystore" }
+
+func (s *KeystoreKeySource) NewAddress(index uint32) (common.Address, error) {
+	account, err := s.ks.NewAccount(s.passphrase)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to create keystore account: %w", err)
+	}
+	return account.Address, nil
+}
+
+func (s *KeystoreKeySource) PrivateKey(passenger *Passenger) (*ecdsa.PrivateKey, error) {
+	account, err := s.ks.Find(accounts.Account{Address: common.HexToAddress(passenger.Address)})
+	if err != nil {
+		return nil, fmt.Errorf("no keystore entry for %s: %w", passenger.MSISDN, err)
+	}
+	keyJSON, err := os.ReadFile(account.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, s.passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock wallet for %s: %w", passenger.MSISDN, err)
+	}
+	return key.PrivateKey, nil
+}